@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package activity builds activity bitmaps from a stream of events, such as the users seen each hour. Each
+// event is an ID seen at a time, and the IDs seen in each window of time are collected in an EWAH bitmap,
+// which is written to a sink when the window closes, and from time to time while it's still open:
+//
+//	b := activity.New(activity.Options{Window: time.Hour, SnapshotEvery: 5 * time.Minute}, sink)
+//	err := b.Consume(ctx, events)
+//
+// Events must come roughly in the order of their time, as they do from a Kafka partition or a log file:
+// a window stays open for Lateness after its end, and events for windows already closed are dropped.
+// Times are event times, the clock of the machine is never read, so replaying a stream gives the same
+// bitmaps.
+package activity
+
+import (
+	"context"
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the default number of IDs collected before they are added to the bitmap of their
+	// window
+	DefaultBatchSize = 4096
+)
+
+var (
+	ErrLate      = errors.New("activity: the window of the event is closed")
+	ErrInvalidID = errors.New("activity: ID out of the range of EWAH bitmaps")
+)
+
+// Event is an ID, a user or a device for example, seen at a time
+type Event struct {
+	Time time.Time
+	ID   int64
+}
+
+// Sink receives the bitmaps of the windows, with the start of each window in UTC. final is false for a
+// snapshot of a window still open, which later snapshots replace, and true when the window is closed. The
+// bitmap belongs to the sink.
+type Sink interface {
+	Write(start time.Time, e *ewah.Ewah, final bool) error
+}
+
+// SinkFunc is a function used as a Sink
+type SinkFunc func(start time.Time, e *ewah.Ewah, final bool) error
+
+var _ Sink = SinkFunc(nil)
+
+func (this SinkFunc) Write(start time.Time, e *ewah.Ewah, final bool) error {
+	return this(start, e, final)
+}
+
+type Options struct {
+	// Window is the duration of the windows. Windows start at multiples of it since the Unix epoch.
+	Window time.Duration
+
+	// SnapshotEvery is how often, in event time, the open windows are written to the sink. If it's 0, they
+	// are only written when they close.
+	SnapshotEvery time.Duration
+
+	// Lateness is how long a window stays open after its end, for events that come a little out of order
+	Lateness time.Duration
+
+	// BatchSize is the number of IDs collected before they are added to the bitmap of their window, or
+	// DefaultBatchSize if it's not positive
+	BatchSize int
+}
+
+// Builder collects the events in the bitmaps of their windows. It must not be used by several goroutines
+// at the same time.
+type Builder struct {
+	opts Options
+	sink Sink
+
+	// windows are the open windows, by start time in nanoseconds, and the windows starting at or before
+	// closed are closed
+	windows map[int64]*window
+	closed  int64
+
+	// watermark is the time of the latest event, and nextSnapshot the time the open windows are written at
+	watermark    int64
+	started      bool
+	nextSnapshot int64
+
+	late int64
+}
+
+type window struct {
+	e       *ewah.Ewah
+	pending []int64
+}
+
+// New returns a builder that writes the bitmaps of its windows to sink. It returns nil if the window is not
+// positive, or the other durations are negative.
+func New(opts Options, sink Sink) *Builder {
+	if opts.Window <= 0 || opts.SnapshotEvery < 0 || opts.Lateness < 0 {
+		return nil
+	}
+
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	return &Builder{
+		opts:    opts,
+		sink:    sink,
+		windows: make(map[int64]*window),
+		closed:  math.MinInt64,
+	}
+}
+
+// Add adds the event to the bitmap of its window. Windows that end, with their lateness, before the event
+// are closed first, and if it's time for a snapshot, the open windows are written to the sink. It returns
+// ErrLate if the window of the event is already closed, ErrInvalidID if the ID can't be set in a bitmap,
+// ewah.ErrResultTooLarge if adding the IDs to a bitmap could exceed the budget set with
+// ewah.SetMaxResultWords, or the error of the sink.
+func (this *Builder) Add(ev Event) error {
+	if ev.ID < 0 || ev.ID > math.MaxInt32-64 {
+		return ErrInvalidID
+	}
+
+	t := ev.Time.UnixNano()
+	start := floor(t, int64(this.opts.Window))
+
+	if start <= this.closed {
+		this.late++
+		return ErrLate
+	}
+
+	w, ok := this.windows[start]
+	if !ok {
+		w = &window{e: ewah.NewEwah()}
+		this.windows[start] = w
+	}
+
+	w.pending = append(w.pending, ev.ID)
+	if len(w.pending) >= this.opts.BatchSize {
+		if err := w.merge(); err != nil {
+			return err
+		}
+	}
+
+	return this.advance(t)
+}
+
+// Consume adds the events received from events until it's closed, then flushes all the windows. Late events
+// are dropped. It stops at the first other error, or when the context is done.
+func (this *Builder) Consume(ctx context.Context, events <-chan Event) error {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return this.Flush()
+			}
+
+			if err := this.Add(ev); err != nil && err != ErrLate {
+				return err
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Flush closes all the open windows, and writes them to the sink, in the order of their start. Events can
+// still be added after, for windows after the ones closed.
+func (this *Builder) Flush() error {
+	return this.close(math.MaxInt64)
+}
+
+// Late returns the number of events dropped because their window was closed
+func (this *Builder) Late() int64 {
+	return this.late
+}
+
+//
+// Not-exported functions
+//
+
+// floor returns the largest multiple of d at or before t
+func floor(t, d int64) int64 {
+	if t%d != 0 && t < 0 {
+		return t - t%d - d
+	}
+
+	return t - t%d
+}
+
+// advance moves the watermark to t if it's later, closing the windows that end before, and writing
+// snapshots of the open windows when it goes past the time of the next snapshot
+func (this *Builder) advance(t int64) error {
+	if this.started && t <= this.watermark {
+		return nil
+	}
+
+	this.watermark = t
+
+	if err := this.close(t - int64(this.opts.Window+this.opts.Lateness)); err != nil {
+		return err
+	}
+
+	if this.opts.SnapshotEvery == 0 {
+		this.started = true
+		return nil
+	}
+
+	every := int64(this.opts.SnapshotEvery)
+	if !this.started {
+		this.started = true
+		this.nextSnapshot = floor(t, every) + every
+		return nil
+	}
+
+	if t < this.nextSnapshot {
+		return nil
+	}
+
+	for this.nextSnapshot <= t {
+		this.nextSnapshot += every
+	}
+
+	for _, start := range this.starts(math.MaxInt64) {
+		w := this.windows[start]
+		if err := w.merge(); err != nil {
+			return err
+		}
+
+		if err := this.sink.Write(time.Unix(0, start).UTC(), w.e.Snapshot(), false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close writes the windows starting at or before start, in order, and forgets them
+func (this *Builder) close(start int64) error {
+	if start != math.MaxInt64 && start > this.closed {
+		this.closed = start
+	}
+
+	for _, s := range this.starts(start) {
+		w := this.windows[s]
+		if err := w.merge(); err != nil {
+			return err
+		}
+		delete(this.windows, s)
+
+		if s > this.closed {
+			this.closed = s
+		}
+
+		if err := this.sink.Write(time.Unix(0, s).UTC(), w.e, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// starts returns the start of the open windows starting at or before max, sorted
+func (this *Builder) starts(max int64) []int64 {
+	var starts []int64
+	for s := range this.windows {
+		if s <= max {
+			starts = append(starts, s)
+		}
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	return starts
+}
+
+// merge adds the pending IDs to the bitmap of the window. IDs after the last one set are set directly,
+// otherwise they're ORed with the bitmap. If the Or fails, the IDs stay pending.
+func (this *window) merge() error {
+	if len(this.pending) == 0 {
+		return nil
+	}
+
+	sort.Slice(this.pending, func(i, j int) bool { return this.pending[i] < this.pending[j] })
+
+	target := this.e
+	if this.pending[0] < this.e.Size() {
+		target = ewah.NewEwah()
+	}
+
+	for k, i := range this.pending {
+		if k == 0 || i != this.pending[k-1] {
+			target.Set(i)
+		}
+	}
+
+	if target != this.e {
+		e, err := this.e.OrChecked(target)
+		if err != nil {
+			return err
+		}
+		this.e = e.(*ewah.Ewah)
+	}
+
+	this.pending = this.pending[:0]
+
+	return nil
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package activity
+
+import (
+	"context"
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type write struct {
+	start time.Time
+	e     *ewah.Ewah
+	final bool
+}
+
+func TestConsume(t *testing.T) {
+	base := time.Date(2013, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Events over 10 hours, a few minutes out of order at most
+	expected := make(map[time.Time]map[int64]bool)
+	events := make(chan Event, 100)
+	go func() {
+		for k := 0; k < 20000; k++ {
+			at := base.Add(time.Duration(k)*1800*time.Millisecond - time.Duration(rand.Intn(5))*time.Minute)
+			if at.Before(base) {
+				at = base
+			}
+
+			id := int64(rand.Intn(5000))
+			start := at.Truncate(time.Hour)
+			if expected[start] == nil {
+				expected[start] = make(map[int64]bool)
+			}
+			expected[start][id] = true
+
+			events <- Event{Time: at, ID: id}
+		}
+		close(events)
+	}()
+
+	var writes []write
+	sink := SinkFunc(func(start time.Time, e *ewah.Ewah, final bool) error {
+		writes = append(writes, write{start, e, final})
+		return nil
+	})
+
+	b := New(Options{Window: time.Hour, SnapshotEvery: 10 * time.Minute, Lateness: 5 * time.Minute, BatchSize: 100}, sink)
+	if err := b.Consume(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Late() != 0 {
+		t.Fatalf("expected no late event, got %d", b.Late())
+	}
+
+	finals := make(map[time.Time]*ewah.Ewah)
+	var last time.Time
+	for _, w := range writes {
+		if !w.final {
+			if finals[w.start] != nil {
+				t.Fatalf("snapshot of %v after it was closed", w.start)
+			}
+			continue
+		}
+
+		if !w.start.After(last) && !last.IsZero() {
+			t.Fatalf("window %v closed after %v", w.start, last)
+		}
+		last = w.start
+		finals[w.start] = w.e
+	}
+
+	if len(finals) != len(expected) {
+		t.Fatalf("expected %d windows, got %d", len(expected), len(finals))
+	}
+
+	for start, ids := range expected {
+		e := finals[start]
+		if e == nil || e.Cardinality() != int64(len(ids)) {
+			t.Fatalf("window %v: expected %d IDs", start, len(ids))
+		}
+		for id := range ids {
+			if !e.Get(id) {
+				t.Fatalf("window %v: expected ID %d", start, id)
+			}
+		}
+	}
+
+	// Snapshots only have IDs of the final bitmap, and there's several per window
+	snapshots := 0
+	for _, w := range writes {
+		if !w.final {
+			snapshots++
+			if w.e.AndNot(finals[w.start]).(*ewah.Ewah).Cardinality() != 0 {
+				t.Fatalf("snapshot of %v has IDs the window doesn't have", w.start)
+			}
+		}
+	}
+	if snapshots < 3*len(finals) {
+		t.Fatalf("expected at least %d snapshots, got %d", 3*len(finals), snapshots)
+	}
+}
+
+func TestLate(t *testing.T) {
+	base := time.Unix(0, 0)
+
+	var finals []time.Time
+	b := New(Options{Window: time.Minute, Lateness: 10 * time.Second}, SinkFunc(func(start time.Time, e *ewah.Ewah, final bool) error {
+		finals = append(finals, start)
+		return nil
+	}))
+
+	for _, c := range []struct {
+		at  time.Duration
+		err error
+	}{
+		{-5 * time.Second, nil},
+		{30 * time.Second, nil},
+		{65 * time.Second, nil},
+		{20 * time.Second, nil},
+		{75 * time.Second, nil},
+		{50 * time.Second, ErrLate},
+		{-time.Second, ErrLate},
+	} {
+		if err := b.Add(Event{Time: base.Add(c.at), ID: 1}); err != c.err {
+			t.Fatalf("Add at %v: expected %v, got %v", c.at, c.err, err)
+		}
+	}
+
+	if err := b.Add(Event{Time: base, ID: -1}); err != ErrInvalidID {
+		t.Fatalf("expected ErrInvalidID, got %v", err)
+	}
+
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(finals) != 3 || !finals[0].Equal(base.Add(-time.Minute)) || !finals[1].Equal(base) || !finals[2].Equal(base.Add(time.Minute)) {
+		t.Fatalf("unexpected windows %v", finals)
+	}
+
+	if b.Late() != 2 {
+		t.Fatalf("expected 2 late events, got %d", b.Late())
+	}
+
+	if err := b.Add(Event{Time: base.Add(90 * time.Second), ID: 1}); err != ErrLate {
+		t.Fatalf("expected ErrLate after Flush, got %v", err)
+	}
+}
+
+func TestSinkError(t *testing.T) {
+	fail := errors.New("sink failed")
+	b := New(Options{Window: time.Minute}, SinkFunc(func(start time.Time, e *ewah.Ewah, final bool) error {
+		return fail
+	}))
+
+	events := make(chan Event, 2)
+	events <- Event{Time: time.Unix(0, 0), ID: 1}
+	events <- Event{Time: time.Unix(120, 0), ID: 2}
+
+	if err := b.Consume(context.Background(), events); err != fail {
+		t.Fatalf("expected the error of the sink, got %v", err)
+	}
+
+	if New(Options{}, nil) != nil {
+		t.Fatal("New should fail without a window")
+	}
+}
+
+func TestMaxResultWords(t *testing.T) {
+	var got *ewah.Ewah
+	b := New(Options{Window: time.Minute, BatchSize: 2}, SinkFunc(func(start time.Time, e *ewah.Ewah, final bool) error {
+		got = e
+		return nil
+	}))
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	// The second batch comes before the first one, so it's ORed with the bitmap
+	var err error
+	for _, id := range []int64{1000, 5000, 10, 3000} {
+		if err = b.Add(Event{Time: time.Unix(0, 0), ID: id}); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Fatalf("Add over the budget: %v", err)
+	}
+
+	ewah.SetMaxResultWords(0)
+	if err := b.Flush(); err != nil || got.Cardinality() != 4 {
+		t.Fatalf("the IDs should stay pending until the budget allows them: %v", err)
+	}
+}
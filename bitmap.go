@@ -6,20 +6,60 @@
 
 package bitmap
 
-type Bitmap interface {
-	Set(int64) Bitmap
+import "encoding"
+
+// The interfaces are split by what the bitmaps can do, so an implementation that only supports a part of
+// Bitmap, like a frozen bitmap or a bitmap stored remotely, can implement what it supports, and functions can
+// ask for no more than they need.
+
+// Reader is the read-only part of a bitmap. A frozen bitmap only exposes a Reader, so it can be shared
+// between goroutines without any of them modifying it.
+type Reader interface {
 	Get(int64) bool
 	Size() int64
-	Reset()
-	Clone() Bitmap
-	Copy(Bitmap) Bitmap
-	Equal(Bitmap) bool
-
 	Cardinality() int64
+}
 
+// ReadOnly is another name for Reader.
+//
+// Deprecated: use Reader.
+type ReadOnly = Reader
+
+// Mutable is a bitmap that bits can be set in
+type Mutable interface {
+	Reader
+
+	Set(int64) Bitmap
+	Reset()
+}
+
+// Aggregatable is a bitmap that can be combined with others of the same implementation. The operations
+// return a new bitmap, except Not which changes the bitmap, or nil if they fail.
+//
+// And, Or, AndNot and Xor take any number of operands. The result is always the one of a left fold, applying
+// the operation to the bitmap and the first operand, then to that result and the next operand, and so on:
+// a.AndNot(b, c) is a.AndNot(b).AndNot(c), the bits of a in neither b nor c. Implementations may combine all
+// the operands at once instead, like the Or of EWAH, but they must return the same bits and the same size,
+// the size of the largest operand. With no operand, the result is a copy of the bitmap.
+type Aggregatable interface {
 	And(...Bitmap) Bitmap
 	Or(...Bitmap) Bitmap
 	AndNot(...Bitmap) Bitmap
 	Xor(...Bitmap) Bitmap
 	Not() Bitmap
 }
+
+// Serializable is a bitmap that can be encoded to bytes and decoded back
+type Serializable interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+type Bitmap interface {
+	Mutable
+	Aggregatable
+
+	Clone() Bitmap
+	Copy(Bitmap) Bitmap
+	Equal(Bitmap) bool
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package bitmaptest cross-checks the implementations of bitmap.Bitmap against bitset.Bitset in tests. The
+// random bitmaps are built the same way in both, so every operation must give the same bits in both.
+package bitmaptest
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitset"
+	"math/rand"
+	"testing"
+)
+
+// CrossCheck builds n pairs of random bitmaps with random, and checks that the operations on them give the
+// same results as on the bitsets built with them. Not applied twice must give back the bitmap.
+func CrossCheck(t testing.TB, n int, random func() (bitmap.Bitmap, *bitset.Bitset)) {
+	t.Helper()
+
+	for ; n > 0; n-- {
+		e1, b1 := random()
+		e2, b2 := random()
+
+		Check(t, "Set", e1, b1)
+		Check(t, "And", e1.And(e2), b1.And(b2))
+		Check(t, "Or", e1.Or(e2), b1.Or(b2))
+		Check(t, "Xor", e1.Xor(e2), b1.Xor(b2))
+		Check(t, "AndNot", e1.AndNot(e2), b1.AndNot(b2))
+		Check(t, "Not", e1.Clone().Not(), b1.Clone().Not())
+		Check(t, "And+Not", e1.And(e2).Not(), b1.And(b2).Not())
+
+		if c := e1.Clone(); !c.Equal(e1) || !c.Not().Not().Equal(e1) {
+			t.Fatalf("%T: Not twice should give back the original bitmap", e1)
+		}
+	}
+}
+
+// Check fails the test if got, the result of op, doesn't have the size, the cardinality and the bits of
+// want.
+func Check(t testing.TB, op string, got, want bitmap.Reader) {
+	t.Helper()
+
+	if got.Size() != want.Size() {
+		t.Fatalf("%T %s: Size %d != %d", got, op, got.Size(), want.Size())
+	}
+
+	if got.Cardinality() != want.Cardinality() {
+		t.Fatalf("%T %s: Cardinality %d != %d", got, op, got.Cardinality(), want.Cardinality())
+	}
+
+	for i := int64(0); i < want.Size(); i++ {
+		if got.Get(i) != want.Get(i) {
+			t.Fatalf("%T %s: Get(%d) = %t, should be %t", got, op, i, got.Get(i), want.Get(i))
+		}
+	}
+}
+
+// Bits returns the same random bitmap as a bitmap of newFn and as a Bitset, with up to n bits set one by
+// one, at most gap bits apart. Every now and then, if longGap isn't 0, the distance is up to longGap instead,
+// so we also get long runs of 0's.
+func Bits(newFn func() bitmap.Bitmap, n, gap, longGap int) (bitmap.Bitmap, *bitset.Bitset) {
+	e := newFn()
+	b := bitset.New().(*bitset.Bitset)
+
+	bit := int64(-1)
+	for i := rand.Intn(n); i > 0; i-- {
+		if longGap > 0 && rand.Intn(20) == 0 {
+			bit += int64(rand.Intn(longGap) + 1)
+		} else {
+			bit += int64(rand.Intn(gap) + 1)
+		}
+
+		e.Set(bit)
+		b.Set(bit)
+	}
+
+	return e, b
+}
+
+// Ranges returns the same random bitmap as a bitmap of newFn and as a Bitset, made of up to n ranges of up
+// to maxLen bits, less than maxGap bits apart, so some of them touch. The ranges are set with SetRange when
+// the bitmap has it.
+func Ranges(newFn func() bitmap.Bitmap, n, maxGap, maxLen int) (bitmap.Bitmap, *bitset.Bitset) {
+	e := newFn()
+	b := bitset.New().(*bitset.Bitset)
+
+	r, hasRange := e.(interface {
+		SetRange(start, end int64) bitmap.Bitmap
+	})
+
+	bit := int64(0)
+	for i := rand.Intn(n); i > 0; i-- {
+		start := bit + int64(rand.Intn(maxGap))
+		end := start + int64(rand.Intn(maxLen)+1)
+
+		for k := start; k < end; k++ {
+			if !hasRange {
+				e.Set(k)
+			}
+			b.Set(k)
+		}
+		if hasRange {
+			r.SetRange(start, end)
+		}
+
+		bit = end
+	}
+
+	return e, b
+}
@@ -4,150 +4,213 @@
  *
  */
 
+// Package bitset implements the bitmap interface with a plain, uncompressed slice of words. It is
+// the right choice for dense data, and serves as a straightforward reference implementation to
+// cross-check the compressed bitmaps against.
 package bitset
 
 import (
 	"github.com/reducedb/bitmap"
-	"github.com/willf/bitset"
+	"math/bits"
+)
+
+const (
+	// wordInBits is the constant representing the number of bits in a uint64
+	wordInBits int64 = 64
+
+	// defaultBufferSize is a constant default memory allocation when the object is constructed
+	defaultBufferSize int64 = 4
 )
 
 type Bitset struct {
-	b *bitset.BitSet
+	// words holds the bits, least significant bit first
+	words []uint64
+
+	// sizeInBits is the number of bits in the bitset, that is the highest bit set + 1
+	sizeInBits int64
 }
 
 var _ bitmap.Bitmap = (*Bitset)(nil)
 
+func init() {
+	bitmap.Register("bitset", New)
+}
+
 func New() bitmap.Bitmap {
 	return &Bitset{
-		b: bitset.New(4),
+		words: make([]uint64, 0, defaultBufferSize),
 	}
 }
 
+// Set sets the bit at position i to true (1). Unlike the compressed bitmaps, bits can be set in any order.
 func (this *Bitset) Set(i int64) bitmap.Bitmap {
-	this.b.Set(uint(i))
+	if i < 0 {
+		return nil
+	}
+
+	this.grow(i + 1)
+	this.words[i/wordInBits] |= uint64(1) << uint64(i%wordInBits)
+
 	return this
 }
 
 func (this *Bitset) Get(i int64) bool {
-	return this.b.Test(uint(i))
+	if i < 0 || i >= this.sizeInBits {
+		return false
+	}
+
+	return this.words[i/wordInBits]&(uint64(1)<<uint64(i%wordInBits)) != 0
 }
 
+// Size returns the number of bits in the bitset, that is the position of the highest bit set + 1.
 func (this *Bitset) Size() int64 {
-	return int64(this.b.Len())
+	return this.sizeInBits
 }
 
 func (this *Bitset) Reset() {
-	this.b.ClearAll()
-}
-
-func (this *Bitset) Clone() bitmap.Bitmap {
-	return &Bitset{
-		b: this.b.Clone(),
+	for i := range this.words {
+		this.words[i] = 0
 	}
+
+	this.words = this.words[:0]
+	this.sizeInBits = 0
 }
 
-func (this *Bitset) Copy(other bitmap.Bitmap) bitmap.Bitmap {
-	this.b.Copy(other.(*Bitset).b)
+func (this *Bitset) Swap(other *Bitset) bitmap.Bitmap {
+	this.words, other.words = other.words, this.words
+	this.sizeInBits, other.sizeInBits = other.sizeInBits, this.sizeInBits
+
 	return this
 }
 
-func (this *Bitset) Equal(other bitmap.Bitmap) bool {
-	return this.b.Equal(other.(*Bitset).b)
-}
+func (this *Bitset) Clone() bitmap.Bitmap {
+	c := &Bitset{
+		words:      make([]uint64, len(this.words)),
+		sizeInBits: this.sizeInBits,
+	}
+	copy(c.words, this.words)
 
-func (this *Bitset) Cardinality() int64 {
-	return int64(this.b.Count())
+	return c
 }
 
-func (this *Bitset) And(a ...bitmap.Bitmap) bitmap.Bitmap {
-	n := len(a)
-	bm, ok := a[0].(*Bitset)
+func (this *Bitset) Copy(other bitmap.Bitmap) bitmap.Bitmap {
+	o, ok := other.(*Bitset)
 	if !ok {
 		return nil
 	}
 
-	ans := New().(*Bitset)
-	ans.b = this.b.Intersection(bm.b)
+	this.words = make([]uint64, len(o.words))
+	copy(this.words, o.words)
+	this.sizeInBits = o.sizeInBits
 
-	for i := 1; i < n; i++ {
-		bm, ok := a[i].(*Bitset)
-		if !ok {
-			return nil
+	return this
+}
+
+func (this *Bitset) Equal(other bitmap.Bitmap) bool {
+	o, ok := other.(*Bitset)
+	if !ok || o == nil {
+		return false
+	}
+
+	if this.sizeInBits != o.sizeInBits {
+		return false
+	}
+
+	for i, v := range this.words {
+		if o.words[i] != v {
+			return false
 		}
+	}
+
+	return true
+}
 
-		ans.b = ans.b.Intersection(bm.b)
+func (this *Bitset) Cardinality() int64 {
+	n := 0
+	for _, v := range this.words {
+		n += bits.OnesCount64(v)
 	}
 
-	return ans
+	return int64(n)
+}
+
+func (this *Bitset) And(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y uint64) uint64 { return x & y })
 }
 
 func (this *Bitset) Or(a ...bitmap.Bitmap) bitmap.Bitmap {
-	n := len(a)
-	bm, ok := a[0].(*Bitset)
-	if !ok {
-		return nil
-	}
+	return this.fold(a, func(x, y uint64) uint64 { return x | y })
+}
 
-	ans := New().(*Bitset)
-	ans.b = this.b.Union(bm.b)
+func (this *Bitset) AndNot(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y uint64) uint64 { return x &^ y })
+}
 
-	for i := 1; i < n; i++ {
-		bm, ok := a[i].(*Bitset)
-		if !ok {
-			return nil
-		}
+func (this *Bitset) Xor(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y uint64) uint64 { return x ^ y })
+}
 
-		ans.b = ans.b.Union(bm.b)
+// Not negates all the bits of the bitset, up to Size(), in place.
+func (this *Bitset) Not() bitmap.Bitmap {
+	for i, v := range this.words {
+		this.words[i] = ^v
 	}
 
-	return ans
+	if lastBits := this.sizeInBits % wordInBits; lastBits != 0 {
+		this.words[len(this.words)-1] &= ^uint64(0) >> uint64(wordInBits-lastBits)
+	}
+
+	return this
 }
 
-func (this *Bitset) AndNot(a ...bitmap.Bitmap) bitmap.Bitmap {
-	n := len(a)
-	bm, ok := a[0].(*Bitset)
-	if !ok {
-		return nil
-	}
+//
+// Not-exported functions
+//
 
-	ans := New().(*Bitset)
-	ans.b = this.b.Difference(bm.b)
+// fold applies the word operation f to this bitset and each of the bitmaps in a, from left to right.
+// Like the compressed bitmaps, the result is as large as the largest of the operands, and the missing
+// words of the smaller operands are treated as 0's.
+func (this *Bitset) fold(a []bitmap.Bitmap, f func(x, y uint64) uint64) bitmap.Bitmap {
+	ans := this.Clone().(*Bitset)
 
-	for i := 1; i < n; i++ {
-		bm, ok := a[i].(*Bitset)
+	for _, v := range a {
+		b, ok := v.(*Bitset)
 		if !ok {
 			return nil
 		}
 
-		ans.b = ans.b.Difference(bm.b)
+		ans.grow(b.sizeInBits)
+
+		for i := range ans.words {
+			var w uint64
+			if i < len(b.words) {
+				w = b.words[i]
+			}
+			ans.words[i] = f(ans.words[i], w)
+		}
 	}
 
 	return ans
 }
 
-func (this *Bitset) Xor(a ...bitmap.Bitmap) bitmap.Bitmap {
-	n := len(a)
-	bm, ok := a[0].(*Bitset)
-	if !ok {
-		return nil
+// grow extends the bitset so it can hold size bits. It never shrinks it.
+func (this *Bitset) grow(size int64) {
+	if size <= this.sizeInBits {
+		return
 	}
 
-	ans := New().(*Bitset)
-	ans.b = this.b.SymmetricDifference(bm.b)
-
-	for i := 1; i < n; i++ {
-		bm, ok := a[i].(*Bitset)
-		if !ok {
-			return nil
+	n := int((size + wordInBits - 1) / wordInBits)
+	if n > cap(this.words) {
+		newCap := 2 * cap(this.words)
+		if newCap < n {
+			newCap = n
 		}
 
-		ans.b = ans.b.SymmetricDifference(bm.b)
+		words := make([]uint64, len(this.words), newCap)
+		copy(words, this.words)
+		this.words = words
 	}
 
-	return ans
-}
-
-func (this *Bitset) Not() bitmap.Bitmap {
-	this.b = this.b.Complement()
-	return this
+	this.words = this.words[:n]
+	this.sizeInBits = size
 }
@@ -17,11 +17,10 @@ const (
 	c2 uint32 = 0x1b873593
 )
 
-/*
 var (
 	nums, nums10 []int64
-	bm, bm10 *Bitset
-	count int = 10000
+	bm, bm10     *Bitset
+	count        int = 10000
 )
 
 func init() {
@@ -31,14 +30,14 @@ func init() {
 	bit := int64(0)
 	rand.Seed(int64(c1))
 	for i := 0; i < count; i++ {
-		bit += int64(rand.Intn(1000)+1)
+		bit += int64(rand.Intn(1000) + 1)
 		nums[i] = bit
 	}
 
 	bit = int64(0)
 	rand.Seed(int64(c2))
 	for i := 0; i < count; i++ {
-		bit += int64(rand.Intn(1000)+1)
+		bit += int64(rand.Intn(1000) + 1)
 		nums10[i] = bit
 	}
 
@@ -56,7 +55,7 @@ func TestSet(t *testing.T) {
 		}
 	}
 	for i := 0; i < count; i++ {
-		if ! bm.Get(nums[i]) {
+		if !bm.Get(nums[i]) {
 			t.Fatalf("Check(%d) at %d failed\n", nums[i], i)
 		}
 	}
@@ -72,7 +71,7 @@ func TestSet2(t *testing.T) {
 		bit := int64(0)
 		rand.Seed(int64(c1))
 		for i := 0; i < count; i++ {
-			bit += int64(rand.Intn(int(rs[r]))+1)
+			bit += int64(rand.Intn(int(rs[r])) + 1)
 			nums2[i] = bit
 		}
 
@@ -97,14 +96,13 @@ func TestSet2(t *testing.T) {
 
 func TestGet(t *testing.T) {
 	for i := 0; i < count; i++ {
-		if ! bm.Get(nums[i]) {
+		if !bm.Get(nums[i]) {
 			t.Fatalf("Check(%d) at %d failed\n", nums[i], i)
 		}
 	}
 	//bm.PrintStats(false)
 }
 
-
 func TestSwap(t *testing.T) {
 	bm2 := New().(*Bitset)
 	bm3 := New().(*Bitset)
@@ -147,32 +145,29 @@ func TestSwap(t *testing.T) {
 	}
 }
 
-
 func TestClone(t *testing.T) {
 	bm2 := bm.Clone()
 
 	for i := 0; i < count; i++ {
-		if ! bm2.Get(nums[i]) {
+		if !bm2.Get(nums[i]) {
 			t.Fatalf("Check(%d) at %d failed\n", nums[i], i)
 		}
 	}
 	//bm.PrintStats(false)
 }
 
-
 func TestCopy(t *testing.T) {
 	bm2 := New().(*Bitset)
 	bm2.Copy(bm)
 
 	for i := 0; i < count; i++ {
-		if ! bm2.Get(nums[i]) {
+		if !bm2.Get(nums[i]) {
 			t.Fatalf("Check(%d) at %d failed\n", nums[i], i)
 		}
 	}
 	//bm.PrintStats(false)
 }
 
-
 func TestAnd(t *testing.T) {
 	bm2 := New().(*Bitset)
 	bm3 := New().(*Bitset)
@@ -189,7 +184,6 @@ func TestAnd(t *testing.T) {
 		t.Fatal("Cardinality != 1")
 	}
 
-
 	if bm4.Get(10) {
 		t.Fatalf("Get(%d) failed, should NOT be set\n", 10)
 	}
@@ -288,7 +282,7 @@ func TestNot(t *testing.T) {
 	bm2.Not()
 	c2 := bm2.Cardinality()
 
-	if c1 != size - c2 {
+	if c1 != size-c2 {
 		t.Fatalf("c1 (%d) != size (%d) - c2 (%d)", c1, size, c2)
 	}
 
@@ -342,7 +336,7 @@ func BenchmarkGet(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		if ! bm.Get(nums[i%count]) {
+		if !bm.Get(nums[i%count]) {
 			failed += 1
 		}
 	}
@@ -397,7 +391,7 @@ func BenchmarkNot(b *testing.B) {
 		}
 	}
 }
-*/
+
 // f is the function to call, like And, Or, Xor, AndNot
 // b1 is the number of bits for the first bitmap
 // b2 is the number of bits for the second bitmap
@@ -438,7 +432,7 @@ func benchmarkDifferentCombinations(b *testing.B, op string, b1, b2 int, s1, s2
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		if f(m2) == nil {
-			b.Fatal("Problem with %s benchmark at i =", op, i)
+			b.Fatalf("Problem with %s benchmark at i = %d", op, i)
 		}
 	}
 }
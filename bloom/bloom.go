@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package bloom implements a Bloom filter over bit positions. It answers "is this position set?" with no
+// false negatives and a chosen rate of false positives, in a fraction of the size of the exact bitmap, so it
+// can be shipped where the bitmap itself would be too large.
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+type Filter struct {
+	words []uint64
+
+	// m is the number of bits of the filter, and k the number of hash functions
+	m uint64
+	k uint64
+}
+
+// New returns an empty filter sized for n positions with a false positive rate of fpRate
+func New(n int64, fpRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{
+		words: make([]uint64, (m+63)/64),
+		m:     m,
+		k:     k,
+	}
+}
+
+// Add adds the position to the filter
+func (this *Filter) Add(i int64) *Filter {
+	h1, h2 := hashes(i)
+	for j := uint64(0); j < this.k; j++ {
+		b := (h1 + j*h2) % this.m
+		this.words[b/64] |= 1 << (b % 64)
+	}
+
+	return this
+}
+
+// Test returns false if the position was never added, and true if it probably was
+func (this *Filter) Test(i int64) bool {
+	h1, h2 := hashes(i)
+	for j := uint64(0); j < this.k; j++ {
+		b := (h1 + j*h2) % this.m
+		if this.words[b/64]&(1<<(b%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SizeInBits returns the number of bits of the filter
+func (this *Filter) SizeInBits() int64 {
+	return int64(this.m)
+}
+
+// Hashes returns the number of hash functions, that is the number of bits set for each position
+func (this *Filter) Hashes() int {
+	return int(this.k)
+}
+
+// MarshalBinary encodes the filter: the number of bits and of hash functions, then the words, all as
+// big endian uint64.
+func (this *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 16+8*len(this.words))
+
+	binary.BigEndian.PutUint64(b, this.m)
+	binary.BigEndian.PutUint64(b[8:], this.k)
+
+	for i, w := range this.words {
+		binary.BigEndian.PutUint64(b[16+8*i:], w)
+	}
+
+	return b, nil
+}
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary. It replaces the content of the filter.
+func (this *Filter) UnmarshalBinary(b []byte) error {
+	if len(b) < 16 {
+		return errors.New("bloom/UnmarshalBinary: buffer is too short")
+	}
+
+	m := binary.BigEndian.Uint64(b)
+	k := binary.BigEndian.Uint64(b[8:])
+
+	if m == 0 || k == 0 || m > math.MaxInt64-63 || uint64(len(b)-16) != 8*((m+63)/64) {
+		return errors.New("bloom/UnmarshalBinary: invalid sizes")
+	}
+
+	this.words = make([]uint64, (m+63)/64)
+	for i := range this.words {
+		this.words[i] = binary.BigEndian.Uint64(b[16+8*i:])
+	}
+
+	this.m = m
+	this.k = k
+
+	return nil
+}
+
+//
+// Not-exported functions
+//
+
+// hashes returns the two hashes that the k bit positions are derived from (Kirsch and Mitzenmacher)
+func hashes(i int64) (uint64, uint64) {
+	h1 := mix(uint64(i))
+	h2 := mix(h1^0x9e3779b97f4a7c15) | 1
+
+	return h1, h2
+}
+
+// mix is the finalizer of splitmix64
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package bloom
+
+import (
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestFalsePositiveRate(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	for _, fpRate := range []float64{0.1, 0.01, 0.001} {
+		f := New(10000, fpRate)
+		added := make(map[int64]bool)
+
+		for len(added) < 10000 {
+			i := rand.Int63n(1 << 40)
+			f.Add(i)
+			added[i] = true
+		}
+
+		for i := range added {
+			if !f.Test(i) {
+				t.Fatalf("Position %d was added but is not in the filter", i)
+			}
+		}
+
+		fp := 0
+		for n := 0; n < 100000; n++ {
+			if i := rand.Int63n(1 << 40); !added[i] && f.Test(i) {
+				fp++
+			}
+		}
+
+		if rate := float64(fp) / 100000; rate > 1.5*fpRate {
+			t.Fatalf("False positive rate %f for %f, with %d bits and %d hashes", rate, fpRate, f.SizeInBits(), f.Hashes())
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	f := New(1000, 0.01)
+	for n := 0; n < 1000; n++ {
+		f.Add(rand.Int63())
+	}
+
+	b, _ := f.MarshalBinary()
+
+	g := New(1, 0.5)
+	if err := g.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.SizeInBits() != f.SizeInBits() || g.Hashes() != f.Hashes() {
+		t.Fatal("UnmarshalBinary: sizes are different")
+	}
+
+	for n := int64(0); n < 100000; n++ {
+		if f.Test(n) != g.Test(n) {
+			t.Fatalf("UnmarshalBinary: Test(%d) is different", n)
+		}
+	}
+
+	if err := g.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Fatal("UnmarshalBinary should fail on a truncated buffer")
+	}
+}
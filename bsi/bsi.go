@@ -0,0 +1,327 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package bsi implements a bit-sliced index: it stores an unsigned integer value for each column (position)
+// as a stack of EWAH bitmaps, one per bit of the values. Aggregations and range queries are then computed
+// with bitmap operations on the slices, without looking at the values one by one. The queries return the
+// errors of these operations, like ewah.ErrResultTooLarge when a result could exceed the budget set with
+// ewah.SetMaxResultWords.
+//
+// Reference: P. O'Neil, D. Quass. Improved query performance with variant indexes. SIGMOD 1997.
+package bsi
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+)
+
+type BSI struct {
+	// ebm, the existence bitmap, has a bit set for each column that has a value
+	ebm *ewah.Ewah
+
+	// slices[i] has a bit set for each column whose value has bit i set
+	slices []*ewah.Ewah
+}
+
+func New() *BSI {
+	return &BSI{
+		ebm: ewah.NewEwah(),
+	}
+}
+
+// SetValue sets the value of a column. Like the bits of a bitmap, the columns must be set in ascending order.
+// It returns nil if the column is out of order or out of range.
+func (this *BSI) SetValue(col int64, v uint64) *BSI {
+	if this.ebm.Set(col) == nil {
+		return nil
+	}
+
+	for i := 0; v != 0; i, v = i+1, v>>1 {
+		if i == len(this.slices) {
+			this.slices = append(this.slices, ewah.NewEwah())
+		}
+
+		if v&1 != 0 {
+			this.slices[i].Set(col)
+		}
+	}
+
+	return this
+}
+
+// GetValue returns the value of a column, and whether the column has a value at all
+func (this *BSI) GetValue(col int64) (uint64, bool) {
+	if !this.ebm.Get(col) {
+		return 0, false
+	}
+
+	v := uint64(0)
+	for i, s := range this.slices {
+		if s.Get(col) {
+			v |= 1 << uint(i)
+		}
+	}
+
+	return v, true
+}
+
+// BitDepth returns the number of slices, which is the number of bits of the largest value
+func (this *BSI) BitDepth() int {
+	return len(this.slices)
+}
+
+// Columns returns the bitmap of the columns that have a value
+func (this *BSI) Columns() *ewah.Ewah {
+	return this.ebm
+}
+
+// Sum returns the sum of the values of the columns in filter, and the number of these columns. A nil filter
+// selects all the columns. The sum wraps around if it doesn't fit in 64 bits.
+func (this *BSI) Sum(filter *ewah.Ewah) (uint64, int64, error) {
+	f, err := this.filter(filter)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sum := uint64(0)
+	for i, s := range this.slices {
+		c, err := and(f, s)
+		if err != nil {
+			return 0, 0, err
+		}
+		sum += uint64(c.Cardinality()) << uint(i)
+	}
+
+	return sum, f.Cardinality(), nil
+}
+
+// Max returns the largest value of the columns in filter, or false if none of them has a value. A nil filter
+// selects all the columns.
+func (this *BSI) Max(filter *ewah.Ewah) (uint64, bool, error) {
+	f, err := this.filter(filter)
+	if err != nil || f.Cardinality() == 0 {
+		return 0, false, err
+	}
+
+	// From the highest bit down, keep the columns that have the bit set, if there are any
+	max := uint64(0)
+	for i := len(this.slices) - 1; i >= 0; i-- {
+		c, err := and(f, this.slices[i])
+		if err != nil {
+			return 0, false, err
+		}
+		if c.Cardinality() > 0 {
+			f = c
+			max |= 1 << uint(i)
+		}
+	}
+
+	return max, true, nil
+}
+
+// Min returns the smallest value of the columns in filter, or false if none of them has a value. A nil filter
+// selects all the columns.
+func (this *BSI) Min(filter *ewah.Ewah) (uint64, bool, error) {
+	f, err := this.filter(filter)
+	if err != nil || f.Cardinality() == 0 {
+		return 0, false, err
+	}
+
+	// From the highest bit down, keep the columns that don't have the bit set, if there are any
+	min := uint64(0)
+	for i := len(this.slices) - 1; i >= 0; i-- {
+		c, err := andNot(f, this.slices[i])
+		if err != nil {
+			return 0, false, err
+		}
+		if c.Cardinality() > 0 {
+			f = c
+		} else {
+			min |= 1 << uint(i)
+		}
+	}
+
+	return min, true, nil
+}
+
+// Range returns the columns in filter whose value is between lo and hi, both inclusive. A nil filter
+// selects all the columns.
+func (this *BSI) Range(lo, hi uint64, filter *ewah.Ewah) (*ewah.Ewah, error) {
+	if lo > hi {
+		return ewah.NewEwah(), nil
+	}
+
+	f, err := this.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ge, err := this.compare(lo, true)
+	if err != nil {
+		return nil, err
+	}
+
+	le, err := this.compare(hi, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, err = and(f, ge); err != nil {
+		return nil, err
+	}
+
+	return and(f, le)
+}
+
+// TopK returns k of the columns in filter with the largest values. When several columns have the same value
+// and only some of them fit, the ones with the lowest positions are kept. A nil filter selects all the
+// columns.
+func (this *BSI) TopK(k int64, filter *ewah.Ewah) (*ewah.Ewah, error) {
+	// g holds the columns that are known to be in the top k, e the ones that are still candidates
+	g := ewah.NewEwah()
+	e, err := this.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if k <= 0 {
+		return g, nil
+	}
+
+	for i := len(this.slices) - 1; i >= 0; i-- {
+		set, err := and(e, this.slices[i])
+		if err != nil {
+			return nil, err
+		}
+
+		x, err := or(g, set)
+		if err != nil {
+			return nil, err
+		}
+
+		n := x.Cardinality()
+		if n > k {
+			e = set
+		} else if n < k {
+			g = x
+			if e, err = andNot(e, this.slices[i]); err != nil {
+				return nil, err
+			}
+		} else {
+			e = set
+			break
+		}
+	}
+
+	// The candidates left all have the same value, so only keep as many as we need
+	left := k - g.Cardinality()
+	if e.Cardinality() <= left {
+		return or(g, e)
+	}
+
+	t := ewah.NewEwah()
+	for it := e.Iterator(); left > 0 && it.HasNext(); left-- {
+		t.Set(it.Next())
+	}
+
+	return or(g, t)
+}
+
+//
+// Not-exported functions
+//
+
+// filter returns the columns that have a value and are in filter
+func (this *BSI) filter(filter *ewah.Ewah) (*ewah.Ewah, error) {
+	if filter == nil {
+		return this.ebm, nil
+	}
+
+	return and(this.ebm, filter)
+}
+
+// compare returns the columns whose value is greater than or equal to c (ge is true), or less than or equal
+// to c (ge is false). It walks the slices from the highest bit down, keeping the columns that are equal to
+// c so far, and adding those that become strictly greater (or smaller) on the way.
+func (this *BSI) compare(c uint64, ge bool) (*ewah.Ewah, error) {
+	// Values with more bits than we have slices are larger than any of the values stored
+	if len(this.slices) < 64 && c>>uint(len(this.slices)) != 0 {
+		if ge {
+			return ewah.NewEwah(), nil
+		}
+		return this.ebm, nil
+	}
+
+	strict := ewah.NewEwah()
+	eq := this.ebm
+
+	for i := len(this.slices) - 1; i >= 0; i-- {
+		s := this.slices[i]
+
+		var err error
+		if c&(1<<uint(i)) != 0 {
+			if !ge {
+				if strict, err = orAndNot(strict, eq, s); err != nil {
+					return nil, err
+				}
+			}
+			eq, err = and(eq, s)
+		} else {
+			if ge {
+				if strict, err = orAnd(strict, eq, s); err != nil {
+					return nil, err
+				}
+			}
+			eq, err = andNot(eq, s)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return or(strict, eq)
+}
+
+func and(a *ewah.Ewah, b bitmap.Bitmap) (*ewah.Ewah, error) {
+	return result(a.AndChecked(b))
+}
+
+func or(a *ewah.Ewah, b bitmap.Bitmap) (*ewah.Ewah, error) {
+	return result(a.OrChecked(b))
+}
+
+func andNot(a *ewah.Ewah, b bitmap.Bitmap) (*ewah.Ewah, error) {
+	return result(a.AndNotChecked(b))
+}
+
+// orAnd returns a | (b & c)
+func orAnd(a, b, c *ewah.Ewah) (*ewah.Ewah, error) {
+	x, err := and(b, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return or(a, x)
+}
+
+// orAndNot returns a | (b &^ c)
+func orAndNot(a, b, c *ewah.Ewah) (*ewah.Ewah, error) {
+	x, err := andNot(b, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return or(a, x)
+}
+
+// result returns the result of a checked operation as an *ewah.Ewah
+func result(b bitmap.Bitmap, err error) (*ewah.Ewah, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return b.(*ewah.Ewah), nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package bsi
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestBSI(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	for n := 0; n < 50; n++ {
+		b, values := randomBSI(rand.Intn(500), uint64(rand.Intn(1<<uint(rand.Intn(20)))+1))
+
+		filter := ewah.NewEwah()
+		for col := int64(0); col < 2000; col += int64(rand.Intn(5) + 1) {
+			filter.Set(col)
+		}
+
+		for _, f := range []*ewah.Ewah{nil, filter} {
+			in := func(col int64) bool { return f == nil || f.Get(col) }
+
+			sum, count := uint64(0), int64(0)
+			min, max := ^uint64(0), uint64(0)
+			for col, v := range values {
+				if in(col) {
+					sum += v
+					count++
+					if v < min {
+						min = v
+					}
+					if v > max {
+						max = v
+					}
+				}
+			}
+
+			if s, c, err := b.Sum(f); err != nil || s != sum || c != count {
+				t.Fatalf("Sum = %d, %d, should be %d, %d", s, c, sum, count)
+			}
+
+			if m, ok, err := b.Max(f); err != nil || ok != (count > 0) || (ok && m != max) {
+				t.Fatalf("Max = %d, should be %d", m, max)
+			}
+
+			if m, ok, err := b.Min(f); err != nil || ok != (count > 0) || (ok && m != min) {
+				t.Fatalf("Min = %d, should be %d", m, min)
+			}
+
+			lo := uint64(rand.Int63n(int64(max) + 2))
+			hi := lo + uint64(rand.Int63n(int64(max)+2))
+			r, err := b.Range(lo, hi, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for col, v := range values {
+				if r.Get(col) != (in(col) && v >= lo && v <= hi) {
+					t.Fatalf("Range(%d, %d): column %d with value %d", lo, hi, col, v)
+				}
+			}
+			if r.Cardinality() > count {
+				t.Fatalf("Range(%d, %d) has too many columns", lo, hi)
+			}
+
+			k := rand.Int63n(count + 2)
+			top, err := b.TopK(k, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := minInt64(k, count); top.Cardinality() != want {
+				t.Fatalf("TopK(%d) has %d columns, should be %d", k, top.Cardinality(), want)
+			}
+
+			// Every value in the top k must be at least as large as every value left out
+			lowestIn, highestOut := ^uint64(0), uint64(0)
+			for col, v := range values {
+				if !in(col) {
+					continue
+				}
+				if top.Get(col) {
+					if v < lowestIn {
+						lowestIn = v
+					}
+				} else if v > highestOut {
+					highestOut = v
+				}
+			}
+			if top.Cardinality() > 0 && top.Cardinality() < count && lowestIn < highestOut {
+				t.Fatalf("TopK(%d) left out %d but kept %d", k, highestOut, lowestIn)
+			}
+		}
+	}
+}
+
+func TestGetValue(t *testing.T) {
+	b, values := randomBSI(1000, 1<<40)
+
+	for col := int64(0); col < 5000; col++ {
+		v, ok := b.GetValue(col)
+		if w, exists := values[col]; ok != exists || v != w {
+			t.Fatalf("GetValue(%d) = %d, %t, should be %d, %t", col, v, ok, w, exists)
+		}
+	}
+
+	if b.SetValue(0, 1) != nil {
+		t.Fatal("Setting columns out of order should fail")
+	}
+}
+
+func TestMaxResultWords(t *testing.T) {
+	b, _ := randomBSI(1000, 1<<20)
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if _, err := b.Range(10, 500, nil); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Errorf("Range: %v", err)
+	}
+	if _, err := b.TopK(10, nil); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Errorf("TopK: %v", err)
+	}
+	for _, f := range []func(*ewah.Ewah) (uint64, bool, error){b.Min, b.Max} {
+		if _, _, err := f(nil); err != nil && !errors.Is(err, ewah.ErrResultTooLarge) {
+			t.Errorf("Min or Max: %v", err)
+		}
+	}
+}
+
+// randomBSI returns a BSI with n columns with values below max, and the same values in a map
+func randomBSI(n int, max uint64) (*BSI, map[int64]uint64) {
+	b := New()
+	values := make(map[int64]uint64)
+
+	col := int64(-1)
+	for i := 0; i < n; i++ {
+		col += int64(rand.Intn(4) + 1)
+		v := uint64(rand.Int63n(int64(max)))
+
+		b.SetValue(col, v)
+		values[col] = v
+	}
+
+	return b, values
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
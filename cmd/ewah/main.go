@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Command ewah inspects and converts serialized EWAH bitmaps, for example dumps of production bitmaps.
+//
+//	ewah stats [-format f] file           size, cardinality and compression statistics
+//	ewah list [-format f] file            positions of the bits set, one per line
+//	ewah convert -from f -to g in out     converts between formats
+//	ewah and|or [-format f] [-o out] file...  intersection or union of the files
+//
+// The formats are ewah (the format of MarshalBinary, which is also JavaEWAH's), javaewah (the same), cpp
+// (the format of the C++ EWAHBoolArray, see MarshalCpp), text (positions separated by white space) and,
+// when built with the roaring build tag, roaring. The default is ewah. A file named - is the standard input or output.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// format reads and writes bitmaps in one serialization format
+type format struct {
+	read  func(b []byte) (*ewah.Ewah, error)
+	write func(e *ewah.Ewah) ([]byte, error)
+}
+
+var formats = map[string]format{
+	"cpp":      {readCpp, writeCpp},
+	"ewah":     {readEwah, writeEwah},
+	"javaewah": {readEwah, writeEwah},
+	"text":     {readText, writeText},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "ewah:", err)
+		os.Exit(1)
+	}
+}
+
+//
+// Not-exported functions
+//
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: ewah stats|list|convert|and|or [flags] files...")
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	from := flags.String("format", "ewah", "format of the files read")
+	flags.StringVar(from, "from", "ewah", "format of the files read")
+	to := flags.String("to", "", "format of the files written, the same as the files read by default")
+	out := flags.String("o", "-", "file written by and and or")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *to == "" {
+		*to = *from
+	}
+
+	files := flags.Args()
+	read := func(name string) (*ewah.Ewah, error) {
+		return readFile(name, *from, stdin)
+	}
+
+	switch args[0] {
+	case "stats":
+		if len(files) != 1 {
+			return errors.New("stats: one file expected")
+		}
+
+		e, err := read(files[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdout, e)
+		fmt.Fprintf(stdout, "stats: %+v\n", e.Stats())
+		fmt.Fprintf(stdout, "runs: %+v\n", e.RunHistogram())
+		fmt.Fprintf(stdout, "gaps: %+v\n", e.GapStats())
+		fmt.Fprintf(stdout, "canonical: %v, valid: %v\n", e.IsCanonical(), e.Validate())
+
+	case "list":
+		if len(files) != 1 {
+			return errors.New("list: one file expected")
+		}
+
+		e, err := read(files[0])
+		if err != nil {
+			return err
+		}
+
+		return writeFile("-", "text", e, stdout)
+
+	case "convert":
+		if len(files) != 2 {
+			return errors.New("convert: an input and an output file expected")
+		}
+
+		e, err := read(files[0])
+		if err != nil {
+			return err
+		}
+
+		return writeFile(files[1], *to, e, stdout)
+
+	case "and", "or":
+		if len(files) == 0 {
+			return fmt.Errorf("%s: at least one file expected", args[0])
+		}
+
+		bms := make([]bitmap.Bitmap, len(files))
+		for k, name := range files {
+			e, err := read(name)
+			if err != nil {
+				return err
+			}
+			bms[k] = e
+		}
+
+		var e bitmap.Bitmap = bms[0]
+		if len(bms) > 1 {
+			if args[0] == "and" {
+				e = bms[0].And(bms[1:]...)
+			} else {
+				e = bms[0].Or(bms[1:]...)
+			}
+		}
+
+		return writeFile(*out, *to, e.(*ewah.Ewah), stdout)
+
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	return nil
+}
+
+func readFile(name, f string, stdin io.Reader) (*ewah.Ewah, error) {
+	ft, ok := formats[f]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", f)
+	}
+
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = io.ReadAll(stdin)
+	} else {
+		b, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := ft.read(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return e, nil
+}
+
+func writeFile(name, f string, e *ewah.Ewah, stdout io.Writer) error {
+	ft, ok := formats[f]
+	if !ok {
+		return fmt.Errorf("unknown format %q", f)
+	}
+
+	b, err := ft.write(e)
+	if err != nil {
+		return err
+	}
+
+	if name == "-" {
+		_, err = stdout.Write(b)
+		return err
+	}
+
+	return os.WriteFile(name, b, 0644)
+}
+
+func readEwah(b []byte) (*ewah.Ewah, error) {
+	e := ewah.NewEwah()
+	if err := e.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func writeEwah(e *ewah.Ewah) ([]byte, error) {
+	return e.MarshalBinary()
+}
+
+func readCpp(b []byte) (*ewah.Ewah, error) {
+	e := ewah.NewEwah()
+	if err := e.UnmarshalCpp(b); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func writeCpp(e *ewah.Ewah) ([]byte, error) {
+	return e.MarshalCpp()
+}
+
+// readText reads positions separated by white space, in any order
+func readText(b []byte) (*ewah.Ewah, error) {
+	var positions []int64
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Split(bufio.ScanWords)
+	for s.Scan() {
+		i, err := strconv.ParseInt(s.Text(), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, i)
+	}
+
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	e := ewah.NewEwah()
+	for k, i := range positions {
+		if k > 0 && i == positions[k-1] {
+			continue
+		}
+		if e.Set(i) == nil {
+			return nil, fmt.Errorf("position %d out of range", i)
+		}
+	}
+
+	return e, nil
+}
+
+func writeText(e *ewah.Ewah) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for it := e.Iterator(); it.HasNext(); {
+		buf.WriteString(strconv.FormatInt(it.Next(), 10))
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+
+	var out bytes.Buffer
+	if err := run([]string{"convert", "-from", "text", "-to", "ewah", "-", a}, strings.NewReader("5 1 70 1\n200"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"convert", "-from", "text", "-to", "javaewah", "-", b}, strings.NewReader("1 2 200"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"convert", "-to", "cpp", a, c}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"list", a}, "1\n5\n70\n200\n"},
+		{[]string{"and", "-to", "text", a, b}, "1\n200\n"},
+		{[]string{"or", "-to", "text", a, b}, "1\n2\n5\n70\n200\n"},
+		{[]string{"convert", "-to", "text", a, "-"}, "1\n5\n70\n200\n"},
+		{[]string{"list", "-format", "cpp", c}, "1\n5\n70\n200\n"},
+	} {
+		out.Reset()
+		if err := run(c.args, nil, &out); err != nil || out.String() != c.want {
+			t.Errorf("%v: %q, %v, should be %q", c.args, out.String(), err, c.want)
+		}
+	}
+
+	out.Reset()
+	if err := run([]string{"stats", a}, nil, &out); err != nil || !strings.Contains(out.String(), "cardinality: 4") {
+		t.Errorf("stats: %q, %v", out.String(), err)
+	}
+
+	for _, args := range [][]string{{}, {"foo"}, {"list"}, {"list", "-format", "foo", a}, {"list", filepath.Join(dir, "c")}, {"list", "-format", "text", "-"}} {
+		if err := run(args, strings.NewReader("x"), &out); err == nil {
+			t.Errorf("%v: no error", args)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build roaring
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package main
+
+import (
+	"github.com/RoaringBitmap/roaring"
+	"github.com/reducedb/bitmap/ewah"
+	"github.com/reducedb/bitmap/ewah/ewahroaring"
+)
+
+func init() {
+	formats["roaring"] = format{readRoaring, writeRoaring}
+}
+
+//
+// Not-exported functions
+//
+
+// readRoaring reads the portable serialization format of roaring bitmaps
+func readRoaring(b []byte) (*ewah.Ewah, error) {
+	r := roaring.New()
+	if err := r.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return ewahroaring.FromRoaring(r), nil
+}
+
+func writeRoaring(e *ewah.Ewah) ([]byte, error) {
+	return ewahroaring.ToRoaring(e).ToBytes()
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package counting implements a multiset of positions: each position has a small counter, stored as a stack
+// of EWAH bitmaps where layer k has a bit set for each position whose counter is at least k. Extracting the
+// positions seen at least k times is then free, which is what frequency capping needs.
+package counting
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+)
+
+type Counting struct {
+	// layers[k] has a bit set for each position whose counter is at least k+1
+	layers []*ewah.Ewah
+
+	// max is the largest value of a counter. Counters saturate instead of going over it.
+	max int
+}
+
+// New returns an empty multiset whose counters go up to max
+func New(max int) *Counting {
+	if max < 1 {
+		max = 1
+	}
+
+	return &Counting{
+		max: max,
+	}
+}
+
+// Max returns the largest value of a counter
+func (this *Counting) Max() int {
+	return this.max
+}
+
+// Increment adds one to the counter of the position. The errors are the ones of IncrementAll, or an error
+// matching ewah.ErrOutOfRange if the position is out of range.
+func (this *Counting) Increment(pos int64) error {
+	b := ewah.NewEwah()
+	if err := b.SetChecked(pos); err != nil {
+		return err
+	}
+
+	return this.IncrementAll(b)
+}
+
+// Decrement subtracts one from the counter of the position, if it isn't 0 already. The errors are the ones
+// of DecrementAll, or an error matching ewah.ErrOutOfRange if the position is out of range.
+func (this *Counting) Decrement(pos int64) error {
+	b := ewah.NewEwah()
+	if err := b.SetChecked(pos); err != nil {
+		return err
+	}
+
+	return this.DecrementAll(b)
+}
+
+// IncrementAll adds one to the counters of all the positions set in b. A position is at least at k+1 after
+// the increment if it was already, or if it was at least at k and is set in b. If an operation fails, like
+// with ewah.ErrResultTooLarge when a layer could exceed the budget set with ewah.SetMaxResultWords, it
+// returns the error and the counters are left unchanged.
+func (this *Counting) IncrementAll(b *ewah.Ewah) error {
+	if len(this.layers) == 0 {
+		this.layers = append(this.layers, b.Clone().(*ewah.Ewah))
+		return nil
+	}
+
+	layers := append([]*ewah.Ewah(nil), this.layers...)
+
+	if n := len(layers); n < this.max {
+		top, err := and(layers[n-1], b)
+		if err != nil {
+			return err
+		}
+		if top.Cardinality() > 0 {
+			layers = append(layers, top)
+		}
+	}
+
+	// Work from the top down so the layer below hasn't changed yet
+	for k := len(layers) - 1; k >= 0; k-- {
+		add := b
+		if k > 0 {
+			var err error
+			if add, err = and(layers[k-1], b); err != nil {
+				return err
+			}
+		}
+
+		l, err := or(layers[k], add)
+		if err != nil {
+			return err
+		}
+		layers[k] = l
+	}
+
+	this.layers = layers
+
+	return nil
+}
+
+// DecrementAll subtracts one from the counters of all the positions set in b. A position is at least at k
+// after the decrement if it was at least at k+1, or if it was at least at k and is not set in b. Like
+// IncrementAll, the counters are left unchanged if it returns an error.
+func (this *Counting) DecrementAll(b *ewah.Ewah) error {
+	layers := append([]*ewah.Ewah(nil), this.layers...)
+
+	// Work from the bottom up so the layer above hasn't changed yet
+	for k := range layers {
+		l, err := andNot(layers[k], b)
+		if err != nil {
+			return err
+		}
+		if k+1 < len(layers) {
+			if l, err = or(l, layers[k+1]); err != nil {
+				return err
+			}
+		}
+
+		layers[k] = l
+	}
+
+	for n := len(layers); n > 0 && layers[n-1].Cardinality() == 0; n-- {
+		layers = layers[:n-1]
+	}
+
+	this.layers = layers
+
+	return nil
+}
+
+// CountAt returns the counter of the position
+func (this *Counting) CountAt(pos int64) int {
+	// The layers are nested, so the counter is the number of layers the position is in, which we find with
+	// a binary search
+	lo, hi := 0, len(this.layers)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if this.layers[m].Get(pos) {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+
+	return lo
+}
+
+// Threshold returns the positions whose counter is at least k. It is a copy that can be modified freely.
+// Any k below 1 is the same as 1, that is all the positions with a counter.
+func (this *Counting) Threshold(k int) *ewah.Ewah {
+	if k < 1 {
+		k = 1
+	}
+
+	if k > len(this.layers) {
+		return ewah.NewEwah()
+	}
+
+	return this.layers[k-1].Clone().(*ewah.Ewah)
+}
+
+// Cardinality returns the number of positions with a counter, which is not the sum of the counters
+func (this *Counting) Cardinality() int64 {
+	if len(this.layers) == 0 {
+		return 0
+	}
+
+	return this.layers[0].Cardinality()
+}
+
+//
+// Not-exported functions
+//
+
+func and(a *ewah.Ewah, b bitmap.Bitmap) (*ewah.Ewah, error) {
+	return result(a.AndChecked(b))
+}
+
+func or(a *ewah.Ewah, b bitmap.Bitmap) (*ewah.Ewah, error) {
+	return result(a.OrChecked(b))
+}
+
+func andNot(a *ewah.Ewah, b bitmap.Bitmap) (*ewah.Ewah, error) {
+	return result(a.AndNotChecked(b))
+}
+
+// result returns the result of a checked operation as an *ewah.Ewah
+func result(b bitmap.Bitmap, err error) (*ewah.Ewah, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return b.(*ewah.Ewah), nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package counting
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestCounting(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	c := New(5)
+	counts := make(map[int64]int)
+
+	for n := 0; n < 2000; n++ {
+		pos := int64(rand.Intn(300))
+
+		if rand.Intn(3) == 0 {
+			if err := c.Decrement(pos); err != nil {
+				t.Fatal(err)
+			}
+			if counts[pos] > 0 {
+				counts[pos]--
+			}
+		} else {
+			if err := c.Increment(pos); err != nil {
+				t.Fatal(err)
+			}
+			if counts[pos] < c.Max() {
+				counts[pos]++
+			}
+		}
+
+		if n%100 == 0 {
+			checkCounts(t, c, counts)
+		}
+	}
+
+	checkCounts(t, c, counts)
+}
+
+func TestIncrementAll(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	c := New(3)
+	counts := make(map[int64]int)
+
+	for n := 0; n < 20; n++ {
+		b := ewah.NewEwah()
+		for pos := int64(rand.Intn(10)); pos < 1000; pos += int64(rand.Intn(10) + 1) {
+			b.Set(pos)
+			if counts[pos] < c.Max() {
+				counts[pos]++
+			}
+		}
+
+		if err := c.IncrementAll(b); err != nil {
+			t.Fatal(err)
+		}
+		checkCounts(t, c, counts)
+	}
+}
+
+func TestMaxResultWords(t *testing.T) {
+	c := New(3)
+	counts := make(map[int64]int)
+
+	b := ewah.NewEwah()
+	for pos := int64(0); pos < 5000; pos += 70 {
+		b.Set(pos)
+		counts[pos] = 1
+	}
+	if err := c.IncrementAll(b); err != nil {
+		t.Fatal(err)
+	}
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if err := c.IncrementAll(b); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Fatalf("IncrementAll over the budget: %v", err)
+	}
+	if err := c.Increment(10); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Fatalf("Increment over the budget: %v", err)
+	}
+	if err := c.Increment(-1); !errors.Is(err, ewah.ErrOutOfRange) {
+		t.Fatalf("Increment out of range: %v", err)
+	}
+
+	// The counters are left unchanged by the failed calls
+	checkCounts(t, c, counts)
+}
+
+func checkCounts(t *testing.T, c *Counting, counts map[int64]int) {
+	card := int64(0)
+	for pos, n := range counts {
+		if c.CountAt(pos) != n {
+			t.Fatalf("CountAt(%d) = %d, should be %d", pos, c.CountAt(pos), n)
+		}
+
+		if n > 0 {
+			card++
+		}
+	}
+
+	if c.Cardinality() != card {
+		t.Fatalf("Cardinality %d != %d", c.Cardinality(), card)
+	}
+
+	for k := 1; k <= c.Max()+1; k++ {
+		th := c.Threshold(k)
+		for pos, n := range counts {
+			if th.Get(pos) != (n >= k) {
+				t.Fatalf("Threshold(%d): position %d has a count of %d", k, pos, n)
+			}
+		}
+	}
+}
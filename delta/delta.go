@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package delta implements a mutable bitmap on top of an immutable EWAH base. Bits can be added and removed
+// in any order: the changes are kept in small overlay sets that are checked on every read, and merged into a
+// new base when Compact is called. The base itself is never modified, so it can be shared, or decoded from a
+// memory mapped file.
+package delta
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+	"math"
+	"sort"
+)
+
+// maxPosition is the largest position EWAH supports
+const maxPosition int64 = math.MaxInt32 - 64
+
+type Delta struct {
+	base *ewah.Ewah
+
+	// baseCardinality is cached since the base never changes
+	baseCardinality int64
+
+	// adds are the bits set that are not in the base, removes the bits of the base that were cleared
+	adds    map[int64]struct{}
+	removes map[int64]struct{}
+}
+
+// New returns a bitmap starting with the bits of base. A nil base is the same as an empty one.
+func New(base *ewah.Ewah) *Delta {
+	if base == nil {
+		base = ewah.NewEwah()
+	}
+
+	return &Delta{
+		base:            base,
+		baseCardinality: base.Cardinality(),
+		adds:            make(map[int64]struct{}),
+		removes:         make(map[int64]struct{}),
+	}
+}
+
+// Add sets the bit at position i to true (1). It returns nil if the position is out of the range EWAH
+// supports.
+func (this *Delta) Add(i int64) *Delta {
+	if i < 0 || i > maxPosition {
+		return nil
+	}
+
+	if this.base.Get(i) {
+		delete(this.removes, i)
+	} else {
+		this.adds[i] = struct{}{}
+	}
+
+	return this
+}
+
+// Remove sets the bit at position i to false (0)
+func (this *Delta) Remove(i int64) *Delta {
+	if _, ok := this.adds[i]; ok {
+		delete(this.adds, i)
+	} else if this.base.Get(i) {
+		this.removes[i] = struct{}{}
+	}
+
+	return this
+}
+
+func (this *Delta) Get(i int64) bool {
+	if _, ok := this.adds[i]; ok {
+		return true
+	}
+
+	if _, ok := this.removes[i]; ok {
+		return false
+	}
+
+	return this.base.Get(i)
+}
+
+func (this *Delta) Cardinality() int64 {
+	return this.baseCardinality + int64(len(this.adds)) - int64(len(this.removes))
+}
+
+// Base returns the current base. It must not be modified.
+func (this *Delta) Base() *ewah.Ewah {
+	return this.base
+}
+
+// OverlaySize returns the number of changes not merged into the base yet, which helps decide when to call
+// Compact.
+func (this *Delta) OverlaySize() int {
+	return len(this.adds) + len(this.removes)
+}
+
+// Bitmap returns a new EWAH bitmap with the base and all the changes merged. Neither the base nor the overlay
+// are modified. It returns the error of the operations merging them, like ewah.ErrResultTooLarge.
+func (this *Delta) Bitmap() (*ewah.Ewah, error) {
+	if this.OverlaySize() == 0 {
+		return this.base.Clone().(*ewah.Ewah), nil
+	}
+
+	ans := this.base
+	if len(this.removes) > 0 {
+		b, err := ans.AndNotChecked(toEwah(this.removes))
+		if err != nil {
+			return nil, err
+		}
+		ans = b.(*ewah.Ewah)
+	}
+
+	if len(this.adds) > 0 {
+		b, err := ans.OrChecked(toEwah(this.adds))
+		if err != nil {
+			return nil, err
+		}
+		ans = b.(*ewah.Ewah)
+	}
+
+	return ans, nil
+}
+
+// Compact merges the changes into a new base and clears the overlay. The previous base is left untouched.
+func (this *Delta) Compact() error {
+	b, err := this.Bitmap()
+	if err != nil {
+		return err
+	}
+
+	this.base = b
+	this.baseCardinality = b.Cardinality()
+	this.adds = make(map[int64]struct{})
+	this.removes = make(map[int64]struct{})
+
+	return nil
+}
+
+//
+// Not-exported functions
+//
+
+// toEwah returns the positions as an EWAH bitmap
+func toEwah(m map[int64]struct{}) *ewah.Ewah {
+	pos := make([]int64, 0, len(m))
+	for i := range m {
+		pos = append(pos, i)
+	}
+
+	sort.Slice(pos, func(i, j int) bool { return pos[i] < pos[j] })
+
+	e := ewah.NewEwah()
+	for _, i := range pos {
+		e.Set(i)
+	}
+
+	return e
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package delta
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestDelta(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	base := ewah.NewEwah()
+	bits := make(map[int64]bool)
+	for i := int64(0); i < 5000; i += int64(rand.Intn(10) + 1) {
+		base.Set(i)
+		bits[i] = true
+	}
+
+	baseCopy := base.Clone()
+	d := New(base)
+
+	for n := 0; n < 3000; n++ {
+		i := int64(rand.Intn(6000))
+
+		if rand.Intn(2) == 0 {
+			d.Add(i)
+			bits[i] = true
+		} else {
+			d.Remove(i)
+			delete(bits, i)
+		}
+
+		if n%500 == 0 {
+			checkDelta(t, d, bits)
+		}
+
+		if n%1000 == 999 {
+			if err := d.Compact(); err != nil || d.OverlaySize() != 0 {
+				t.Fatalf("Problem compacting: %v", err)
+			}
+			checkDelta(t, d, bits)
+		}
+	}
+
+	if !base.Equal(baseCopy) {
+		t.Fatal("The base should not be modified")
+	}
+
+	if d.Add(-1) != nil {
+		t.Fatal("Adding a negative position should fail")
+	}
+}
+
+func checkDelta(t *testing.T, d *Delta, bits map[int64]bool) {
+	if d.Cardinality() != int64(len(bits)) {
+		t.Fatalf("Cardinality %d != %d", d.Cardinality(), len(bits))
+	}
+
+	b, err := d.Bitmap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Cardinality() != int64(len(bits)) {
+		t.Fatalf("Merged cardinality %d != %d", b.Cardinality(), len(bits))
+	}
+
+	for i := int64(0); i < 6000; i++ {
+		if d.Get(i) != bits[i] || b.Get(i) != bits[i] {
+			t.Fatalf("Get(%d) = %t, merged = %t, should be %t", i, d.Get(i), b.Get(i), bits[i])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AliasCheck returns an error matching ErrAliased if the bitmap shares memory with one of the others, or if
+// its cursors don't read its own buffer. Only the buffers shared on purpose, between a bitmap and its
+// snapshots until either is modified, are allowed. It's meant for tests, after Clone, Copy or the
+// operations, to catch bitmaps that would change when another one is modified in place.
+func (this *Ewah) AliasCheck(others ...*Ewah) error {
+	for _, c := range []*cursor{this.setCursor, this.getCursor} {
+		if c != nil && reflect.ValueOf(c.buffer).Pointer() != reflect.ValueOf(this.buffer).Pointer() {
+			return newError(ErrAliased, "ewah/AliasCheck: a cursor doesn't read the buffer of the bitmap")
+		}
+	}
+
+	for k, o := range others {
+		if o == nil || o == this {
+			continue
+		}
+
+		if this.setCursor == o.setCursor || this.getCursor == o.getCursor {
+			return newError(ErrAliased, fmt.Sprintf("ewah/AliasCheck: the bitmap shares a cursor with bitmap %d", k))
+		}
+
+		if overlap(this.buffer, o.buffer) && !(this.cow.Load() && o.cow.Load()) {
+			return newError(ErrAliased, fmt.Sprintf("ewah/AliasCheck: the bitmap shares its buffer with bitmap %d", k))
+		}
+	}
+
+	return nil
+}
+
+//
+// Not-exported functions
+//
+
+// overlap returns true if a and b have memory in common, up to their capacity
+func overlap(a, b []uint64) bool {
+	if cap(a) == 0 || cap(b) == 0 {
+		return false
+	}
+
+	pa, pb := reflect.ValueOf(a).Pointer(), reflect.ValueOf(b).Pointer()
+	return pa < pb+8*uintptr(cap(b)) && pb < pa+8*uintptr(cap(a))
+}
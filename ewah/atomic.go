@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"sync/atomic"
+)
+
+// Atomic holds a frozen version of a bitmap that can be replaced atomically. A background job rebuilds the
+// bitmap and publishes it with SwapAtomic, while readers call LoadSnapshot without any lock, and keep using
+// the version they loaded as long as they need.
+type Atomic struct {
+	v atomic.Value
+}
+
+// NewAtomic returns an Atomic holding a frozen version of e, or an empty bitmap if e is nil
+func NewAtomic(e *Ewah) *Atomic {
+	a := new(Atomic)
+
+	if e == nil {
+		e = NewEwah()
+	}
+
+	a.v.Store(e.Snapshot())
+
+	return a
+}
+
+// LoadSnapshot returns the bitmap last published. Each call returns a new snapshot, so each reader gets its
+// own cursors and can use the result freely, even modify it, without affecting the other readers.
+func (this *Atomic) LoadSnapshot() *Ewah {
+	return this.v.Load().(*Ewah).Snapshot()
+}
+
+// SwapAtomic publishes a frozen version of e, and returns the previously published one. Readers that loaded
+// a snapshot before still see the old version. e itself can still be modified by the caller afterwards,
+// since it's copied the next time it is.
+func (this *Atomic) SwapAtomic(e *Ewah) *Ewah {
+	if e == nil {
+		return nil
+	}
+
+	return this.v.Swap(e.Snapshot()).(*Ewah).Snapshot()
+}
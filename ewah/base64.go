@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// EncodeToString returns the URL-safe base64 encoding of MarshalBinary, without padding, so the bitmap can
+// be stored in URLs, environment variables and text columns without escaping. It returns the error of
+// MarshalBinary for bitmaps too large to be serialized.
+func (this *Ewah) EncodeToString() (string, error) {
+	b, err := this.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeString returns the bitmap encoded by EncodeToString. The padding is optional. A string that is not
+// a bitmap encoded this way returns an error matching ErrCorruptData.
+func DecodeString(s string) (*Ewah, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, newError(ErrCorruptData, "ewah/DecodeString: "+err.Error())
+	}
+
+	e := NewEwah()
+	if err := e.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
@@ -7,124 +7,177 @@
 package ewah
 
 import (
+	"context"
+	"fmt"
 	"github.com/reducedb/bitmap"
 	"math"
 )
 
+// ctxCheckInterval is the number of steps the context-aware operations take between two checks of the
+// context, since checking it at each step would be too costly
+const ctxCheckInterval = 1024
+
+// And returns the intersection of the bitmap and the operands, or nil if it fails. Like for the other
+// operations, operands of other implementations of bitmap.Bitmap are converted to *Ewah first, bit by bit.
 func (this *Ewah) And(a ...bitmap.Bitmap) bitmap.Bitmap {
-	b, ok := a[0].(*Ewah)
-	if !ok {
+	ans, err := this.AndChecked(a...)
+	if err != nil {
 		return nil
 	}
 
-	ans := New().(*Ewah)
-	tmp := New().(*Ewah)
-	ans.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
-	tmp.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
+	return ans
+}
 
-	this.andToContainer(b, ans)
+// AndChecked is the same as And, but it reports why the operation failed, with an error matching
+// ErrIncompatibleBitmap if an operand can't be converted to an *Ewah.
+func (this *Ewah) AndChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	ans, err := this.bitOp("and", "AndChecked", a, (*Ewah).andToContainer)
+	if err != nil {
+		return nil, err
+	}
+
+	return ans, nil
+}
 
-	for _, v := range a[1:] {
-		b, ok := v.(*Ewah)
-		if !ok {
-			return nil
+// AndCtx is the same as And, but it stops and returns the error of the context as soon as it is done, so a
+// request timeout can abort a long aggregation.
+func (this *Ewah) AndCtx(ctx context.Context, a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	if len(a) == 0 {
+		return this.Clone(), nil
+	}
+
+	this = this.orEmpty()
+	end := this.startOperation(ctx, "and", a)
+
+	ans := this
+	for _, v := range a {
+		b, err := toEwah(v, "AndCtx")
+		if err != nil {
+			end(nil, err)
+			return nil, err
 		}
 
-		ans.andToContainer(b, tmp)
-		tmp.Swap(ans)
-		tmp.Reset()
+		tmp := NewWithOptions(this.Options())
+		tmp.reserve(int32(math.Max(float64(ans.actualSizeInWords), float64(b.actualSizeInWords))))
+
+		if err := ans.andToContainerCtx(ctx, b, tmp); err != nil {
+			end(nil, err)
+			return nil, err
+		}
+
+		ans = tmp
 	}
 
-	return ans
+	recordOperation("and", ans)
+	end(ans, nil)
+
+	return ans, nil
 }
 
 func (this *Ewah) AndNot(a ...bitmap.Bitmap) bitmap.Bitmap {
-	b, ok := a[0].(*Ewah)
-	if !ok {
+	ans, err := this.AndNotChecked(a...)
+	if err != nil {
 		return nil
 	}
 
-	ans := New().(*Ewah)
-	tmp := New().(*Ewah)
-	ans.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
-	tmp.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
-
-	this.andNotToContainer(b, ans)
-
-	for _, v := range a[1:] {
-		b, ok := v.(*Ewah)
-		if !ok {
-			return nil
-		}
+	return ans
+}
 
-		ans.andNotToContainer(b, tmp)
-		tmp.Swap(ans)
-		tmp.Reset()
+// AndNotChecked is the same as AndNot, but it reports why the operation failed, like AndChecked
+func (this *Ewah) AndNotChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	ans, err := this.bitOp("andnot", "AndNotChecked", a, (*Ewah).andNotToContainer)
+	if err != nil {
+		return nil, err
 	}
 
-	return ans
+	return ans, nil
 }
 
 func (this *Ewah) Or(a ...bitmap.Bitmap) bitmap.Bitmap {
-	b, ok := a[0].(*Ewah)
-	if !ok {
+	ans, err := this.OrChecked(a...)
+	if err != nil {
 		return nil
 	}
 
-	ans := New().(*Ewah)
-	tmp := New().(*Ewah)
-	ans.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
-	tmp.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
+	return ans
+}
 
-	this.orToContainer(b, ans)
+// OrChecked is the same as Or, but it reports why the operation failed. It returns ErrResultTooLarge,
+// without doing any work, if the result could exceed the budget set with SetMaxResultWords.
+func (this *Ewah) OrChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	if len(a) == 0 {
+		return this.Clone(), nil
+	}
 
-	for _, v := range a[1:] {
-		b, ok := v.(*Ewah)
-		if !ok {
-			return nil
+	this = this.orEmpty()
+	end := this.startOperation(context.Background(), "or", a)
+
+	operands := make([]*Ewah, 0, len(a)+1)
+	operands = append(operands, this)
+	for _, v := range a {
+		b, err := toEwah(v, "OrChecked")
+		if err != nil {
+			end(nil, err)
+			return nil, err
 		}
+		operands = append(operands, b)
+	}
 
-		ans.orToContainer(b, tmp)
-		tmp.Swap(ans)
-		tmp.Reset()
+	ans, err := orOperands(operands)
+	end(ans, err)
+	if err != nil {
+		return nil, err
 	}
 
-	return ans
+	return ans, nil
 }
 
 func (this *Ewah) Xor(a ...bitmap.Bitmap) bitmap.Bitmap {
-	b, ok := a[0].(*Ewah)
-	if !ok {
+	ans, err := this.XorChecked(a...)
+	if err != nil {
 		return nil
 	}
 
-	ans := New().(*Ewah)
-	tmp := New().(*Ewah)
-	ans.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
-	tmp.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
+	return ans
+}
 
-	this.xorToContainer(b, ans)
+// XorChecked is the same as Xor, but it reports why the operation failed, like AndChecked
+func (this *Ewah) XorChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	ans, err := this.bitOp("xor", "XorChecked", a, (*Ewah).xorToContainer)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, v := range a[1:] {
-		b, ok := v.(*Ewah)
-		if !ok {
-			return nil
-		}
+	return ans, nil
+}
 
-		ans.xorToContainer(b, tmp)
-		tmp.Swap(ans)
-		tmp.Reset()
+func (this *Ewah) Not() bitmap.Bitmap {
+	ans, err := this.NotChecked()
+	if err != nil {
+		return nil
 	}
 
 	return ans
 }
 
-func (this *Ewah) Not() bitmap.Bitmap {
+// NotChecked is the same as Not, but it returns ErrResultTooLarge, leaving the bitmap untouched, if the
+// result could exceed the budget set with SetMaxResultWords, and ErrReadOnly if the bitmap is read-only.
+func (this *Ewah) NotChecked() (bitmap.Bitmap, error) {
+	if err := this.checkWritable("Not"); err != nil {
+		return nil, err
+	}
+
+	this.Flush()
+
+	if err := checkResultWords("Not", estimateNotWords(this)); err != nil {
+		return nil, err
+	}
+
+	this.ensureOwned()
+
 	c := newCursor(this.buffer, this.actualSizeInWords)
 
 	for !c.end() {
-		//fmt.Printf("bitops.go/Not2: c.marker = %d, sizeInWords = %d, literals = %d\n",
-		// c.marker, this.actualSizeInWords, c.literalRemaining())
 		c.setEmptyBit(!c.emptyBit())
 
 		for i, v := range this.buffer[c.marker+1 : c.marker+c.literalRemaining()+1] {
@@ -145,8 +198,8 @@ func (this *Ewah) Not() bitmap.Bitmap {
 			// the word
 			if c.literalCount() == 0 {
 				if c.emptyCount() > 0 && c.emptyBit() {
-					c.setLiteralCount(int64(c.literalCount()) - 1)
-					this.addLiteralWord(uint64(0) >> uint64(wordInBits-lastBits))
+					c.setEmptyCount(c.emptyCount() - 1)
+					this.addLiteralWord(^uint64(0) >> uint64(wordInBits-lastBits))
 				}
 
 				break
@@ -161,10 +214,113 @@ func (this *Ewah) Not() bitmap.Bitmap {
 		}
 	}
 
-	return this
+	// The marker words were changed behind the back of our own cursors, so refresh them
+	this.setCursor.quickUpdate(this.buffer, this.actualSizeInWords)
+	this.getCursor.reset(this.buffer, this.actualSizeInWords)
+
+	recordOperation("not", this)
+
+	return this, nil
+}
+
+// orOperands returns the union of two or more bitmaps. It's OrChecked without the span, for the functions
+// of the package that start their own.
+func orOperands(operands []*Ewah) (*Ewah, error) {
+	if err := checkResultWords("Or", estimateOrWords(operands...)); err != nil {
+		return nil, err
+	}
+
+	this, b := operands[0], operands[1]
+	ans := NewWithOptions(this.Options())
+	tmp := NewWithOptions(this.Options())
+	ans.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
+	tmp.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
+
+	this.orToContainer(b, ans)
+
+	for _, b := range operands[2:] {
+		ans.orToContainer(b, tmp)
+		tmp.Swap(ans)
+		tmp.Reset()
+	}
+
+	recordOperation("or", ans)
+
+	return ans, nil
+}
+
+// bitOp is the core of And, AndNot and Xor: it applies the operation, the toContainer method of its bitwise
+// operator, to this and each operand in turn. op is the name of the operation for the span, and fn the name
+// of the function for the errors.
+func (this *Ewah) bitOp(op, fn string, a []bitmap.Bitmap, toContainer func(this, a *Ewah, container BitmapStorage)) (*Ewah, error) {
+	if len(a) == 0 {
+		return this.Clone().(*Ewah), nil
+	}
+
+	this = this.orEmpty()
+	end := this.startOperation(context.Background(), op, a)
+
+	operands := make([]*Ewah, len(a))
+	for k, v := range a {
+		b, err := toEwah(v, fn)
+		if err != nil {
+			end(nil, err)
+			return nil, err
+		}
+		operands[k] = b
+	}
+
+	b := operands[0]
+	ans := NewWithOptions(this.Options())
+	tmp := NewWithOptions(this.Options())
+	ans.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
+	tmp.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(b.actualSizeInWords))))
+
+	toContainer(this, b, ans)
+
+	for _, b := range operands[1:] {
+		toContainer(ans, b, tmp)
+		tmp.Swap(ans)
+		tmp.Reset()
+	}
+
+	recordOperation(op, ans)
+	end(ans, nil)
+
+	return ans, nil
+}
+
+// toEwah returns the operand of an operation as an *Ewah. Other implementations of bitmap.Bitmap are
+// converted by reading each of their bits with Get, since the interface has no faster way to walk them, so
+// it takes a time proportional to their size. nil is the empty bitmap. fn is the name of the function for
+// the errors.
+func toEwah(v bitmap.Bitmap, fn string) (*Ewah, error) {
+	if b, ok := v.(*Ewah); ok || v == nil {
+		return b.orEmpty(), nil
+	}
+
+	size := v.Size()
+	if size > math.MaxInt32-wordInBits+1 {
+		return nil, newError(ErrIncompatibleBitmap, fmt.Sprintf("ewah/%s: operand of %d bits is too large", fn, size))
+	}
+
+	ans := NewEwah()
+	for i := int64(0); i < size; i++ {
+		if v.Get(i) {
+			ans.Set(i)
+		}
+	}
+
+	return ans, nil
 }
 
 func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
+	this.andToContainerCtx(context.Background(), a, container)
+}
+
+// andToContainerCtx is andToContainer, checking every ctxCheckInterval marker words whether the context is
+// done. If it is, it returns the error of the context, and the container is left half filled.
+func (this *Ewah) andToContainerCtx(ctx context.Context, a *Ewah, container BitmapStorage) error {
 	// i and j may switch depending on the the bitwise operation
 	i, j := a, this
 
@@ -172,8 +328,12 @@ func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
 	jCursor := newCursor(j.buffer, j.SizeInWords())
 
 	// Keep going thru the words until one of the cursors have reached the end (checked > size)
-	for iCursor.markerRemaining() > 0 && jCursor.markerRemaining() > 0 {
-		//fmt.Println("bitops.go/andToContainer2: --- inside 1st for loop\n--- iCursor =", iCursor, "\n--- jCursor =", jCursor)
+	for n := 1; iCursor.markerRemaining() > 0 && jCursor.markerRemaining() > 0; n++ {
+		if n%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 
 		// For each of the marker words, keep moving thru them until both have gone through their empty words
 		for iCursor.emptyRemaining() > 0 || jCursor.emptyRemaining() > 0 {
@@ -185,8 +345,6 @@ func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
 				prey, predator = jCursor, iCursor
 			}
 
-			//fmt.Println("bitops.go/andToContainer2: --- inside 2nd for loop\n--- prey =", prey, "\n--- predator =", predator)
-
 			if predator.emptyBit() == false {
 				// If predator's (one with more empty words) empty words are false, which means all these words
 				// are 0, then the result of the AND operation will also be 0. So we insert the same number
@@ -194,9 +352,7 @@ func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
 				container.addStreamOfEmptyWords(false, predator.emptyRemaining())
 
 				// And we move both prey and predator forward by the same number of words
-				//fmt.Printf("bitops.go/andToContainer2: prey.moveForward(%d)\n", predator.emptyRemaining())
 				prey.moveForward(predator.emptyRemaining())
-				//fmt.Printf("bitops.go/andToContainer2: predator.moveForward(%d)\n", predator.emptyRemaining())
 				predator.moveForward(predator.emptyRemaining())
 			} else {
 				// If the predator's empty words are true, which means all these words are 1, then the result of
@@ -204,7 +360,6 @@ func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
 				// words into the result set, up to the same number as the predator's running length. Prey may
 				// not have enough remaining words to cover the full running length, so we need to get back the
 				// total number that's been copied over.
-				//fmt.Printf("bitops.go/andToContainer2: prey.copyForward(%d)\n", predator.emptyRemaining())
 				index, _ := prey.copyForward(container, predator.emptyRemaining(), false)
 				container.addStreamOfEmptyWords(false, predator.emptyRemaining()-index)
 				predator.moveForward(predator.emptyRemaining())
@@ -213,8 +368,6 @@ func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
 
 		// Now that we have gone through all the empty words, let's take care of the left over literal words
 		leftOverLiterals := int64(math.Min(float64(iCursor.literalRemaining()), float64(jCursor.literalRemaining())))
-		//fmt.Printf("bitops.go/andToContainer2: leftOverLiterals = %d, i.literalRemaining() = %d, j.literalRemaining() = %d\n",
-		//	leftOverLiterals, iCursor.literalRemaining(), jCursor.literalRemaining())
 
 		if leftOverLiterals > 0 {
 			// for each of the left over literals, we will AND them and put the result in the contanier
@@ -223,16 +376,11 @@ func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
 			}
 
 			// Move the cursors forward
-			//fmt.Printf("bitops.go/andToContainer2: iCursor.moveForward(%d)\n", leftOverLiterals)
 			iCursor.moveForward(leftOverLiterals)
-			//fmt.Printf("bitops.go/andToContainer2: jCursor.moveForward(%d)\n", leftOverLiterals)
 			jCursor.moveForward(leftOverLiterals)
 		}
 
 	}
-	//fmt.Println("------------------------")
-	//fmt.Println("bitops.go/andToContainer2: iCursor =", iCursor)
-	//fmt.Println("bitops.go/andToContainer2: jCursor =", jCursor)
 
 	// Adjust the result set size to the bigger of the two original bitmaps if needed, by padding 0's
 	if this.adjustContainerSizeWhenAggregating {
@@ -252,9 +400,10 @@ func (this *Ewah) andToContainer(a *Ewah, container BitmapStorage) {
 		remaining.copyForwardEmpty(container)
 
 		// Then set the result container size to the max of the two bitmaps
-		//fmt.Printf("bitops.go/andToContainer2: i.size = %d, j.size = %d\n", i.Size(), j.Size())
 		container.setSizeInBits(int64(math.Max(float64(i.Size()), float64(j.Size()))))
 	}
+
+	return nil
 }
 
 // Returns the cardinality of the result of a bitwise AND of the values of the current bitmap with some
@@ -286,34 +435,22 @@ func (this *Ewah) andNotToContainer(a *Ewah, container BitmapStorage) {
 			} else {
 				prey, predator = jCursor, iCursor
 			}
-			//fmt.Println("bitops.go/andNotToContainer: ---")
-			//fmt.Println("bitops.go/andNotToContainer: iCursor =", iCursor)
-			//fmt.Println("bitops.go/andNotToContainer: jCursor =", jCursor)
-			//container.(*Ewah).printDetails()
 
 			if (predator.emptyBit() == true && i_is_prey) || (predator.emptyBit() == false && !i_is_prey) {
-				//fmt.Println("bitops.go/andNotToContainer: addStreamOfEmptyWords", predator.emptyRemaining())
 				container.addStreamOfEmptyWords(false, predator.emptyRemaining())
 				prey.moveForward(predator.emptyRemaining())
 				predator.moveForward(predator.emptyRemaining())
 			} else if i_is_prey {
 				index, _ := prey.copyForward(container, predator.emptyRemaining(), false)
-				//fmt.Printf("bitops.go/andNotToContainer: addStreamOfEmptyWords %d, index = %d\n", predator.emptyRemaining(), index)
 				container.addStreamOfEmptyWords(false, predator.emptyRemaining()-index)
 				predator.moveForward(predator.emptyRemaining())
 			} else {
 				index, _ := prey.copyForward(container, predator.emptyRemaining(), true)
-				//fmt.Printf("bitops.go/andNotToContainer: negated addStreamOfEmptyWords %d, index = %d\n", predator.emptyRemaining(), index)
 				container.addStreamOfEmptyWords(true, predator.emptyRemaining()-index)
 				predator.moveForward(predator.emptyRemaining())
 			}
 		}
 
-		//fmt.Println("bitops.go/andNotToContainer: ===")
-		//fmt.Println("bitops.go/andNotToContainer: iCursor =", iCursor)
-		//fmt.Println("bitops.go/andNotToContainer: jCursor =", jCursor)
-		//container.(*Ewah).printDetails()
-
 		leftOverLiterals := int64(math.Min(float64(iCursor.literalRemaining()), float64(jCursor.literalRemaining())))
 
 		if leftOverLiterals > 0 {
@@ -326,11 +463,6 @@ func (this *Ewah) andNotToContainer(a *Ewah, container BitmapStorage) {
 		}
 	}
 
-	//fmt.Println("bitops.go/andNotToContainer: ***")
-	//fmt.Println("bitops.go/andNotToContainer: iCursor =", iCursor)
-	//fmt.Println("bitops.go/andNotToContainer: jCursor =", jCursor)
-	//container.(*Ewah).printDetails()
-
 	iRemains := iCursor.markerRemaining() > 0
 	var remaining *cursor
 
@@ -350,11 +482,6 @@ func (this *Ewah) andNotToContainer(a *Ewah, container BitmapStorage) {
 		container.setSizeInBits(int64(math.Max(float64(i.Size()), float64(j.Size()))))
 	}
 
-	//fmt.Println("bitops.go/andNotToContainer: >>>")
-	//fmt.Println("bitops.go/andNotToContainer: iCursor =", iCursor)
-	//fmt.Println("bitops.go/andNotToContainer: jCursor =", jCursor)
-	//container.(*Ewah).printDetails()
-
 }
 
 func (this *Ewah) andNotCardinality(a *Ewah) int32 {
@@ -371,8 +498,6 @@ func (this *Ewah) orToContainer(a *Ewah, container BitmapStorage) {
 
 	// Keep going thru the words until one of the cursors have reached the end (checked > size)
 	for iCursor.markerRemaining() > 0 && jCursor.markerRemaining() > 0 {
-		//fmt.Println("bitops.go/orToContainer: i =", iCursor)
-		//fmt.Println("bitops.go/orToContainer: j =", jCursor)
 		// For each of the marker words, keep moving thru them until both have gone through their empty words
 		for iCursor.emptyRemaining() > 0 || jCursor.emptyRemaining() > 0 {
 			// Predator is the one that has more empty words. Prey is the one with less.
@@ -408,20 +533,22 @@ func (this *Ewah) orToContainer(a *Ewah, container BitmapStorage) {
 		}
 	}
 
-	// Adjust the result set size to the bigger of the two original bitmaps if needed, by padding 0's
-	if this.adjustContainerSizeWhenAggregating {
-		// Only one of the cursors should words left. So we check to see if iCursor has left over words.
-		// If iCursor doesn't have anything left (checked >= size), then it must be jCursor that has left overs.
-		iRemains := iCursor.markerRemaining() > 0
-		var remaining *cursor
+	// Only one of the cursors should words left. So we check to see if iCursor has left over words.
+	// If iCursor doesn't have anything left (checked >= size), then it must be jCursor that has left overs.
+	iRemains := iCursor.markerRemaining() > 0
+	var remaining *cursor
 
-		if iRemains {
-			remaining = iCursor
-		} else {
-			remaining = jCursor
-		}
+	if iRemains {
+		remaining = iCursor
+	} else {
+		remaining = jCursor
+	}
 
-		remaining.copyForwardRemaining(container)
+	// The words left are part of the union whatever the options, only the size is adjusted
+	remaining.copyForwardRemaining(container)
+
+	// Adjust the result set size to the bigger of the two original bitmaps if needed
+	if this.adjustContainerSizeWhenAggregating {
 		container.setSizeInBits(int64(math.Max(float64(i.Size()), float64(j.Size()))))
 	}
 }
@@ -440,8 +567,6 @@ func (this *Ewah) xorToContainer(a *Ewah, container BitmapStorage) {
 
 	// Keep going thru the words until one of the cursors have reached the end (checked > size)
 	for iCursor.markerRemaining() > 0 && jCursor.markerRemaining() > 0 {
-		//fmt.Println("bitops.go/orToContainer: i =", iCursor)
-		//fmt.Println("bitops.go/orToContainer: j =", jCursor)
 		// For each of the marker words, keep moving thru them until both have gone through their empty words
 		for iCursor.emptyRemaining() > 0 || jCursor.emptyRemaining() > 0 {
 			// Predator is the one that has more empty words. Prey is the one with less.
@@ -487,7 +612,9 @@ func (this *Ewah) xorToContainer(a *Ewah, container BitmapStorage) {
 	}
 
 	remaining.copyForwardRemaining(container)
-	container.setSizeInBits(int64(math.Max(float64(i.Size()), float64(j.Size()))))
+	if this.adjustContainerSizeWhenAggregating {
+		container.setSizeInBits(int64(math.Max(float64(i.Size()), float64(j.Size()))))
+	}
 }
 
 func (this *Ewah) xorCardinality(a *Ewah) int32 {
@@ -0,0 +1,23 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"github.com/reducedb/bitmap/bloom"
+)
+
+// ToBloom returns a Bloom filter with the positions of the bits set to 1, sized for a false positive rate
+// of fpRate. The filter is much smaller than the bitmap when the bits are scattered.
+func (this *Ewah) ToBloom(fpRate float64) *bloom.Filter {
+	f := bloom.New(this.Cardinality(), fpRate)
+
+	for it := this.Iterator(); it.HasNext(); {
+		f.Add(it.Next())
+	}
+
+	return f
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"math"
+	"sort"
+)
+
+// Builder builds a bitmap from several goroutines at once. Each goroutine sets bits in its own shard, in any
+// order, and Build merges the shards into a single bitmap. How positions are split between the shards is up
+// to the caller: by range, by hash, or simply by which goroutine saw them.
+type Builder struct {
+	shards []*Shard
+}
+
+// Shard collects the bits set by one goroutine. It must not be used by several goroutines at the same time.
+type Shard struct {
+	positions []int64
+}
+
+// NewBuilder returns a builder with n shards
+func NewBuilder(n int) *Builder {
+	if n < 1 {
+		n = 1
+	}
+
+	b := &Builder{
+		shards: make([]*Shard, n),
+	}
+
+	for k := range b.shards {
+		b.shards[k] = new(Shard)
+	}
+
+	return b
+}
+
+// Shards returns the number of shards
+func (this *Builder) Shards() int {
+	return len(this.shards)
+}
+
+// Shard returns the k-th shard, or nil if there's none
+func (this *Builder) Shard(k int) *Shard {
+	if k < 0 || k >= len(this.shards) {
+		return nil
+	}
+
+	return this.shards[k]
+}
+
+// Build sorts the bits of each shard into a bitmap, in parallel on the default pool, then returns their
+// union. The shards are emptied. It returns ErrResultTooLarge if the union could exceed the budget set with
+// SetMaxResultWords.
+func (this *Builder) Build() (*Ewah, error) {
+	bitmaps := make([]*Ewah, len(this.shards))
+
+	parallelFor(len(this.shards), 0, func(k int) error {
+		bitmaps[k] = this.shards[k].build()
+		return nil
+	})
+
+	if len(bitmaps) == 1 {
+		return bitmaps[0], nil
+	}
+
+	return orAll(bitmaps)
+}
+
+// Set sets the bit at position i to true (1). Unlike Ewah's Set, bits can be set in any order, and more
+// than once. It returns nil if i is out of the range EWAH supports.
+func (this *Shard) Set(i int64) *Shard {
+	if i < 0 || i > math.MaxInt32-wordInBits {
+		return nil
+	}
+
+	this.positions = append(this.positions, i)
+
+	return this
+}
+
+//
+// Not-exported functions
+//
+
+// build returns the bits of the shard as a bitmap, and empties the shard
+func (this *Shard) build() *Ewah {
+	sort.Slice(this.positions, func(i, j int) bool { return this.positions[i] < this.positions[j] })
+
+	e := NewEwah()
+	for k, i := range this.positions {
+		if k == 0 || i != this.positions[k-1] {
+			e.Set(i)
+		}
+	}
+
+	this.positions = nil
+
+	return e
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+// Canonical returns a copy of the bitmap in its canonical form: each run of 0's or 1's in a single marker
+// word, literal words only where the bits differ, nothing past the size, and the bits of the last word past
+// the size cleared. Bitmaps built with Set are already canonical, but other writers, or bitmaps put
+// together from parts, may use more words for the same bits. Two bitmaps with the same size and bits have
+// the same canonical form, down to the bytes of MarshalBinary.
+func (this *Ewah) Canonical() *Ewah {
+	ans := NewEwah()
+
+	this.walkCanonical(ans.addStreamOfEmptyWords, ans.add)
+	ans.sizeInBits = this.sizeInBits
+
+	return ans
+}
+
+// IsCanonical returns true if the bitmap is in its canonical form, as returned by Canonical
+func (this *Ewah) IsCanonical() bool {
+	return this.Equal(this.Canonical())
+}
+
+//
+// Not-exported functions
+//
+
+// walkCanonical is walkWords over the canonical form of the bitmap: the words up to the size, with the bits
+// of the last word past the size cleared, the literal words with all their bits equal turned into runs, and
+// the runs of the same value merged. Two bitmaps with the same size and bits have the same canonical form.
+func (this *Ewah) walkCanonical(run func(v bool, n int64), literal func(w uint64)) {
+	words := (this.sizeInBits + wordInBits - 1) / wordInBits
+	last := ^uint64(0)
+	if r := this.sizeInBits % wordInBits; r != 0 {
+		last = uint64(1)<<uint64(r) - 1
+	}
+
+	// value is the value of the pending run of count words
+	value, count := false, int64(0)
+	flush := func() {
+		if count > 0 {
+			run(value, count)
+			count = 0
+		}
+	}
+
+	addWord := func(w uint64, n int64) {
+		if n <= 0 {
+			return
+		}
+
+		if w == 0 || w == ^uint64(0) {
+			if count > 0 && (w != 0) != value {
+				flush()
+			}
+			value = w != 0
+			count += n
+			return
+		}
+
+		flush()
+		for ; n > 0; n-- {
+			literal(w)
+		}
+	}
+
+	pos := int64(0)
+	add := func(w uint64, n int64) {
+		if n > words-pos {
+			n = words - pos
+		}
+		if n <= 0 {
+			return
+		}
+
+		// The bits of the last word past the size are not part of the bitmap
+		if pos+n == words {
+			addWord(w, n-1)
+			addWord(w&last, 1)
+		} else {
+			addWord(w, n)
+		}
+
+		pos += n
+	}
+
+	this.walkWords(func(v bool, n int64) {
+		if v {
+			add(^uint64(0), n)
+		} else {
+			add(0, n)
+		}
+	}, func(w uint64) {
+		add(w, 1)
+	})
+
+	// Words missing at the end are empty
+	add(0, words-pos)
+	flush()
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// DefaultCBORTag is the CBOR tag of the bitmaps, unless SetCBORTag sets another one. It's "EWAH" in ASCII,
+// in the range of tags anyone can use, but it's not registered with IANA.
+const DefaultCBORTag uint64 = 0x45574148
+
+// The CBOR major types of the byte strings and of the tags, and the simple value null
+const (
+	cborBytes = 2
+	cborTag   = 6
+	cborNull  = 0xf6
+)
+
+var cborTagNumber atomic.Uint64
+
+// SetCBORTag sets the CBOR tag of the bitmaps, for the protocols that registered their own
+func SetCBORTag(tag uint64) {
+	cborTagNumber.Store(tag)
+}
+
+// CBORTag returns the CBOR tag of the bitmaps
+func CBORTag() uint64 {
+	return cborTagNumber.Load()
+}
+
+// MarshalCBOR encodes the bitmap as a CBOR byte string, holding its encoding by MarshalBinary, with the tag
+// set with SetCBORTag. It's the method the CBOR libraries, like github.com/fxamacker/cbor, call to encode a
+// value that has it, so bitmaps can be used in CBOR and COSE protocols without this package depending on
+// one.
+func (this *Ewah) MarshalCBOR() ([]byte, error) {
+	b, err := this.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	head := appendCBORHead(nil, cborTag, CBORTag())
+	head = appendCBORHead(head, cborBytes, uint64(len(b)))
+
+	return append(head, b...), nil
+}
+
+// UnmarshalCBOR decodes a bitmap encoded by MarshalCBOR, and replaces the content of the bitmap. The byte
+// string may also come without a tag. null leaves the bitmap untouched. Another tag, or anything else than
+// a byte string holding a bitmap, returns an error matching ErrCorruptData.
+func (this *Ewah) UnmarshalCBOR(b []byte) error {
+	if err := this.checkWritable("UnmarshalCBOR"); err != nil {
+		return err
+	}
+
+	if len(b) == 1 && b[0] == cborNull {
+		return nil
+	}
+
+	major, n, rest, err := readCBORHead(b)
+	if err == nil && major == cborTag {
+		if n != CBORTag() {
+			return newError(ErrCorruptData, fmt.Sprintf("ewah/UnmarshalCBOR: tag %d, not %d", n, CBORTag()))
+		}
+		major, n, rest, err = readCBORHead(rest)
+	}
+	if err != nil {
+		return newError(ErrCorruptData, "ewah/UnmarshalCBOR: "+err.Error())
+	}
+
+	if major != cborBytes || n != uint64(len(rest)) {
+		return newError(ErrCorruptData, "ewah/UnmarshalCBOR: not a byte string")
+	}
+
+	return this.UnmarshalBinary(rest)
+}
+
+//
+// Not-exported functions
+//
+
+func init() {
+	cborTagNumber.Store(DefaultCBORTag)
+}
+
+// appendCBORHead appends the head of a data item of the major type, with the argument n, in its shortest
+// form
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xff:
+		return append(b, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+// readCBORHead reads the head of a data item, and returns its major type, its argument, and what follows
+func readCBORHead(b []byte) (major byte, n uint64, rest []byte, err error) {
+	if len(b) == 0 {
+		return 0, 0, nil, errors.New("no data item")
+	}
+
+	head := b[0]
+	major, info := head>>5, head&0x1f
+	b = b[1:]
+
+	switch {
+	case info < 24:
+		return major, uint64(info), b, nil
+	case info == 24 && len(b) >= 1:
+		return major, uint64(b[0]), b[1:], nil
+	case info == 25 && len(b) >= 2:
+		return major, uint64(binary.BigEndian.Uint16(b)), b[2:], nil
+	case info == 26 && len(b) >= 4:
+		return major, uint64(binary.BigEndian.Uint32(b)), b[4:], nil
+	case info == 27 && len(b) >= 8:
+		return major, binary.BigEndian.Uint64(b), b[8:], nil
+	}
+
+	return 0, 0, nil, fmt.Errorf("invalid head %#x", head)
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package conformance holds test vectors for the encodings of EWAH bitmaps, so decoders written in other
+// languages, and new codecs of this library, can check they read and write exactly the same bytes.
+//
+// The vectors are in the vectors directory. Each <name>.txt lists the bits set in a bitmap, one position
+// or one inclusive range "start-end" per line, optionally with a step, as in "0-254/2". Lines starting
+// with # are comments. The size in bits of the bitmap is one more than its last position, or 0 if it's
+// empty. Next to it, <name>.<format> is the bitmap encoded in each format:
+//
+//	ewah  MarshalBinary, the format of JavaEWAH
+//
+// There are no vectors for MarshalCpp yet: written by MarshalCpp itself, they would only check the library
+// against itself. They are to be added once they can be generated with the C++ library.
+//
+// The bitmaps are built by setting the bits one at a time, in ascending order, which is how the other
+// implementations build them too, so full words of 1's are runs and not literal words. Run go generate
+// after adding a vector, and never change the encoding of an existing one.
+package conformance
+
+//go:generate go run gen.go
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/reducedb/bitmap/ewah"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes and decodes bitmaps in one of the formats of the vectors
+type Codec interface {
+	// Format is the extension of the encoded vectors, "ewah"
+	Format() string
+
+	// Encode returns the bitmap with the bits set at the positions, in ascending order
+	Encode(positions []int64) ([]byte, error)
+
+	// Decode returns the positions of the bits set, in ascending order, and the size in bits
+	Decode(b []byte) (positions []int64, sizeInBits int64, err error)
+}
+
+// Vector is a test vector: a bitmap and its encoding in each format
+type Vector struct {
+	Name      string
+	Positions []int64
+	Encoded   map[string][]byte
+}
+
+// SizeInBits returns the size in bits of the bitmap of the vector
+func (this *Vector) SizeInBits() int64 {
+	if len(this.Positions) == 0 {
+		return 0
+	}
+
+	return this.Positions[len(this.Positions)-1] + 1
+}
+
+// Binary is the codec of MarshalBinary
+var Binary Codec = codec{"ewah", (*ewah.Ewah).MarshalBinary, (*ewah.Ewah).UnmarshalBinary}
+
+//go:embed vectors
+var files embed.FS
+
+// Vectors returns the test vectors, sorted by name
+func Vectors() ([]*Vector, error) {
+	entries, err := files.ReadDir("vectors")
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make(map[string]*Vector)
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+
+		v := vectors[name]
+		if v == nil {
+			v = &Vector{Name: name, Encoded: make(map[string][]byte)}
+			vectors[name] = v
+		}
+
+		b, err := files.ReadFile("vectors/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if ext == ".txt" {
+			if v.Positions, err = ParseManifest(b); err != nil {
+				return nil, fmt.Errorf("conformance/Vectors: %s: %v", entry.Name(), err)
+			}
+			continue
+		}
+		v.Encoded[strings.TrimPrefix(ext, ".")] = b
+	}
+
+	ans := make([]*Vector, 0, len(vectors))
+	for _, v := range vectors {
+		ans = append(ans, v)
+	}
+	sort.Slice(ans, func(i, j int) bool { return ans[i].Name < ans[j].Name })
+
+	return ans, nil
+}
+
+// ParseManifest returns the positions listed in a <name>.txt file of the vectors
+func ParseManifest(b []byte) ([]int64, error) {
+	var positions []int64
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		start, end, step, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if len(positions) > 0 && start <= positions[len(positions)-1] {
+			return nil, fmt.Errorf("line %d: positions are not in ascending order", n)
+		}
+
+		for i := start; i <= end; i += step {
+			positions = append(positions, i)
+		}
+	}
+
+	return positions, s.Err()
+}
+
+// Check decodes and encodes every vector with the codec, and returns an error describing the first
+// vector it doesn't decode to the same bitmap, or doesn't encode to the same bytes.
+func Check(c Codec) error {
+	vectors, err := Vectors()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range vectors {
+		b, ok := v.Encoded[c.Format()]
+		if !ok {
+			return fmt.Errorf("conformance/Check: no %q encoding for vector %s", c.Format(), v.Name)
+		}
+
+		positions, sizeInBits, err := c.Decode(b)
+		if err != nil {
+			return fmt.Errorf("conformance/Check: %s: decode: %v", v.Name, err)
+		}
+		if sizeInBits != v.SizeInBits() {
+			return fmt.Errorf("conformance/Check: %s: decoded size is %d bits, want %d", v.Name, sizeInBits, v.SizeInBits())
+		}
+		if k := firstDifference(positions, v.Positions); k >= 0 {
+			return fmt.Errorf("conformance/Check: %s: decoded position #%d is %s, want %s", v.Name, k, at(positions, k), at(v.Positions, k))
+		}
+
+		encoded, err := c.Encode(v.Positions)
+		if err != nil {
+			return fmt.Errorf("conformance/Check: %s: encode: %v", v.Name, err)
+		}
+		if !bytes.Equal(encoded, b) {
+			k := 0
+			for k < len(encoded) && k < len(b) && encoded[k] == b[k] {
+				k++
+			}
+			return fmt.Errorf("conformance/Check: %s: encoded %d bytes, want %d, first difference at byte %d", v.Name, len(encoded), len(b), k)
+		}
+	}
+
+	return nil
+}
+
+//
+// Not-exported functions
+//
+
+// codec is a Codec for a pair of methods of ewah.Ewah
+type codec struct {
+	format    string
+	marshal   func(*ewah.Ewah) ([]byte, error)
+	unmarshal func(*ewah.Ewah, []byte) error
+}
+
+func (this codec) Format() string {
+	return this.format
+}
+
+func (this codec) Encode(positions []int64) ([]byte, error) {
+	e := ewah.NewEwah()
+	for _, i := range positions {
+		if e.Set(i) == nil {
+			return nil, fmt.Errorf("cannot set bit %d", i)
+		}
+	}
+
+	return this.marshal(e)
+}
+
+func (this codec) Decode(b []byte) ([]int64, int64, error) {
+	e := ewah.NewEwah()
+	if err := this.unmarshal(e, b); err != nil {
+		return nil, 0, err
+	}
+
+	var positions []int64
+	for it := e.Iterator(); it.HasNext(); {
+		positions = append(positions, it.Next())
+	}
+
+	return positions, e.Size(), nil
+}
+
+// parseLine parses a line of a manifest: a position, or a range with an optional step
+func parseLine(line string) (start, end, step int64, err error) {
+	step = 1
+	if k := strings.IndexByte(line, '/'); k >= 0 {
+		if step, err = strconv.ParseInt(line[k+1:], 10, 64); err != nil || step < 1 {
+			return 0, 0, 0, errors.New("invalid step")
+		}
+		line = line[:k]
+	}
+
+	if k := strings.IndexByte(line, '-'); k > 0 {
+		start, err = strconv.ParseInt(line[:k], 10, 64)
+		if err == nil {
+			end, err = strconv.ParseInt(line[k+1:], 10, 64)
+		}
+	} else {
+		start, err = strconv.ParseInt(line, 10, 64)
+		end = start
+	}
+
+	if err != nil || start < 0 || end < start {
+		return 0, 0, 0, errors.New("invalid position or range")
+	}
+
+	return start, end, step, nil
+}
+
+// firstDifference returns the index of the first position that differs, or -1 if there's none
+func firstDifference(a, b []int64) int {
+	for k := 0; k < len(a) || k < len(b); k++ {
+		if k >= len(a) || k >= len(b) || a[k] != b[k] {
+			return k
+		}
+	}
+
+	return -1
+}
+
+func at(positions []int64, k int) string {
+	if k >= len(positions) {
+		return "missing"
+	}
+
+	return strconv.FormatInt(positions[k], 10)
+}
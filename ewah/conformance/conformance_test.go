@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package conformance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	for _, c := range []Codec{Binary} {
+		if err := Check(c); err != nil {
+			t.Errorf("%s: %v", c.Format(), err)
+		}
+	}
+}
+
+func TestVectors(t *testing.T) {
+	vectors, err := Vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vectors) < 10 {
+		t.Fatalf("only %d vectors", len(vectors))
+	}
+
+	for _, v := range vectors {
+		if len(v.Encoded) != 1 {
+			t.Errorf("%s: %d encodings, want 1", v.Name, len(v.Encoded))
+		}
+	}
+
+	// Full words are runs, not literal words
+	for _, v := range vectors {
+		if v.Name == "word" && len(v.Encoded["ewah"]) != 4+4+8+4 {
+			t.Errorf("word: %d bytes, want a single marker word", len(v.Encoded["ewah"]))
+		}
+	}
+}
+
+// wrongCodec encodes the bitmaps like Binary, but without their size in bits
+type wrongCodec struct {
+	Codec
+}
+
+func (this wrongCodec) Encode(positions []int64) ([]byte, error) {
+	b, err := this.Codec.Encode(positions)
+	if err == nil {
+		copy(b, []byte{0, 0, 0, 0})
+	}
+
+	return b, err
+}
+
+func TestCheckFails(t *testing.T) {
+	err := Check(wrongCodec{Binary})
+	if err == nil || !strings.Contains(err.Error(), "alternating: encoded") {
+		t.Errorf("got %v, want an encoding error for the first vector", err)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	positions, err := ParseManifest([]byte("# comment\n1\n\n3-5\n10-16/3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{1, 3, 4, 5, 10, 13, 16}
+	if firstDifference(positions, want) >= 0 {
+		t.Errorf("got %v, want %v", positions, want)
+	}
+
+	for _, s := range []string{"5\n3\n", "x\n", "5-3\n", "1-5/0\n", "-1\n"} {
+		if _, err := ParseManifest([]byte(s)); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
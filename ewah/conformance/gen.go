@@ -0,0 +1,48 @@
+//go:build ignore
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// gen writes the encodings of the vectors from their .txt files. Run it with go generate.
+package main
+
+import (
+	"github.com/reducedb/bitmap/ewah/conformance"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	names, err := filepath.Glob("vectors/*.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		positions, err := conformance.ParseManifest(b)
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+
+		for _, c := range []conformance.Codec{conformance.Binary} {
+			encoded, err := c.Encode(positions)
+			if err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+
+			if err := os.WriteFile(strings.TrimSuffix(name, ".txt")+"."+c.Format(), encoded, 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+const (
+	zeroSegment = iota
+	oneSegment
+	literalSegment
+)
+
+// segment is a run of empty words, a run of full words, or the literal words of a marker
+type segment struct {
+	kind int
+
+	// n is the number of uncompressed words, and markers the number of marker words read to get there
+	n       int64
+	markers int64
+}
+
+// CostAnd returns an estimate of the number of words And reads to intersect the bitmap with other: the
+// marker words, and the literal words that are not skipped over because the other bitmap has a run of 0's
+// there. Planners can use it to run the cheapest intersections first.
+func (this *Ewah) CostAnd(other *Ewah) int64 {
+	return cost(this.segments(), other.segments(), false, func(x, y int) int64 {
+		switch {
+		case x == zeroSegment || y == zeroSegment:
+			return 0
+		case x == literalSegment && y == literalSegment:
+			return 2
+		case x == literalSegment || y == literalSegment:
+			return 1
+		}
+		return 0
+	})
+}
+
+// CostOr returns an estimate of the number of words Or reads to unite the bitmap with other: the marker
+// words, and the literal words that are not skipped over because the other bitmap has a run of 1's there.
+// Unlike And, Or reads both bitmaps up to the end.
+func (this *Ewah) CostOr(other *Ewah) int64 {
+	return cost(this.segments(), other.segments(), true, func(x, y int) int64 {
+		switch {
+		case x == oneSegment || y == oneSegment:
+			return 0
+		case x == literalSegment && y == literalSegment:
+			return 2
+		case x == literalSegment || y == literalSegment:
+			return 1
+		}
+		return 0
+	})
+}
+
+//
+// Not-exported functions
+//
+
+// segments returns the runs and literal words of the bitmap, in order
+func (this *Ewah) segments() []segment {
+	var s []segment
+
+	for pos := int64(0); pos < this.actualSizeInWords; {
+		rlw := this.buffer[pos]
+		runlen := int64((rlw >> 1) & LargestRunningLengthCount)
+		literals := int64(rlw >> uint32(1+RunningLengthBits))
+
+		// The marker is counted with the first segment it has
+		markers := int64(1)
+		if runlen > 0 {
+			kind := zeroSegment
+			if rlw&1 != 0 {
+				kind = oneSegment
+			}
+			s = append(s, segment{kind: kind, n: runlen, markers: markers})
+			markers = 0
+		}
+
+		if literals > 0 {
+			s = append(s, segment{kind: literalSegment, n: literals, markers: markers})
+		}
+
+		pos += 1 + literals
+	}
+
+	return s
+}
+
+// cost walks the segments of two bitmaps side by side, and adds up the words read where they overlap, as
+// told by words for each kind of segment, and the marker words. If tail is true, the words of the longest
+// bitmap past the end of the other are read too.
+func cost(a, b []segment, tail bool, words func(x, y int) int64) int64 {
+	n := int64(0)
+
+	i, j := 0, 0
+	var left, right int64
+	if len(a) > 0 {
+		left = a[0].n
+		n += a[0].markers
+	}
+	if len(b) > 0 {
+		right = b[0].n
+		n += b[0].markers
+	}
+
+	for i < len(a) && j < len(b) {
+		overlap := left
+		if right < overlap {
+			overlap = right
+		}
+
+		n += overlap * words(a[i].kind, b[j].kind)
+		left -= overlap
+		right -= overlap
+
+		if left == 0 {
+			if i++; i < len(a) {
+				left = a[i].n
+				n += a[i].markers
+			}
+		}
+		if right == 0 {
+			if j++; j < len(b) {
+				right = b[j].n
+				n += b[j].markers
+			}
+		}
+	}
+
+	if tail {
+		n += rest(a, i, left) + rest(b, j, right)
+	}
+
+	return n
+}
+
+// rest returns the words read from segment i, of which left words remain, to the end
+func rest(s []segment, i int, left int64) int64 {
+	if i >= len(s) {
+		return 0
+	}
+
+	n := int64(0)
+	if s[i].kind == literalSegment {
+		n += left
+	}
+
+	for _, r := range s[i+1:] {
+		n += r.markers
+		if r.kind == literalSegment {
+			n += r.n
+		}
+	}
+
+	return n
+}
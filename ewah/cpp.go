@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// cppHeaderSize is the size in bytes of the sizes written before the words by the C++ library
+const cppHeaderSize = 16
+
+// MarshalCpp encodes the bitmap in the format of EWAHBoolArray<uint64_t>::write() of the C++ library, with
+// the size in bits saved. The integers are little endian, as the C++ library writes its memory as it is on
+// the little endian machines it runs on, and unlike MarshalBinary, the position of the last marker word is
+// not written: it's found by walking the marker words when the bitmap is read.
+//
+//	sizeInBits (uint64) | sizeInWords (uint64) | words (sizeInWords x uint64)
+//
+// The words start 16 bytes in, so a buffer aligned on 8 bytes can be used in place by ViewCpp and
+// FromBuffer, or by the C++ library through a cast. The layouts of the older releases of the library are
+// handled by WriteCpp and ReadCpp.
+func (this *Ewah) MarshalCpp() ([]byte, error) {
+	this = this.orEmpty()
+
+	end := startCodec("marshalcpp", this.actualSizeInWords)
+	b, err := this.marshalCpp()
+	end(this, err)
+
+	return b, err
+}
+
+// marshalCpp is MarshalCpp, without the span
+func (this *Ewah) marshalCpp() ([]byte, error) {
+	b := make([]byte, cppHeaderSize+8*this.actualSizeInWords)
+
+	binary.LittleEndian.PutUint64(b, uint64(this.sizeInBits))
+	binary.LittleEndian.PutUint64(b[8:], uint64(this.actualSizeInWords))
+
+	for i, v := range this.buffer[:this.actualSizeInWords] {
+		binary.LittleEndian.PutUint64(b[cppHeaderSize+8*i:], v)
+	}
+
+	return b, nil
+}
+
+// UnmarshalCpp decodes a bitmap encoded by MarshalCpp, or by EWAHBoolArray<uint64_t>::write() of the C++
+// library with the size in bits saved. It replaces the content of the bitmap.
+func (this *Ewah) UnmarshalCpp(b []byte) error {
+	if err := this.checkWritable("UnmarshalCpp"); err != nil {
+		return err
+	}
+
+	end := startCodec("unmarshalcpp", int64(len(b)/8))
+	err := this.unmarshalCpp(b)
+	end(this, err)
+
+	return err
+}
+
+// unmarshalCpp is UnmarshalCpp, without the span
+func (this *Ewah) unmarshalCpp(b []byte) error {
+	sizeInBits, sizeInWords, err := readCppHeader(b)
+	if err != nil {
+		return newError(ErrCorruptData, "ewah/UnmarshalCpp: "+err.Error())
+	}
+
+	buffer := make([]uint64, sizeInWords)
+	for i := range buffer {
+		buffer[i] = binary.LittleEndian.Uint64(b[cppHeaderSize+8*i:])
+	}
+
+	rlw, _, err := scanMarkers(buffer, sizeInWords)
+	if err != nil {
+		return newError(ErrCorruptData, "ewah/UnmarshalCpp: "+err.Error())
+	}
+
+	this.load(buffer, sizeInWords, sizeInBits, rlw, false)
+
+	return nil
+}
+
+// ViewCpp returns the bitmap encoded in b by MarshalCpp or by the C++ library, like UnmarshalCpp, but reads
+// the words in place when it can: on little endian machines, if the words of b are aligned on 8 bytes. This
+// is what memory shared with C++ code, or mapped from a file, usually looks like. Otherwise, or when built
+// with the purego build tag or TinyGo, the words are copied. The bitmap copies the words the first time it's
+// modified, so b is never written to, but it must not be modified while the bitmap is in use.
+func ViewCpp(b []byte) (*Ewah, error) {
+	sizeInBits, sizeInWords, err := readCppHeader(b)
+	if err != nil {
+		return nil, newError(ErrCorruptData, "ewah/ViewCpp: "+err.Error())
+	}
+
+	e := NewEwah()
+
+	buffer := wordsInPlace(b[cppHeaderSize:])
+	if buffer == nil {
+		if err := e.unmarshalCpp(b); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	rlw, _, err := scanMarkers(buffer, sizeInWords)
+	if err != nil {
+		return nil, newError(ErrCorruptData, "ewah/ViewCpp: "+err.Error())
+	}
+
+	e.load(buffer, sizeInWords, sizeInBits, rlw, true)
+
+	return e, nil
+}
+
+//
+// Not-exported functions
+//
+
+// readCppHeader returns the sizes of a bitmap encoded for the C++ library, after checking they match the
+// size of b
+func readCppHeader(b []byte) (sizeInBits, sizeInWords int64, err error) {
+	if len(b) < cppHeaderSize {
+		return 0, 0, errors.New("buffer is too short")
+	}
+
+	bits := binary.LittleEndian.Uint64(b)
+	words := binary.LittleEndian.Uint64(b[8:])
+
+	if bits > math.MaxUint32 || words < 1 || words != uint64(len(b)-cppHeaderSize)/8 || len(b)%8 != 0 {
+		return 0, 0, errors.New("invalid sizes")
+	}
+
+	return int64(bits), int64(words), nil
+}
+
+// load replaces the content of the bitmap with the words of buffer. If shared is true, the buffer belongs
+// to someone else, and is copied before the bitmap is modified.
+func (this *Ewah) load(buffer []uint64, sizeInWords, sizeInBits, rlw int64, shared bool) {
+	if this.setCursor == nil {
+		this.Reset()
+	}
+
+	this.buffer = buffer
+	this.actualSizeInWords = sizeInWords
+	this.sizeInBits = sizeInBits
+	this.pending = nil
+	this.cow.Store(shared)
+
+	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, rlw)
+	this.getCursor.reset(this.buffer, this.actualSizeInWords)
+}
@@ -0,0 +1,14 @@
+//go:build purego || tinygo
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+// wordsInPlace always returns nil without unsafe, so the words are copied
+func wordsInPlace(b []byte) []uint64 {
+	return nil
+}
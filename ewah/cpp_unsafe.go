@@ -0,0 +1,29 @@
+//go:build !purego && !tinygo
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// littleEndian is true if the machine stores integers little endian, like the C++ library writes them
+var littleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// wordsInPlace returns the little endian words of b as a slice of words sharing its memory, or nil if they
+// can't be read in place
+func wordsInPlace(b []byte) []uint64 {
+	if !littleEndian || len(b) < 8 || uintptr(unsafe.Pointer(&b[0]))%8 != 0 {
+		return nil
+	}
+
+	n := len(b) / 8
+
+	return unsafe.Slice((*uint64)(unsafe.Pointer(&b[0])), n)[:n:n]
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// CppLayout is the layout of a bitmap written by EWAHBoolArray<uint64_t>::write() of the C++ library. The
+// zero value is the layout of the current releases, the one of MarshalCpp, and the fields select the
+// variants written by older releases, or when write() is told not to save the size in bits. Whatever the
+// layout, the integers are little endian:
+//
+//	sizeInBits (uint64 or uint32, unless NoSizeInBits) | sizeInWords (uint64 or uint32) |
+//	words (sizeInWords x uint64) | rlw position (uint64 or uint32, if RLW)
+type CppLayout struct {
+	// Narrow is true for the older releases writing the sizes as size_t, when it's 32 bits, instead of
+	// uint64
+	Narrow bool
+
+	// NoSizeInBits is true when write() is called with savesizeinbits set to false. The size of a bitmap
+	// read is then the position of its last bit set + 1.
+	NoSizeInBits bool
+
+	// RLW is true when the position of the last marker word is written after the words, like JavaEWAH
+	// does. It's how MarshalCpp wrote bitmaps before it followed the C++ library, and they are read with
+	// CppLayout{Narrow: true, RLW: true}. Otherwise, the last marker word is found by walking the marker
+	// words when the bitmap is read.
+	RLW bool
+}
+
+// WriteCpp writes the bitmap to w in the layout of the C++ library, and returns the number of bytes written
+func (this *Ewah) WriteCpp(w io.Writer, layout CppLayout) (int64, error) {
+	this = this.orEmpty()
+
+	if layout.Narrow && (this.sizeInBits > math.MaxUint32 || this.actualSizeInWords > math.MaxUint32) {
+		return 0, newError(ErrOutOfRange, "ewah/WriteCpp: bitmap is too large for 32-bit sizes")
+	}
+
+	b := make([]byte, 0, layout.headerSize()+8*this.actualSizeInWords+layout.intSize())
+	if !layout.NoSizeInBits {
+		b = layout.appendInt(b, this.sizeInBits)
+	}
+	b = layout.appendInt(b, this.actualSizeInWords)
+	for _, v := range this.buffer[:this.actualSizeInWords] {
+		b = binary.LittleEndian.AppendUint64(b, v)
+	}
+	if layout.RLW {
+		b = layout.appendInt(b, this.setCursor.marker)
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadCpp replaces the content of the bitmap with a bitmap read from r, written in the layout by the C++
+// library or by WriteCpp, and returns the number of bytes read. Like ReadFrom, it reads no more than the
+// bitmap, and only allocates memory as the words are read. A stream that ends before the bitmap does, or
+// words that are not valid, return an error matching ErrCorruptData.
+func (this *Ewah) ReadCpp(r io.Reader, layout CppLayout) (int64, error) {
+	if err := this.checkWritable("ReadCpp"); err != nil {
+		return 0, err
+	}
+
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, r, layout.headerSize())
+	if err != nil {
+		return n, cppReadError(err)
+	}
+
+	header := b.Bytes()
+	sizeInBits := int64(-1)
+	if !layout.NoSizeInBits {
+		sizeInBits, header = layout.int(header), header[layout.intSize():]
+	}
+	sizeInWords := layout.int(header)
+
+	if sizeInWords < 1 || sizeInWords > math.MaxInt32 || sizeInBits > math.MaxUint32 {
+		return n, newError(ErrCorruptData, "ewah/ReadCpp: invalid sizes")
+	}
+
+	trailer := int64(0)
+	if layout.RLW {
+		trailer = layout.intSize()
+	}
+
+	b.Reset()
+	m, err := io.CopyN(&b, r, 8*sizeInWords+trailer)
+	n += m
+	if err != nil {
+		return n, cppReadError(err)
+	}
+
+	words := b.Bytes()
+	buffer := make([]uint64, sizeInWords)
+	for i := range buffer {
+		buffer[i] = binary.LittleEndian.Uint64(words[8*i:])
+	}
+
+	last, highest, err := scanMarkers(buffer, sizeInWords)
+	if err != nil {
+		return n, newError(ErrCorruptData, "ewah/ReadCpp: "+err.Error())
+	}
+	if layout.RLW {
+		if rlw := layout.int(words[8*sizeInWords:]); rlw != last {
+			return n, newError(ErrCorruptData, fmt.Sprintf("ewah/ReadCpp: the last marker word is at %d, not at %d", last, rlw))
+		}
+	}
+	if sizeInBits < 0 {
+		sizeInBits = highest
+	}
+
+	this.load(buffer, sizeInWords, sizeInBits, last, false)
+
+	return n, nil
+}
+
+//
+// Not-exported functions
+//
+
+// intSize returns the size in bytes of the sizes of the layout
+func (this CppLayout) intSize() int64 {
+	if this.Narrow {
+		return 4
+	}
+
+	return 8
+}
+
+// headerSize returns the size in bytes of what comes before the words
+func (this CppLayout) headerSize() int64 {
+	if this.NoSizeInBits {
+		return this.intSize()
+	}
+
+	return 2 * this.intSize()
+}
+
+func (this CppLayout) appendInt(b []byte, v int64) []byte {
+	if this.Narrow {
+		return binary.LittleEndian.AppendUint32(b, uint32(v))
+	}
+
+	return binary.LittleEndian.AppendUint64(b, uint64(v))
+}
+
+// int reads a size at the start of b. Sizes too large for an int64 are returned as math.MaxInt64.
+func (this CppLayout) int(b []byte) int64 {
+	if this.Narrow {
+		return int64(binary.LittleEndian.Uint32(b))
+	}
+
+	if v := binary.LittleEndian.Uint64(b); v <= math.MaxInt64 {
+		return int64(v)
+	}
+
+	return math.MaxInt64
+}
+
+// cppReadError returns the error of ReadCpp for an error of the reader
+func cppReadError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return newError(ErrCorruptData, "ewah/ReadCpp: the stream ends before the bitmap")
+	}
+
+	return err
+}
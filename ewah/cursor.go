@@ -61,6 +61,12 @@ func (this *cursor) quickUpdate(a []uint64, s int64) {
 }
 
 func (this *cursor) updateMarkerCounts() {
+	// Once we moved past the last marker, there's nothing left to count
+	if this.marker >= this.bsize {
+		this.emptyCnt, this.literalCnt, this.emptyWordBit = 0, 0, false
+		return
+	}
+
 	this.emptyCnt = int64((this.buffer[this.marker] >> 1) & LargestRunningLengthCount)
 	this.literalCnt = int64(this.buffer[this.marker] >> uint32((1 + RunningLengthBits)))
 	this.emptyWordBit = (int64(this.buffer[this.marker]) & 1) != 0
@@ -151,7 +157,6 @@ func (this *cursor) copyForward(container BitmapStorage, max int64, negated bool
 		return 0, errors.New("cursor:copyForward: container is nil")
 	}
 
-	//fmt.Printf("cursor.go/copyForward: max = %d\n", max)
 	// index keeps track of the number of words we have copied so far
 	index := int64(0)
 
@@ -167,13 +172,12 @@ func (this *cursor) copyForward(container BitmapStorage, max int64, negated bool
 				pl = max - index
 			}
 
-			// Copy the words into the result set with the same 0 or 1 setting
-			container.addStreamOfEmptyWords(this.emptyBit(), pl)
+			// Copy the words into the result set with the same 0 or 1 setting, flipped if negated
+			container.addStreamOfEmptyWords(this.emptyBit() != negated, pl)
 
 			// Update the index to reflect the number of words copied
 			index += pl
 		}
-		//fmt.Printf("cursor.go/copyForward: pl = %d\n", pl)
 
 		// Now we copy the remaining literal words. If there are more literal words than we need, then we
 		// just copy up to max
@@ -193,7 +197,6 @@ func (this *cursor) copyForward(container BitmapStorage, max int64, negated bool
 			// Update the index to reflect the number of words copied
 			index += pd
 		}
-		//fmt.Printf("cursor.go/copyForward: pd = %d\n", pd)
 
 		// Now that we have copied the words, move the cursor forward
 		if _, err := this.moveForward(pl + pd); err != nil {
@@ -201,8 +204,6 @@ func (this *cursor) copyForward(container BitmapStorage, max int64, negated bool
 		}
 	}
 
-	//fmt.Printf("cursor.go/copyForward: index = %d\n", index)
-
 	return index, nil
 }
 
@@ -264,8 +265,14 @@ func (this *cursor) String() string {
 		this.bsize, this.marker, this.totalChecked, this.literalChecked, this.literalCount(), this.emptyChecked, this.emptyCount())
 }
 
+// end returns true if there are no more words to check. A marker word at the end of the buffer with no
+// literal words may still have some empty words left, so we are not done until those are checked too.
 func (this *cursor) end() bool {
-	if this.marker+this.literalChecked+1 >= this.bsize {
+	if this.marker >= this.bsize {
+		return true
+	}
+
+	if this.marker+this.literalChecked+1 >= this.bsize && this.emptyRemaining() == 0 {
 		return true
 	}
 
@@ -306,6 +313,9 @@ func (this *cursor) emptyRemaining() int64 {
 func (this *cursor) setLiteralCount(n int64) {
 	this.buffer[this.marker] |= NotRunningLengthPlusRunningBit
 	this.buffer[this.marker] &= (uint64(n) << uint64(RunningLengthBits+1)) | RunningLengthPlusRunningBit
+
+	// Keep the cached counts in sync with the marker word we just changed
+	this.updateMarkerCounts()
 }
 
 func (this *cursor) setEmptyBit(b bool) {
@@ -314,11 +324,17 @@ func (this *cursor) setEmptyBit(b bool) {
 	} else {
 		this.buffer[this.marker] &= ^uint64(1)
 	}
+
+	// Keep the cached counts in sync with the marker word we just changed
+	this.updateMarkerCounts()
 }
 
 func (this *cursor) setEmptyCount(n int64) {
 	this.buffer[this.marker] |= ShiftedLargestRunningLengthCount
 	this.buffer[this.marker] &= (uint64(n) << 1) | NotShiftedLargestRunningLengthCount
+
+	// Keep the cached counts in sync with the marker word we just changed
+	this.updateMarkerCounts()
 }
 
 // size returns the size in uncompressed words represented by this running length word
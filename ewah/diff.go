@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff lists the differences between two bitmaps A and B
+type Diff struct {
+	// OnlyInA are the first positions set in A but not in B, and OnlyInACount how many there are in all.
+	// Same for OnlyInB.
+	OnlyInA      []int64
+	OnlyInACount int64
+	OnlyInB      []int64
+	OnlyInBCount int64
+
+	SizeA, SizeB int64
+}
+
+// DiffReport compares the bitmap (A) with other (B), and returns the first limit positions set in only one
+// of them, with the total counts. A negative limit returns all of them. The error is the one of AndNotChecked.
+func (this *Ewah) DiffReport(other *Ewah, limit int) (Diff, error) {
+	d := Diff{
+		SizeA: this.sizeInBits,
+		SizeB: other.sizeInBits,
+	}
+
+	onlyInA, err := this.AndNotChecked(other)
+	if err != nil {
+		return Diff{}, err
+	}
+	onlyInB, err := other.AndNotChecked(this)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	d.OnlyInA, d.OnlyInACount = firstPositions(onlyInA.(*Ewah), limit)
+	d.OnlyInB, d.OnlyInBCount = firstPositions(onlyInB.(*Ewah), limit)
+
+	return d, nil
+}
+
+// Equal returns true if the bitmaps have the same bits set. Their sizes may differ.
+func (this Diff) Equal() bool {
+	return this.OnlyInACount == 0 && this.OnlyInBCount == 0
+}
+
+// String returns the report, in a few lines
+func (this Diff) String() string {
+	if this.Equal() {
+		return fmt.Sprintf("same bits set (sizes %d and %d)", this.SizeA, this.SizeB)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "sizes %d and %d\n", this.SizeA, this.SizeB)
+	fmt.Fprintf(&sb, "only in A: %d %s\n", this.OnlyInACount, positions(this.OnlyInA, this.OnlyInACount))
+	fmt.Fprintf(&sb, "only in B: %d %s", this.OnlyInBCount, positions(this.OnlyInB, this.OnlyInBCount))
+
+	return sb.String()
+}
+
+// Comparer returns a function telling if two bitmaps have the same size and the same bits set, however
+// they're encoded. It's meant for go-cmp, without depending on it:
+//
+//	cmp.Equal(got, want, cmp.Comparer(ewah.Comparer()))
+func Comparer() func(a, b *Ewah) bool {
+	return func(a, b *Ewah) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+
+		if a.sizeInBits != b.sizeInBits {
+			return false
+		}
+
+		d, err := a.DiffReport(b, 0)
+		return err == nil && d.Equal()
+	}
+}
+
+//
+// Not-exported functions
+//
+
+// firstPositions returns the first limit positions set in e, or all of them if limit is negative, and the
+// cardinality of e
+func firstPositions(e *Ewah, limit int) ([]int64, int64) {
+	var first []int64
+	for it := e.Iterator(); it.HasNext() && (limit < 0 || len(first) < limit); {
+		first = append(first, it.Next())
+	}
+
+	return first, e.Cardinality()
+}
+
+// positions formats the positions listed out of count, like [1 2 3 ...]
+func positions(first []int64, count int64) string {
+	s := fmt.Sprint(first)
+	if int64(len(first)) < count {
+		s = s[:len(s)-1] + " ...]"
+	}
+
+	return s
+}
@@ -0,0 +1,22 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewah implements the Enhanced Word-Aligned Hybrid (EWAH) bitmap compression, with 64-bit words.
+//
+// A nil *Ewah is an empty bitmap for the methods that only read it: Get, GetChecked, Size, SizeInWords,
+// LogicalBits, CompressedWords, Cardinality, Iterator, Equal, Clone, Options, MarshalBinary, MarshalCpp,
+// and And, AndNot, Or and Xor with their variants. A nil operand of the operations, or of Copy, is an empty bitmap too. The methods
+// that modify the bitmap still need a non-nil one.
+//
+// Set and the operations come in two more flavors than the ones of bitmap.Bitmap, which return nil when
+// they fail: SetChecked, AndChecked and the other Checked methods return an error, for services, and
+// MustSet, MustAnd and the other Must methods panic with it, and can be chained, for scripts and tests.
+//
+// The package builds with TinyGo, and for WebAssembly, so code running in a browser can decode and query
+// the bitmaps of a backend. With TinyGo, or with the purego build tag, it doesn't use unsafe: ViewCpp then
+// copies the words instead of reading them in place. The package has no large static tables, and decoding
+// only allocates memory in proportion to the size of its input, once the sizes of the header are checked.
+package ewah
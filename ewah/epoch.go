@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"github.com/reducedb/bitmap"
+	"sync"
+	"sync/atomic"
+)
+
+// Epochs publishes read-only bitmaps that are replaced over time, like Atomic, but also tells when an old
+// one isn't used anymore. Each published bitmap comes with a release function, called once the bitmap has
+// been replaced and all the readers that acquired it have released it, so a bitmap whose buffer is a view
+// of a mapped file or a pooled buffer can be unmapped or recycled without pulling it from under a reader.
+type Epochs struct {
+	mu      sync.RWMutex
+	current *Epoch
+}
+
+// Epoch is a published bitmap, held by a reader between Acquire and Release
+type Epoch struct {
+	r       bitmap.Reader
+	release func()
+
+	// refs counts the readers, plus one while the epoch is the current one
+	refs int64
+}
+
+// NewEpochs returns an Epochs publishing r, whose release function is called once r is no longer used. r
+// must not be modified afterwards. release may be nil.
+func NewEpochs(r bitmap.Reader, release func()) *Epochs {
+	return &Epochs{
+		current: newEpoch(r, release),
+	}
+}
+
+// Acquire returns the bitmap published last. The caller must call Release when it's done with it, and
+// must not use it afterwards.
+func (this *Epochs) Acquire() *Epoch {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	atomic.AddInt64(&this.current.refs, 1)
+
+	return this.current
+}
+
+// Swap publishes r in place of the current bitmap. Readers acquiring the bitmap afterwards get r, and the
+// release function of the previous bitmap is called once all the readers that acquired it released it,
+// possibly right away, from the goroutine of the last Release.
+func (this *Epochs) Swap(r bitmap.Reader, release func()) {
+	e := newEpoch(r, release)
+
+	this.mu.Lock()
+	old := this.current
+	this.current = e
+	this.mu.Unlock()
+
+	old.Release()
+}
+
+// Close releases the current bitmap. Epochs must not be used afterwards.
+func (this *Epochs) Close() {
+	this.mu.Lock()
+	old := this.current
+	this.current = nil
+	this.mu.Unlock()
+
+	if old != nil {
+		old.Release()
+	}
+}
+
+// Reader returns the bitmap of the epoch
+func (this *Epoch) Reader() bitmap.Reader {
+	return this.r
+}
+
+// Release tells that the caller is done with the bitmap
+func (this *Epoch) Release() {
+	n := atomic.AddInt64(&this.refs, -1)
+
+	if n < 0 {
+		panic("ewah: Epoch released more times than it was acquired")
+	}
+
+	if n == 0 && this.release != nil {
+		this.release()
+	}
+}
+
+//
+// Not-exported functions
+//
+
+func newEpoch(r bitmap.Reader, release func()) *Epoch {
+	return &Epoch{
+		r:       r,
+		release: release,
+		refs:    1,
+	}
+}
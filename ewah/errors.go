@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import "errors"
+
+// The errors returned by the package match one of these with errors.Is, so callers can tell the failures
+// apart without looking at the messages, which say more about what went wrong.
+var (
+	// ErrOutOfOrder is returned when a bit is set before the last bit set, since bits must be set in
+	// ascending order
+	ErrOutOfOrder = errors.New("ewah: bits must be set in ascending order")
+
+	// ErrOutOfRange is returned for positions or sizes the bitmaps or their encodings can't hold
+	ErrOutOfRange = errors.New("ewah: position or size out of range")
+
+	// ErrIncompatibleBitmap is returned when an operand of an operation can't be converted to an *Ewah,
+	// because it's too large
+	ErrIncompatibleBitmap = errors.New("ewah: operand can't be converted to an *Ewah")
+
+	// ErrCorruptData is returned when an encoded bitmap, or the words of a bitmap, are not valid
+	ErrCorruptData = errors.New("ewah: corrupt data")
+
+	// ErrReadOnly is returned when a bitmap made read-only with SetReadOnly is modified
+	ErrReadOnly = errors.New("ewah: read-only bitmap")
+
+	// ErrAliased is returned by AliasCheck when bitmaps share memory they shouldn't
+	ErrAliased = errors.New("ewah: bitmaps share memory")
+
+	// ErrInputTooLarge is returned by DeserializeLimited for encoded bitmaps with more words than its limit
+	ErrInputTooLarge = errors.New("ewah: encoded bitmap exceeds the size limit")
+
+	// ErrResultTooLarge is returned when the estimated size of the result of an operation exceeds the budget
+	// set with SetMaxResultWords
+	ErrResultTooLarge = errors.New("ewah: estimated result size exceeds the configured budget")
+
+	// ErrChecksumMismatch is returned when an encoded bitmap doesn't end with the checksum of its content,
+	// see Options.Checksum
+	ErrChecksumMismatch = errors.New("ewah: checksum mismatch")
+)
+
+//
+// Not-exported functions
+//
+
+// kindError is an error with its own message, that errors.Is matches with the sentinel error of its kind
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (this *kindError) Error() string {
+	return this.msg
+}
+
+func (this *kindError) Unwrap() error {
+	return this.kind
+}
+
+// newError returns an error with the message, of the kind of the sentinel error
+func newError(kind error, msg string) error {
+	return &kindError{kind, msg}
+}
@@ -7,10 +7,11 @@
 package ewah
 
 import (
-	"errors"
 	"fmt"
 	"github.com/reducedb/bitmap"
 	"math"
+	"reflect"
+	"sync/atomic"
 )
 
 const (
@@ -40,7 +41,7 @@ type Ewah struct {
 	// buffer representing the bitmap
 	buffer []uint64
 
-	// whether we adjust after some aggregation by adding in zeroes
+	// whether we adjust after some aggregation by adding in zeroes, unless Options.NoPadding is set
 	adjustContainerSizeWhenAggregating bool
 
 	// getCursor remembers the last search position and try to search from there for the next one
@@ -49,12 +50,48 @@ type Ewah struct {
 
 	// setCursor remembers the last set position and move forward from there
 	setCursor *cursor
+
+	// trace receives the structural changes of the bitmap when it's set, see SetTrace
+	trace func(format string, args ...interface{})
+
+	// cow is true when the buffer is shared with a snapshot, so it must be copied before it's modified. It's
+	// atomic since taking a snapshot sets it, and readers of a frozen bitmap may all take snapshots at once.
+	cow atomic.Bool
+
+	// readOnly is set by SetReadOnly, after which the bitmap can't be modified
+	readOnly atomic.Bool
+
+	// setMode is what Set does with the positions before the last bit set, and pending the positions kept
+	// aside with SetBuffered, until Flush
+	setMode SetMode
+	pending []int64
+
+	// checksum is true when the encodings of the bitmap end with a checksum, see Options.Checksum
+	checksum bool
 }
 
+// ewahBytes and cursorBytes are the sizes of the structures, for HeapBytes
+var (
+	ewahBytes   = int64(reflect.TypeOf((*Ewah)(nil)).Elem().Size())
+	cursorBytes = int64(reflect.TypeOf((*cursor)(nil)).Elem().Size())
+)
+
 var _ bitmap.Bitmap = (*Ewah)(nil)
+var _ bitmap.Serializable = (*Ewah)(nil)
 var _ BitmapStorage = (*Ewah)(nil)
 
+func init() {
+	bitmap.Register("ewah", New)
+}
+
+// New returns an empty bitmap, as a bitmap.Bitmap, for the code written against the interface and the
+// registry. Use NewEwah to get an *Ewah.
 func New() bitmap.Bitmap {
+	return NewEwah()
+}
+
+// NewEwah returns an empty bitmap
+func NewEwah() *Ewah {
 	ewah := new(Ewah)
 
 	ewah.Reset()
@@ -62,9 +99,67 @@ func New() bitmap.Bitmap {
 	return ewah
 }
 
+// FromWords returns a bitmap of sizeInBits bits, with the bits of the uncompressed words, the first bit
+// being the lowest bit of words[0]. The bits of the last word past the size are ignored. It returns nil if
+// there are not enough words for the size, or the size is out of the range Set supports.
+func FromWords(words []uint64, sizeInBits int64) *Ewah {
+	n := (sizeInBits + wordInBits - 1) / wordInBits
+	if sizeInBits < 0 || sizeInBits > math.MaxInt32-wordInBits+1 || n > int64(len(words)) {
+		return nil
+	}
+
+	e := NewEwah()
+	for k, w := range words[:n] {
+		if k == int(n-1) && sizeInBits%wordInBits != 0 {
+			w &= uint64(1)<<uint64(sizeInBits%wordInBits) - 1
+		}
+		e.add(w)
+	}
+	e.sizeInBits = sizeInBits
+
+	return e
+}
+
+// FromCompressed returns a bitmap of sizeInBits bits, with the compressed words returned by AppendWords,
+// which it copies. Words that are not valid, or a size that's out of range, return an error matching
+// ErrCorruptData.
+func FromCompressed(words []uint64, sizeInBits int64) (*Ewah, error) {
+	if len(words) == 0 || int64(len(words)) > math.MaxInt32 || sizeInBits < 0 || sizeInBits > math.MaxUint32 {
+		return nil, newError(ErrCorruptData, "ewah/FromCompressed: invalid sizes")
+	}
+
+	sizeInWords := int64(len(words))
+	buffer := make([]uint64, sizeInWords)
+	copy(buffer, words)
+
+	last, _, err := scanMarkers(buffer, sizeInWords)
+	if err != nil {
+		return nil, newError(ErrCorruptData, "ewah/FromCompressed: "+err.Error())
+	}
+
+	e := NewEwah()
+	e.load(buffer, sizeInWords, sizeInBits, last, false)
+
+	return e, nil
+}
+
 // Set sets the bit at position i to true (1). The bits must be set in ascending order. For example, set(15)
-// then set(7) will fail.
+// then set(7) will fail, unless the OutOfOrder option of the bitmap says otherwise.
 func (this *Ewah) Set(i int64) bitmap.Bitmap {
+	if this.SetChecked(i) != nil {
+		return nil
+	}
+
+	return this
+}
+
+// SetChecked is the same as Set, but it reports why the bit can't be set: ErrOutOfRange for a position past
+// the largest one, or ErrOutOfOrder for a position before the last bit set.
+func (this *Ewah) SetChecked(i int64) error {
+	if err := this.checkWritable("SetChecked"); err != nil {
+		return err
+	}
+
 	// According to @lemire: https://github.com/lemire/javaewah/issues/23#issuecomment-23998948
 	// In the current version, the range of allowable values for the set method is [0,Integer.MAX_VALUE - 64].
 	// (If you use the 32-bit EWAH, the answer is slightly different [0,Integer.MAX_VALUE - 32].)
@@ -72,14 +167,17 @@ func (this *Ewah) Set(i int64) bitmap.Bitmap {
 	// If you want to use a bitmap having few values over a wide range, it is wasted effort.
 	// You are better off using a different data structure.
 	if i > math.MaxInt32-wordInBits || i < 0 {
-		return nil
+		return newError(ErrOutOfRange, fmt.Sprintf("ewah/Set: position %d out of range", i))
 	}
 
-	// If i is less than sizeInBits, then we are trying to set a previous bit, which is not allowed
+	// If i is less than sizeInBits, then we are trying to set a previous bit, which is only allowed by
+	// some of the modes
 	if i < this.sizeInBits {
-		return nil
+		return this.setOutOfOrder(i)
 	}
 
+	this.ensureOwned()
+
 	// Distance of the bit from the active word in the buffer
 	// We want to know this so we can decide whether we need to add some empty words to pad the bitmap,
 	// or update the bit in the current word
@@ -99,14 +197,14 @@ func (this *Ewah) Set(i int64) bitmap.Bitmap {
 		// Once we padded the bitmap with empty words, then we can add a new literal word at the end
 		this.addLiteralWord(uint64(1) << uint64((i % wordInBits)))
 
-		return this
+		return nil
 	}
 
 	// Now we know dist == 0 since it can't be < 0 (can't set a bit past the current active bit)
 	if this.setCursor.literalCount() == 0 {
 		this.setCursor.setEmptyCount(this.setCursor.emptyCount() - 1)
 		this.addLiteralWord(1 << uint64(i%wordInBits))
-		return this
+		return nil
 	}
 
 	this.buffer[this.actualSizeInWords-1] |= 1 << uint64(i%wordInBits)
@@ -121,80 +219,205 @@ func (this *Ewah) Set(i int64) bitmap.Bitmap {
 		this.setCursor.quickUpdate(this.buffer, this.actualSizeInWords)
 	}
 
+	return nil
+}
+
+// SetChanged is the same as SetChecked, but it also reports whether the bit changed, so the callers
+// keeping counts don't need to call Get first. Setting a bit that's already set, even before the last bit
+// set, doesn't change it and is not an error. Setting a bit set to 0 before the last bit set still fails
+// with ErrOutOfOrder, unless the OutOfOrder option of the bitmap says otherwise.
+func (this *Ewah) SetChanged(i int64) (changed bool, err error) {
+	if err := this.checkWritable("SetChanged"); err != nil {
+		return false, err
+	}
+
+	if i >= 0 && i < this.sizeInBits && this.Get(i) {
+		return false, nil
+	}
+
+	if err := this.SetChecked(i); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetRange sets all the bits from start (inclusive) to end (exclusive) to true (1). Like Set, the range must
+// start after the last bit set. Whole words are added as a run of 1's instead of one bit at a time.
+func (this *Ewah) SetRange(start, end int64) bitmap.Bitmap {
+	if end <= start || start < this.sizeInBits || end-1 > math.MaxInt32-wordInBits || this.IsReadOnly() {
+		return nil
+	}
+
+	this.ensureOwned()
+
+	i := start
+	for ; i < end && (i == start || i%wordInBits != 0); i++ {
+		this.Set(i)
+	}
+
+	if n := (end - i) / wordInBits; n > 0 {
+		this.addStreamOfEmptyWords(true, n)
+		i += n * wordInBits
+	}
+
+	for ; i < end; i++ {
+		this.Set(i)
+	}
+
 	return this
 }
 
+// Get returns true if the bit at position i is set. The positions out of the bitmap, below 0 or at or past
+// Size, are not set. Use GetChecked to tell them apart from the bits set to 0.
 func (this *Ewah) Get(i int64) bool {
-	if i < 0 || i > this.sizeInBits {
+	if this == nil || i < 0 || i >= this.sizeInBits {
 		return false
 	}
 
+	this.Flush()
+
 	wordToCheck := i / wordInBits
 	bitInWord := uint64(i % wordInBits)
 
+	// The marker word under the cursor may have been extended by the set cursor since the last Get, so
+	// make sure we are not looking at stale counts
+	this.getCursor.updateMarkerCounts()
+
 	// If the word to check is before the the words already checked then let's update the buffer
 	if wordToCheck < this.getCursor.totalChecked {
-		//fmt.Printf("ewah.go/Get: reset ---> wordToCheck = %d, bitInWord = %d, size = %d\n---> %v\n", wordToCheck, bitInWord, this.SizeInWords(), this.getCursor)
 		this.getCursor.reset(this.buffer, this.actualSizeInWords)
 	}
 
-	//fmt.Printf("ewah.go/Get: ---> wordToCheck = %d, bitInWord = %d\n", wordToCheck, bitInWord)
-	//this.printDetails()
-
 	for this.getCursor.totalChecked <= wordToCheck && !this.getCursor.end() {
-		//fmt.Println("ewah.go/Get: cursor =", this.getCursor)
-
-		emptyRemaining := this.getCursor.emptyRemaining()
-
-		if wordToCheck < this.getCursor.totalChecked+emptyRemaining {
-			//fmt.Println("ewah.go/Get: inside empty words,", this.getCursor.emptyBit())
-			return this.getCursor.emptyBit()
+		if emptyRemaining := this.getCursor.emptyRemaining(); emptyRemaining > 0 {
+			if wordToCheck < this.getCursor.totalChecked+emptyRemaining {
+				return this.getCursor.emptyBit()
+			}
+
+			// If the marker has no literal words, this takes us to the next marker, which may start with
+			// some empty words of its own, so we start over
+			this.getCursor.moveForward(emptyRemaining)
+			continue
 		}
 
-		this.getCursor.moveForward(emptyRemaining)
+		if literalRemaining := this.getCursor.literalRemaining(); literalRemaining > 0 {
+			if wordToCheck < this.getCursor.totalChecked+literalRemaining {
+				n := this.getCursor.marker + this.getCursor.literalChecked + (wordToCheck - this.getCursor.totalChecked) + 1
+				return this.buffer[n]&(uint64(1)<<bitInWord) != 0
+			}
 
-		//fmt.Printf("ewah.go/Get: after move forward %d empty words, cursor = %v\n", emptyRemaining, this.getCursor)
-
-		literalRemaining := this.getCursor.literalRemaining()
-
-		if wordToCheck < this.getCursor.totalChecked+literalRemaining {
-			//i := this.getCursor.marker + (wordToCheck - this.getCursor.totalChecked) + 1
-			//fmt.Printf("%4d: %20d %064b\n", i, uint64(this.buffer[i]), uint64(this.buffer[i]))
-			b := this.buffer[this.getCursor.marker+(wordToCheck-this.getCursor.totalChecked)+1]&(uint64(1)<<bitInWord) != 0
-			//fmt.Printf("ewah.go/Get: inside literal words and it's %t\n", b)
-			return b
+			this.getCursor.moveForward(literalRemaining)
+			continue
 		}
 
-		this.getCursor.moveForward(literalRemaining)
-		//fmt.Printf("ewah.go/Get: after move forward %d literal words, cursor = %v\n", literalRemaining, this.getCursor)
+		// Nothing left in this marker, so let's go to the next one
+		if this.getCursor.nextMarker() != nil {
+			break
+		}
 	}
 
 	return false
 }
 
+// GetChecked is the same as Get, but it returns an error matching ErrOutOfRange for positions below 0, or
+// at or past Size.
+func (this *Ewah) GetChecked(i int64) (bool, error) {
+	if size := this.Size(); i < 0 || i >= size {
+		return false, newError(ErrOutOfRange, fmt.Sprintf("ewah/GetChecked: position %d out of the %d bits of the bitmap", i, size))
+	}
+
+	return this.Get(i), nil
+}
+
 // Returns the size in bits of the *uncompressed* bitmap represented by this compressed bitmap.
-// Initially, the sizeInBits is zero. It is extended automatically when you set bits to true.
+// Initially, the sizeInBits is zero. It is extended automatically when you set bits to true. It's the same
+// as LogicalBits.
 func (this *Ewah) Size() int64 {
+	if this == nil {
+		return 0
+	}
+
 	return this.sizeInBits
 }
 
-// Report the *compressed* size of the bitmap (equivalent to memory usage, after accounting for some overhead).
+// Report the *compressed* size of the bitmap, 8 bytes per compressed word. It's not the memory used by the
+// bitmap, which HeapBytes returns.
 func (this *Ewah) SizeInBytes() int64 {
-	return this.actualSizeInWords * (wordInBits / 8)
+	return this.CompressedWords() * (wordInBits / 8)
 }
 
+// SizeInWords is the same as CompressedWords
 func (this *Ewah) SizeInWords() int64 {
+	return this.CompressedWords()
+}
+
+// LogicalBits returns the number of bits of the uncompressed bitmap, from the first one to the last bit
+// set, or further after some operations. It's the same as Size.
+func (this *Ewah) LogicalBits() int64 {
+	return this.Size()
+}
+
+// CompressedWords returns the number of words used to encode the bitmap, which is what MarshalBinary
+// writes, and the operations take a time proportional to. An empty bitmap has 1 word.
+func (this *Ewah) CompressedWords() int64 {
+	if this == nil {
+		return 1
+	}
+
 	return this.actualSizeInWords
 }
 
+// AppendWords appends the compressed words of the bitmap to dst, and returns the extended slice. With the
+// size of the bitmap, they're what FromCompressed takes to build it again.
+func (this *Ewah) AppendWords(dst []uint64) []uint64 {
+	this = this.orEmpty()
+	return append(dst, this.buffer[:this.actualSizeInWords]...)
+}
+
+// BufferCapacityWords returns the number of words the buffer can hold before it has to grow. It's at least
+// CompressedWords.
+func (this *Ewah) BufferCapacityWords() int64 {
+	if this == nil {
+		return 0
+	}
+
+	return int64(len(this.buffer))
+}
+
+// HeapBytes returns an estimate of the memory used by the bitmap: the bitmap itself, its cursors and the
+// whole capacity of its buffer. A buffer shared with snapshots is counted by each of them.
+func (this *Ewah) HeapBytes() int64 {
+	if this == nil {
+		return 0
+	}
+
+	return ewahBytes + 2*cursorBytes + 8*int64(cap(this.buffer))
+}
+
 func (this *Ewah) Clear() {
 	this.Reset()
 }
 
 func (this *Ewah) Reset() {
+	if this.IsReadOnly() {
+		return
+	}
+
 	this.actualSizeInWords = 1
 	this.sizeInBits = 0
-	this.adjustContainerSizeWhenAggregating = true
+	this.pending = nil
+
+	// The first reset initializes the bitmap, the next ones keep its options
+	if this.setCursor == nil {
+		this.adjustContainerSizeWhenAggregating = true
+	}
+
+	// Don't write over the buffer of a snapshot
+	if this.cow.Load() {
+		this.buffer = nil
+		this.cow.Store(false)
+	}
 
 	if this.buffer == nil {
 		this.buffer = make([]uint64, defaultBufferSize)
@@ -216,61 +439,135 @@ func (this *Ewah) Reset() {
 
 }
 
+// Swap exchanges the content of the bitmaps, with the positions kept aside by SetBuffered, the mode of Set
+// and the function of SetTrace, and returns the bitmap. It returns nil if one of them is read-only.
 func (this *Ewah) Swap(other *Ewah) bitmap.Bitmap {
+	if this.IsReadOnly() || other.IsReadOnly() {
+		return nil
+	}
+
 	this.buffer, other.buffer = other.buffer, this.buffer
+	this.pending, other.pending = other.pending, this.pending
+	this.setMode, other.setMode = other.setMode, this.setMode
+	this.trace, other.trace = other.trace, this.trace
 	this.actualSizeInWords, other.actualSizeInWords = other.actualSizeInWords, this.actualSizeInWords
 	this.sizeInBits, other.sizeInBits = other.sizeInBits, this.sizeInBits
+	cow := this.cow.Load()
+	this.cow.Store(other.cow.Load())
+	other.cow.Store(cow)
 
 	s1, s2 := this.setCursor.marker, other.setCursor.marker
-	g1, g2 := this.getCursor.marker, other.getCursor.marker
 
+	// The get cursors can't be carried over since resetting the marker loses the number of words
+	// checked before it, so they just start over from the beginning.
 	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, s2)
-	this.getCursor.resetMarker(this.buffer, this.actualSizeInWords, g2)
+	this.getCursor.reset(this.buffer, this.actualSizeInWords)
 	other.setCursor.resetMarker(other.buffer, other.actualSizeInWords, s1)
-	other.getCursor.resetMarker(other.buffer, other.actualSizeInWords, g1)
+	other.getCursor.reset(other.buffer, other.actualSizeInWords)
 
 	return this
 }
 
+// Clone returns a copy of the bitmap that doesn't share anything with it: its buffer is a new one, with a
+// capacity of exactly the words used, and so are its cursors. The positions kept aside by SetBuffered are
+// copied as they are, not merged, so Clone only reads the bitmap, and can run at the same time as other
+// readers that don't move the cursors, like Freeze, Snapshot, Cardinality or the Iterator, on a bitmap
+// that's no longer modified. These other readers merge the positions kept aside, which modifies the bitmap:
+// a bitmap with the SetBuffered mode must be flushed before it's shared.
 func (this *Ewah) Clone() bitmap.Bitmap {
-	c := New().(*Ewah)
-	c.reserve(int32(this.actualSizeInWords))
-	copy(c.buffer, this.buffer)
-	c.actualSizeInWords = this.actualSizeInWords
-	c.sizeInBits = this.sizeInBits
+	if this == nil {
+		return NewEwah()
+	}
 
-	c.setCursor.resetMarker(c.buffer, c.actualSizeInWords, this.setCursor.marker)
-	c.getCursor.resetMarker(c.buffer, c.actualSizeInWords, this.getCursor.marker)
-	c.getCursor.totalChecked = this.getCursor.totalChecked
+	c := NewWithOptions(this.Options())
+	c.load(this.copyWords(), this.actualSizeInWords, this.sizeInBits, this.setCursor.marker, false)
+	c.pending = append([]int64(nil), this.pending...)
 
 	return c
 }
 
+// Copy replaces the content of the bitmap with a copy of other, and returns the bitmap. Like with Clone, the
+// buffer is a new one, with a capacity of exactly the words used, so nothing is shared with other, and
+// modifying one never changes the other. Other implementations of bitmap.Bitmap are converted bit by bit,
+// like the operands of the operations. It returns nil, leaving the bitmap untouched, if other is nil.
 func (this *Ewah) Copy(other bitmap.Bitmap) bitmap.Bitmap {
-	o := other.(*Ewah)
-	this.buffer = make([]uint64, o.SizeInWords())
-	copy(this.buffer, o.buffer)
-	this.actualSizeInWords = o.SizeInWords()
-	this.sizeInBits = o.Size()
+	o, err := toEwah(other, "Copy")
+	if err != nil || this.IsReadOnly() {
+		return nil
+	}
 
-	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, o.setCursor.marker)
-	this.getCursor.resetMarker(this.buffer, this.actualSizeInWords, o.getCursor.marker)
-	this.getCursor.totalChecked = o.getCursor.totalChecked
+	this.load(o.copyWords(), o.actualSizeInWords, o.sizeInBits, o.setCursor.marker, false)
 
 	return this
 }
 
-func (this *Ewah) Equal(other bitmap.Bitmap) bool {
-	if other == nil {
-		return false
+// CopyFrom is the same as Copy, but it reuses the buffer of the bitmap when it's large enough, and it's not
+// shared with a snapshot or a frame, so copying bitmaps of similar sizes in the same one doesn't allocate.
+// The capacity is then the one of the buffer reused. The bitmap never shares its buffer with other. It
+// returns an error matching ErrIncompatibleBitmap if other is nil or can't be converted.
+func (this *Ewah) CopyFrom(other bitmap.Bitmap) error {
+	if err := this.checkWritable("CopyFrom"); err != nil {
+		return err
 	}
 
-	o := other.(*Ewah)
-	if this.Size() != o.Size() {
-		return false
+	o, err := toEwah(other, "CopyFrom")
+	if err != nil {
+		return err
+	}
+	if o == this {
+		return nil
+	}
+
+	buffer := this.buffer
+	if this.cow.Load() || int64(len(buffer)) < o.actualSizeInWords {
+		buffer = make([]uint64, o.actualSizeInWords)
+	}
+
+	copy(buffer, o.buffer[:o.actualSizeInWords])
+	this.load(buffer, o.actualSizeInWords, o.sizeInBits, o.setCursor.marker, false)
+
+	return nil
+}
+
+// Snapshot returns a read-only copy of the bitmap in constant time. The snapshot shares the buffer with the
+// bitmap, which copies it the next time it's modified, so later changes are not seen by the snapshot. Each
+// snapshot has its own cursors, so a snapshot can be used by another goroutine than the bitmap, but like any
+// bitmap, it must not be used by several goroutines at the same time. Take one snapshot per reader instead.
+func (this *Ewah) Snapshot() *Ewah {
+	this.Flush()
+
+	// Only write the flag if needed, so taking snapshots of a snapshot doesn't write anything
+	if !this.cow.Load() {
+		this.cow.Store(true)
 	}
 
-	//fmt.Printf("ewah.go/Equal: sizeInWords = %d, this.cap = %d, o.cap = %d\n", this.SizeInWords(), cap(this.buffer), cap(o.buffer))
+	buffer := this.buffer[:this.actualSizeInWords:this.actualSizeInWords]
+
+	s := &Ewah{
+		actualSizeInWords:                  this.actualSizeInWords,
+		sizeInBits:                         this.sizeInBits,
+		buffer:                             buffer,
+		adjustContainerSizeWhenAggregating: this.adjustContainerSizeWhenAggregating,
+		setMode:                            this.setMode,
+		checksum:                           this.checksum,
+		getCursor:                          newCursor(buffer, this.actualSizeInWords),
+		setCursor:                          newCursor(buffer, this.actualSizeInWords),
+	}
+	s.cow.Store(true)
+	s.setCursor.resetMarker(buffer, this.actualSizeInWords, this.setCursor.marker)
+
+	return s
+}
+
+// Equal returns true if other has the same size and the same words. Other implementations of bitmap.Bitmap
+// are converted first, like the operands of the operations.
+func (this *Ewah) Equal(other bitmap.Bitmap) bool {
+	this = this.orEmpty()
+
+	o, err := toEwah(other, "Equal")
+	if err != nil || this.Size() != o.Size() || this.actualSizeInWords != o.actualSizeInWords {
+		return false
+	}
 
 	for i, v := range this.buffer[:this.actualSizeInWords] {
 		if o.buffer[i] != v {
@@ -281,16 +578,20 @@ func (this *Ewah) Equal(other bitmap.Bitmap) bool {
 }
 
 func (this *Ewah) Cardinality() int64 {
+	if this == nil {
+		return 0
+	}
+
+	this.Flush()
+
 	n := int64(0)
 	c := newCursor(this.buffer, this.actualSizeInWords)
 
 	for !c.end() {
-		//fmt.Printf("ewah.go/Cardinality: cursor = %v\n", c)
 		if c.emptyBit() {
 			n += wordInBits * c.emptyCount()
 		}
 
-		//fmt.Printf("ewah.go/Cardinality: #literalWords = %d\n", c.literalCount())
 		for j := int64(0); j < c.literalCount(); j++ {
 			n += int64(popcount_3(uint64(c.getLiteralWordAt(j))))
 		}
@@ -305,6 +606,7 @@ func (this *Ewah) Cardinality() int64 {
 
 func (this *Ewah) PrintStats(details bool) {
 	fmt.Printf("actualSizeInWords = %d, actualSizeInBits = %d, cardinality = %d\n", this.SizeInWords(), this.Size(), this.Cardinality())
+	fmt.Printf("%+v\n", this.Stats())
 
 	if details {
 		this.printDetails()
@@ -312,13 +614,7 @@ func (this *Ewah) PrintStats(details bool) {
 }
 
 func (this *Ewah) printDetails() {
-	//fmt.Println("                           0123456789012345678901234567890123456789012345678901234567890123")
 	fmt.Println("                           3210987654321098765432109876543210987654321098765432109876543210")
-	/*
-		for i := int64(0); i < this.actualSizeInWords; i++ {
-			fmt.Printf("%4d: %20d %064b\n", i, uint64(this.buffer[i]), uint64(this.buffer[i]))
-		}
-	*/
 	for i, v := range this.buffer[:this.actualSizeInWords] {
 		fmt.Printf("%4d: %20d %064b\n", i, uint64(v), uint64(v))
 	}
@@ -328,6 +624,60 @@ func (this *Ewah) printDetails() {
 // Not-exported functions
 //
 
+// maxPending is the number of positions kept aside with SetBuffered before they're merged into the bitmap
+const maxPending = 4096
+
+// setOutOfOrder sets the bit at position i, before the last bit set, as the mode of the bitmap says
+func (this *Ewah) setOutOfOrder(i int64) error {
+	switch {
+	case this.setMode == SetIgnoreSet && this.Get(i):
+		return nil
+	case this.setMode == SetBuffered:
+		if this.pending = append(this.pending, i); len(this.pending) >= maxPending {
+			this.Flush()
+		}
+		return nil
+	}
+
+	return newError(ErrOutOfOrder, fmt.Sprintf("ewah/Set: position %d after %d", i, this.sizeInBits-1))
+}
+
+// orEmpty returns the bitmap, or a new empty bitmap if it's nil, for the read-only methods
+func (this *Ewah) orEmpty() *Ewah {
+	if this == nil {
+		return NewEwah()
+	}
+
+	// The operations and encoders all start here, so they see the positions kept aside
+	this.Flush()
+
+	return this
+}
+
+// ensureOwned copies the buffer if it's shared with a snapshot. It must be called before the buffer is
+// modified in place.
+func (this *Ewah) ensureOwned() {
+	if !this.cow.Load() {
+		return
+	}
+
+	size := this.actualSizeInWords * 2
+	if size < int64(defaultBufferSize) {
+		size = int64(defaultBufferSize)
+	}
+
+	buffer := make([]uint64, size)
+	copy(buffer, this.buffer[:this.actualSizeInWords])
+	this.buffer = buffer
+	this.cow.Store(false)
+	if this.trace != nil {
+		this.tracef("buffer shared with a snapshot copied, %d words", size)
+	}
+
+	this.setCursor.quickUpdate(this.buffer, this.actualSizeInWords)
+	this.getCursor.quickUpdate(this.buffer, this.actualSizeInWords)
+}
+
 // add is used to add words directly to the bitmap.
 func (this *Ewah) add(newdata uint64) {
 	this.addSignificantBits(newdata, wordInBits)
@@ -335,11 +685,10 @@ func (this *Ewah) add(newdata uint64) {
 
 // addWithSize adds words directly to the bitmap, but with the number of significant bits specified.
 func (this *Ewah) addSignificantBits(newdata uint64, bitsthatmatter int64) {
-	//fmt.Printf("ewah.go/addSignificantBits:    %064b\n----\n", newdata)
 	this.sizeInBits += bitsthatmatter
 	if newdata == 0 {
 		this.addEmptyWord(false)
-	} else if newdata == ^uint64(1) {
+	} else if newdata == ^uint64(0) {
 		this.addEmptyWord(true)
 	} else {
 		this.addLiteralWord(newdata)
@@ -357,6 +706,9 @@ func (this *Ewah) addEmptyWord(v bool) {
 
 	if noLiteralWord && this.setCursor.emptyBit() == v && uint64(runlen) < LargestRunningLengthCount {
 		this.setCursor.setEmptyCount(runlen + 1)
+		if this.trace != nil {
+			this.tracef("run of %v extended to %d words", v, runlen+1)
+		}
 		return
 	}
 
@@ -364,13 +716,14 @@ func (this *Ewah) addEmptyWord(v bool) {
 	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
 	this.setCursor.setEmptyBit(v)
 	this.setCursor.setEmptyCount(1)
+	if this.trace != nil {
+		this.tracef("run of %v started with a new marker word at %d", v, this.actualSizeInWords-1)
+	}
 }
 
 // addLiteralWord adds a literal word to the bitmap.
 func (this *Ewah) addLiteralWord(newdata uint64) {
-	//fmt.Printf("ewah.go/addLiteralWord: newdata = %064b\n", newdata)
 	numberSoFar := this.setCursor.literalCount()
-	//fmt.Printf("ewah.go/addLiteralWord: numberSoFar = %d\n", numberSoFar)
 	if uint64(numberSoFar) >= LargestLiteralCount {
 		this.pushback(0)
 		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
@@ -378,8 +731,10 @@ func (this *Ewah) addLiteralWord(newdata uint64) {
 		this.pushback(newdata)
 	}
 	this.setCursor.setLiteralCount(numberSoFar + 1)
-	//fmt.Printf("ewah.go/addLiteralWord: getNumberOfLiteralWords = %d\n", this.setCursor.literalCount())
 	this.pushback(newdata)
+	if this.trace != nil {
+		this.tracef("literal word %#016x added at %d", newdata, this.actualSizeInWords-1)
+	}
 }
 
 // addStreamOfLiteralWords adds several literal words at a time, might be faster
@@ -393,7 +748,6 @@ func (this *Ewah) addStreamOfLiteralWords(data []uint64, start, number int32) {
 		this.setCursor.setLiteralCount(numberOfLiteralWords + whatWeCanAdd)
 		leftOverNumber -= whatWeCanAdd
 
-		//fmt.Printf("ewah.go/addStreamOfLiteralWords: #ofLiteral = %d, leftOver = %d, whatWeCanAdd = %d\n", numberOfLiteralWords, leftOverNumber, whatWeCanAdd)
 		this.pushbackMultiple(data, start, int32(whatWeCanAdd))
 		this.sizeInBits += whatWeCanAdd * wordInBits
 
@@ -403,7 +757,9 @@ func (this *Ewah) addStreamOfLiteralWords(data []uint64, start, number int32) {
 		}
 	}
 
-	//fmt.Printf("ewah.go/addStreamOfLiteralWords: sizeinbits = %d, actuaSizeInWords = %d\n", this.sizeInBits, this.actualSizeInWords)
+	if this.trace != nil {
+		this.tracef("%d literal words added, %d words used", number, this.actualSizeInWords)
+	}
 }
 
 // addStreamOfEmptyWords adds several empty words at a time, might be faster
@@ -413,6 +769,7 @@ func (this *Ewah) addStreamOfEmptyWords(v bool, number int64) {
 	}
 
 	this.sizeInBits += number * wordInBits
+	n := number
 
 	if this.setCursor.emptyBit() != v && this.setCursor.size() == 0 {
 		this.setCursor.setEmptyBit(v)
@@ -425,7 +782,7 @@ func (this *Ewah) addStreamOfEmptyWords(v bool, number int64) {
 	}
 
 	runlen := this.setCursor.emptyCount()
-	whatWeCanAdd := int64(math.Min(float64(number), float64(LargestLiteralCount-uint64(runlen))))
+	whatWeCanAdd := int64(math.Min(float64(number), float64(LargestRunningLengthCount-uint64(runlen))))
 
 	this.setCursor.setEmptyCount(runlen + whatWeCanAdd)
 	number -= whatWeCanAdd
@@ -450,11 +807,15 @@ func (this *Ewah) addStreamOfEmptyWords(v bool, number int64) {
 		this.setCursor.setEmptyCount(number)
 	}
 
-	//fmt.Printf("ewah.go/addStreamOfEmptyWords: sizeinbits = %d, actuaSizeInWords = %d\n", this.sizeInBits, this.actualSizeInWords)
+	if this.trace != nil {
+		this.tracef("run of %d words of %v added, %d words used", n, v, this.actualSizeInWords)
+	}
 }
 
 // fastAddStreamOfEmptyWords adds many zeroes and ones faster. This does not update sizeInBits
 func (this *Ewah) fastAddStreamOfEmptyWords(v bool, number int64) {
+	n := number
+
 	if this.setCursor.emptyBit() != v && this.setCursor.size() == 0 {
 		this.setCursor.setEmptyBit(v)
 	} else if this.setCursor.literalCount() != 0 || this.setCursor.emptyBit() != v {
@@ -466,7 +827,7 @@ func (this *Ewah) fastAddStreamOfEmptyWords(v bool, number int64) {
 	}
 
 	runlen := this.setCursor.emptyCount()
-	whatWeCanAdd := int64(math.Min(float64(number), float64(LargestLiteralCount-uint64(runlen))))
+	whatWeCanAdd := int64(math.Min(float64(number), float64(LargestRunningLengthCount-uint64(runlen))))
 
 	this.setCursor.setEmptyCount(runlen + whatWeCanAdd)
 	number -= whatWeCanAdd
@@ -491,6 +852,10 @@ func (this *Ewah) fastAddStreamOfEmptyWords(v bool, number int64) {
 
 		this.setCursor.setEmptyCount(number)
 	}
+
+	if this.trace != nil {
+		this.tracef("run of %d words of %v added, %d words used", n, v, this.actualSizeInWords)
+	}
 }
 
 // addStreamOfNegatedLiteralWords is similar to addStreamOfLiteralWords except the words are negated
@@ -547,7 +912,6 @@ func (this *Ewah) pushbackMultiple(data []uint64, start, number int32) {
 	// to allocate
 	nextSize := this.actualSizeInWords + int64(number)
 	bufferCap := int64(cap(this.buffer))
-	//fmt.Printf("ewah.go/pushbackMultiple: start = %d, number = %d, size = %d, cap = %d\n", start, number, this.actualSizeInWords, bufferCap)
 	if nextSize >= bufferCap {
 		var newSize int64
 		if nextSize < 32768 {
@@ -561,8 +925,10 @@ func (this *Ewah) pushbackMultiple(data []uint64, start, number int32) {
 		oldBuffer := this.buffer
 		this.buffer = make([]uint64, newSize)
 		copy(this.buffer, oldBuffer)
+		if this.trace != nil {
+			this.tracef("buffer grown from %d to %d words", len(oldBuffer), newSize)
+		}
 	}
-	//fmt.Printf("ewah.go/pushbackMultiple: copy(this.buffer[%d:], data[%d:%d]), cap=%d", this.actualSizeInWords, start, start+number, cap(this.buffer))
 	copy(this.buffer[this.actualSizeInWords:], data[start:start+number])
 	this.actualSizeInWords += int64(number)
 
@@ -573,11 +939,10 @@ func (this *Ewah) pushbackMultiple(data []uint64, start, number int32) {
 
 func (this *Ewah) setSizeInBits(size int64) error {
 	if (size+wordInBits-1)/wordInBits != (this.sizeInBits+wordInBits-1)/wordInBits {
-		return errors.New("ewah/setSizeInBits: You can only reduce the size of teh bitmap within the scope of the last word. To extend the bitmap, please call setSizeInBitsWithDefault(int32)")
+		return newError(ErrOutOfRange, "ewah/setSizeInBits: You can only reduce the size of teh bitmap within the scope of the last word. To extend the bitmap, please call setSizeInBitsWithDefault(int32)")
 	}
 
 	this.sizeInBits = size
-	//fmt.Println("ewah.go/setSizeInBits: size =", this.sizeInBits)
 	return nil
 }
 
@@ -590,6 +955,8 @@ func (this *Ewah) setSizeInBitsWithDefault(size int64, defaultValue bool) bool {
 		return false
 	}
 
+	this.ensureOwned()
+
 	if !defaultValue {
 		this.extendEmptyBits(this, this.sizeInBits, size)
 	} else {
@@ -617,12 +984,21 @@ func (this *Ewah) extendEmptyBits(storage *Ewah, currentSize, newSize int64) {
 
 }
 
+// copyWords returns a copy of the words used, in a buffer of exactly their size
+func (this *Ewah) copyWords() []uint64 {
+	buffer := make([]uint64, this.actualSizeInWords)
+	copy(buffer, this.buffer[:this.actualSizeInWords])
+
+	return buffer
+}
+
 func (this *Ewah) reserve(size int32) bitmap.Bitmap {
 	if size > int32(len(this.buffer)) {
 		oldBuffer := this.buffer
 		this.buffer = make([]uint64, size)
 		copy(this.buffer, oldBuffer)
 		this.setCursor.reset(this.buffer, this.actualSizeInWords)
+		this.getCursor.reset(this.buffer, this.actualSizeInWords)
 	}
 
 	return this
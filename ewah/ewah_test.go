@@ -7,10 +7,26 @@
 package ewah
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitmaptest"
+	"github.com/reducedb/bitmap/bitset"
+	"math"
 	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 const (
@@ -43,8 +59,8 @@ func init() {
 		nums10[i] = bit
 	}
 
-	bm = New().(*Ewah)
-	bm10 = New().(*Ewah)
+	bm = NewEwah()
+	bm10 = NewEwah()
 }
 
 func TestSet(t *testing.T) {
@@ -64,7 +80,7 @@ func TestSet(t *testing.T) {
 
 func TestSet2(t *testing.T) {
 	rs := []int64{10, 100, 1000, 10000, 100000}
-	bm2 := New().(*Ewah)
+	bm2 := NewEwah()
 
 	for r := range rs {
 		nums2 := make([]int64, count)
@@ -105,8 +121,8 @@ func TestGet(t *testing.T) {
 }
 
 func TestSwap(t *testing.T) {
-	bm2 := New().(*Ewah)
-	bm3 := New().(*Ewah)
+	bm2 := NewEwah()
+	bm3 := NewEwah()
 
 	bm2.Set(10)
 	bm2.Set(70)
@@ -144,6 +160,18 @@ func TestSwap(t *testing.T) {
 			t.Fatalf("Get(%d) failed, should be set\n", nums3[i])
 		}
 	}
+
+	// The positions kept aside by SetBuffered go with the bitmap they were set in
+	buffered := NewWithOptions(Options{OutOfOrder: SetBuffered}).MustSet(100).MustSet(7)
+	plain := NewEwah().MustSet(50)
+	plain.Swap(buffered)
+
+	if plain.Options().OutOfOrder != SetBuffered || buffered.Options().OutOfOrder != SetFail {
+		t.Fatalf("Swap should exchange the modes of Set, got %v and %v", plain.Options(), buffered.Options())
+	}
+	if plain.Cardinality() != 2 || !plain.Get(7) || !plain.Get(100) || buffered.Cardinality() != 1 || buffered.Get(7) {
+		t.Fatalf("Swap should exchange the positions kept aside, got %v and %v", plain, buffered)
+	}
 }
 
 func TestClone(t *testing.T) {
@@ -158,7 +186,7 @@ func TestClone(t *testing.T) {
 }
 
 func TestCopy(t *testing.T) {
-	bm2 := New().(*Ewah)
+	bm2 := NewEwah()
 	bm2.Copy(bm)
 
 	for i := 0; i < count; i++ {
@@ -170,8 +198,8 @@ func TestCopy(t *testing.T) {
 }
 
 func TestAnd(t *testing.T) {
-	bm2 := New().(*Ewah)
-	bm3 := New().(*Ewah)
+	bm2 := NewEwah()
+	bm3 := NewEwah()
 
 	bm2.Set(10)
 	bm2.Set(70)
@@ -203,8 +231,8 @@ func TestAnd(t *testing.T) {
 }
 
 func TestAndNot(t *testing.T) {
-	bm2 := New().(*Ewah)
-	bm3 := New().(*Ewah)
+	bm2 := NewEwah()
+	bm3 := NewEwah()
 
 	bm2.Set(10)
 	bm2.Set(70)
@@ -247,8 +275,8 @@ func TestAndNot(t *testing.T) {
 }
 
 func TestOr(t *testing.T) {
-	bm2 := New().(*Ewah)
-	bm3 := New().(*Ewah)
+	bm2 := NewEwah()
+	bm3 := NewEwah()
 
 	bm2.Set(10)
 	bm2.Set(70)
@@ -275,7 +303,7 @@ func TestOr(t *testing.T) {
 }
 
 func TestNot(t *testing.T) {
-	bm2 := New().(*Ewah)
+	bm2 := NewEwah()
 
 	bm2.Set(10)
 	bm2.Set(100)
@@ -299,8 +327,8 @@ func TestNot(t *testing.T) {
 }
 
 func TestXor(t *testing.T) {
-	bm2 := New().(*Ewah)
-	bm3 := New().(*Ewah)
+	bm2 := NewEwah()
+	bm3 := NewEwah()
 
 	bm2.Set(10)
 	bm2.Set(70)
@@ -334,6 +362,3066 @@ func TestXor(t *testing.T) {
 	}
 }
 
+func TestMaxResultWords(t *testing.T) {
+	bm2 := NewEwah()
+	bm3 := NewEwah()
+
+	for i := int64(0); i < 1000; i += 70 {
+		bm2.Set(i)
+		bm3.Set(i + 1)
+	}
+
+	SetMaxResultWords(bm2.SizeInWords())
+	defer SetMaxResultWords(0)
+
+	if _, err := bm2.OrChecked(bm3); !errors.Is(err, ErrResultTooLarge) {
+		t.Fatalf("OrChecked() error = %v, should be ErrResultTooLarge", err)
+	}
+
+	if bm2.Or(bm3) != nil {
+		t.Fatal("Or() should return nil when the result is too large")
+	}
+
+	c := bm2.Cardinality()
+	if _, err := bm2.NotChecked(); !errors.Is(err, ErrResultTooLarge) {
+		t.Fatalf("NotChecked() error = %v, should be ErrResultTooLarge", err)
+	}
+
+	if bm2.Cardinality() != c {
+		t.Fatal("NotChecked() should not modify the bitmap when the result is too large")
+	}
+
+	SetMaxResultWords(bm2.SizeInWords() + bm3.SizeInWords())
+
+	bm4, err := bm2.OrChecked(bm3)
+	if err != nil {
+		t.Fatalf("OrChecked() error = %v", err)
+	}
+
+	if bm4.Cardinality() != bm2.Cardinality()+bm3.Cardinality() {
+		t.Fatalf("Cardinality %d != %d", bm4.Cardinality(), bm2.Cardinality()+bm3.Cardinality())
+	}
+}
+
+// TestCrossCheckBitset compares the results of the bitwise operations against the uncompressed
+// bitset implementation, using bitmaps of various densities.
+func TestIterator(t *testing.T) {
+	rand.Seed(int64(c2))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	for n := 0; n < 100; n++ {
+		e, b := crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+
+		// Negating gives us some long runs of 1's
+		if n%2 == 1 {
+			e.Not()
+			b.Not()
+		}
+
+		it := e.Iterator()
+		for i := int64(0); i < b.Size(); i++ {
+			if b.Get(i) {
+				if next := it.Next(); next != i {
+					t.Fatalf("Iterator returned %d, should be %d", next, i)
+				}
+			}
+		}
+
+		if it.HasNext() || it.Next() != -1 {
+			t.Fatal("Iterator should be done")
+		}
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	for n := 0; n < 100; n++ {
+		e := NewEwah()
+		b := bitset.New().(*bitset.Bitset)
+
+		bit := int64(0)
+		for k := rand.Intn(20); k > 0; k-- {
+			start := bit + int64(rand.Intn(200))
+			end := start + int64(rand.Intn(500)+1)
+
+			if e.SetRange(start, end) == nil {
+				t.Fatalf("Problem setting range [%d, %d)", start, end)
+			}
+			for i := start; i < end; i++ {
+				b.Set(i)
+			}
+
+			bit = end
+		}
+
+		bitmaptest.Check(t, "SetRange", e, b)
+	}
+
+	if New().Set(100).(*Ewah).SetRange(50, 60) != nil {
+		t.Fatal("Setting a range out of order should fail")
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	// JavaEWAH's serialization of a bitmap with bits 0 and 200 set
+	java := []byte{
+		0, 0, 0, 201, // size in bits
+		0, 0, 0, 4, // size in words
+		0, 0, 0, 2, 0, 0, 0, 0, // marker: 1 literal word
+		0, 0, 0, 0, 0, 0, 0, 1, // literal word
+		0, 0, 0, 2, 0, 0, 0, 4, // marker: 2 empty words, 1 literal word
+		0, 0, 0, 0, 0, 0, 1, 0, // literal word
+		0, 0, 0, 2, // position of the last marker
+	}
+
+	bm := New().Set(0).Set(200).(*Ewah)
+	if b, err := bm.MarshalBinary(); err != nil || string(b) != string(java) {
+		t.Fatalf("MarshalBinary = %v, %v, should be %v", b, err, java)
+	}
+
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	for n := 0; n < 100; n++ {
+		e, _ := crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+		if n%2 == 1 {
+			e.Not()
+		}
+
+		b, err := e.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := NewEwah()
+		if err := d.UnmarshalBinary(b); err != nil || !d.Equal(e) || d.Cardinality() != e.Cardinality() {
+			t.Fatalf("UnmarshalBinary should give back the original bitmap, err = %v", err)
+		}
+
+		// We should be able to keep setting bits after decoding
+		if next := e.Size() + 100; !d.Set(next).Equal(e.Set(next)) {
+			t.Fatal("Problem setting bits after UnmarshalBinary")
+		}
+
+		if d.UnmarshalBinary(b[:len(b)-1]) == nil {
+			t.Fatal("UnmarshalBinary should fail on a truncated buffer")
+		}
+	}
+}
+
+func TestMarshalSegmented(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	for n := 0; n < 50; n++ {
+		e, b := crossCheckBitmaps(gaps[n%len(gaps)])
+		if n%3 == 0 {
+			e.Not()
+			b.Not()
+		}
+
+		segmentBits := []int64{64, 1000, 1 << 16}[n%3]
+		data, err := e.MarshalSegmented(segmentBits, n%4)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e2 := NewEwah()
+		if err := e2.UnmarshalSegmented(data, n%3); err != nil {
+			t.Fatal(err)
+		}
+
+		bitmaptest.Check(t, "UnmarshalSegmented", e2, b)
+
+		// The decoded bitmap can be extended
+		e2.Set(e2.Size() + 100)
+		if !e2.Get(b.Size()+100) || e2.Cardinality() != b.Cardinality()+1 {
+			t.Fatal("UnmarshalSegmented: can't set bits after decoding")
+		}
+
+		if err := e2.UnmarshalSegmented(data[:len(data)-1], 0); err == nil {
+			t.Fatal("UnmarshalSegmented should fail on a truncated buffer")
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	rand.Seed(int64(c2))
+
+	for n := 0; n < 100; n++ {
+		e, b := crossCheckBitmaps(10)
+
+		s1 := e.Snapshot()
+		s2 := s1.Snapshot()
+
+		// Changing the bitmap or a snapshot must not change the others
+		e.Set(e.Size() + 10).Not()
+		s2.SetRange(s2.Size()+1, s2.Size()+200)
+
+		bitmaptest.Check(t, "Snapshot", s1, b)
+
+		if c := e.Cardinality(); c != e.Size()-b.Cardinality()-1 {
+			t.Fatalf("Snapshot: cardinality of the negated bitmap %d != %d", c, e.Size()-b.Cardinality()-1)
+		}
+
+		if c := s2.Cardinality(); c != b.Cardinality()+199 {
+			t.Fatalf("Snapshot: cardinality of the extended snapshot %d != %d", c, b.Cardinality()+199)
+		}
+	}
+}
+
+func TestToBloom(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	e, b := crossCheckBitmaps(100)
+	f := e.ToBloom(0.01)
+
+	fp := 0
+	for i := int64(0); i < b.Size(); i++ {
+		switch {
+		case b.Get(i) && !f.Test(i):
+			t.Fatalf("ToBloom: bit %d is set but not in the filter", i)
+		case !b.Get(i) && f.Test(i):
+			fp++
+		}
+	}
+
+	if rate := float64(fp) / float64(b.Size()-b.Cardinality()); rate > 0.02 {
+		t.Fatalf("ToBloom: false positive rate %f for 0.01", rate)
+	}
+}
+
+func TestToHLL(t *testing.T) {
+	bms := make([]*Ewah, 100)
+	for k := range bms {
+		bms[k] = NewEwah()
+		for i := int64(k * 1000); i < int64(k*1000+5000); i += 2 {
+			bms[k].Set(i)
+		}
+	}
+
+	s := bms[0].ToHLL(14)
+	for _, e := range bms[1:] {
+		if err := s.Merge(e.ToHLL(14)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	union, _ := orAll(bms)
+	if n := union.Cardinality(); math.Abs(float64(s.Count()-n)) > 0.05*float64(n) {
+		t.Fatalf("ToHLL: estimate %d for %d bits", s.Count(), n)
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	e := NewEwah()
+	a := NewAtomic(nil)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// Every published version has all the multiples of 3 up to its size
+				s := a.LoadSnapshot()
+				for i := int64(0); i < s.Size(); i += 3 {
+					if !s.Get(i) {
+						t.Errorf("Atomic: bit %d should be set", i)
+						return
+					}
+				}
+				s.Set(s.Size() + 1)
+			}
+		}()
+	}
+
+	for i := int64(0); i < 30000; i += 3 {
+		e.Set(i)
+		if i%3000 == 0 {
+			a.SwapAtomic(e)
+		}
+	}
+
+	old := a.SwapAtomic(e)
+	close(done)
+	wg.Wait()
+
+	if old.Size() != 27001 || a.LoadSnapshot().Cardinality() != 10000 {
+		t.Fatalf("Atomic: old size %d, cardinality %d", old.Size(), a.LoadSnapshot().Cardinality())
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	rand.Seed(int64(c2))
+
+	b := NewBuilder(4)
+	bs := bitset.New().(*bitset.Bitset)
+
+	positions := make([]int64, 20000)
+	for k := range positions {
+		positions[k] = rand.Int63n(1000000)
+		bs.Set(positions[k])
+	}
+
+	// Each goroutine sets a quarter of the bits, in random order and with duplicates
+	var wg sync.WaitGroup
+	for k := 0; k < b.Shards(); k++ {
+		wg.Add(1)
+		go func(s *Shard, positions []int64) {
+			defer wg.Done()
+			for _, i := range positions {
+				s.Set(i)
+			}
+		}(b.Shard(k), positions[k*5000:(k+1)*5000])
+	}
+	wg.Wait()
+
+	e, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bitmaptest.Check(t, "Builder", e, bs)
+}
+
+func TestParallelOrAll(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	bms := make([]*Ewah, 1000)
+	b := bitset.New().(*bitset.Bitset)
+	for k := range bms {
+		bms[k] = NewEwah()
+		for i := int64(rand.Intn(1000)); i < 100000; i += int64(rand.Intn(5000) + 1) {
+			bms[k].Set(i)
+			b.Set(i)
+		}
+	}
+
+	for _, workers := range []int{0, 1, 3, 16} {
+		e, err := ParallelOrAll(context.Background(), bms, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bitmaptest.Check(t, "ParallelOrAll", e, b)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ParallelOrAll(ctx, bms, 4); err != context.Canceled {
+		t.Fatalf("ParallelOrAll should return context.Canceled, got %v", err)
+	}
+}
+
+func TestAndCtx(t *testing.T) {
+	rand.Seed(int64(c2))
+
+	for n := 0; n < 20; n++ {
+		e1, b1 := crossCheckBitmaps(1000)
+		e2, b2 := crossCheckBitmaps(1000)
+		e3, b3 := crossCheckBitmaps(1000)
+
+		e, err := e1.AndCtx(context.Background(), e2, e3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bitmaptest.Check(t, "AndCtx", e, b1.And(b2, b3))
+	}
+
+	// One bit every 200, so there's a marker word for each bit
+	e1, e2 := NewEwah(), NewEwah()
+	for i := int64(0); i < 10000000; i += 200 {
+		e1.Set(i)
+		e2.Set(i + 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := e1.AndCtx(ctx, e2); err != context.Canceled {
+		t.Fatalf("AndCtx should return context.Canceled, got %v", err)
+	}
+
+	it := e1.Iterator()
+	for i := 0; i < 2*ctxCheckInterval; i++ {
+		if _, err := it.NextCtx(ctx); err != nil {
+			if err != context.Canceled {
+				t.Fatalf("NextCtx should return context.Canceled, got %v", err)
+			}
+			return
+		}
+	}
+
+	t.Fatal("NextCtx should stop once the context is done")
+}
+
+func TestFreeze(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	for n := 0; n < 20; n++ {
+		e, b := crossCheckBitmaps(gaps[n%len(gaps)])
+		f := e.Freeze()
+
+		// Changing the bitmap must not change the frozen version
+		e.Set(e.Size() + 10).Not()
+
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if f.Cardinality() != b.Cardinality() {
+					t.Errorf("Freeze: Cardinality %d != %d", f.Cardinality(), b.Cardinality())
+				}
+				for i := int64(0); i < b.Size(); i++ {
+					if f.Get(i) != b.Get(i) {
+						t.Errorf("Freeze: Get(%d) = %t, should be %t", i, f.Get(i), b.Get(i))
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		bitmaptest.Check(t, "Freeze", f, b)
+		bitmaptest.Check(t, "Freeze", f.(*Frozen).Bitmap(), b)
+	}
+}
+
+func TestAsBytes(t *testing.T) {
+	e, b := crossCheckBitmaps(10)
+	f := e.Freeze().(*Frozen)
+
+	// The bytes must be the same for all readers, and not change with the bitmap
+	encoded := make([][]byte, 4)
+	var wg sync.WaitGroup
+	for r := range encoded {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			encoded[r] = f.AsBytes()
+		}(r)
+	}
+	e.Set(e.Size() + 10).Not()
+	wg.Wait()
+
+	for _, v := range encoded[1:] {
+		if &v[0] != &encoded[0][0] {
+			t.Fatal("AsBytes should always return the same bytes")
+		}
+	}
+
+	d := NewEwah()
+	if err := d.UnmarshalBinary(f.AsBytes()); err != nil {
+		t.Fatal(err)
+	}
+	bitmaptest.Check(t, "AsBytes", d, b)
+}
+
+func TestQueue(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	q := NewQueue(nil, 100)
+	b := bitset.New().(*bitset.Bitset)
+
+	for round := 0; round < 3; round++ {
+		positions := make([][]int64, 8)
+		for k := range positions {
+			for n := 0; n < 5000; n++ {
+				i := rand.Int63n(1000000)
+				positions[k] = append(positions[k], i)
+				b.Set(i)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, p := range positions {
+			wg.Add(1)
+			go func(p []int64) {
+				defer wg.Done()
+				for _, i := range p {
+					q.Set(i)
+				}
+			}(p)
+		}
+		wg.Wait()
+
+		e, err := q.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bitmaptest.Check(t, "Queue", e, b)
+	}
+
+	if e, err := q.Close(); err != nil || e.Cardinality() != b.Cardinality() {
+		t.Fatalf("Queue: Close returned %v", err)
+	}
+}
+
+func TestSharded(t *testing.T) {
+	rand.Seed(int64(c2))
+
+	sh := NewSharded(10000, 8)
+	b := bitset.New().(*bitset.Bitset)
+
+	// Writer k sets the bits of shards k and k+4, readers keep reading all the shards meanwhile
+	positions := make([][]int64, 4)
+	for k := range positions {
+		for _, base := range []int64{int64(k) * 10048, int64(k+4) * 10048} {
+			for i := base + int64(rand.Intn(50)); i < base+10048; i += int64(rand.Intn(50) + 1) {
+				positions[k] = append(positions[k], i)
+				b.Set(i)
+			}
+		}
+	}
+
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				for i := int64(0); i < sh.Size(); i += 97 {
+					sh.Get(i)
+				}
+				sh.Cardinality()
+
+				// Without preemption, as on WebAssembly, the writers only run when the readers yield
+				runtime.Gosched()
+			}
+		}()
+	}
+
+	for _, p := range positions {
+		writers.Add(1)
+		go func(p []int64) {
+			defer writers.Done()
+			for _, i := range p {
+				if sh.Set(i) == nil {
+					t.Errorf("Sharded: Set(%d) failed", i)
+					return
+				}
+			}
+		}(p)
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	bitmaptest.Check(t, "Sharded", sh, b)
+	bitmaptest.Check(t, "Sharded.Bitmap", sh.Bitmap(), b)
+
+	if sh.Set(8*10048) != nil || sh.Set(b.Size()-1) != nil {
+		t.Fatal("Sharded: Set should fail out of range or out of order")
+	}
+}
+
+func TestAllPartial(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	bms := make([]*Ewah, 200)
+	or := bitset.New().(*bitset.Bitset)
+	and := bitset.New().(*bitset.Bitset)
+	for k := range bms {
+		e, b := crossCheckBitmaps(2)
+		if k < 3 {
+			// The first ones are intersected, and always have bits in common
+			e, b = NewEwah(), bitset.New().(*bitset.Bitset)
+			for i := int64(0); i < 1000; i += int64(k + 2) {
+				e.Set(i)
+				b.Set(i)
+			}
+		}
+
+		bms[k] = e
+		or = or.Or(b).(*bitset.Bitset)
+		if k == 0 {
+			and = b
+		} else if k < 3 {
+			and = and.And(b).(*bitset.Bitset)
+		}
+	}
+
+	e, n, err := OrAllPartial(context.Background(), bms)
+	if err != nil || n != len(bms) {
+		t.Fatalf("OrAllPartial: %d bitmaps folded, %v", n, err)
+	}
+	bitmaptest.Check(t, "OrAllPartial", e, or)
+
+	e, n, err = AndAllPartial(context.Background(), bms[:3])
+	if err != nil || n != 3 || e.Cardinality() != and.Cardinality() || e.Cardinality() == 0 {
+		t.Fatalf("AndAllPartial: %d bitmaps folded, %v", n, err)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	if e, n, err = OrAllPartial(ctx, bms); err != ErrDeadlineExceeded || n != 0 || e.Cardinality() != 0 {
+		t.Fatalf("OrAllPartial: %d bitmaps folded, %v", n, err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	pool := NewPool(2)
+	defer pool.Close()
+
+	old := DefaultPool()
+	SetDefaultPool(pool)
+	defer SetDefaultPool(old)
+
+	// No more goroutines than the pool has, whatever the caller asks for
+	var running, max int64
+	var mu sync.Mutex
+	err := parallelFor(100, 16, func(k int) error {
+		mu.Lock()
+		if running++; running > max {
+			max = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max > 2 {
+		t.Fatalf("%d tasks ran at once on a pool of 2", max)
+	}
+
+	bms := make([]*Ewah, 300)
+	b := bitset.New().(*bitset.Bitset)
+	for k := range bms {
+		bms[k] = NewEwah()
+		for i := int64(rand.Intn(1000)); i < 100000; i += int64(rand.Intn(5000) + 1) {
+			bms[k].Set(i)
+			b.Set(i)
+		}
+	}
+
+	// Concurrent operations share the pool
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			e, err := ParallelOrAll(context.Background(), bms, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			data, err := e.MarshalSegmented(1024, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			e2 := NewEwah()
+			if err := e2.UnmarshalSegmented(data, 0); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !e2.Equal(e) {
+				t.Error("The bitmap decoded on the pool is different from the one encoded")
+			}
+		}()
+	}
+	wg.Wait()
+
+	e, _ := ParallelOrAll(context.Background(), bms, 0)
+	bitmaptest.Check(t, "ParallelOrAll on a pool", e, b)
+}
+
+func TestEpochs(t *testing.T) {
+	var released [3]int32
+	release := func(k int) func() {
+		return func() { atomic.AddInt32(&released[k], 1) }
+	}
+
+	bms := make([]*Ewah, 3)
+	for k := range bms {
+		bms[k] = NewEwah()
+		bms[k].Set(int64(k))
+	}
+
+	epochs := NewEpochs(bms[0].Freeze(), release(0))
+
+	// A reader still holding the first bitmap keeps it from being released
+	e := epochs.Acquire()
+	epochs.Swap(bms[1].Freeze(), release(1))
+
+	if atomic.LoadInt32(&released[0]) != 0 {
+		t.Fatal("The bitmap was released while a reader held it")
+	}
+	if !e.Reader().Get(0) {
+		t.Fatal("The reader should still see the first bitmap")
+	}
+
+	e.Release()
+	if atomic.LoadInt32(&released[0]) != 1 {
+		t.Fatal("The bitmap should be released once the last reader is done")
+	}
+
+	// Readers race with swaps, and no bitmap is released while it's held
+	var flags sync.Map
+	swap := func() {
+		r, flag := bms[1].Freeze(), new(int32)
+		flags.Store(r, flag)
+		epochs.Swap(r, func() { atomic.StoreInt32(flag, 1) })
+	}
+	swap()
+
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for k := 0; k < 1000; k++ {
+				e := epochs.Acquire()
+				flag, _ := flags.Load(e.Reader())
+				if atomic.LoadInt32(flag.(*int32)) != 0 {
+					t.Error("A bitmap was released while a reader held it")
+				}
+				e.Release()
+			}
+		}()
+	}
+
+	for k := 0; k < 100; k++ {
+		swap()
+	}
+	wg.Wait()
+
+	epochs.Swap(bms[2].Freeze(), release(2))
+	epochs.Close()
+
+	if atomic.LoadInt32(&released[1]) != 1 || atomic.LoadInt32(&released[2]) != 1 {
+		t.Fatalf("Released %v, should be [1 1 1]", released)
+	}
+	flags.Range(func(r, flag interface{}) bool {
+		if atomic.LoadInt32(flag.(*int32)) != 1 {
+			t.Fatal("All the bitmaps swapped out should be released")
+		}
+		return true
+	})
+}
+
+func TestConcurrentClone(t *testing.T) {
+	e, b := crossCheckBitmaps(100)
+	f := e.Clone().(*Ewah).Freeze().(*Frozen)
+
+	// Clone, Freeze and Snapshot only read the bitmap, and run along with readers, under -race. e hasn't
+	// been frozen yet, so the goroutines race to be the first.
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+
+			for k := 0; k < 50; k++ {
+				var c bitmap.Reader
+				switch (n + k) % 5 {
+				case 0:
+					c = e.Clone()
+				case 1:
+					c = e.Freeze()
+				case 2:
+					c = f.Bitmap().Clone()
+				case 3:
+					c = f.Bitmap().Freeze()
+				case 4:
+					c = e.Snapshot()
+				}
+
+				if c.Cardinality() != b.Cardinality() || f.Cardinality() != b.Cardinality() {
+					t.Error("A copy taken during concurrent reads is different from the bitmap")
+					return
+				}
+
+				for it := e.Iterator(); it.HasNext(); {
+					if i := it.Next(); !f.Get(i) {
+						t.Errorf("Get(%d) failed, should be set", i)
+						return
+					}
+				}
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	bitmaptest.Check(t, "Clone", e.Clone(), b)
+}
+
+func TestStats(t *testing.T) {
+	e := NewEwah()
+	if s := e.Stats(); s.MarkerWords != 1 || s.RunWords != 0 || s.LiteralWords != 0 || s.CompressionRatio != 0 {
+		t.Fatalf("Stats of an empty bitmap: %+v", s)
+	}
+
+	// 10 empty words, a literal word, then 100 full words
+	e.Set(10*64 + 3)
+	for i := int64(11 * 64); i < 111*64; i++ {
+		e.Set(i)
+	}
+
+	s := e.Stats()
+	if s.RunWords != 110 || s.LongestRun != 100 {
+		t.Fatalf("RunWords %d != 110, or LongestRun %d != 100", s.RunWords, s.LongestRun)
+	}
+	if s.MarkerWords+s.LiteralWords != e.SizeInWords() || s.LiteralWords != 1 {
+		t.Fatalf("MarkerWords %d + LiteralWords %d != %d words", s.MarkerWords, s.LiteralWords, e.SizeInWords())
+	}
+	if s.CompressionRatio != float64(e.SizeInWords())/111 {
+		t.Fatalf("CompressionRatio %f != %d / 111", s.CompressionRatio, e.SizeInWords())
+	}
+	if s.BufferUtilization <= 0 || s.BufferUtilization > 1 {
+		t.Fatalf("BufferUtilization %f is out of ]0, 1]", s.BufferUtilization)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	e := NewEwah()
+	e.Set(1)
+	e.Set(5)
+	e.Set(64)
+
+	if s := fmt.Sprint(e); s != "ewah{size: 65, cardinality: 3, words: 3}" {
+		t.Fatalf("Sprint = %q", s)
+	}
+
+	if s := fmt.Sprintf("%v", e); s != e.String() {
+		t.Fatalf("%%v = %q, should be %q", s, e.String())
+	}
+
+	if s := fmt.Sprintf("%b", e); s != "[1 5 64]" {
+		t.Fatalf("%%b = %q, should be [1 5 64]", s)
+	}
+
+	if s := fmt.Sprintf("%+b", e); strings.Count(s, "\n") != int(e.SizeInWords()) {
+		t.Fatalf("%%+b should print %d words, got %q", e.SizeInWords(), s)
+	}
+}
+
+func TestRunHistogram(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		e, b := crossCheckBitmaps(n%5 + 1)
+
+		// Count the runs bit by bit
+		var expected RunHistogram
+		start := int64(0)
+		for i := int64(1); i <= b.Size(); i++ {
+			if i == b.Size() || b.Get(i) != b.Get(start) {
+				expected.add(b.Get(start), i-start)
+				start = i
+			}
+		}
+
+		h := e.RunHistogram()
+		if fmt.Sprint(h) != fmt.Sprint(expected) {
+			t.Fatalf("RunHistogram = %v, should be %v", h, expected)
+		}
+	}
+
+	// 1000 0's then 100 1's
+	e := NewEwah()
+	for i := int64(1000); i < 1100; i++ {
+		e.Set(i)
+	}
+
+	h := e.RunHistogram()
+	if len(h.Zeros) != 10 || h.Zeros[9] != 1 || len(h.Ones) != 7 || h.Ones[6] != 1 {
+		t.Fatalf("RunHistogram = %v", h)
+	}
+}
+
+func TestDensityProfile(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		e, b := crossCheckBitmaps(n%5 + 1)
+
+		for _, chunkBits := range []int64{1, 7, 64, 100, 1000} {
+			profile := e.DensityProfile(chunkBits)
+			if len(profile) != int((b.Size()+chunkBits-1)/chunkBits) {
+				t.Fatalf("%d chunks of %d bits for %d bits", len(profile), chunkBits, b.Size())
+			}
+
+			for k := range profile {
+				ones, size := int64(0), int64(0)
+				for i := int64(k) * chunkBits; i < int64(k+1)*chunkBits && i < b.Size(); i++ {
+					if b.Get(i) {
+						ones++
+					}
+					size++
+				}
+
+				if profile[k] != float64(ones)/float64(size) {
+					t.Fatalf("Chunk %d of %d bits: density %f != %d / %d", k, chunkBits, profile[k], ones, size)
+				}
+			}
+		}
+	}
+
+	// A run of 1's spread over several chunks
+	e := NewEwah()
+	for i := int64(0); i < 1000; i++ {
+		e.Set(i)
+	}
+	e.Set(1999)
+
+	profile := e.DensityProfile(300)
+	if fmt.Sprint(profile) != fmt.Sprint([]float64{1, 1, 1, 100.0 / 300, 0, 0, 1.0 / 200}) {
+		t.Fatalf("DensityProfile = %v", profile)
+	}
+
+	if e.DensityProfile(0) != nil {
+		t.Fatal("DensityProfile should return nil for empty chunks")
+	}
+}
+
+func TestHash64(t *testing.T) {
+	marker := func(v bool, runlen, literals uint64) uint64 {
+		rlw := runlen<<1 | literals<<uint32(1+RunningLengthBits)
+		if v {
+			rlw |= 1
+		}
+		return rlw
+	}
+
+	encoded := func(sizeInBits int64, words ...uint64) *Ewah {
+		e := NewEwah()
+		e.buffer = words
+		e.actualSizeInWords = int64(len(words))
+		e.sizeInBits = sizeInBits
+		return e
+	}
+
+	// Bit 130 and 192 to 259, encoded in several ways
+	e1 := NewEwah()
+	e1.Set(130)
+	for i := int64(192); i < 260; i++ {
+		e1.Set(i)
+	}
+
+	e2 := encoded(260, marker(false, 1, 0), marker(false, 1, 1), 1<<2, marker(true, 1, 1), 0xf)
+	e3 := encoded(260, marker(false, 0, 3), 0, 0, 1<<2, marker(true, 1, 1), 0xff)
+
+	if e1.Hash64() != e2.Hash64() || e1.Hash64() != e3.Hash64() {
+		t.Fatalf("Bitmaps with the same bits should have the same hash: %x, %x, %x", e1.Hash64(), e2.Hash64(), e3.Hash64())
+	}
+
+	// Different bits or sizes have different hashes
+	e4 := e1.Clone().(*Ewah)
+	e4.Set(300)
+	e5 := encoded(261, marker(false, 2, 1), 1<<2, marker(true, 1, 1), 0xf)
+
+	if e1.Hash64() == e4.Hash64() || e1.Hash64() == e5.Hash64() {
+		t.Fatal("Bitmaps with different bits or sizes should have different hashes")
+	}
+
+	for n := 0; n < 20; n++ {
+		e, _ := crossCheckBitmaps(n%5 + 1)
+		if e.Hash64() != e.Clone().(*Ewah).Hash64() || e.Hash64() != e.Or(New()).(*Ewah).Hash64() {
+			t.Fatal("A copy of a bitmap should have the same hash")
+		}
+	}
+}
+
+func TestDenseRegions(t *testing.T) {
+	e := NewEwah()
+
+	// 10 bits in [0, 100[, 50 in [200, 300[, 30 in [500, 600[, 50 in [900, 1000[
+	for _, r := range [][2]int64{{0, 10}, {200, 50}, {500, 30}, {900, 50}} {
+		for i := r[0]; i < r[0]+r[1]; i++ {
+			e.Set(i)
+		}
+	}
+
+	regions := e.DenseRegions(3, 100)
+	expected := []Region{{200, 50}, {900, 50}, {500, 30}}
+	if fmt.Sprint(regions) != fmt.Sprint(expected) {
+		t.Fatalf("DenseRegions = %v, should be %v", regions, expected)
+	}
+
+	if regions := e.DenseRegions(10, 100); len(regions) != 4 {
+		t.Fatalf("DenseRegions should only return the 4 windows with bits set, got %v", regions)
+	}
+
+	if e.DenseRegions(0, 100) != nil || e.DenseRegions(3, 0) != nil {
+		t.Fatal("DenseRegions should return nil for no region or empty windows")
+	}
+}
+
+func TestGapStats(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		e, b := crossCheckBitmaps(n%5 + 1)
+
+		var gaps []int64
+		last := int64(-1)
+		for i := int64(0); i < b.Size(); i++ {
+			if b.Get(i) {
+				if last >= 0 {
+					gaps = append(gaps, i-last)
+				}
+				last = i
+			}
+		}
+
+		g := e.GapStats()
+		if len(gaps) == 0 {
+			if g != (GapStats{}) {
+				t.Fatalf("GapStats = %+v, should be empty", g)
+			}
+			continue
+		}
+
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		sum := int64(0)
+		for _, d := range gaps {
+			sum += d
+		}
+
+		percentile := func(p float64) int64 {
+			return gaps[int(math.Ceil(p*float64(len(gaps))))-1]
+		}
+
+		expected := GapStats{
+			Count: int64(len(gaps)),
+			Min:   gaps[0],
+			Max:   gaps[len(gaps)-1],
+			Mean:  float64(sum) / float64(len(gaps)),
+			P50:   percentile(0.5),
+			P90:   percentile(0.9),
+			P99:   percentile(0.99),
+		}
+
+		if g.Count != expected.Count || g.Min != expected.Min || g.Max != expected.Max || math.Abs(g.Mean-expected.Mean) > 1e-9 ||
+			g.P50 != expected.P50 || g.P90 != expected.P90 || g.P99 != expected.P99 {
+			t.Fatalf("GapStats = %+v, should be %+v", g, expected)
+		}
+	}
+}
+
+func TestRankIndex(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		e, b := crossCheckBitmaps(n%5 + 1)
+
+		// Some long runs of 1's, and many literal words, so there are several blocks per marker
+		if n%2 == 0 {
+			for i := b.Size() + 100; i < b.Size()+10000; i++ {
+				if i%3 != 0 || i < b.Size()+1000 {
+					e.Set(i)
+				}
+			}
+			b = bitset.New().(*bitset.Bitset)
+			for it := e.Iterator(); it.HasNext(); {
+				b.Set(it.Next())
+			}
+		}
+
+		r := e.BuildRankIndex()
+		if r.Cardinality() != b.Cardinality() {
+			t.Fatalf("Cardinality %d != %d", r.Cardinality(), b.Cardinality())
+		}
+
+		rank := int64(0)
+		for i := int64(0); i < b.Size()+10; i++ {
+			if r.Rank(i) != rank {
+				t.Fatalf("Rank(%d) = %d, should be %d", i, r.Rank(i), rank)
+			}
+
+			if b.Get(i) {
+				if r.Select(rank) != i {
+					t.Fatalf("Select(%d) = %d, should be %d", rank, r.Select(rank), i)
+				}
+				rank++
+			}
+		}
+
+		if r.Select(rank) != -1 || r.Select(-1) != -1 {
+			t.Fatal("Select should return -1 for ranks out of range")
+		}
+	}
+}
+
+func TestPositionAtPercentile(t *testing.T) {
+	// The positions 0, 10, ..., 990
+	e := NewEwah()
+	for i := int64(0); i < 1000; i += 10 {
+		e.Set(i)
+	}
+
+	r := e.BuildRankIndex()
+	for _, c := range []struct {
+		p float64
+		i int64
+	}{{0, 0}, {1, 0}, {1.5, 10}, {50, 490}, {99, 980}, {100, 990}, {-1, -1}, {101, -1}} {
+		if i := r.PositionAtPercentile(c.p); i != c.i {
+			t.Fatalf("PositionAtPercentile(%f) = %d, should be %d", c.p, i, c.i)
+		}
+	}
+
+	if e.PositionAtPercentile(50) != 490 {
+		t.Fatalf("PositionAtPercentile(50) = %d, should be 490", e.PositionAtPercentile(50))
+	}
+
+	if NewEwah().PositionAtPercentile(50) != -1 {
+		t.Fatal("PositionAtPercentile should return -1 for an empty bitmap")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		e, _ := crossCheckBitmaps(n%5 + 1)
+		if err := e.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := e.MarshalBinary()
+		d := NewEwah()
+		if err := d.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		o, _ := crossCheckBitmaps(n%5 + 1)
+		for _, r := range []bitmap.Bitmap{e.Or(o), e.And(o), e.AndNot(o), e.Xor(o), e.Clone().Not(), e.Clone()} {
+			if err := r.(*Ewah).Validate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := NewEwah().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := func(f func(e *Ewah)) *Ewah {
+		e := NewEwah()
+		for i := int64(0); i < 1000; i += 3 {
+			e.Set(i)
+		}
+		f(e)
+		return e
+	}
+
+	for name, e := range map[string]*Ewah{
+		"literals past the end": corrupt(func(e *Ewah) { e.buffer[0] += 1 << uint32(1+RunningLengthBits) }),
+		"size too small":        corrupt(func(e *Ewah) { e.sizeInBits = 500 }),
+		"no words":              corrupt(func(e *Ewah) { e.actualSizeInWords = 0 }),
+		"words past the buffer": corrupt(func(e *Ewah) { e.actualSizeInWords = int64(len(e.buffer)) + 1 }),
+		"wrong last marker":     corrupt(func(e *Ewah) { e.setCursor.marker = 1 }),
+		"nil bitmap":            nil,
+	} {
+		if err := e.Validate(); !errors.Is(err, ErrCorruptData) {
+			t.Fatalf("Validate should fail with %s: %v", name, err)
+		}
+	}
+}
+
+func TestDiffReport(t *testing.T) {
+	a, b := NewEwah(), NewEwah()
+	for i := int64(0); i < 1000; i++ {
+		if i%2 == 0 {
+			a.Set(i)
+		}
+		if i%3 == 0 {
+			b.Set(i)
+		}
+	}
+
+	d, err := a.DiffReport(b, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(d.OnlyInA) != "[2 4 8]" || d.OnlyInACount != 333 {
+		t.Fatalf("Only in A: %v, %d", d.OnlyInA, d.OnlyInACount)
+	}
+	if fmt.Sprint(d.OnlyInB) != "[3 9 15]" || d.OnlyInBCount != 167 {
+		t.Fatalf("Only in B: %v, %d", d.OnlyInB, d.OnlyInBCount)
+	}
+	if d.Equal() {
+		t.Fatal("The bitmaps are different")
+	}
+
+	expected := "sizes 999 and 1000\nonly in A: 333 [2 4 8 ...]\nonly in B: 167 [3 9 15 ...]"
+	if d.String() != expected {
+		t.Fatalf("String() = %q, should be %q", d.String(), expected)
+	}
+
+	if d, _ := a.DiffReport(a.Clone().(*Ewah), 10); !d.Equal() || len(d.OnlyInA) != 0 {
+		t.Fatalf("A bitmap should have no difference with itself: %v", d)
+	}
+
+	if d, _ := a.DiffReport(b, -1); len(d.OnlyInA) != 333 || len(d.OnlyInB) != 167 {
+		t.Fatal("DiffReport should list all the positions with a negative limit")
+	}
+
+	equal := Comparer()
+	c := b.Or(a).(*Ewah).AndNot(a).(*Ewah).Or(a).(*Ewah)
+	if !equal(c, b.Or(a).(*Ewah)) || equal(a, b) || !equal(nil, nil) || equal(a, nil) {
+		t.Fatal("Comparer should compare the sizes and the bits set")
+	}
+
+	// AndNot never takes more words than its operands, so the budget of the results doesn't apply
+	SetMaxResultWords(2)
+	defer SetMaxResultWords(0)
+
+	if d, err := a.DiffReport(b, 3); err != nil || d.OnlyInACount != 333 || d.OnlyInBCount != 167 {
+		t.Fatalf("DiffReport with a result budget: %v, %v", d, err)
+	}
+}
+
+func TestEstimateCompressedSize(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		e, _ := crossCheckBitmaps(n%5 + 1)
+
+		// Bitmaps built with Set are canonical, so the estimate is exact
+		data, _ := e.MarshalBinary()
+		if size := e.EstimateCompressedSize(); size != int64(len(data)) {
+			t.Fatalf("EstimateCompressedSize = %d, should be %d", size, len(data))
+		}
+	}
+
+	// The same bits, with a run split in two and a full literal word
+	marker := func(v bool, runlen, literals uint64) uint64 {
+		rlw := runlen<<1 | literals<<uint32(1+RunningLengthBits)
+		if v {
+			rlw |= 1
+		}
+		return rlw
+	}
+
+	e := NewEwah()
+	e.buffer = []uint64{marker(false, 1, 0), marker(false, 1, 2), 1 << 2, ^uint64(0), marker(true, 1, 0)}
+	e.actualSizeInWords = int64(len(e.buffer))
+	e.sizeInBits = 5 * 64
+
+	// Canonical: a run of 2 empty words, a literal word, then a run of 2 full words
+	if size := e.EstimateCompressedSize(); size != 4+4+8*3+4 {
+		t.Fatalf("EstimateCompressedSize = %d, should be %d", size, 4+4+8*3+4)
+	}
+
+	if NewEwah().EstimateCompressedSize() != 4+4+8+4 {
+		t.Fatal("An empty bitmap has one marker word")
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	e := NewEwah()
+	for i := int64(0); i < 1000; i += 2 {
+		e.Set(i)
+	}
+
+	// One bit out of two: one bit of entropy per position
+	if h := e.Entropy(); math.Abs(h-999*-(500.0/999*math.Log2(500.0/999)+499.0/999*math.Log2(499.0/999))) > 1e-6 {
+		t.Fatalf("Entropy = %f", h)
+	}
+
+	if NewEwah().Entropy() != 0 {
+		t.Fatal("An empty bitmap has no entropy")
+	}
+}
+
+func TestCost(t *testing.T) {
+	// a has literal words in [0, 64000[, b in [64000, 128000[, c everywhere
+	a, b, c := NewEwah(), NewEwah(), NewEwah()
+	for i := int64(0); i < 128000; i += 3 {
+		if i < 64000 {
+			a.Set(i)
+		} else {
+			b.Set(i)
+		}
+		c.Set(i)
+	}
+
+	// a and b don't overlap, so And skips all the literal words
+	if n := a.CostAnd(b); n > 10 {
+		t.Fatalf("CostAnd of disjoint bitmaps = %d, should only read a few marker words", n)
+	}
+
+	// a and c overlap on 1000 words, which are read in both
+	if n := a.CostAnd(c); n < 2000 || n > 2010 {
+		t.Fatalf("CostAnd = %d, should be about 2000", n)
+	}
+
+	// Or reads everything
+	if n := a.CostOr(b); n != a.SizeInWords()+b.SizeInWords() {
+		t.Fatalf("CostOr = %d, should be %d", n, a.SizeInWords()+b.SizeInWords())
+	}
+	if n := a.CostOr(c); n != a.SizeInWords()+c.SizeInWords() {
+		t.Fatalf("CostOr = %d, should be %d", n, a.SizeInWords()+c.SizeInWords())
+	}
+
+	// Or skips the words under a run of 1's
+	ones := NewEwah()
+	for i := int64(0); i < 128000; i++ {
+		ones.Set(i)
+	}
+	if n := c.CostOr(ones); n > 10 {
+		t.Fatalf("CostOr with a run of 1's = %d, should only read a few marker words", n)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	marker := func(v bool, runlen, literals uint64) uint64 {
+		rlw := runlen<<1 | literals<<uint32(1+RunningLengthBits)
+		if v {
+			rlw |= 1
+		}
+		return rlw
+	}
+
+	encoded := func(sizeInBits int64, words ...uint64) *Ewah {
+		e := NewEwah()
+		e.buffer = words
+		e.actualSizeInWords = int64(len(words))
+		e.sizeInBits = sizeInBits
+		e.setCursor.resetMarker(e.buffer, e.actualSizeInWords, 0)
+		return e
+	}
+
+	// Bit 130 and 192 to 259
+	e := NewEwah()
+	e.Set(130)
+	for i := int64(192); i < 260; i++ {
+		e.Set(i)
+	}
+
+	if !e.IsCanonical() || !e.Canonical().Equal(e) {
+		t.Fatal("A bitmap built with Set should be canonical")
+	}
+
+	for _, x := range []*Ewah{
+		encoded(260, marker(false, 1, 0), marker(false, 1, 1), 1<<2, marker(true, 1, 1), 0xf),
+		encoded(260, marker(false, 0, 3), 0, 0, 1<<2, marker(true, 1, 1), 0xff),
+		encoded(260, marker(false, 2, 1), 1<<2, marker(true, 1, 1), 0xf, marker(false, 3, 0)),
+	} {
+		if x.IsCanonical() {
+			t.Fatal("A bitmap with extra words should not be canonical")
+		}
+
+		c := x.Canonical()
+		if !c.IsCanonical() || !c.Equal(e) {
+			t.Fatalf("Canonical form is different from the expected one:\n%+b\n%+b", c, e)
+		}
+
+		b1, _ := c.MarshalBinary()
+		b2, _ := e.MarshalBinary()
+		if !bytes.Equal(b1, b2) {
+			t.Fatal("Canonical forms should have the same bytes")
+		}
+
+		if err := c.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !NewEwah().IsCanonical() {
+		t.Fatal("An empty bitmap should be canonical")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var events []string
+	e := NewEwah()
+	e.SetTrace(func(format string, args ...interface{}) {
+		events = append(events, fmt.Sprintf(format, args...))
+	})
+
+	for i := int64(0); i < 200; i += 3 {
+		e.Set(i)
+	}
+	e.Set(10000)
+
+	for _, s := range []string{"literal word", "words of false", "buffer grown"} {
+		found := false
+		for _, ev := range events {
+			found = found || strings.Contains(ev, s)
+		}
+		if !found {
+			t.Errorf("no %q in the trace: %v", s, events)
+		}
+	}
+
+	n := len(events)
+	e.SetTrace(nil)
+	e.Set(20000)
+	if len(events) != n || e.Clone().(*Ewah).trace != nil {
+		t.Errorf("trace not turned off")
+	}
+}
+
+func TestWalkWords(t *testing.T) {
+	e := NewEwah()
+	e.Set(3)
+	e.SetRange(640, 1000)
+
+	var got []string
+	e.WalkWords(func(v bool, n int64) {
+		got = append(got, fmt.Sprintf("%v*%d", v, n))
+	}, func(w uint64) {
+		got = append(got, fmt.Sprintf("%#x", w))
+	})
+
+	if s := strings.Join(got, " "); s != "0x8 false*9 true*5 0xffffffffff" {
+		t.Errorf("WalkWords: %s", s)
+	}
+}
+
+func TestFromWords(t *testing.T) {
+	e := FromWords([]uint64{0, ^uint64(0), ^uint64(0), 0x5, 0xff}, 4*64+3)
+	if e == nil || e.Validate() != nil || e.Size() != 4*64+3 || e.Cardinality() != 128+2+3 {
+		t.Fatalf("FromWords: %v", e)
+	}
+
+	if !e.Get(64) || !e.Get(64*3+2) || e.Get(64*3+1) || e.Get(4*64+3) {
+		t.Errorf("FromWords: wrong bits %b", e)
+	}
+
+	if FromWords([]uint64{1}, 65) != nil || FromWords(nil, -1) != nil {
+		t.Errorf("FromWords should fail without enough words")
+	}
+}
+
+// countingMetrics counts the measures it receives
+type countingMetrics struct {
+	mu    sync.Mutex
+	ops   map[string]int
+	words int64
+	tasks int
+}
+
+func (this *countingMetrics) Operation(op string, resultWords int64) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.ops[op]++
+	this.words += resultWords
+}
+
+func (this *countingMetrics) PoolTask(hit bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.tasks++
+}
+
+func TestMetrics(t *testing.T) {
+	m := &countingMetrics{ops: make(map[string]int)}
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	a, b := NewEwah(), NewEwah()
+	for i := int64(0); i < 1000; i += 3 {
+		a.Set(i)
+		b.Set(i + 1)
+	}
+
+	a.And(b)
+	a.Or(b)
+	a.Or(b, a)
+	a.AndNot(b)
+	a.Xor(b)
+	a.Clone().Not()
+
+	if _, err := ParallelOrAll(context.Background(), []*Ewah{a, b, a, b}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ops["and"] != 1 || m.ops["or"] < 2 || m.ops["andnot"] != 1 || m.ops["xor"] != 1 || m.ops["not"] != 1 {
+		t.Errorf("wrong operation counts: %v", m.ops)
+	}
+	if m.words == 0 || m.tasks == 0 {
+		t.Errorf("no result words (%d) or pool tasks (%d)", m.words, m.tasks)
+	}
+}
+
+// recordingTracer records the spans it's asked to start
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+type recordedSpan struct {
+	op          string
+	words       []int64
+	cardinality int64
+	err         error
+	ended       bool
+}
+
+func (this *recordingTracer) Start(ctx context.Context, op string, operandWords []int64) func(int64, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	k := len(this.spans)
+	this.spans = append(this.spans, recordedSpan{op: op, words: operandWords})
+
+	return func(cardinality int64, err error) {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+
+		this.spans[k].cardinality, this.spans[k].err, this.spans[k].ended = cardinality, err, true
+	}
+}
+
+func TestTracer(t *testing.T) {
+	r := &recordingTracer{}
+	SetTracer(r)
+	defer SetTracer(nil)
+
+	a, b := NewEwah(), NewEwah()
+	for i := int64(0); i < 1000; i += 3 {
+		a.Set(i)
+		b.Set(i + 1)
+	}
+
+	a.And(b)
+	a.Or(b, a)
+	a.AndNot(b)
+	a.Xor(b)
+	a.And(hugeBitmap{})
+
+	if _, err := ParallelOrAll(context.Background(), []*Ewah{a, b, a, b}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := a.MarshalSegmented(256, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEwah().UnmarshalSegmented(data, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEwah().UnmarshalBinary([]byte{1, 2, 3}); err == nil {
+		t.Fatal("UnmarshalBinary should fail")
+	}
+
+	expected := []recordedSpan{
+		{op: "and", words: []int64{a.SizeInWords(), b.SizeInWords()}, cardinality: 0},
+		{op: "or", words: []int64{a.SizeInWords(), b.SizeInWords(), a.SizeInWords()}, cardinality: 668},
+		{op: "andnot", words: []int64{a.SizeInWords(), b.SizeInWords()}, cardinality: 334},
+		{op: "xor", words: []int64{a.SizeInWords(), b.SizeInWords()}, cardinality: 668},
+		{op: "and", words: []int64{a.SizeInWords(), 0}, cardinality: -1, err: ErrIncompatibleBitmap},
+		{op: "parallelor", words: []int64{a.SizeInWords(), b.SizeInWords(), a.SizeInWords(), b.SizeInWords()}, cardinality: 668},
+		{op: "marshalsegmented", words: []int64{a.SizeInWords()}, cardinality: 334},
+		{op: "unmarshalsegmented", words: []int64{int64(len(data) / 8)}, cardinality: 334},
+		{op: "unmarshal", words: []int64{0}, cardinality: -1},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.spans) != len(expected) {
+		t.Fatalf("expected %d spans, got %d: %v", len(expected), len(r.spans), r.spans)
+	}
+
+	for k, s := range r.spans {
+		e := expected[k]
+		if s.op != e.op || fmt.Sprint(s.words) != fmt.Sprint(e.words) || s.cardinality != e.cardinality || !s.ended {
+			t.Errorf("span %d: expected %v, got %v", k, e, s)
+		}
+		if (s.err != nil) != (e.cardinality < 0) || (e.err != nil && !errors.Is(s.err, e.err)) {
+			t.Errorf("span %d: unexpected error %v", k, s.err)
+		}
+	}
+}
+
+func TestLoadPositions(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		opts  LoadOptions
+		want  string
+	}{
+		{"1\n5\n\n5\n 70 \n", LoadOptions{}, "[1 5 70]"},
+		{"id,pos\na,3\nb,200\nc,64\n", LoadOptions{Comma: ',', Column: 1, Header: true, SortBuffer: 2}, "[3 64 200]"},
+		{"9\n2\n7\n2\n1000\n0\n", LoadOptions{SortBuffer: 4}, "[0 2 7 9 1000]"},
+		{"x\t1\ny\t2\n", LoadOptions{Comma: '\t', Column: 1}, "[1 2]"},
+		{"", LoadOptions{}, "[]"},
+	} {
+		e, err := LoadPositions(strings.NewReader(c.input), c.opts)
+		if err != nil {
+			t.Errorf("%q: %v", c.input, err)
+			continue
+		}
+		if s := fmt.Sprintf("%b", e); s != c.want {
+			t.Errorf("%q: %s, should be %s", c.input, s, c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		input string
+		opts  LoadOptions
+	}{
+		{"5\n1\n", LoadOptions{}},
+		{"1\nfoo\n", LoadOptions{}},
+		{"-1\n", LoadOptions{SortBuffer: 10}},
+		{"a,1\nb\n", LoadOptions{Comma: ',', Column: 1}},
+	} {
+		if _, err := LoadPositions(strings.NewReader(c.input), c.opts); err == nil {
+			t.Errorf("%q: no error", c.input)
+		}
+	}
+
+	SetMaxResultWords(2)
+	defer SetMaxResultWords(0)
+
+	if _, err := LoadPositions(strings.NewReader("1\n100\n1000\n10000\n"), LoadOptions{SortBuffer: 2}); !errors.Is(err, ErrResultTooLarge) {
+		t.Errorf("LoadPositions over the budget: %v", err)
+	}
+}
+
+func TestRemoteSegmented(t *testing.T) {
+	e, _ := crossCheckBitmaps(40)
+	e.SetRange(e.Size()+10, e.Size()+5000)
+
+	b, err := e.MarshalSegmented(1024, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests, fetched int64
+	f := RangeFetcherFunc(func(ctx context.Context, offset, length int64) ([]byte, error) {
+		atomic.AddInt64(&requests, 1)
+		atomic.AddInt64(&fetched, length)
+		return ReaderAtFetcher(bytes.NewReader(b)).FetchRange(ctx, offset, length)
+	})
+
+	ctx := context.Background()
+	r, err := OpenSegmented(ctx, f, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != e.Size() {
+		t.Fatalf("Size: %d, should be %d", r.Size(), e.Size())
+	}
+
+	// A single bit only needs its segment
+	requests, fetched = 0, 0
+	i := e.Size() / 2
+	if v, err := r.Get(ctx, i); err != nil || v != e.Get(i) {
+		t.Errorf("Get(%d): %v, %v", i, v, err)
+	}
+	if requests != 1 || fetched >= int64(len(b))/4 {
+		t.Errorf("Get fetched %d bytes out of %d in %d requests", fetched, len(b), requests)
+	}
+
+	rank := e.BuildRankIndex()
+	for k := 0; k < 200; k++ {
+		i := rand.Int63n(e.Size() + 100)
+		if v, err := r.Get(ctx, i); err != nil || v != e.Get(i) {
+			t.Fatalf("Get(%d): %v, %v", i, v, err)
+		}
+		if n, err := r.Rank(ctx, i); err != nil || n != rank.Rank(i) {
+			t.Fatalf("Rank(%d): %d, %v, should be %d", i, n, err, rank.Rank(i))
+		}
+	}
+
+	for k := 0; k < 50; k++ {
+		start := rand.Int63n(e.Size())
+		end := start + 1 + rand.Int63n(5000)
+
+		s, err := r.Slice(ctx, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if size := e.Size(); s.Size() != end && (end < size || s.Size() != size) {
+			t.Fatalf("Slice(%d, %d): size %d", start, end, s.Size())
+		}
+
+		mask := NewEwah()
+		mask.SetRange(start, end)
+		want := e.And(mask).(*Ewah)
+		if d, _ := s.DiffReport(want, 5); d.OnlyInACount+d.OnlyInBCount != 0 {
+			t.Fatalf("Slice(%d, %d): %v", start, end, d)
+		}
+	}
+
+	if _, err := OpenSegmented(ctx, ReaderAtFetcher(bytes.NewReader(b[:10])), 0); err == nil {
+		t.Errorf("OpenSegmented of a truncated bitmap should fail")
+	}
+
+	// The And keeping the range never takes more words than its operands, so the result budget doesn't apply
+	SetMaxResultWords(2)
+	defer SetMaxResultWords(0)
+
+	if s, err := r.Slice(ctx, 100, 3000); err != nil || s.Validate() != nil {
+		t.Errorf("Slice with a result budget: %v", err)
+	}
+}
+
+func TestMarshalCpp(t *testing.T) {
+	// A bitmap with bits 0 and 200 set, laid out as EWAHBoolArray<uint64_t>::write() writes it on a little
+	// endian machine: the size in bits and the number of words as uint64, then the words set() builds, and
+	// nothing after them
+	cpp := []byte{
+		201, 0, 0, 0, 0, 0, 0, 0, // size in bits
+		4, 0, 0, 0, 0, 0, 0, 0, // size in words
+		0, 0, 0, 0, 2, 0, 0, 0, // marker: 1 literal word
+		1, 0, 0, 0, 0, 0, 0, 0, // literal word
+		4, 0, 0, 0, 2, 0, 0, 0, // marker: 2 empty words, 1 literal word
+		0, 1, 0, 0, 0, 0, 0, 0, // literal word
+	}
+
+	bm := New().Set(0).Set(200).(*Ewah)
+	if b, err := bm.MarshalCpp(); err != nil || string(b) != string(cpp) {
+		t.Fatalf("MarshalCpp = %v, %v, should be %v", b, err, cpp)
+	}
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	for n := 0; n < 50; n++ {
+		e, _ := crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+		if n%2 == 1 {
+			e.Not()
+		}
+
+		b, err := e.MarshalCpp()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := NewEwah()
+		if err := d.UnmarshalCpp(b); err != nil || !d.Equal(e) || d.Cardinality() != e.Cardinality() {
+			t.Fatalf("UnmarshalCpp should give back the original bitmap, err = %v", err)
+		}
+
+		// Copy the encoding at an aligned and at an unaligned address, ViewCpp must read both
+		words := make([]uint64, len(b)/8+2)
+		raw := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), 8*len(words))
+		for _, offset := range []int{0, 3} {
+			v := raw[offset : offset+len(b)]
+			copy(v, b)
+
+			view, err := ViewCpp(v)
+			if err != nil || !view.Equal(e) || view.Cardinality() != e.Cardinality() {
+				t.Fatalf("ViewCpp should give back the original bitmap, err = %v", err)
+			}
+
+			// Modifying the view must not write to the encoding
+			next := e.Size() + 100
+			if !view.Set(next).Equal(e.Clone().(*Ewah).Set(next)) {
+				t.Fatal("Problem setting bits after ViewCpp")
+			}
+			if !bytes.Equal(v, b) {
+				t.Fatal("ViewCpp should not modify its buffer")
+			}
+		}
+	}
+
+	// The last marker word with 2 literal words, past the end of the words
+	overrun := bytes.Clone(cpp)
+	overrun[36] = 4
+
+	for _, b := range [][]byte{nil, cpp[:12], cpp[:len(cpp)-1], cpp[:len(cpp)-8], overrun} {
+		if err := NewEwah().UnmarshalCpp(b); err == nil {
+			t.Fatalf("UnmarshalCpp(%v) should fail", b)
+		}
+		if _, err := ViewCpp(b); err == nil {
+			t.Fatalf("ViewCpp(%v) should fail", b)
+		}
+	}
+}
+
+var _ sql.Scanner = (*NullEwah)(nil)
+
+func TestNullEwah(t *testing.T) {
+	e, _ := crossCheckBitmaps(10)
+
+	for _, n := range []NullEwah{{e, true}, {nil, true}, {nil, false}, {e, false}} {
+		v, err := n.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (v == nil) == n.Valid {
+			t.Fatalf("Value of %v: %v", n.Valid, v)
+		}
+
+		var d NullEwah
+		d.Ewah, d.Valid = e, true
+		if err := d.Scan(v); err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case d.Valid != n.Valid:
+			t.Fatalf("Scan: Valid = %v, should be %v", d.Valid, n.Valid)
+		case !d.Valid && d.Ewah != nil:
+			t.Fatal("Scan of NULL should clear the bitmap")
+		case d.Valid && n.Ewah == nil && d.Ewah.Cardinality() != 0:
+			t.Fatal("Scan should give back an empty bitmap")
+		case d.Valid && n.Ewah != nil && !d.Ewah.Equal(e):
+			t.Fatal("Scan should give back the bitmap")
+		}
+	}
+
+	var d NullEwah
+	if b, _ := e.MarshalBinary(); d.Scan(string(b)) != nil || !d.Ewah.Equal(e) {
+		t.Fatal("Scan should decode strings")
+	}
+	if d.Scan(42) == nil || d.Scan([]byte{1, 2}) == nil {
+		t.Fatal("Scan should fail on other types and invalid data")
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	e, _ := crossCheckBitmaps(10)
+
+	v, err := e.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewEwah()
+	d.Set(3)
+	if err := d.Scan(v); err != nil || !d.Equal(e) {
+		t.Fatalf("Scan: %v", err)
+	}
+	if err := d.Scan(string(v.([]byte))); err != nil || !d.Equal(e) {
+		t.Fatalf("Scan of a string: %v", err)
+	}
+
+	if v, err := (*Ewah)(nil).Value(); v != nil || err != nil {
+		t.Fatalf("Value of nil: %v, %v", v, err)
+	}
+	if d.Scan(nil) == nil || d.Scan(42) == nil || d.Scan([]byte{1, 2}) == nil {
+		t.Fatal("Scan should fail on NULL, other types and invalid data")
+	}
+
+	d.SetReadOnly()
+	if err := d.Scan(v); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Scan of a read-only bitmap: %v", err)
+	}
+}
+
+func TestEncodeToString(t *testing.T) {
+	for _, gap := range []int{1, 10, 1000} {
+		e, _ := crossCheckBitmaps(gap)
+
+		s, err := e.EncodeToString()
+		if err != nil || s != e.MustEncodeToString() {
+			t.Fatalf("EncodeToString: %v", err)
+		}
+		if strings.ContainsAny(s, "+/=") {
+			t.Fatalf("%q is not URL-safe", s)
+		}
+
+		for _, s := range []string{s, s + strings.Repeat("=", (4-len(s)%4)%4)} {
+			d, err := DecodeString(s)
+			if err != nil || !d.Equal(e) {
+				t.Fatalf("DecodeString: %v", err)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "!!", "AAAA"} {
+		if _, err := DecodeString(s); !errors.Is(err, ErrCorruptData) {
+			t.Fatalf("DecodeString(%q): %v", s, err)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	e, _ := crossCheckBitmaps(10)
+	plain := mustMarshal(e.MarshalBinary())
+
+	c := e.Clone().(*Ewah)
+	c.SetOptions(Options{Checksum: true})
+	b := mustMarshal(c.MarshalBinary())
+	if len(b) != len(plain)+4 || !bytes.Equal(b[:len(plain)], plain) {
+		t.Fatalf("MarshalBinary with a checksum: %d bytes, without: %d", len(b), len(plain))
+	}
+	if !c.Or(e).(*Ewah).Options().Checksum || !c.Snapshot().Options().Checksum {
+		t.Fatal("the results and the snapshots should keep the option")
+	}
+
+	// Both kinds of bitmaps read encodings with a checksum, only the ones with the option require it
+	for _, opts := range []Options{{}, {Checksum: true}} {
+		d := NewWithOptions(opts)
+		if err := d.UnmarshalBinary(b); err != nil || !d.Equal(e) {
+			t.Fatalf("UnmarshalBinary with %+v: %v", opts, err)
+		}
+		if err := d.UnmarshalBinary(plain); (err != nil) != opts.Checksum || opts.Checksum && !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("UnmarshalBinary without a checksum, with %+v: %v", opts, err)
+		}
+	}
+
+	for _, i := range []int{0, 9, len(b) / 2, len(b) - 5, len(b) - 1} {
+		corrupt := append([]byte(nil), b...)
+		corrupt[i] ^= 0x10
+		if err := NewEwah().UnmarshalBinary(corrupt); !errors.Is(err, ErrChecksumMismatch) && !errors.Is(err, ErrCorruptData) {
+			t.Fatalf("UnmarshalBinary with byte %d flipped: %v", i, err)
+		}
+	}
+	corrupt := append([]byte(nil), b...)
+	corrupt[len(b)-5] ^= 0x10
+	if err := NewEwah().UnmarshalBinary(corrupt); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("UnmarshalBinary with the rlw position flipped: %v", err)
+	}
+
+	// ReadFrom reads the checksums of the bitmaps with the option, so they can follow each other
+	var stream bytes.Buffer
+	c.WriteTo(&stream)
+	c.WriteTo(&stream)
+	for k := 0; k < 2; k++ {
+		d := NewWithOptions(Options{Checksum: true})
+		if n, err := d.ReadFrom(&stream); err != nil || n != int64(len(b)) || !d.Equal(e) {
+			t.Fatalf("ReadFrom %d: %d, %v", k, n, err)
+		}
+	}
+
+	var git bytes.Buffer
+	if _, err := c.WriteGit(&git); err != nil || !bytes.Equal(git.Bytes(), plain) {
+		t.Fatalf("WriteGit should not write a checksum: %v", err)
+	}
+
+	if d, err := DecodeString(c.MustEncodeToString()); err != nil || !d.Equal(e) {
+		t.Fatalf("DecodeString with a checksum: %v", err)
+	}
+}
+
+func TestFromBuffer(t *testing.T) {
+	e, _ := crossCheckBitmaps(10)
+	other, _ := crossCheckBitmaps(7)
+
+	b, err := e.MarshalCpp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words := make([]uint64, len(b)/8+1)
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), 8*len(words))[:len(b)]
+	copy(raw, b)
+
+	view, err := FromBuffer(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if view.Size() != e.Size() || view.Cardinality() != e.Cardinality() {
+		t.Fatalf("FromBuffer: %d bits, %d set", view.Size(), view.Cardinality())
+	}
+	for it, i := view.Iterator(), e.Iterator(); it.HasNext() || i.HasNext(); {
+		if n := it.Next(); n != i.Next() || !view.Get(n) {
+			t.Fatalf("FromBuffer should iterate over the same bits, got %d", n)
+		}
+	}
+	if !view.And(other).Equal(e.And(other)) || !view.Or(other).Equal(e.Or(other)) {
+		t.Fatal("FromBuffer should be usable as the left operand of the operations")
+	}
+
+	if wordsInPlace(raw[16:]) != nil && &view.(*Ewah).buffer[0] != &words[2] {
+		t.Fatal("FromBuffer should read the words in place")
+	}
+
+	view.(*Ewah).Set(e.Size() + 100)
+	if !view.(*Ewah).Equal(e) || !bytes.Equal(raw, b) {
+		t.Fatal("FromBuffer should return a read-only bitmap")
+	}
+
+	if _, err := FromBuffer(b[:len(b)-1]); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("FromBuffer of a truncated buffer: %v", err)
+	}
+}
+
+func TestDeserializeLimited(t *testing.T) {
+	e, _ := crossCheckBitmaps(10)
+	b := mustMarshal(e.MarshalBinary())
+
+	r := bytes.NewReader(append(append([]byte(nil), b...), b...))
+	for k := 0; k < 2; k++ {
+		d, err := DeserializeLimited(r, e.CompressedWords())
+		if err != nil || !d.Equal(e) || d.Validate() != nil {
+			t.Fatalf("DeserializeLimited %d: %v", k, err)
+		}
+	}
+
+	r = bytes.NewReader(b)
+	if _, err := DeserializeLimited(r, e.CompressedWords()-1); !errors.Is(err, ErrInputTooLarge) || errors.Is(err, ErrResultTooLarge) || r.Len() != len(b)-8 {
+		t.Fatalf("DeserializeLimited over the limit: %v, %d bytes left", err, r.Len())
+	}
+
+	for _, n := range []int{0, 5, 8, len(b) / 2, len(b) - 1} {
+		if _, err := DeserializeLimited(bytes.NewReader(b[:n]), math.MaxInt64); !errors.Is(err, ErrCorruptData) {
+			t.Fatalf("DeserializeLimited of %d bytes: %v", n, err)
+		}
+	}
+
+	// A marker word with more literal words than the bitmap has fails in the first chunk
+	const words = 1 << 20
+	bomb := make([]byte, 8+8*words+4)
+	binary.BigEndian.PutUint32(bomb[4:], words)
+	binary.BigEndian.PutUint64(bomb[8:], LargestLiteralCount<<(1+RunningLengthBits))
+	r = bytes.NewReader(bomb)
+	if _, err := DeserializeLimited(r, math.MaxInt64); !errors.Is(err, ErrCorruptData) || r.Len() < len(bomb)/2 {
+		t.Fatalf("DeserializeLimited of an invalid marker word: %v, %d bytes left", err, r.Len())
+	}
+
+	rlw := append([]byte(nil), b...)
+	rlw[len(rlw)-1]++
+	if _, err := DeserializeLimited(bytes.NewReader(rlw), math.MaxInt64); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("DeserializeLimited with a wrong last marker word: %v", err)
+	}
+
+	// With a checksum, which is read with the bitmap and checked
+	opts := Options{Checksum: true}
+	c := e.Clone().(*Ewah)
+	c.SetOptions(opts)
+	sum := mustMarshal(c.MarshalBinary())
+
+	r = bytes.NewReader(append(bytes.Clone(sum), b...))
+	if d, err := DeserializeLimitedWithOptions(r, math.MaxInt64, opts); err != nil || !d.Equal(e) || d.Options() != opts || r.Len() != len(b) {
+		t.Fatalf("DeserializeLimitedWithOptions: %v, %d bytes left", err, r.Len())
+	}
+
+	wrong := bytes.Clone(sum)
+	wrong[len(wrong)-1]++
+	for _, enc := range [][]byte{b, wrong} {
+		if _, err := DeserializeLimitedWithOptions(bytes.NewReader(enc), math.MaxInt64, opts); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("DeserializeLimitedWithOptions of a bitmap without its checksum: %v", err)
+		}
+	}
+	if _, err := DeserializeLimitedWithOptions(bytes.NewReader(sum[:len(sum)-1]), math.MaxInt64, opts); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("DeserializeLimitedWithOptions of a truncated checksum: %v", err)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	var bms []*Ewah
+	var sets []*bitset.Bitset
+	for _, gap := range []int{1, 10, 1000} {
+		e, b := crossCheckBitmaps(gap)
+		bms, sets = append(bms, e), append(sets, b)
+	}
+	bms, sets = append(bms, NewEwah()), append(sets, bitset.New().(*bitset.Bitset))
+
+	data, err := MarshalFrame(bms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := append([]byte(nil), data...)
+
+	f, err := OpenFrame(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != len(bms) || f.Bitmap(-1) != nil || f.Bitmap(len(bms)) != nil {
+		t.Fatalf("Frame: %d bitmaps, should be %d", f.Len(), len(bms))
+	}
+
+	for k := range bms {
+		e := f.Bitmap(k)
+		if e.Validate() != nil || !e.Equal(bms[k]) {
+			t.Fatalf("Frame: bitmap %d is different", k)
+		}
+		bitmaptest.Check(t, "Frame", e, sets[k])
+
+		// Modifying the bitmap must not write to the frame
+		e.Set(e.Size() + 100).Not()
+	}
+
+	if !bytes.Equal(data, original) {
+		t.Fatal("Frame: the bitmaps should not write to the frame")
+	}
+
+	for _, b := range [][]byte{nil, data[:15], data[:len(data)-8], append(data[:len(data):len(data)], 0), []byte("EWAHFRM2" + string(data[8:]))} {
+		if _, err := OpenFrame(b); err == nil {
+			t.Fatalf("OpenFrame should fail on %d bytes", len(b))
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	a := NewEwah()
+	if err := a.SetChecked(10); err != nil {
+		t.Fatal(err)
+	}
+
+	_, andErr := a.AndChecked(hugeBitmap{})
+	_, orErr := a.OrChecked(a, hugeBitmap{})
+
+	checks := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"SetChecked before the last bit", a.SetChecked(5), ErrOutOfOrder},
+		{"SetChecked past the largest position", a.SetChecked(math.MaxInt32), ErrOutOfRange},
+		{"SetChecked negative", a.SetChecked(-1), ErrOutOfRange},
+		{"setSizeInBits", a.setSizeInBits(1000), ErrOutOfRange},
+		{"UnmarshalBinary", NewEwah().UnmarshalBinary([]byte{1, 2, 3}), ErrCorruptData},
+		{"UnmarshalCpp", NewEwah().UnmarshalCpp(make([]byte, 20)), ErrCorruptData},
+		{"UnmarshalSegmented", NewEwah().UnmarshalSegmented([]byte("EWAH"), 1), ErrCorruptData},
+		{"Validate", (&Ewah{}).Validate(), ErrCorruptData},
+		{"AndChecked", andErr, ErrIncompatibleBitmap},
+		{"OrChecked", orErr, ErrIncompatibleBitmap},
+	}
+
+	for _, c := range checks {
+		if !errors.Is(c.err, c.kind) {
+			t.Errorf("%s: got %v, want %v", c.name, c.err, c.kind)
+		}
+	}
+
+	// The methods without error still return nil, and the bitmap is unchanged
+	if a.Set(5) != nil || a.Xor(hugeBitmap{}) != nil || a.AndNot(hugeBitmap{}) != nil || a.Cardinality() != 1 {
+		t.Error("expected nil results")
+	}
+
+	// Without operand, the result is a copy of the bitmap
+	for _, f := range []func(...bitmap.Bitmap) (bitmap.Bitmap, error){a.AndChecked, a.AndNotChecked, a.OrChecked, a.XorChecked} {
+		if ans, err := f(); err != nil || !ans.Equal(a) || ans == bitmap.Bitmap(a) {
+			t.Errorf("got %v, %v without operand", ans, err)
+		}
+	}
+
+	b := NewEwah()
+	b.Set(3)
+	b.Set(10)
+	for _, c := range []struct {
+		f    func(...bitmap.Bitmap) (bitmap.Bitmap, error)
+		want int64
+	}{{a.AndChecked, 1}, {a.AndNotChecked, 0}, {a.XorChecked, 1}} {
+		if ans, err := c.f(b); err != nil || ans.Cardinality() != c.want {
+			t.Errorf("got %v, %v, want a cardinality of %d", ans, err, c.want)
+		}
+	}
+}
+
+func TestForeignOperands(t *testing.T) {
+	a, b := NewEwah(), NewEwah()
+	bs := bitset.New()
+	for i := int64(0); i < 5000; i++ {
+		if rand.Intn(3) == 0 {
+			a.Set(i)
+		}
+		if i%7 == 0 || (i > 2000 && i < 3000) {
+			b.Set(i)
+			bs.Set(i)
+		}
+	}
+
+	ops := []struct {
+		name string
+		f    func(...bitmap.Bitmap) (bitmap.Bitmap, error)
+	}{
+		{"and", a.AndChecked},
+		{"andnot", a.AndNotChecked},
+		{"or", a.OrChecked},
+		{"xor", a.XorChecked},
+		{"andctx", func(o ...bitmap.Bitmap) (bitmap.Bitmap, error) { return a.AndCtx(context.Background(), o...) }},
+	}
+
+	for _, op := range ops {
+		want, err := op.f(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := op.f(bs)
+		if err != nil {
+			t.Errorf("%s: %v", op.name, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got a cardinality of %d, want %d", op.name, got.Cardinality(), want.Cardinality())
+		}
+	}
+
+	if ans := a.Xor(bs, b); ans == nil || ans.Cardinality() != a.Cardinality() || ans.Xor(a).Cardinality() != 0 {
+		t.Error("a xor b xor b should be a")
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	a := NewEwah()
+	bs := bitset.New()
+	for i := int64(0); i < 3000; i += 5 {
+		a.Set(i)
+		bs.Set(i)
+	}
+
+	// Other implementations are converted
+	c := NewEwah()
+	if c.Copy(bs) == nil || !c.Equal(a) {
+		t.Error("Copy of a bitset differs")
+	}
+	if c.Copy(hugeBitmap{}) != nil || !c.Equal(a) {
+		t.Error("Copy should return nil and leave the bitmap untouched")
+	}
+
+	// CopyFrom reuses a buffer large enough
+	b := NewEwah()
+	b.reserve(int32(a.SizeInWords()) + 10)
+	buffer := b.buffer
+	if err := b.CopyFrom(a); err != nil || !b.Equal(a) {
+		t.Fatalf("CopyFrom: %v", err)
+	}
+	if &b.buffer[0] != &buffer[0] {
+		t.Error("CopyFrom didn't reuse the buffer")
+	}
+
+	// but not the buffer of a snapshot, nor the one of other
+	s := b.Snapshot()
+	if err := b.CopyFrom(bs); err != nil || !b.Equal(a) {
+		t.Fatalf("CopyFrom: %v", err)
+	}
+	if &b.buffer[0] == &s.buffer[0] || &b.buffer[0] == &a.buffer[0] {
+		t.Error("CopyFrom shares a buffer")
+	}
+
+	b.Set(5000)
+	if a.Get(5000) || s.Get(5000) || !s.Equal(a) {
+		t.Error("CopyFrom modified the source or the snapshot")
+	}
+
+	if err := b.CopyFrom(hugeBitmap{}); !errors.Is(err, ErrIncompatibleBitmap) {
+		t.Errorf("got %v, want ErrIncompatibleBitmap", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	a, b := NewEwah(), NewEwah()
+	for i := int64(0); i < 100; i += 3 {
+		a.Set(i)
+	}
+	for i := int64(1); i < 300; i += 2 {
+		b.Set(i)
+	}
+
+	unpadded := Options{NoPadding: true}
+	for _, c := range []struct {
+		name   string
+		f      func(Options, ...bitmap.Bitmap) (bitmap.Bitmap, error)
+		padded bitmap.Bitmap
+	}{
+		{"and", a.AndWith, a.And(b)},
+		{"andnot", a.AndNotWith, a.AndNot(b)},
+		{"or", a.OrWith, a.Or(b)},
+		{"xor", a.XorWith, a.Xor(b)},
+	} {
+		if c.padded.Size() != 300 {
+			t.Errorf("%s: padded result of %d bits, want 300", c.name, c.padded.Size())
+		}
+
+		ans, err := c.f(unpadded, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The bits are the same, only the size differs
+		if ans.Size()%64 != 0 || ans.Cardinality() != c.padded.Cardinality() || ans.(*Ewah).Options() != unpadded {
+			t.Errorf("%s: unpadded result of %d bits, cardinality %d, want %d", c.name, ans.Size(), ans.Cardinality(), c.padded.Cardinality())
+		}
+
+		// With the default options, it's the same as without options
+		if ans, err := c.f(Options{}, b); err != nil || !ans.Equal(c.padded) {
+			t.Errorf("%s: got %v, %v with the default options", c.name, ans, err)
+		}
+	}
+
+	if a.Options() != (Options{}) {
+		t.Error("AndWith changed the options of the bitmap")
+	}
+
+	// The options are kept by the results, the clones and Reset
+	c := NewWithOptions(unpadded)
+	c.Set(3)
+	for _, e := range []*Ewah{c.And(b).(*Ewah), c.Or(b, a).(*Ewah), c.Clone().(*Ewah), c.Snapshot()} {
+		if e.Options() != unpadded {
+			t.Error("options not kept")
+		}
+	}
+	c.Reset()
+	if c.Options() != unpadded {
+		t.Error("options not kept by Reset")
+	}
+}
+
+func TestGetChecked(t *testing.T) {
+	// The last word is a run of 1's past the size, which Get must not read
+	a := NewEwah()
+	a.SetRange(0, 128)
+	if err := a.setSizeInBits(100); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		i    int64
+		want bool
+		err  bool
+	}{{-1, false, true}, {0, true, false}, {99, true, false}, {100, false, true}, {127, false, true}, {128, false, true}} {
+		if a.Get(c.i) != c.want {
+			t.Errorf("Get(%d) = %v, want %v", c.i, !c.want, c.want)
+		}
+
+		got, err := a.GetChecked(c.i)
+		if got != c.want || (err != nil) != c.err || (err != nil && !errors.Is(err, ErrOutOfRange)) {
+			t.Errorf("GetChecked(%d) = %v, %v", c.i, got, err)
+		}
+	}
+
+	if _, err := NewEwah().GetChecked(0); err == nil {
+		t.Error("GetChecked(0) of an empty bitmap should fail")
+	}
+}
+
+// hugeBitmap is a bitmap too large to be converted to an *Ewah
+type hugeBitmap struct {
+	bitmap.Bitmap
+}
+
+func (this hugeBitmap) Size() int64 {
+	return math.MaxInt64
+}
+
+func TestNil(t *testing.T) {
+	var n *Ewah
+	a := NewEwah()
+	a.Set(3)
+	a.Set(100)
+
+	if n.Get(3) || n.Size() != 0 || n.Cardinality() != 0 || n.Iterator().HasNext() || n.Options() != (Options{}) {
+		t.Error("nil is not empty")
+	}
+	if _, err := n.GetChecked(0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("got %v, want ErrOutOfRange", err)
+	}
+	if !n.Equal(NewEwah()) || !NewEwah().Equal(n) || !NewEwah().Equal(nil) || n.Equal(a) || a.Equal(n) {
+		t.Error("nil should only be equal to the empty bitmap")
+	}
+	if c := n.Clone(); c == nil || c.Cardinality() != 0 || c.Set(5) == nil {
+		t.Error("the clone of nil should be a new empty bitmap")
+	}
+
+	for _, b := range [][]byte{mustMarshal(n.MarshalBinary()), mustMarshal(NewEwah().MarshalBinary())} {
+		if e := NewEwah(); e.UnmarshalBinary(b) != nil || e.Size() != 0 {
+			t.Error("nil should be encoded as the empty bitmap")
+		}
+	}
+	if _, err := n.MarshalCpp(); err != nil {
+		t.Error(err)
+	}
+
+	for _, c := range []struct {
+		name      string
+		left      bitmap.Bitmap
+		right     bitmap.Bitmap
+		wantNil   int64
+		wantOther int64
+	}{
+		{"and", n.And(a), a.And(n), 0, 0},
+		{"andnot", n.AndNot(a), a.AndNot(n), 0, 2},
+		{"or", n.Or(a), a.Or(n), 2, 2},
+		{"xor", n.Xor(a), a.Xor(n), 2, 2},
+		{"nil interface", a.Or(nil), a.And(nil), 2, 0},
+	} {
+		if c.left == nil || c.right == nil || c.left.Cardinality() != c.wantNil || c.right.Cardinality() != c.wantOther {
+			t.Errorf("%s: got %v and %v", c.name, c.left, c.right)
+		}
+	}
+
+	if ans, err := n.AndCtx(context.Background(), a); err != nil || ans.Cardinality() != 0 {
+		t.Errorf("AndCtx: got %v, %v", ans, err)
+	}
+	if ans, err := n.OrWith(Options{NoPadding: true}, a); err != nil || ans.Cardinality() != 2 {
+		t.Errorf("OrWith: got %v, %v", ans, err)
+	}
+
+	if a.Copy(n) == nil || a.Cardinality() != 0 {
+		t.Error("Copy of nil should empty the bitmap")
+	}
+}
+
+func mustMarshal(b []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func TestSetChanged(t *testing.T) {
+	a := NewEwah()
+	a.SetRange(64, 128)
+
+	for _, c := range []struct {
+		i       int64
+		changed bool
+		err     error
+	}{
+		{200, true, nil},
+		{200, false, nil},
+		{100, false, nil},
+		{150, false, ErrOutOfOrder},
+		{201, true, nil},
+		{-1, false, ErrOutOfRange},
+	} {
+		changed, err := a.SetChanged(c.i)
+		if changed != c.changed || !errors.Is(err, c.err) || (err == nil) != (c.err == nil) {
+			t.Errorf("SetChanged(%d) = %v, %v, want %v, %v", c.i, changed, err, c.changed, c.err)
+		}
+	}
+
+	if a.Cardinality() != 66 || a.Size() != 202 {
+		t.Errorf("got %d bits set out of %d", a.Cardinality(), a.Size())
+	}
+}
+
+func TestSizeAccessors(t *testing.T) {
+	a := NewEwah()
+	for i := int64(0); i < 10000; i += 100 {
+		a.Set(i)
+	}
+
+	if a.LogicalBits() != a.Size() || a.LogicalBits() != 9901 {
+		t.Errorf("LogicalBits() = %d, Size() = %d", a.LogicalBits(), a.Size())
+	}
+	if a.CompressedWords() != a.SizeInWords() || a.SizeInBytes() != 8*a.CompressedWords() {
+		t.Errorf("CompressedWords() = %d, SizeInWords() = %d", a.CompressedWords(), a.SizeInWords())
+	}
+	if a.BufferCapacityWords() < a.CompressedWords() || a.HeapBytes() < 8*a.BufferCapacityWords() {
+		t.Errorf("BufferCapacityWords() = %d, HeapBytes() = %d", a.BufferCapacityWords(), a.HeapBytes())
+	}
+
+	var n *Ewah
+	if n.LogicalBits() != 0 || n.CompressedWords() != 1 || n.BufferCapacityWords() != 0 || n.HeapBytes() != 0 {
+		t.Error("wrong sizes for nil")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	a := NewEwah()
+	a.SetRange(64, 128)
+	a.Set(200)
+	a.SetReadOnly()
+
+	b := NewEwah()
+	b.Set(300)
+	data := mustMarshal(b.MarshalBinary())
+
+	if !a.IsReadOnly() || b.IsReadOnly() {
+		t.Fatal("IsReadOnly failed")
+	}
+
+	_, changed := a.SetChanged(300)
+	_, not := a.NotChecked()
+	for name, err := range map[string]error{
+		"SetChecked":      a.SetChecked(300),
+		"SetChanged":      changed,
+		"CopyFrom":        a.CopyFrom(b),
+		"NotChecked":      not,
+		"UnmarshalBinary": a.UnmarshalBinary(data),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: got %v, want ErrReadOnly", name, err)
+		}
+	}
+
+	if a.Set(300) != nil || a.SetRange(300, 400) != nil || a.Not() != nil || a.Copy(b) != nil || b.Swap(a) != nil {
+		t.Error("a read-only bitmap was modified")
+	}
+	a.Reset()
+	a.SetOptions(Options{NoPadding: true})
+
+	if a.Cardinality() != 65 || a.Size() != 201 || a.Options().NoPadding || b.Cardinality() != 1 {
+		t.Errorf("got %d bits set out of %d", a.Cardinality(), a.Size())
+	}
+
+	// The results and the clones can be modified
+	c := a.Clone().(*Ewah)
+	if c.IsReadOnly() || c.SetChecked(300) != nil {
+		t.Error("the clone is read-only")
+	}
+	if ans, err := a.OrChecked(b); err != nil || ans.(*Ewah).IsReadOnly() || ans.Cardinality() != 66 {
+		t.Errorf("Or: got %v, %v", ans, err)
+	}
+}
+
+func TestMust(t *testing.T) {
+	b := NewEwah().MustSet(2).MustSet(4)
+	a := NewEwah().MustSet(1).MustSet(2).MustSet(3).MustSet(4)
+
+	if ans := a.MustAnd(b).MustOr(NewEwah().MustSet(7)).MustAndNot(NewEwah().MustSet(4)); ans.Cardinality() != 2 ||
+		!ans.Get(2) || !ans.Get(7) {
+		t.Errorf("got %v", ans)
+	}
+	if ans := a.MustXor(b).MustNot(); ans.Cardinality() != 3 || ans.Get(1) || ans.Get(3) {
+		t.Errorf("got %v", ans)
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrOutOfOrder) {
+			t.Errorf("got %v, want a panic with ErrOutOfOrder", err)
+		}
+	}()
+	a.MustSet(0)
+}
+
+func TestCorruptWords(t *testing.T) {
+	a := NewEwah()
+	for i := int64(0); i < 1000; i += 3 {
+		a.Set(i)
+	}
+	a.SetRange(2000, 3000)
+
+	// A marker word saying it's followed by more literal words than there are
+	bad := a.Clone().(*Ewah)
+	bad.buffer[0] |= uint64(1000) << uint32(1+RunningLengthBits)
+
+	it := bad.Iterator()
+	for it.HasNext() {
+		it.Next()
+	}
+	if !errors.Is(it.Err(), ErrCorruptData) || a.Iterator().Err() != nil {
+		t.Errorf("got %v, want ErrCorruptData", it.Err())
+	}
+	if _, err := bad.Iterator().NextCtx(context.Background()); err != nil {
+		t.Errorf("got %v before the corrupt words", err)
+	}
+
+	binary, cpp := mustMarshal(bad.MarshalBinary()), mustMarshal(bad.MarshalCpp())
+	if err := NewEwah().UnmarshalBinary(binary); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("UnmarshalBinary: got %v, want ErrCorruptData", err)
+	}
+	if err := NewEwah().UnmarshalCpp(cpp); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("UnmarshalCpp: got %v, want ErrCorruptData", err)
+	}
+	if _, err := ViewCpp(cpp); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("ViewCpp: got %v, want ErrCorruptData", err)
+	}
+
+	// Whatever byte is changed, decoding and reading the bitmap must not panic
+	b := mustMarshal(a.MarshalBinary())
+	for k := range b {
+		c := append([]byte(nil), b...)
+		c[k] ^= 0xa5
+
+		e := NewEwah()
+		if e.UnmarshalBinary(c) != nil {
+			continue
+		}
+		for it := e.Iterator(); it.HasNext(); {
+			it.Next()
+		}
+		e.Cardinality()
+		e.Get(e.Size() - 1)
+	}
+}
+
+func TestCloneShareNothing(t *testing.T) {
+	a := NewEwah()
+	for i := int64(0); i < 5000; i += 7 {
+		a.Set(i)
+	}
+	want := a.Clone().(*Ewah)
+
+	c := a.Clone().(*Ewah)
+	d := NewEwah().Copy(a).(*Ewah)
+	e := NewEwah().MustSet(100000)
+	if err := e.CopyFrom(a); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []*Ewah{c, d, e} {
+		if err := b.AliasCheck(a, c, d, e); err != nil {
+			t.Error(err)
+		}
+		if b.BufferCapacityWords() < b.CompressedWords() {
+			t.Errorf("capacity of %d words for %d words", b.BufferCapacityWords(), b.CompressedWords())
+		}
+	}
+	if c.BufferCapacityWords() != a.CompressedWords() || d.BufferCapacityWords() != a.CompressedWords() {
+		t.Errorf("capacities of %d and %d words, want %d", c.BufferCapacityWords(), d.BufferCapacityWords(), a.CompressedWords())
+	}
+
+	// Modifying the copies in place doesn't change the bitmap
+	c.Set(6000)
+	d.Not()
+	e.SetRange(7000, 8000)
+	if !a.Equal(want) {
+		t.Error("the bitmap changed")
+	}
+
+	// Only snapshots may share the buffer
+	s := a.Snapshot()
+	if err := s.AliasCheck(a); err != nil {
+		t.Error(err)
+	}
+	bad := &Ewah{buffer: a.buffer, getCursor: newCursor(a.buffer, 1), setCursor: newCursor(a.buffer, 1)}
+	if err := bad.AliasCheck(want, a); !errors.Is(err, ErrAliased) {
+		t.Errorf("got %v, want ErrAliased", err)
+	}
+	bad.getCursor = want.getCursor
+	if err := bad.AliasCheck(); !errors.Is(err, ErrAliased) {
+		t.Errorf("got %v, want ErrAliased", err)
+	}
+}
+
+func TestSetModes(t *testing.T) {
+	for _, c := range []struct {
+		mode    SetMode
+		err     error
+		ignored bool
+	}{
+		{SetFail, ErrOutOfOrder, false},
+		{SetIgnoreSet, ErrOutOfOrder, true},
+		{SetBuffered, nil, true},
+	} {
+		a := NewWithOptions(Options{OutOfOrder: c.mode})
+		a.SetRange(64, 128)
+		a.Set(200)
+
+		if err := a.SetChecked(100); (err == nil) != c.ignored {
+			t.Errorf("mode %d: setting a bit already set: got %v", c.mode, err)
+		}
+		if err := a.SetChecked(10); !errors.Is(err, c.err) || (err == nil) != (c.err == nil) {
+			t.Errorf("mode %d: setting a bit set to 0: got %v, want %v", c.mode, err, c.err)
+		}
+		if a.Clone().(*Ewah).Options().OutOfOrder != c.mode {
+			t.Errorf("mode %d: the clone has other options", c.mode)
+		}
+	}
+
+	// The buffered positions are seen by the readers, and merged with a single Or
+	a := NewWithOptions(Options{OutOfOrder: SetBuffered})
+	want := NewEwah()
+	for i := int64(0); i < 10000; i += 2 {
+		a.Set(i)
+		want.Set(i)
+	}
+	for i := int64(9999); i > 0; i -= 2 {
+		a.Set(i)
+	}
+	a.Set(5)
+	a.Set(20000)
+
+	if len(a.pending) == 0 {
+		t.Error("no position kept aside")
+	}
+
+	// Clone copies the positions kept aside without merging them into the bitmap
+	n := len(a.pending)
+	c := a.Clone().(*Ewah)
+	if len(a.pending) != n || len(c.pending) != n || c.Cardinality() != 10001 || c.Not().Get(5) {
+		t.Errorf("Clone: %d positions kept aside, %d in the clone", len(a.pending), len(c.pending))
+	}
+	if a.Cardinality() != 10001 || len(a.pending) != 0 || a.Size() != 20001 || !a.Get(20000) {
+		t.Errorf("got %d bits set out of %d", a.Cardinality(), a.Size())
+	}
+	if err := a.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	b := NewWithOptions(Options{OutOfOrder: SetBuffered}).MustSet(100).MustSet(7)
+	if ans := b.And(NewEwah().MustSet(7)); ans.Cardinality() != 1 || !ans.Get(7) {
+		t.Errorf("And: got %v", ans)
+	}
+
+	a.Set(9)
+	a.SetOptions(Options{})
+	if len(a.pending) != 0 || a.SetChecked(11) == nil {
+		t.Error("changing the mode doesn't flush the bitmap")
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	a, b := NewEwah(), NewEwah()
+	for i := int64(0); i < 10000; i += 3 {
+		a.Set(i)
+	}
+	b.SetRange(100, 1000)
+
+	var buf bytes.Buffer
+	for _, e := range []*Ewah{a, b} {
+		n, err := e.WriteTo(&buf)
+		if err != nil || n != 8*e.CompressedWords()+12 {
+			t.Fatalf("WriteTo: got %d, %v", n, err)
+		}
+	}
+
+	for _, want := range []*Ewah{a, b} {
+		got := NewEwah()
+		if n, err := got.ReadFrom(&buf); err != nil || n != 8*want.CompressedWords()+12 || !got.Equal(want) {
+			t.Errorf("ReadFrom: got %v, %d, %v, want %v", got, n, err, want)
+		}
+	}
+
+	// A truncated stream
+	data := mustMarshal(a.MarshalBinary())
+	for _, b := range [][]byte{nil, data[:5], data[:len(data)-1]} {
+		if _, err := NewEwah().ReadFrom(bytes.NewReader(b)); !errors.Is(err, ErrCorruptData) {
+			t.Errorf("got %v, want ErrCorruptData", err)
+		}
+	}
+}
+
+func TestAggregateResult(t *testing.T) {
+	a, b, c := NewEwah(), NewEwah(), NewEwah()
+	for i := int64(0); i < 10000; i++ {
+		if i%2 == 0 {
+			a.Set(i)
+		}
+		if i%3 == 0 {
+			b.Set(i)
+		}
+	}
+	c.SetRange(0, 6000)
+
+	for _, tc := range []struct {
+		name string
+		f    func(context.Context, []*Ewah) (*Result, error)
+		want bitmap.Bitmap
+	}{
+		{"and", AndAllResult, a.And(b, c)},
+		{"or", OrAllResult, a.Or(b, c)},
+	} {
+		r, err := tc.f(context.Background(), []*Ewah{a, b, c})
+		if err != nil || !r.Bitmap.Equal(tc.want) || r.Cardinality != tc.want.Cardinality() {
+			t.Fatalf("%s: got %v, %v", tc.name, r, err)
+		}
+
+		if len(r.OperandWords) != 3 || r.OperandWords[1] != b.CompressedWords() || r.Duration < 0 {
+			t.Errorf("%s: got %+v", tc.name, r)
+		}
+
+		// Each operand is read once, and the intermediate results once more
+		if words := a.CompressedWords() + b.CompressedWords() + c.CompressedWords(); r.WordsScanned <= words {
+			t.Errorf("%s: %d words scanned, want more than %d", tc.name, r.WordsScanned, words)
+		}
+	}
+
+	if r, err := AndAllResult(context.Background(), nil); err != nil || r.Cardinality != 0 || r.Bitmap.Size() != 0 {
+		t.Errorf("got %+v, %v without bitmaps", r, err)
+	}
+	if r, err := OrAllResult(context.Background(), []*Ewah{nil, a}); err != nil || !r.Bitmap.Equal(a) {
+		t.Errorf("got %+v, %v with a nil bitmap", r, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := OrAllResult(ctx, []*Ewah{a, b}); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestCppLayouts(t *testing.T) {
+	a := NewEwah()
+	for i := int64(0); i < 10000; i += 3 {
+		a.Set(i)
+	}
+	a.SetRange(20000, 30000)
+
+	var buf bytes.Buffer
+	if _, err := a.WriteCpp(&buf, CppLayout{}); err != nil || !bytes.Equal(buf.Bytes(), mustMarshal(a.MarshalCpp())) {
+		t.Fatalf("the zero layout is not the one of MarshalCpp: %v", err)
+	}
+
+	for _, narrow := range []bool{false, true} {
+		for _, noSize := range []bool{false, true} {
+			for _, rlw := range []bool{false, true} {
+				layout := CppLayout{Narrow: narrow, NoSizeInBits: noSize, RLW: rlw}
+
+				buf.Reset()
+				n, err := a.WriteCpp(&buf, layout)
+				if err != nil || n != int64(buf.Len()) {
+					t.Fatalf("%+v: got %d, %v", layout, n, err)
+				}
+
+				// Followed by another bitmap, which must not be read
+				NewEwah().MustSet(5).WriteCpp(&buf, layout)
+
+				got := NewEwah()
+				if m, err := got.ReadCpp(&buf, layout); err != nil || m != n || !got.Equal(a) || got.Validate() != nil {
+					t.Errorf("%+v: got %v, %d, %v", layout, got, m, err)
+				}
+				if _, err := got.ReadCpp(&buf, layout); err != nil || got.Cardinality() != 1 || got.Size() != 6 {
+					t.Errorf("%+v: got %v, %v for the second bitmap", layout, got, err)
+				}
+
+				b := new(bytes.Buffer)
+				a.WriteCpp(b, layout)
+				if _, err := NewEwah().ReadCpp(bytes.NewReader(b.Bytes()[:b.Len()-1]), layout); !errors.Is(err, ErrCorruptData) {
+					t.Errorf("%+v: got %v, want ErrCorruptData", layout, err)
+				}
+			}
+		}
+	}
+
+	// The header of a release writing the sizes as a 32-bit size_t, with the words of bitmap {0, 3}
+	b := []byte{4, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0}
+	got := NewEwah()
+	if _, err := got.ReadCpp(bytes.NewReader(b), CppLayout{Narrow: true}); err != nil || got.Size() != 4 ||
+		got.Cardinality() != 2 || !got.Get(0) || !got.Get(3) {
+		t.Errorf("got %v, %v", got, err)
+	}
+
+	// Bitmap {0, 200} as MarshalCpp wrote it before it followed the C++ library
+	b = []byte{
+		201, 0, 0, 0, 4, 0, 0, 0,
+		0, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 2, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+		2, 0, 0, 0,
+	}
+	if _, err := got.ReadCpp(bytes.NewReader(b), CppLayout{Narrow: true, RLW: true}); err != nil || got.Size() != 201 ||
+		got.Cardinality() != 2 || !got.Get(0) || !got.Get(200) {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
+
+func TestGit(t *testing.T) {
+	// Bitmap {0, 3} as stored by Git: a marker word followed by a literal word
+	b := []byte{0, 0, 0, 4, 0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 0}
+
+	e, err := ReadGit(bytes.NewReader(b))
+	if err != nil || e.Size() != 4 || e.Cardinality() != 2 || !e.Get(0) || !e.Get(3) {
+		t.Fatalf("got %v, %v", e, err)
+	}
+
+	var buf bytes.Buffer
+	if n, err := e.WriteGit(&buf); err != nil || n != int64(len(b)) || !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("got %v, %d, %v", buf.Bytes(), n, err)
+	}
+
+	if _, err := ReadGit(bytes.NewReader(b[:10])); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("got %v, want ErrCorruptData", err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	defer SetJSONFormat(CurrentJSONFormat())
+
+	a := NewEwah()
+	for i := int64(0); i < 1000; i += 7 {
+		a.Set(i)
+	}
+	a.SetRange(2000, 3000)
+
+	type payload struct {
+		Docs *Ewah `json:"docs"`
+	}
+
+	for _, c := range []struct {
+		format JSONFormat
+		prefix string
+	}{
+		{JSONPositions, `{"docs":[0,7,14,`},
+		{JSONBase64, `{"docs":"`},
+	} {
+		SetJSONFormat(c.format)
+
+		b, err := json.Marshal(payload{a})
+		if err != nil || !strings.HasPrefix(string(b), c.prefix) {
+			t.Fatalf("format %d: got %s, %v", c.format, b, err)
+		}
+
+		var got payload
+		if err := json.Unmarshal(b, &got); err != nil || !sameBits(got.Docs, a) {
+			t.Errorf("format %d: got %v, %v", c.format, got.Docs, err)
+		}
+	}
+
+	var got payload
+	if err := json.Unmarshal([]byte(`{"docs": [5, 1, 5, 3]}`), &got); err != nil || got.Docs.Cardinality() != 3 || got.Docs.Size() != 6 {
+		t.Errorf("got %v, %v", got.Docs, err)
+	}
+	if err := json.Unmarshal([]byte(`{"docs": null}`), &got); err != nil || got.Docs != nil {
+		t.Errorf("got %v, %v", got.Docs, err)
+	}
+
+	for b, want := range map[string]error{`[1, -1]`: ErrOutOfRange, `"AAAA"`: ErrCorruptData, `"???"`: ErrCorruptData} {
+		if err := NewEwah().UnmarshalJSON([]byte(b)); !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %v", b, err, want)
+		}
+	}
+}
+
+// sameBits returns true if a and b have the same bits set, whatever their size
+func sameBits(a, b *Ewah) bool {
+	x, y := a.Iterator(), b.Iterator()
+	for x.HasNext() && y.HasNext() {
+		if x.Next() != y.Next() {
+			return false
+		}
+	}
+
+	return !x.HasNext() && !y.HasNext()
+}
+
+func TestMsgpack(t *testing.T) {
+	for _, n := range []int64{10, 1000, 100000} {
+		a := NewEwah()
+		for i := int64(0); i < n; i += 3 {
+			a.Set(i)
+		}
+
+		b, err := a.MarshalMsgpack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The type byte says how many bytes the length takes
+		data := mustMarshal(a.MarshalBinary())
+		want := byte(msgpackBin32)
+		if len(data) <= math.MaxUint8 {
+			want = msgpackBin8
+		} else if len(data) <= math.MaxUint16 {
+			want = msgpackBin16
+		}
+		if b[0] != want {
+			t.Errorf("%d bytes: got type %#x, want %#x", len(data), b[0], want)
+		}
+		if !bytes.HasSuffix(b, data) {
+			t.Errorf("%d bytes: the value doesn't hold the binary encoding", len(data))
+		}
+
+		got := NewEwah()
+		if err := got.UnmarshalMsgpack(b); err != nil || !got.Equal(a) {
+			t.Errorf("got %v, %v, want %v", got, err, a)
+		}
+
+		if err := got.UnmarshalMsgpack(b[:len(b)-1]); !errors.Is(err, ErrCorruptData) {
+			t.Errorf("got %v, want ErrCorruptData", err)
+		}
+	}
+
+	a := NewEwah().MustSet(3)
+	if err := a.UnmarshalMsgpack([]byte{msgpackNil}); err != nil || a.Cardinality() != 1 {
+		t.Errorf("nil: got %v, %v", a, err)
+	}
+	if err := a.UnmarshalMsgpack([]byte{0xa1, 'a'}); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("got %v, want ErrCorruptData", err)
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	a := NewEwah()
+	for i := int64(0); i < 3000; i += 3 {
+		a.Set(i)
+	}
+
+	b, err := a.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tag "EWAH" in 4 bytes, then a byte string whose length takes 2 bytes
+	data := mustMarshal(a.MarshalBinary())
+	if !bytes.HasPrefix(b, []byte{0xda, 'E', 'W', 'A', 'H', 0x59, byte(len(data) >> 8), byte(len(data))}) ||
+		!bytes.HasSuffix(b, data) {
+		t.Errorf("got % x", b[:8])
+	}
+
+	for _, v := range [][]byte{b, b[5:]} {
+		got := NewEwah()
+		if err := got.UnmarshalCBOR(v); err != nil || !got.Equal(a) {
+			t.Errorf("got %v, %v", got, err)
+		}
+	}
+
+	if err := a.UnmarshalCBOR([]byte{cborNull}); err != nil || a.Cardinality() != 1000 {
+		t.Errorf("null: got %v, %v", a, err)
+	}
+
+	defer SetCBORTag(CBORTag())
+	SetCBORTag(40000)
+	for _, v := range [][]byte{b, b[:len(b)-1], {0x60}, {0x5b, 1}} {
+		if err := NewEwah().UnmarshalCBOR(v); !errors.Is(err, ErrCorruptData) {
+			t.Errorf("% x: got %v, want ErrCorruptData", v[:1], err)
+		}
+	}
+	if b, _ := a.MarshalCBOR(); !bytes.HasPrefix(b, []byte{0xd9, 0x9c, 0x40}) {
+		t.Errorf("got % x for tag 40000", b[:3])
+	}
+}
+
+func TestFromCompressed(t *testing.T) {
+	a := NewEwah()
+	for i := int64(0); i < 10000; i += 3 {
+		a.Set(i)
+	}
+	a.SetRange(20000, 30000)
+
+	words := a.AppendWords(nil)
+	if int64(len(words)) != a.CompressedWords() {
+		t.Fatalf("got %d words, want %d", len(words), a.CompressedWords())
+	}
+
+	b, err := FromCompressed(words, a.Size())
+	if err != nil || !b.Equal(a) || b.Validate() != nil {
+		t.Fatalf("got %v, %v", b, err)
+	}
+
+	// The words are copied
+	words[1] = 0
+	b.Set(40000)
+	if !a.Get(3) || a.Get(40000) {
+		t.Error("the bitmaps share their words")
+	}
+
+	words[0] |= LargestLiteralCount << uint32(1+RunningLengthBits)
+	for _, w := range [][]uint64{nil, words} {
+		if _, err := FromCompressed(w, 100); !errors.Is(err, ErrCorruptData) {
+			t.Errorf("got %v, want ErrCorruptData", err)
+		}
+	}
+}
+
+func TestCrossCheckBitset(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	bitmaptest.CrossCheck(t, 100, func() (bitmap.Bitmap, *bitset.Bitset) {
+		return crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+	})
+}
+
+// crossCheckBitmaps returns the same random bitmap as an Ewah and as a Bitset, see bitmaptest.Bits
+func crossCheckBitmaps(gap int) (*Ewah, *bitset.Bitset) {
+	e, b := bitmaptest.Bits(New, 500, gap, gap*100)
+	return e.(*Ewah), b
+}
+
 func BenchmarkGet(b *testing.B) {
 	//fmt.Printf("BenchmarkSetAndGet %d bits\n", b.N)
 	failed := 0
@@ -403,8 +3491,8 @@ func BenchmarkXor(b *testing.B) {
 // s1 is the sparsity of the first bitmap
 // s2 is the sparsity of the second bitmap
 func benchmarkDifferentCombinations(b *testing.B, op string, b1, b2 int, s1, s2 int) {
-	m1 := New().(*Ewah)
-	m2 := New().(*Ewah)
+	m1 := NewEwah()
+	m2 := NewEwah()
 
 	bit := int64(0)
 	rand.Seed(int64(c1))
@@ -437,7 +3525,7 @@ func benchmarkDifferentCombinations(b *testing.B, op string, b1, b2 int, s1, s2
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		if f(m2) == nil {
-			b.Fatal("Problem with %s benchmark at i =", op, i)
+			b.Fatalf("Problem with %s benchmark at i = %d", op, i)
 		}
 	}
 }
@@ -448,8 +3536,8 @@ func testGenerateData(t *testing.T) {
 	ks := []int{3, 30, 300, 3000, 30000}
 	ls := []int{3, 30, 300, 3000, 30000}
 
-	m1 := New().(*Ewah)
-	m2 := New().(*Ewah)
+	m1 := NewEwah()
+	m2 := NewEwah()
 
 	for i := range is {
 		for j := range js {
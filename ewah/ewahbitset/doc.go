@@ -0,0 +1,13 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahbitset converts EWAH bitmaps to and from github.com/bits-and-blooms/bitset bitsets, copying
+// whole words instead of one bit at a time. It's only built with the bitsandblooms build tag, so the rest of
+// the library doesn't depend on bitset:
+//
+//	go get github.com/bits-and-blooms/bitset
+//	go build -tags bitsandblooms
+package ewahbitset
@@ -0,0 +1,46 @@
+//go:build bitsandblooms
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahbitset
+
+import (
+	"github.com/bits-and-blooms/bitset"
+	"github.com/reducedb/bitmap/ewah"
+)
+
+// FromBitSet returns an EWAH bitmap with the bits of b, and the same length. It returns nil if b is longer
+// than EWAH supports.
+func FromBitSet(b *bitset.BitSet) *ewah.Ewah {
+	return ewah.FromWords(b.Words(), int64(b.Len()))
+}
+
+// ToBitSet returns a bitset with the bits of e, as long as e. Runs are uncompressed into whole words, so
+// the bitset takes Size()/8 bytes whatever the number of bits set.
+func ToBitSet(e *ewah.Ewah) *bitset.BitSet {
+	n := (e.Size() + 63) / 64
+	words := make([]uint64, 0, n)
+
+	e.WalkWords(func(v bool, k int64) {
+		w := uint64(0)
+		if v {
+			w = ^uint64(0)
+		}
+		for ; k > 0; k-- {
+			words = append(words, w)
+		}
+	}, func(w uint64) {
+		words = append(words, w)
+	})
+
+	// The words may not reach the size, after some operations
+	for int64(len(words)) < n {
+		words = append(words, 0)
+	}
+
+	return bitset.FromWithLength(uint(e.Size()), words[:n])
+}
@@ -0,0 +1,46 @@
+//go:build bitsandblooms
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahbitset
+
+import (
+	"github.com/bits-and-blooms/bitset"
+	"github.com/reducedb/bitmap/ewah"
+	"github.com/reducedb/bitmap/ewah/ewahtest"
+	"math/rand"
+	"testing"
+)
+
+func TestBitSet(t *testing.T) {
+	e := ewah.NewEwah()
+	for i := int64(0); i < 100000; i += 1 + rand.Int63n(100) {
+		e.Set(i)
+	}
+	e.SetRange(100010, 300000)
+	e.Set(400000)
+
+	b := ToBitSet(e)
+	if b.Len() != uint(e.Size()) || b.Count() != uint(e.Cardinality()) {
+		t.Fatalf("ToBitSet: length %d and count %d, should be %d and %d", b.Len(), b.Count(), e.Size(), e.Cardinality())
+	}
+
+	it := e.Iterator()
+	for i, ok := b.NextSet(0); ok; i, ok = b.NextSet(i + 1) {
+		if j := it.Next(); int64(i) != j {
+			t.Fatalf("ToBitSet: %d is set, should be %d", i, j)
+		}
+	}
+
+	ewahtest.Equal(t, FromBitSet(b), e)
+
+	c := bitset.New(130).Set(1).Set(129)
+	ewahtest.EqualPositions(t, FromBitSet(c), 1, 129)
+	if FromBitSet(c).Size() != 130 {
+		t.Errorf("FromBitSet: size %d, should be 130", FromBitSet(c).Size())
+	}
+}
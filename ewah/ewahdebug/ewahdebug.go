@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahdebug serves the statistics of the bitmaps of a live service over HTTP, in the spirit of
+// net/http/pprof. Importing it registers its handler under /debug/ewah/ on http.DefaultServeMux:
+//
+//	import _ "github.com/reducedb/bitmap/ewah/ewahdebug"
+//
+// The bitmaps to inspect are registered by name with Register, and the pages are plain text:
+//
+//	/debug/ewah/                      the registered bitmaps, with their size and cardinality
+//	/debug/ewah/name                  the statistics of the bitmap: Stats, RunHistogram and GapStats
+//	/debug/ewah/name/density?chunk=n  the fraction of bits set in each chunk of n bits (65536 by default)
+//	/debug/ewah/name/hex              a hex dump of the bitmap, encoded by MarshalBinary
+package ewahdebug
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/reducedb/bitmap/ewah"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prefix is the path the handler is registered under on http.DefaultServeMux
+const Prefix = "/debug/ewah/"
+
+var registry = struct {
+	sync.RWMutex
+	bitmaps map[string]func() *ewah.Ewah
+}{bitmaps: make(map[string]func() *ewah.Ewah)}
+
+func init() {
+	http.Handle(Prefix, Handler())
+}
+
+// Register makes the bitmap returned by f available under name, replacing the one already there. f is
+// called for each request, and must return a bitmap that isn't modified while it's read, like a snapshot
+// or a frozen bitmap.
+func Register(name string, f func() *ewah.Ewah) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.bitmaps[name] = f
+}
+
+// Unregister removes the bitmap registered under name
+func Unregister(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	delete(registry.bitmaps, name)
+}
+
+// Handler returns the handler serving the registered bitmaps. It expects the paths to start with Prefix,
+// so it's usually registered on another mux under that prefix.
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+//
+// Not-exported functions
+//
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	path := strings.TrimPrefix(r.URL.Path, Prefix)
+	if path == "" {
+		index(w)
+		return
+	}
+
+	// Names may have slashes too, so the whole path is tried first
+	name, page := path, ""
+	f, ok := lookup(name)
+	if k := strings.LastIndex(path, "/"); !ok && k >= 0 {
+		name, page = path[:k], path[k+1:]
+		f, ok = lookup(name)
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("no bitmap named %q", name), http.StatusNotFound)
+		return
+	}
+
+	e := f()
+
+	switch page {
+	case "":
+		fmt.Fprintln(w, e)
+		fmt.Fprintf(w, "stats: %+v\n", e.Stats())
+		fmt.Fprintf(w, "runs: %+v\n", e.RunHistogram())
+		fmt.Fprintf(w, "gaps: %+v\n", e.GapStats())
+
+	case "density":
+		chunk := int64(65536)
+		if s := r.FormValue("chunk"); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid chunk %q", s), http.StatusBadRequest)
+				return
+			}
+			chunk = n
+		}
+
+		for k, d := range e.DensityProfile(chunk) {
+			fmt.Fprintf(w, "%d\t%.6f\n", int64(k)*chunk, d)
+		}
+
+	case "hex":
+		b, err := e.MarshalBinary()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprint(w, hex.Dump(b))
+
+	default:
+		http.Error(w, fmt.Sprintf("unknown page %q", page), http.StatusNotFound)
+	}
+}
+
+func index(w http.ResponseWriter) {
+	registry.RLock()
+	names := make([]string, 0, len(registry.bitmaps))
+	for name := range registry.bitmaps {
+		names = append(names, name)
+	}
+	registry.RUnlock()
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if f, ok := lookup(name); ok {
+			fmt.Fprintf(w, "%s\t%v\n", name, f())
+		}
+	}
+}
+
+func lookup(name string) (func() *ewah.Ewah, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.bitmaps[name]
+	return f, ok
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahdebug
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	e := ewah.NewEwah()
+	for i := int64(0); i < 1000; i += 2 {
+		e.Set(i)
+	}
+	Register("users/active", e.Snapshot)
+	Register("empty", func() *ewah.Ewah { return ewah.NewEwah() })
+	defer Unregister("users/active")
+	defer Unregister("empty")
+
+	s := httptest.NewServer(http.DefaultServeMux)
+	defer s.Close()
+
+	for _, c := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"", 200, "empty\tewah{size: 0, cardinality: 0, words: 1}\nusers/active\tewah{size: 999, cardinality: 500"},
+		{"users/active", 200, "stats: {MarkerWords:1 LiteralWords:16"},
+		{"users/active/density?chunk=500", 200, "0\t0.500000\n500\t0.501002\n"},
+		{"users/active/hex", 200, "00000000  00 00 03 e7 00 00 00 11"},
+		{"users/active/density?chunk=0", 400, "invalid chunk"},
+		{"users/active/foo", 404, "unknown page"},
+		{"users", 404, "no bitmap"},
+	} {
+		resp, err := http.Get(s.URL + Prefix + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.code || !strings.Contains(string(b), c.want) {
+			t.Errorf("%s: %d %q, should be %d with %q", c.path, resp.StatusCode, b, c.code, c.want)
+		}
+	}
+}
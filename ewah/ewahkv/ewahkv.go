@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahkv stores EWAH bitmaps as the values of embedded key-value stores, like Bolt or Badger. It
+// doesn't depend on any of them: the functions take the methods of the stores, which have the same
+// signatures.
+//
+// A bitmap, or a shard of a bitmap, is stored under a key made of a prefix, the name of the bitmap and the
+// shard number, each one prefixed with its length so any name can be used:
+//
+//	uvarint(len(prefix)) | prefix | uvarint(len(name)) | name | shard (uint64, big endian)
+//
+// The shards of a bitmap sort in order after KeyPrefix(prefix, name), for prefix scans. Values are
+// encoded with MarshalBinary.
+//
+// With Badger, bits can be added without reading the bitmap first, with a merge operator doing an Or:
+//
+//	m := db.GetMergeOperator(key, ewahkv.OrMerge, time.Second)
+//	m.Add(value)
+//
+// With Bolt, OrInto does the same within a transaction:
+//
+//	err := ewahkv.OrInto(bucket.Get, bucket.Put, key, e)
+package ewahkv
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"sync"
+)
+
+// Key returns the key of the shard of the bitmap called name, under prefix
+func Key(prefix, name string, shard uint64) []byte {
+	b := KeyPrefix(prefix, name)
+	return binary.BigEndian.AppendUint64(b, shard)
+}
+
+// KeyPrefix returns the start of the keys of all the shards of the bitmap called name, under prefix
+func KeyPrefix(prefix, name string) []byte {
+	b := make([]byte, 0, 2*binary.MaxVarintLen64+len(prefix)+len(name)+8)
+	b = binary.AppendUvarint(b, uint64(len(prefix)))
+	b = append(b, prefix...)
+	b = binary.AppendUvarint(b, uint64(len(name)))
+	b = append(b, name...)
+
+	return b
+}
+
+// ParseKey returns the prefix, the name and the shard of a key made by Key
+func ParseKey(key []byte) (string, string, uint64, error) {
+	var parts [2]string
+	for k := range parts {
+		n, l := binary.Uvarint(key)
+		if l <= 0 || uint64(len(key)-l) < n {
+			return "", "", 0, errors.New("ewahkv/ParseKey: invalid key")
+		}
+
+		parts[k] = string(key[l : l+int(n)])
+		key = key[l+int(n):]
+	}
+
+	if len(key) != 8 {
+		return "", "", 0, errors.New("ewahkv/ParseKey: invalid key")
+	}
+
+	return parts[0], parts[1], binary.BigEndian.Uint64(key), nil
+}
+
+// Encode returns the value of the bitmap
+func Encode(e *ewah.Ewah) ([]byte, error) {
+	return e.MarshalBinary()
+}
+
+// Decode returns the bitmap of a value
+func Decode(b []byte) (*ewah.Ewah, error) {
+	e := ewah.NewEwah()
+	if err := e.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Value is a value read from a store, decoded the first time the bitmap is needed. Its size is read from
+// the value without decoding it. Any number of goroutines can use it at the same time.
+type Value struct {
+	b []byte
+
+	once sync.Once
+	e    *ewah.Ewah
+	err  error
+}
+
+// Lazy returns the value b, which is copied since stores like Bolt only keep values valid during the
+// transaction
+func Lazy(b []byte) *Value {
+	return &Value{b: append([]byte(nil), b...)}
+}
+
+// Size returns the size of the bitmap in bits, or -1 if the value is too short to hold a bitmap
+func (this *Value) Size() int64 {
+	if len(this.b) < 4 {
+		return -1
+	}
+
+	return int64(int32(binary.BigEndian.Uint32(this.b)))
+}
+
+// Bitmap decodes the value the first time it's called, and returns the bitmap. The bitmap is shared by
+// all the callers, so it must not be modified.
+func (this *Value) Bitmap() (*ewah.Ewah, error) {
+	this.once.Do(func() {
+		this.e, this.err = Decode(this.b)
+	})
+
+	return this.e, this.err
+}
+
+// OrMerge returns the value of the union of two values, for Badger's merge operator. Since a merge function
+// can't fail, a value that can't be decoded is dropped: if neither can be decoded, existing is returned. So
+// is existing if the union could exceed the budget set with ewah.SetMaxResultWords.
+func OrMerge(existing, value []byte) []byte {
+	a, errA := Decode(existing)
+	b, errB := Decode(value)
+
+	switch {
+	case errA != nil && errB != nil:
+		return existing
+	case errA != nil:
+		return value
+	case errB != nil:
+		return existing
+	}
+
+	union, err := a.OrChecked(b)
+	if err != nil {
+		return existing
+	}
+
+	ans, err := Encode(union.(*ewah.Ewah))
+	if err != nil {
+		return existing
+	}
+
+	return ans
+}
+
+// OrInto adds the bits of e to the bitmap stored under key, or stores e if there's none, with get and put
+// being the methods of a store, like those of a Bolt bucket. It must run within a transaction, for the
+// read and the write to be atomic. If the union could exceed the budget set with ewah.SetMaxResultWords, it
+// returns ewah.ErrResultTooLarge and stores nothing.
+func OrInto(get func(key []byte) []byte, put func(key, value []byte) error, key []byte, e *ewah.Ewah) error {
+	if b := get(key); b != nil {
+		existing, err := Decode(b)
+		if err != nil {
+			return err
+		}
+
+		union, err := existing.OrChecked(e)
+		if err != nil {
+			return err
+		}
+		e = union.(*ewah.Ewah)
+	}
+
+	b, err := Encode(e)
+	if err != nil {
+		return err
+	}
+
+	return put(key, b)
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahkv
+
+import (
+	"bytes"
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"github.com/reducedb/bitmap/ewah/ewahtest"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	k := Key("idx", "color=red", 42)
+	if !bytes.HasPrefix(k, KeyPrefix("idx", "color=red")) {
+		t.Errorf("%x doesn't start with the prefix", k)
+	}
+	if bytes.Compare(Key("idx", "a", 1), Key("idx", "a", 256)) >= 0 {
+		t.Errorf("shards don't sort in order")
+	}
+	if bytes.HasPrefix(Key("idx", "ab", 0), KeyPrefix("idx", "a")) {
+		t.Errorf("the prefix of a matches the keys of ab")
+	}
+
+	prefix, name, shard, err := ParseKey(k)
+	if err != nil || prefix != "idx" || name != "color=red" || shard != 42 {
+		t.Errorf("ParseKey: %q, %q, %d, %v", prefix, name, shard, err)
+	}
+
+	for _, k := range [][]byte{nil, {5, 'a'}, k[:len(k)-1]} {
+		if _, _, _, err := ParseKey(k); err == nil {
+			t.Errorf("ParseKey(%x): no error", k)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	a, b := ewah.NewEwah(), ewah.NewEwah()
+	a.Set(3)
+	a.Set(1000)
+	b.Set(5)
+
+	va, _ := Encode(a)
+	vb, _ := Encode(b)
+
+	v := Lazy(va)
+	va[0] = 0xff
+	if v.Size() != 1001 {
+		t.Errorf("Size: %d, should be 1001", v.Size())
+	}
+	if e, err := v.Bitmap(); err != nil || !ewahtest.Equal(t, e, a) {
+		t.Errorf("Bitmap: %v", err)
+	}
+	if _, err := Lazy([]byte{1}).Bitmap(); err == nil || Lazy(nil).Size() != -1 {
+		t.Errorf("an invalid value should fail")
+	}
+
+	va, _ = Encode(a)
+	m, err := Decode(OrMerge(va, vb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ewahtest.EqualPositions(t, m, 3, 5, 1000)
+
+	if !bytes.Equal(OrMerge(va, []byte{1}), va) || !bytes.Equal(OrMerge(nil, vb), vb) {
+		t.Errorf("OrMerge should drop the invalid values")
+	}
+
+	store := map[string][]byte{}
+	get := func(key []byte) []byte { return store[string(key)] }
+	put := func(key, value []byte) error {
+		store[string(key)] = value
+		return nil
+	}
+
+	key := Key("", "x", 0)
+	if err := OrInto(get, put, key, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := OrInto(get, put, key, b); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := Decode(store[string(key)])
+	ewahtest.EqualPositions(t, e, 3, 5, 1000)
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if !bytes.Equal(OrMerge(va, vb), va) {
+		t.Errorf("OrMerge over the budget should return the existing value")
+	}
+	before := store[string(key)]
+	if err := OrInto(get, put, key, ewah.NewEwah().Set(2000).(*ewah.Ewah)); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Errorf("OrInto over the budget: %v", err)
+	}
+	if !bytes.Equal(store[string(key)], before) {
+		t.Errorf("OrInto over the budget should store nothing")
+	}
+}
@@ -0,0 +1,18 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahotel traces the heavy operations of the ewah package with OpenTelemetry. It's only built with
+// the otel build tag, so the rest of the library doesn't depend on OpenTelemetry:
+//
+//	go get go.opentelemetry.io/otel
+//	go build -tags otel
+//
+// The tracer is set as the tracer of the ewah package, after the tracer provider is set up:
+//
+//	ewah.SetTracer(ewahotel.New(nil))
+//
+// Without it, or without the build tag, the ewah package doesn't create any span.
+package ewahotel
@@ -0,0 +1,65 @@
+//go:build otel
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahotel
+
+import (
+	"context"
+	"github.com/reducedb/bitmap/ewah"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the OpenTelemetry tracer
+const InstrumentationName = "github.com/reducedb/bitmap/ewah"
+
+// Tracer creates a span for each operation of the ewah package, named ewah.<op>, like ewah.and or
+// ewah.unmarshal, with the attributes:
+//
+//	ewah.operands              the number of operands
+//	ewah.operand_words         the size of each operand, in words
+//	ewah.result_cardinality    the number of bits set in the result, if the operation succeeded
+//
+// If the operation fails, the error is recorded on the span, and its status is set to Error.
+type Tracer struct {
+	t trace.Tracer
+}
+
+var _ ewah.Tracer = (*Tracer)(nil)
+
+// New returns a tracer that creates its spans with the tracer provider, or with the global one if tp is
+// nil
+func New(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return &Tracer{
+		t: tp.Tracer(InstrumentationName),
+	}
+}
+
+func (this *Tracer) Start(ctx context.Context, op string, operandWords []int64) func(int64, error) {
+	_, span := this.t.Start(ctx, "ewah."+op, trace.WithAttributes(
+		attribute.Int("ewah.operands", len(operandWords)),
+		attribute.Int64Slice("ewah.operand_words", operandWords),
+	))
+
+	return func(resultCardinality int64, err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(attribute.Int64("ewah.result_cardinality", resultCardinality))
+		}
+
+		span.End()
+	}
+}
@@ -0,0 +1,90 @@
+//go:build otel
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahotel
+
+import (
+	"context"
+	"github.com/reducedb/bitmap/ewah"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ewah.SetTracer(New(tp))
+	defer ewah.SetTracer(nil)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+
+	a, b := ewah.NewEwah(), ewah.NewEwah()
+	for i := int64(0); i < 1000; i += 2 {
+		a.Set(i)
+		b.Set(i + 1)
+	}
+
+	if _, err := a.AndCtx(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ewah.ParallelOrAll(ctx, []*ewah.Ewah{a, b}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ewah.NewEwah().UnmarshalBinary(nil); err == nil {
+		t.Fatal("UnmarshalBinary should fail")
+	}
+
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+
+	attributes := func(k int) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range spans[k].Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	for k, c := range []struct {
+		name        string
+		cardinality int64
+	}{
+		{"ewah.and", 0},
+		{"ewah.parallelor", 1000},
+	} {
+		if spans[k].Name() != c.name {
+			t.Fatalf("expected span %s, got %s", c.name, spans[k].Name())
+		}
+		if spans[k].Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of the request", c.name)
+		}
+
+		attrs := attributes(k)
+		if attrs["ewah.operands"].AsInt64() != 2 || len(attrs["ewah.operand_words"].AsInt64Slice()) != 2 {
+			t.Errorf("%s: wrong operands %v", c.name, attrs)
+		}
+		if v, ok := attrs["ewah.result_cardinality"]; !ok || v.AsInt64() != c.cardinality {
+			t.Errorf("%s: expected a cardinality of %d, got %v", c.name, c.cardinality, v)
+		}
+	}
+
+	if spans[2].Name() != "ewah.unmarshal" || spans[2].Status().Code != codes.Error || len(spans[2].Events()) == 0 {
+		t.Errorf("the failed unmarshal should be recorded as an error")
+	}
+	if _, ok := attributes(2)["ewah.result_cardinality"]; ok {
+		t.Errorf("the failed unmarshal has a cardinality")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build grpc
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahpb
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+)
+
+// ToProto returns the message of the bitmap. A nil bitmap is an empty one.
+func ToProto(e *ewah.Ewah) *Bitmap {
+	return &Bitmap{
+		SizeInBits: e.Size(),
+		Words:      e.AppendWords(nil),
+	}
+}
+
+// FromProto returns the bitmap of the message. A nil message, or one without words and size, is an empty
+// bitmap. Words that are not valid return an error matching ewah.ErrCorruptData.
+func FromProto(m *Bitmap) (*ewah.Ewah, error) {
+	if len(m.GetWords()) == 0 && m.GetSizeInBits() == 0 {
+		return ewah.NewEwah(), nil
+	}
+
+	return ewah.FromCompressed(m.GetWords(), m.GetSizeInBits())
+}
@@ -0,0 +1,20 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahpb defines the protocol buffers message of an EWAH bitmap, in ewah.proto, so the services
+// exchanging bitmaps over gRPC share the same one, and converts the bitmaps to and from it. Unlike the
+// format of MarshalBinary in a bytes field, the message is readable by any protocol buffers tool. Like the
+// grpcserver package, it's only built with the grpc build tag:
+//
+//	msg := ewahpb.ToProto(e)
+//	...
+//	e, err := ewahpb.FromProto(msg)
+//
+// Other .proto files use the message by importing ewah.proto, as ewah.ewahpb.Bitmap.
+package ewahpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative ewah.proto
+//go:generate sed -i "1i //go:build grpc\n" ewah.pb.go
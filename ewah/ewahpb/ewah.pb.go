@@ -0,0 +1,141 @@
+//go:build grpc
+
+// Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: ewah.proto
+
+package ewahpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Bitmap is an EWAH bitmap with 64-bit words
+type Bitmap struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// size_in_bits is the size of the bitmap, the position of the last bit set + 1 or more
+	SizeInBits int64 `protobuf:"varint,1,opt,name=size_in_bits,json=sizeInBits,proto3" json:"size_in_bits,omitempty"`
+	// words are the compressed words of the bitmap, as returned by AppendWords
+	Words         []uint64 `protobuf:"varint,2,rep,packed,name=words,proto3" json:"words,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Bitmap) Reset() {
+	*x = Bitmap{}
+	mi := &file_ewah_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Bitmap) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Bitmap) ProtoMessage() {}
+
+func (x *Bitmap) ProtoReflect() protoreflect.Message {
+	mi := &file_ewah_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Bitmap.ProtoReflect.Descriptor instead.
+func (*Bitmap) Descriptor() ([]byte, []int) {
+	return file_ewah_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Bitmap) GetSizeInBits() int64 {
+	if x != nil {
+		return x.SizeInBits
+	}
+	return 0
+}
+
+func (x *Bitmap) GetWords() []uint64 {
+	if x != nil {
+		return x.Words
+	}
+	return nil
+}
+
+var File_ewah_proto protoreflect.FileDescriptor
+
+const file_ewah_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"ewah.proto\x12\vewah.ewahpb\"@\n" +
+	"\x06Bitmap\x12 \n" +
+	"\fsize_in_bits\x18\x01 \x01(\x03R\n" +
+	"sizeInBits\x12\x14\n" +
+	"\x05words\x18\x02 \x03(\x04R\x05wordsB(Z&github.com/reducedb/bitmap/ewah/ewahpbb\x06proto3"
+
+var (
+	file_ewah_proto_rawDescOnce sync.Once
+	file_ewah_proto_rawDescData []byte
+)
+
+func file_ewah_proto_rawDescGZIP() []byte {
+	file_ewah_proto_rawDescOnce.Do(func() {
+		file_ewah_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ewah_proto_rawDesc), len(file_ewah_proto_rawDesc)))
+	})
+	return file_ewah_proto_rawDescData
+}
+
+var file_ewah_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_ewah_proto_goTypes = []any{
+	(*Bitmap)(nil), // 0: ewah.ewahpb.Bitmap
+}
+var file_ewah_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_ewah_proto_init() }
+func file_ewah_proto_init() {
+	if File_ewah_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ewah_proto_rawDesc), len(file_ewah_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_ewah_proto_goTypes,
+		DependencyIndexes: file_ewah_proto_depIdxs,
+		MessageInfos:      file_ewah_proto_msgTypes,
+	}.Build()
+	File_ewah_proto = out.File
+	file_ewah_proto_goTypes = nil
+	file_ewah_proto_depIdxs = nil
+}
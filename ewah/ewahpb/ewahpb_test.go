@@ -0,0 +1,52 @@
+//go:build grpc
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahpb
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+func TestProto(t *testing.T) {
+	e := ewah.NewEwah()
+	for i := int64(0); i < 10000; i += 3 {
+		e.Set(i)
+	}
+	e.SetRange(20000, 30000)
+
+	b, err := proto.Marshal(ToProto(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m Bitmap
+	if err := proto.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.SizeInBits != e.Size() || int64(len(m.Words)) != e.CompressedWords() {
+		t.Errorf("got %d bits and %d words", m.SizeInBits, len(m.Words))
+	}
+
+	got, err := FromProto(&m)
+	if err != nil || !got.Equal(e) {
+		t.Errorf("got %v, %v, want %v", got, err, e)
+	}
+
+	for _, m := range []*Bitmap{nil, {}, ToProto(nil)} {
+		if got, err := FromProto(m); err != nil || got.Size() != 0 || got.Cardinality() != 0 {
+			t.Errorf("got %v, %v, want an empty bitmap", got, err)
+		}
+	}
+
+	if _, err := FromProto(&Bitmap{SizeInBits: 100, Words: []uint64{1 << 40}}); !errors.Is(err, ewah.ErrCorruptData) {
+		t.Errorf("got %v, want ewah.ErrCorruptData", err)
+	}
+}
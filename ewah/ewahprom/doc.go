@@ -0,0 +1,18 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahprom exports the metrics of the ewah package to Prometheus. It's only built with the
+// prometheus build tag, so the rest of the library doesn't depend on the Prometheus client:
+//
+//	go get github.com/prometheus/client_golang
+//	go build -tags prometheus
+//
+// The collector is registered with Prometheus, and set as the metrics of the ewah package:
+//
+//	c := ewahprom.New("myservice")
+//	prometheus.MustRegister(c)
+//	ewah.SetMetrics(c)
+package ewahprom
@@ -0,0 +1,78 @@
+//go:build prometheus
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/reducedb/bitmap/ewah"
+)
+
+// Collector receives the metrics of the ewah package, and exports them to Prometheus:
+//
+//	<namespace>_ewah_operations_total{op}          the number of operations
+//	<namespace>_ewah_result_words{op}              the histogram of the sizes of their results, in words
+//	<namespace>_ewah_pool_tasks_total{result}      the tasks given to the pool, with result hit or miss
+type Collector struct {
+	operations *prometheus.CounterVec
+	words      *prometheus.HistogramVec
+	pool       *prometheus.CounterVec
+}
+
+var _ ewah.Metrics = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
+
+// New returns a collector with metrics in the namespace, which can be empty
+func New(namespace string) *Collector {
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ewah",
+			Name:      "operations_total",
+			Help:      "Number of bitmap operations.",
+		}, []string{"op"}),
+		words: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "ewah",
+			Name:      "result_words",
+			Help:      "Size of the results of the bitmap operations, in words.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 12),
+		}, []string{"op"}),
+		pool: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ewah",
+			Name:      "pool_tasks_total",
+			Help:      "Number of tasks given to the pool, by whether a goroutine was free (hit) or not (miss).",
+		}, []string{"result"}),
+	}
+}
+
+func (this *Collector) Operation(op string, resultWords int64) {
+	this.operations.WithLabelValues(op).Inc()
+	this.words.WithLabelValues(op).Observe(float64(resultWords))
+}
+
+func (this *Collector) PoolTask(hit bool) {
+	if hit {
+		this.pool.WithLabelValues("hit").Inc()
+	} else {
+		this.pool.WithLabelValues("miss").Inc()
+	}
+}
+
+func (this *Collector) Describe(ch chan<- *prometheus.Desc) {
+	this.operations.Describe(ch)
+	this.words.Describe(ch)
+	this.pool.Describe(ch)
+}
+
+func (this *Collector) Collect(ch chan<- prometheus.Metric) {
+	this.operations.Collect(ch)
+	this.words.Collect(ch)
+	this.pool.Collect(ch)
+}
@@ -0,0 +1,47 @@
+//go:build prometheus
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/reducedb/bitmap/ewah"
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	c := New("test")
+	r := prometheus.NewPedanticRegistry()
+	r.MustRegister(c)
+
+	ewah.SetMetrics(c)
+	defer ewah.SetMetrics(nil)
+
+	a, b := ewah.NewEwah(), ewah.NewEwah()
+	a.Set(1)
+	b.Set(100)
+	a.Or(b)
+	a.Or(b)
+	a.And(b)
+
+	want := `
+# HELP test_ewah_operations_total Number of bitmap operations.
+# TYPE test_ewah_operations_total counter
+test_ewah_operations_total{op="and"} 1
+test_ewah_operations_total{op="or"} 2
+`
+	if err := testutil.GatherAndCompare(r, strings.NewReader(want), "test_ewah_operations_total"); err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(c, "test_ewah_result_words"); n != 2 {
+		t.Errorf("%d result_words series, should be 2", n)
+	}
+}
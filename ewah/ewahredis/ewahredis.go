@@ -0,0 +1,358 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahredis implements the Redis bitmap commands, SETBIT, GETBIT, BITCOUNT, BITPOS and BITOP, over
+// EWAH bitmaps, so the same logic can run on compressed bitmaps outside of Redis.
+//
+// Like Redis, a bitmap is a string of bytes: offset 0 is the most significant bit of the first byte, the
+// string grows a byte at a time, and bytes past the end are 0's. Ranges are inclusive, and negative ones
+// count from the end of the string.
+package ewahredis
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"math"
+	"math/bits"
+)
+
+// Unit tells whether the start and end of a range are bytes or bits
+type Unit int
+
+const (
+	Byte Unit = iota
+	Bit
+)
+
+// Op is a BITOP operation
+type Op int
+
+const (
+	And Op = iota
+	Or
+	Xor
+	Not
+)
+
+// MaxOffset is the largest offset SETBIT accepts. It's lower than in Redis, since EWAH only goes up to
+// about 2^31 bits.
+const MaxOffset = math.MaxInt32 - 64
+
+// Bitmap is a Redis string used as a bitmap. Bit offset o is stored at position o^7 of the EWAH bitmap,
+// which puts the bits of each byte in the Redis order.
+type Bitmap struct {
+	e *ewah.Ewah
+
+	// length is the length of the string, in bytes
+	length int64
+}
+
+func New() *Bitmap {
+	return &Bitmap{e: ewah.NewEwah()}
+}
+
+// Ewah returns the EWAH bitmap holding the bits, offset o being at position o^7. It must not be modified.
+func (this *Bitmap) Ewah() *ewah.Ewah {
+	return this.e
+}
+
+// Len returns the length of the string in bytes, like STRLEN
+func (this *Bitmap) Len() int64 {
+	return this.length
+}
+
+// SetBit sets the bit at offset to value, 0 or 1, growing the string if needed, and returns the previous
+// value of the bit, like SETBIT. Bits can be set in any order, but setting a bit before the last one set
+// rewrites the bitmap, which fails with ewah.ErrResultTooLarge if it could exceed the budget set with
+// ewah.SetMaxResultWords.
+func (this *Bitmap) SetBit(offset int64, value int) (int, error) {
+	if offset < 0 || offset > MaxOffset {
+		return 0, errors.New("ewahredis/SetBit: bit offset is not an integer or out of range")
+	}
+	if value != 0 && value != 1 {
+		return 0, errors.New("ewahredis/SetBit: bit is not an integer or out of range")
+	}
+
+	old := this.GetBit(offset)
+	if old != value {
+		if err := this.setBit(offset^7, value); err != nil {
+			return 0, err
+		}
+	}
+
+	if offset/8+1 > this.length {
+		this.length = offset/8 + 1
+	}
+
+	return old, nil
+}
+
+// GetBit returns the value of the bit at offset, 0 past the end of the string, like GETBIT
+func (this *Bitmap) GetBit(offset int64) int {
+	if offset < 0 || offset >= this.length*8 {
+		return 0
+	}
+
+	if p := offset ^ 7; p < this.e.Size() && this.e.Get(p) {
+		return 1
+	}
+
+	return 0
+}
+
+// BitCount returns the number of bits set in the string, like BITCOUNT without a range
+func (this *Bitmap) BitCount() int64 {
+	return this.e.Cardinality()
+}
+
+// BitCountRange returns the number of bits set between start and end included, in bytes or bits, like
+// BITCOUNT with a range
+func (this *Bitmap) BitCountRange(start, end int64, unit Unit) int64 {
+	first, last, ok := this.bitRange(start, end, unit)
+	if !ok {
+		return 0
+	}
+
+	n := int64(0)
+	this.walk(first, last+1, func(pos, k int64, v bool) bool {
+		if v {
+			n += k
+		}
+		return false
+	}, func(pos int64, w, mask uint64) bool {
+		n += int64(bits.OnesCount64(w & mask))
+		return false
+	})
+
+	return n
+}
+
+// BitPos returns the offset of the first bit set to bit, 0 or 1, like BITPOS without a range. The string is
+// padded with 0's, so the first 0 is at most at the end of the string. It returns -1 if there's no bit set.
+func (this *Bitmap) BitPos(bit int) int64 {
+	return this.BitPosFrom(bit, 0, Byte)
+}
+
+// BitPosFrom is BitPos from start, in bytes or bits, like BITPOS with a start only
+func (this *Bitmap) BitPosFrom(bit int, start int64, unit Unit) int64 {
+	first, last, ok := this.bitRange(start, -1, unit)
+	if !ok {
+		// An empty string is all 0's
+		if bit == 0 && this.length == 0 {
+			return 0
+		}
+		return -1
+	}
+
+	if i := this.bitPos(bit, first, last); i >= 0 || bit == 1 {
+		return i
+	}
+
+	return last + 1
+}
+
+// BitPosRange is BitPos between start and end included, in bytes or bits, like BITPOS with a range. Unlike
+// BitPos and BitPosFrom, it returns -1 if there's no 0 in the range.
+func (this *Bitmap) BitPosRange(bit int, start, end int64, unit Unit) int64 {
+	first, last, ok := this.bitRange(start, end, unit)
+	if !ok {
+		return -1
+	}
+
+	return this.bitPos(bit, first, last)
+}
+
+// BitOp returns the result of op on the sources, like BITOP. The result is as long as the longest source,
+// the shorter ones being padded with 0's. Not takes a single source. The errors of the bitmap operations,
+// like ewah.ErrResultTooLarge, are returned as they are.
+func BitOp(op Op, srcs ...*Bitmap) (*Bitmap, error) {
+	if len(srcs) == 0 {
+		return nil, errors.New("ewahredis/BitOp: no source")
+	}
+	if op == Not && len(srcs) != 1 {
+		return nil, errors.New("ewahredis/BitOp: Not takes a single source")
+	}
+
+	r := &Bitmap{e: srcs[0].e.Clone().(*ewah.Ewah), length: srcs[0].length}
+
+	if op == Not {
+		// Flip the bits with a run of 1's as long as the string
+		ones := ewah.NewEwah()
+		if r.length > 0 {
+			ones.SetRange(0, r.length*8)
+		}
+		e, err := r.e.XorChecked(ones)
+		if err != nil {
+			return nil, err
+		}
+		r.e = e.(*ewah.Ewah)
+
+		return r, nil
+	}
+
+	for _, s := range srcs[1:] {
+		var e bitmap.Bitmap
+		var err error
+		switch op {
+		case And:
+			e, err = r.e.AndChecked(s.e)
+		case Or:
+			e, err = r.e.OrChecked(s.e)
+		case Xor:
+			e, err = r.e.XorChecked(s.e)
+		default:
+			return nil, errors.New("ewahredis/BitOp: unknown operation")
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.e = e.(*ewah.Ewah)
+
+		if s.length > r.length {
+			r.length = s.length
+		}
+	}
+
+	return r, nil
+}
+
+//
+// Not-exported functions
+//
+
+// setBit sets the bit at position p of the EWAH bitmap to value
+func (this *Bitmap) setBit(p int64, value int) error {
+	if value == 1 && p >= this.e.Size() {
+		this.e.Set(p)
+		return nil
+	}
+
+	b := ewah.NewEwah()
+	b.Set(p)
+
+	var r bitmap.Bitmap
+	var err error
+	if value == 1 {
+		r, err = this.e.OrChecked(b)
+	} else {
+		r, err = this.e.AndNotChecked(b)
+	}
+	if err != nil {
+		return err
+	}
+
+	this.e = r.(*ewah.Ewah)
+
+	return nil
+}
+
+// bitRange returns the first and last offsets of a range of the string, or false if it's empty
+func (this *Bitmap) bitRange(start, end int64, unit Unit) (int64, int64, bool) {
+	n := this.length
+	if unit == Bit {
+		n *= 8
+	}
+
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+	if start > end {
+		return 0, 0, false
+	}
+
+	if unit == Byte {
+		return start * 8, end*8 + 7, true
+	}
+
+	return start, end, true
+}
+
+// bitPos returns the first offset between first and last included with the bit set to bit, or -1
+func (this *Bitmap) bitPos(bit int, first, last int64) int64 {
+	ans := int64(-1)
+
+	this.walk(first, last+1, func(pos, k int64, v bool) bool {
+		if v == (bit == 1) {
+			ans = pos
+			return true
+		}
+		return false
+	}, func(pos int64, w, mask uint64) bool {
+		if bit == 0 {
+			w = ^w
+		}
+		if w &= mask; w == 0 {
+			return false
+		}
+
+		// The lowest byte with a match, and its most significant bit, which is its lowest offset
+		b := bits.TrailingZeros64(w) / 8
+		ans = pos + int64(b)*8 + int64(bits.LeadingZeros8(uint8(w>>uint(b*8))))
+		return true
+	})
+
+	return ans
+}
+
+// walk calls run for each stretch of k offsets from pos with the same value, and literal for each word of
+// offsets from pos with the mask of the offsets in [start, end[, until one of them returns true. Offsets
+// past the EWAH bitmap are a stretch of 0's.
+func (this *Bitmap) walk(start, end int64, run func(pos, k int64, v bool) bool, literal func(pos int64, w, mask uint64) bool) {
+	pos, done := int64(0), false
+
+	this.e.WalkWords(func(v bool, n int64) {
+		lo, hi := pos, pos+n*64
+		if lo < start {
+			lo = start
+		}
+		if hi > end {
+			hi = end
+		}
+
+		if !done && lo < hi {
+			done = run(lo, hi-lo, v)
+		}
+		pos += n * 64
+	}, func(w uint64) {
+		if !done && pos+64 > start && pos < end {
+			done = literal(pos, w, mask(pos, start, end))
+		}
+		pos += 64
+	})
+
+	if pos < start {
+		pos = start
+	}
+	if !done && pos < end {
+		run(pos, end-pos, false)
+	}
+}
+
+// mask returns the bits of the word at pos for the offsets in [start, end[
+func mask(pos, start, end int64) uint64 {
+	if start <= pos && pos+64 <= end {
+		return ^uint64(0)
+	}
+
+	m := uint64(0)
+	for o := pos; o < pos+64; o++ {
+		if o >= start && o < end {
+			m |= uint64(1) << uint((o^7)-pos)
+		}
+	}
+
+	return m
+}
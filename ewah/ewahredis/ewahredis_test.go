@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahredis
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// str is the reference model: the Redis string as bytes
+type str []byte
+
+func (this str) bit(o int64) int {
+	if o/8 >= int64(len(this)) {
+		return 0
+	}
+	return int(this[o/8]>>uint(7-o%8)) & 1
+}
+
+func (this str) set(o int64, v int) str {
+	for int64(len(this)) <= o/8 {
+		this = append(this, 0)
+	}
+	this[o/8] &^= 1 << uint(7-o%8)
+	this[o/8] |= byte(v) << uint(7-o%8)
+	return this
+}
+
+func build(t *testing.T, n int) (*Bitmap, str) {
+	b, s := New(), str(nil)
+
+	for k := 0; k < n; k++ {
+		o := rand.Int63n(2000)
+		if rand.Intn(10) == 0 {
+			// Long runs of 1's
+			for i := o; i < o+300; i++ {
+				b.SetBit(i, 1)
+				s = s.set(i, 1)
+			}
+		}
+
+		v := rand.Intn(2)
+		old, err := b.SetBit(o, v)
+		if err != nil || old != s.bit(o) {
+			t.Fatalf("SetBit(%d, %d): %d, %v, should be %d", o, v, old, err, s.bit(o))
+		}
+		s = s.set(o, v)
+	}
+
+	return b, s
+}
+
+func TestRedis(t *testing.T) {
+	b, s := build(t, 500)
+
+	if b.Len() != int64(len(s)) {
+		t.Fatalf("Len: %d, should be %d", b.Len(), len(s))
+	}
+
+	n := int64(0)
+	for o := int64(0); o < int64(len(s))*8+16; o++ {
+		if b.GetBit(o) != s.bit(o) {
+			t.Fatalf("GetBit(%d): %d, should be %d", o, b.GetBit(o), s.bit(o))
+		}
+		n += int64(s.bit(o))
+	}
+	if b.BitCount() != n {
+		t.Errorf("BitCount: %d, should be %d", b.BitCount(), n)
+	}
+
+	for k := 0; k < 200; k++ {
+		unit := Unit(rand.Intn(2))
+		max := int64(len(s))
+		if unit == Bit {
+			max *= 8
+		}
+		start, end := rand.Int63n(2*max)-max, rand.Int63n(2*max)-max
+		bit := rand.Intn(2)
+
+		// The range in bits, as Redis computes it
+		first, last := start, end
+		if first < 0 {
+			first += max
+		}
+		if last < 0 {
+			last += max
+		}
+		if first < 0 {
+			first = 0
+		}
+		if last >= max {
+			last = max - 1
+		}
+		if unit == Byte {
+			first, last = first*8, last*8+7
+		}
+
+		count, pos := int64(0), int64(-1)
+		for o := first; o <= last; o++ {
+			count += int64(s.bit(o))
+			if pos < 0 && s.bit(o) == bit {
+				pos = o
+			}
+		}
+
+		if c := b.BitCountRange(start, end, unit); c != count {
+			t.Errorf("BitCountRange(%d, %d, %d): %d, should be %d", start, end, unit, c, count)
+		}
+		if p := b.BitPosRange(bit, start, end, unit); p != pos {
+			t.Errorf("BitPosRange(%d, %d, %d, %d): %d, should be %d", bit, start, end, unit, p, pos)
+		}
+	}
+
+	for bit := 0; bit < 2; bit++ {
+		pos := int64(len(s)) * 8
+		if bit == 1 {
+			pos = -1
+		}
+		for o := int64(0); o < int64(len(s))*8; o++ {
+			if s.bit(o) == bit {
+				pos = o
+				break
+			}
+		}
+
+		if p := b.BitPos(bit); p != pos {
+			t.Errorf("BitPos(%d): %d, should be %d", bit, p, pos)
+		}
+	}
+
+	if New().BitPos(0) != 0 || New().BitPos(1) != -1 || New().BitCountRange(0, -1, Byte) != 0 {
+		t.Errorf("wrong results on an empty string")
+	}
+
+	if _, err := b.SetBit(-1, 1); err == nil {
+		t.Errorf("SetBit(-1) should fail")
+	}
+	if _, err := b.SetBit(1, 2); err == nil {
+		t.Errorf("SetBit(1, 2) should fail")
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	a, sa := build(t, 100)
+	b, sb := build(t, 100)
+	b.SetBit(5000, 1)
+	sb = sb.set(5000, 1)
+
+	for _, op := range []Op{And, Or, Xor, Not} {
+		srcs := []*Bitmap{a, b}
+		if op == Not {
+			srcs = srcs[:1]
+		}
+
+		r, err := BitOp(op, srcs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := make(str, len(sa))
+		if op != Not {
+			want = make(str, len(sb))
+		}
+		for k := range want {
+			var x, y byte
+			if k < len(sa) {
+				x = sa[k]
+			}
+			if k < len(sb) {
+				y = sb[k]
+			}
+			switch op {
+			case And:
+				want[k] = x & y
+			case Or:
+				want[k] = x | y
+			case Xor:
+				want[k] = x ^ y
+			case Not:
+				want[k] = ^x
+			}
+		}
+
+		if r.Len() != int64(len(want)) {
+			t.Fatalf("BitOp(%d): length %d, should be %d", op, r.Len(), len(want))
+		}
+
+		n := 0
+		for o := int64(0); o < r.Len()*8; o++ {
+			if r.GetBit(o) != want.bit(o) {
+				t.Fatalf("BitOp(%d): bit %d is %d, should be %d", op, o, r.GetBit(o), want.bit(o))
+			}
+		}
+		for _, c := range want {
+			n += bits.OnesCount8(c)
+		}
+		if r.BitCount() != int64(n) {
+			t.Errorf("BitOp(%d): BitCount %d, should be %d", op, r.BitCount(), n)
+		}
+	}
+
+	if _, err := BitOp(Not, a, b); err == nil {
+		t.Errorf("BitOp(Not) of two sources should fail")
+	}
+	if _, err := BitOp(And); err == nil {
+		t.Errorf("BitOp without a source should fail")
+	}
+}
+
+func TestMaxResultWords(t *testing.T) {
+	a := New()
+	for o := int64(0); o < 2000; o += 100 {
+		a.SetBit(o, 1)
+	}
+	b := New()
+	b.SetBit(3, 1)
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if _, err := BitOp(Or, a, b); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Errorf("BitOp over the budget: %v", err)
+	}
+
+	if _, err := a.SetBit(50, 1); !errors.Is(err, ewah.ErrResultTooLarge) || a.GetBit(50) != 0 || a.BitCount() != 20 {
+		t.Errorf("SetBit over the budget: %v", err)
+	}
+	if _, err := a.SetBit(5000, 1); err != nil || a.Len() != 5000/8+1 {
+		t.Errorf("SetBit past the end doesn't rewrite the bitmap: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahroaring converts EWAH bitmaps to and from github.com/RoaringBitmap/roaring bitmaps, one run or
+// literal word at a time instead of one bit at a time. It's only built with the roaring build tag, so the
+// rest of the library doesn't depend on roaring:
+//
+//	go get github.com/RoaringBitmap/roaring
+//	go build -tags roaring
+package ewahroaring
@@ -0,0 +1,82 @@
+//go:build roaring
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahroaring
+
+import (
+	"github.com/RoaringBitmap/roaring"
+	"github.com/reducedb/bitmap/ewah"
+	"math/bits"
+)
+
+// batchSize is the number of positions read from a roaring bitmap, or added to it, at a time
+const batchSize = 1024
+
+// FromRoaring returns an EWAH bitmap with the bits set in r. Consecutive positions are added as a range, so
+// the runs of r become runs of 1's. The size of the bitmap is the last position set + 1.
+func FromRoaring(r *roaring.Bitmap) *ewah.Ewah {
+	e := ewah.NewEwah()
+
+	// The positions [start, end[ are set, but not added yet
+	start, end := int64(-1), int64(-1)
+	flush := func() {
+		if start >= 0 {
+			e.SetRange(start, end)
+		}
+	}
+
+	buf := make([]uint32, batchSize)
+	for it := r.ManyIterator(); ; {
+		n := it.NextMany(buf)
+		if n == 0 {
+			break
+		}
+
+		for _, v := range buf[:n] {
+			if i := int64(v); i == end {
+				end++
+			} else {
+				flush()
+				start, end = i, i+1
+			}
+		}
+	}
+
+	flush()
+
+	return e
+}
+
+// ToRoaring returns a roaring bitmap with the bits set in e. Runs of 1's are added as ranges, and the bits of
+// the literal words in batches. The result is run-optimized.
+func ToRoaring(e *ewah.Ewah) *roaring.Bitmap {
+	r := roaring.New()
+
+	batch := make([]uint32, 0, batchSize)
+	pos := uint64(0)
+	e.WalkWords(func(v bool, n int64) {
+		if v {
+			r.AddRange(pos, pos+uint64(n)*64)
+		}
+		pos += uint64(n) * 64
+	}, func(w uint64) {
+		for ; w != 0; w &= w - 1 {
+			batch = append(batch, uint32(pos)+uint32(bits.TrailingZeros64(w)))
+		}
+		if len(batch) >= batchSize-64 {
+			r.AddMany(batch)
+			batch = batch[:0]
+		}
+		pos += 64
+	})
+
+	r.AddMany(batch)
+	r.RunOptimize()
+
+	return r
+}
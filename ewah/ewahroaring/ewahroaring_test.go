@@ -0,0 +1,44 @@
+//go:build roaring
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahroaring
+
+import (
+	"github.com/RoaringBitmap/roaring"
+	"github.com/reducedb/bitmap/ewah"
+	"github.com/reducedb/bitmap/ewah/ewahtest"
+	"math/rand"
+	"testing"
+)
+
+func TestRoaring(t *testing.T) {
+	e := ewah.NewEwah()
+	for i := int64(0); i < 100000; i += 1 + rand.Int63n(100) {
+		e.Set(i)
+	}
+	e.SetRange(100010, 300000)
+	e.Set(400000)
+
+	r := ToRoaring(e)
+	if r.GetCardinality() != uint64(e.Cardinality()) {
+		t.Fatalf("ToRoaring: cardinality %d, should be %d", r.GetCardinality(), e.Cardinality())
+	}
+
+	it := e.Iterator()
+	for _, v := range r.ToArray() {
+		if i := it.Next(); int64(v) != i {
+			t.Fatalf("ToRoaring: %d is set, should be %d", v, i)
+		}
+	}
+
+	ewahtest.Equal(t, FromRoaring(r), e)
+
+	if c := FromRoaring(roaring.New()); c.Cardinality() != 0 || c.Size() != 0 {
+		t.Errorf("FromRoaring of an empty bitmap: %v", c)
+	}
+}
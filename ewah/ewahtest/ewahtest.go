@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewahtest provides helpers to compare EWAH bitmaps in tests. On failure, they report the sizes
+// and the first positions set in only one of the bitmaps, instead of just saying they're different.
+package ewahtest
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+	"testing"
+)
+
+// Limit is the number of positions reported on each side when bitmaps differ
+var Limit = 10
+
+// Equal reports an error if got and want don't have the same size and the same bits set. It returns true
+// if they do.
+func Equal(t testing.TB, got, want *ewah.Ewah) bool {
+	t.Helper()
+
+	if ewah.Comparer()(got, want) {
+		return true
+	}
+
+	if got == nil || want == nil {
+		t.Errorf("got %v, want %v", got, want)
+		return false
+	}
+
+	d, err := got.DiffReport(want, Limit)
+	if err != nil {
+		t.Errorf("bitmaps differ, and can't be compared: %v", err)
+		return false
+	}
+
+	t.Errorf("bitmaps differ (A is got, B is want):\n%s", d)
+
+	return false
+}
+
+// EqualPositions reports an error if the bits set in got are not the positions in want. Unlike Equal, the
+// size of got doesn't matter. It returns true if the bits are the same.
+func EqualPositions(t testing.TB, got *ewah.Ewah, want ...int64) bool {
+	t.Helper()
+
+	if got == nil {
+		t.Errorf("got <nil>, want %v", want)
+		return false
+	}
+
+	w := ewah.NewEwah()
+	for _, i := range want {
+		if w.Set(i) == nil {
+			t.Fatalf("invalid wanted position %d, positions must be in ascending order", i)
+		}
+	}
+
+	d, err := got.DiffReport(w, Limit)
+	if err != nil {
+		t.Errorf("bits can't be compared: %v", err)
+		return false
+	}
+	if !d.Equal() {
+		t.Errorf("bits differ (A is got, B is want):\n%s", d)
+		return false
+	}
+
+	return true
+}
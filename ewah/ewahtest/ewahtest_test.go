@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahtest
+
+import (
+	"fmt"
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// recorder is a testing.TB that keeps the errors instead of failing the test
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (this *recorder) Helper() {}
+
+func (this *recorder) Errorf(format string, args ...interface{}) {
+	this.errors = append(this.errors, fmt.Sprintf(format, args...))
+}
+
+func TestEqual(t *testing.T) {
+	a, b := ewah.NewEwah(), ewah.NewEwah()
+	for i := int64(0); i < 1000; i += 7 {
+		a.Set(i)
+		b.Set(i)
+	}
+
+	r := &recorder{TB: t}
+	if !Equal(r, a, b) || !EqualPositions(r, a.And(ewah.New()).(*ewah.Ewah)) || len(r.errors) != 0 {
+		t.Fatalf("Equal bitmaps reported as different: %v", r.errors)
+	}
+
+	c := a.Clone().(*ewah.Ewah)
+	c.Set(1001)
+	if Equal(r, c, b) || len(r.errors) != 1 || !strings.Contains(r.errors[0], "only in A: 1 [1001]") {
+		t.Fatalf("Different bitmaps should be reported with their differences: %v", r.errors)
+	}
+
+	r.errors = nil
+	if EqualPositions(r, a, 0, 7, 15) || len(r.errors) != 1 || !strings.Contains(r.errors[0], "only in B: 1 [15]") {
+		t.Fatalf("Different bits should be reported with their differences: %v", r.errors)
+	}
+
+	r.errors = nil
+	if !Equal(r, nil, nil) || Equal(r, a, nil) || len(r.errors) != 1 {
+		t.Fatalf("Nil bitmaps: %v", r.errors)
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	data := make([]byte, 400)
+	for k := 0; k < 20; k++ {
+		rand.Read(data)
+		Fuzz(t, data)
+	}
+}
+
+func FuzzEwah(f *testing.F) {
+	f.Add([]byte{0, 10, 2, 200, 1, 3, 4, 0, 12, 0, 6, 0})
+	f.Add([]byte{2, 255, 3, 7, 8, 0, 11, 0, 13, 0, 14, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Fuzz(t, data)
+	})
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewahtest
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+	"sort"
+	"testing"
+)
+
+// maxFuzzPosition bounds the positions set by Fuzz, so each run stays fast
+const maxFuzzPosition = 1 << 12
+
+// Fuzz decodes data into a sequence of operations, applies them to two EWAH bitmaps and to two plain sets of
+// positions, and reports an error as soon as a bitmap and its set disagree, or a bitmap isn't valid. It
+// can be called from a fuzz target, to check a fork of the package or the way it's built:
+//
+//	func FuzzEwah(f *testing.F) {
+//		f.Fuzz(func(t *testing.T, data []byte) {
+//			ewahtest.Fuzz(t, data)
+//		})
+//	}
+//
+// Each operation takes two bytes: the first picks the operation and the bitmap it applies to, the second
+// is its argument.
+func Fuzz(t testing.TB, data []byte) {
+	t.Helper()
+
+	bms := []*ewah.Ewah{ewah.NewEwah(), ewah.NewEwah()}
+	sets := []positions{{}, {}}
+
+	for k := 0; k+1 < len(data); k += 2 {
+		op, arg := data[k], int64(data[k+1])
+		x, y := op&1, 1-op&1
+		e := bms[x]
+
+		switch (op >> 1) % 8 {
+		case 0:
+			// Set a bit after the last one, with larger gaps for the high values
+			i := e.Size() + arg*(1+arg/64*64)
+			if i < maxFuzzPosition && e.Set(i) != nil {
+				sets[x][i] = struct{}{}
+			}
+		case 1:
+			start := e.Size() + arg%16
+			end := start + arg*8 + 1
+			if end < maxFuzzPosition && e.SetRange(start, end) != nil {
+				for i := start; i < end; i++ {
+					sets[x][i] = struct{}{}
+				}
+			}
+		case 2:
+			bms[x], sets[x] = e.And(bms[y]).(*ewah.Ewah), sets[x].combine(sets[y], func(a, b bool) bool { return a && b })
+		case 3:
+			bms[x], sets[x] = e.Or(bms[y]).(*ewah.Ewah), sets[x].combine(sets[y], func(a, b bool) bool { return a || b })
+		case 4:
+			bms[x], sets[x] = e.AndNot(bms[y]).(*ewah.Ewah), sets[x].combine(sets[y], func(a, b bool) bool { return a && !b })
+		case 5:
+			bms[x], sets[x] = e.Xor(bms[y]).(*ewah.Ewah), sets[x].combine(sets[y], func(a, b bool) bool { return a != b })
+		case 6:
+			size := e.Size()
+			bms[x] = e.Clone().Not().(*ewah.Ewah)
+			sets[x] = sets[x].not(size)
+		case 7:
+			bms[x] = e.Clone().(*ewah.Ewah)
+		}
+
+		for n := range bms {
+			if !check(t, bms[n], sets[n]) {
+				t.Errorf("after operation %d (%d, %d) on bitmap %d", k/2, (op>>1)%8, arg, x)
+				return
+			}
+		}
+	}
+}
+
+//
+// Not-exported functions
+//
+
+// positions is the reference model: the set of positions of the bits set
+type positions map[int64]struct{}
+
+func (this positions) combine(other positions, f func(a, b bool) bool) positions {
+	ans := positions{}
+
+	for _, s := range []positions{this, other} {
+		for i := range s {
+			_, a := this[i]
+			_, b := other[i]
+			if f(a, b) {
+				ans[i] = struct{}{}
+			}
+		}
+	}
+
+	return ans
+}
+
+func (this positions) not(size int64) positions {
+	ans := positions{}
+
+	for i := int64(0); i < size; i++ {
+		if _, ok := this[i]; !ok {
+			ans[i] = struct{}{}
+		}
+	}
+
+	return ans
+}
+
+func (this positions) sorted() []int64 {
+	s := make([]int64, 0, len(this))
+	for i := range this {
+		s = append(s, i)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+
+	return s
+}
+
+// check reports an error and returns false if e doesn't have the bits of s, or isn't valid
+func check(t testing.TB, e *ewah.Ewah, s positions) bool {
+	t.Helper()
+
+	if err := e.Validate(); err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+
+	if e.Cardinality() != int64(len(s)) {
+		t.Errorf("cardinality %d, should be %d", e.Cardinality(), len(s))
+		return false
+	}
+
+	it := e.Iterator()
+	for _, i := range s.sorted() {
+		if !it.HasNext() {
+			t.Errorf("bit %d is missing", i)
+			return false
+		}
+
+		if j := it.Next(); j != i {
+			t.Errorf("bit %d is set, the next one should be %d", j, i)
+			return false
+		}
+
+		// The bit after each one set is checked too, to catch Get returning true everywhere
+		if !e.Get(i) || e.Get(i+1) != s.has(i+1) {
+			t.Errorf("Get is different from the iterator at %d or %d", i, i+1)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (this positions) has(i int64) bool {
+	_, ok := this[i]
+	return ok
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"fmt"
+)
+
+var _ fmt.Stringer = (*Ewah)(nil)
+var _ fmt.Formatter = (*Ewah)(nil)
+
+// String returns a summary of the bitmap: its size in bits, its cardinality and its size in words
+func (this *Ewah) String() string {
+	return fmt.Sprintf("ewah{size: %d, cardinality: %d, words: %d}", this.sizeInBits, this.Cardinality(), this.actualSizeInWords)
+}
+
+// Format formats the bitmap for the fmt package. %v and %s print the summary returned by String, %b prints
+// the positions of the bits set, like [1 5 64], and %+b prints the words of the buffer, one per line, with
+// their index.
+func (this *Ewah) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's':
+		fmt.Fprint(f, this.String())
+
+	case 'b':
+		if f.Flag('+') {
+			for i, w := range this.buffer[:this.actualSizeInWords] {
+				fmt.Fprintf(f, "%4d: %064b\n", i, w)
+			}
+			return
+		}
+
+		fmt.Fprint(f, "[")
+		for it, sep := this.Iterator(), ""; it.HasNext(); sep = " " {
+			fmt.Fprintf(f, "%s%d", sep, it.Next())
+		}
+		fmt.Fprint(f, "]")
+
+	default:
+		fmt.Fprintf(f, "%%!%c(%s)", verb, this.String())
+	}
+}
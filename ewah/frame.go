@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	frameMagic = "EWAHFRM1"
+
+	// frameHeaderSize is the size of the magic and the count, and frameEntrySize the size of an entry of
+	// the table
+	frameHeaderSize = 16
+	frameEntrySize  = 24
+)
+
+// Frame is a message holding several bitmaps, laid out so the receiver can use the bitmaps right where
+// they are in the message, without decoding them, like Cap'n Proto does for its messages. Everything is
+// little endian, and each array of words starts at a multiple of 8 bytes:
+//
+//	"EWAHFRM1" | count (uint64) | count x entry | count x words
+//
+// where an entry is the offset of the words in the frame (uint64), the number of words (uint32), the
+// position of the last marker word (uint32) and the size in bits (uint64). The words are the buffer of the
+// bitmap, as in MarshalCpp.
+type Frame struct {
+	b     []byte
+	count int
+}
+
+// MarshalFrame returns a frame holding the bitmaps
+func MarshalFrame(bms ...*Ewah) ([]byte, error) {
+	size := int64(frameHeaderSize + frameEntrySize*len(bms))
+	for _, e := range bms {
+		if e.actualSizeInWords > math.MaxUint32 {
+			return nil, newError(ErrOutOfRange, "ewah/MarshalFrame: bitmap is too large to be framed")
+		}
+		size += 8 * e.actualSizeInWords
+	}
+
+	b := make([]byte, size)
+	copy(b, frameMagic)
+	binary.LittleEndian.PutUint64(b[8:], uint64(len(bms)))
+
+	offset := int64(frameHeaderSize + frameEntrySize*len(bms))
+	for k, e := range bms {
+		entry := b[frameHeaderSize+frameEntrySize*k:]
+		binary.LittleEndian.PutUint64(entry, uint64(offset))
+		binary.LittleEndian.PutUint32(entry[8:], uint32(e.actualSizeInWords))
+		binary.LittleEndian.PutUint32(entry[12:], uint32(e.setCursor.marker))
+		binary.LittleEndian.PutUint64(entry[16:], uint64(e.sizeInBits))
+
+		for i, v := range e.buffer[:e.actualSizeInWords] {
+			binary.LittleEndian.PutUint64(b[offset+8*int64(i):], v)
+		}
+		offset += 8 * e.actualSizeInWords
+	}
+
+	return b, nil
+}
+
+// OpenFrame checks the header and the table of a frame, but not the words of the bitmaps, so it takes the
+// same time whatever the size of the bitmaps. b must not be modified while the frame or its bitmaps are in
+// use.
+func OpenFrame(b []byte) (*Frame, error) {
+	if len(b) < frameHeaderSize || string(b[:8]) != frameMagic {
+		return nil, newError(ErrCorruptData, "ewah/OpenFrame: not a frame")
+	}
+
+	count := binary.LittleEndian.Uint64(b[8:])
+	if count > uint64(len(b)-frameHeaderSize)/frameEntrySize {
+		return nil, newError(ErrCorruptData, "ewah/OpenFrame: invalid count")
+	}
+
+	f := &Frame{b: b, count: int(count)}
+
+	end := uint64(frameHeaderSize + frameEntrySize*count)
+	for k := 0; k < f.count; k++ {
+		offset, words, rlw, sizeInBits := f.entry(k)
+		if offset != end || words < 1 || rlw >= words || words > (uint64(len(b))-offset)/8 || sizeInBits > math.MaxInt64 {
+			return nil, newError(ErrCorruptData, "ewah/OpenFrame: invalid entry")
+		}
+		end = offset + 8*words
+	}
+
+	if end != uint64(len(b)) {
+		return nil, newError(ErrCorruptData, "ewah/OpenFrame: invalid size")
+	}
+
+	return f, nil
+}
+
+// Len returns the number of bitmaps of the frame
+func (this *Frame) Len() int {
+	return this.count
+}
+
+// Bitmap returns the k-th bitmap of the frame, or nil if there's none. It reads the words in place on
+// little endian machines, if the frame is aligned on 8 bytes, as the memory allocated by Go is. Otherwise,
+// or when built with the purego build tag or TinyGo, it copies them. Like with Snapshot, the words are
+// copied the first time the bitmap is modified, so the frame is never written to. Since the words are not
+// checked, use Validate on bitmaps from untrusted sources.
+func (this *Frame) Bitmap(k int) *Ewah {
+	if k < 0 || k >= this.count {
+		return nil
+	}
+
+	offset, words, rlw, sizeInBits := this.entry(k)
+	b := this.b[offset : offset+8*words]
+
+	buffer := wordsInPlace(b)
+	shared := buffer != nil
+	if !shared {
+		buffer = make([]uint64, words)
+		for i := range buffer {
+			buffer[i] = binary.LittleEndian.Uint64(b[8*i:])
+		}
+	}
+
+	e := NewEwah()
+	e.load(buffer, int64(words), int64(sizeInBits), int64(rlw), shared)
+
+	return e
+}
+
+//
+// Not-exported functions
+//
+
+// entry returns the k-th entry of the table
+func (this *Frame) entry(k int) (offset, words, rlw, sizeInBits uint64) {
+	entry := this.b[frameHeaderSize+frameEntrySize*k:]
+
+	return binary.LittleEndian.Uint64(entry), uint64(binary.LittleEndian.Uint32(entry[8:])),
+		uint64(binary.LittleEndian.Uint32(entry[12:])), binary.LittleEndian.Uint64(entry[16:])
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"github.com/reducedb/bitmap"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Frozen is a read-only version of a bitmap. Unlike a bitmap, whose Get moves a cursor, it has no state
+// that changes when it's read, so any number of goroutines can read it at the same time. Get finds the
+// marker word covering the position with a binary search.
+type Frozen struct {
+	e *Ewah
+
+	// markers[k] is the position of the k-th marker word in the buffer, and starts[k] the index of the first
+	// uncompressed word it covers
+	markers []int64
+	starts  []int64
+
+	// cardinality caches the cardinality + 1, or is 0 if it's not known yet. It's atomic since Cardinality
+	// can be called by several readers at the same time.
+	cardinality atomic.Int64
+
+	// encoded is the bitmap encoded by AsBytes, the first time it's called
+	encodeOnce sync.Once
+	encoded    []byte
+}
+
+var _ bitmap.Reader = (*Frozen)(nil)
+
+// Freeze returns a read-only version of the bitmap, as it is now. Since it's only a Reader, the compiler
+// makes sure nobody modifies it. It shares the buffer with the bitmap until the bitmap is modified. Several
+// goroutines can freeze or clone a bitmap that's no longer modified at the same time, while others read it,
+// once the positions kept aside by SetBuffered are flushed.
+func (this *Ewah) Freeze() bitmap.Reader {
+	f := &Frozen{
+		e: this.Snapshot(),
+	}
+
+	buffer := f.e.buffer
+	for pos, start := int64(0), int64(0); pos < f.e.actualSizeInWords; {
+		rlw := buffer[pos]
+		runlen := int64((rlw >> 1) & LargestRunningLengthCount)
+		literals := int64(rlw >> uint32(1+RunningLengthBits))
+
+		f.markers = append(f.markers, pos)
+		f.starts = append(f.starts, start)
+
+		start += runlen + literals
+		pos += 1 + literals
+	}
+
+	return f
+}
+
+func (this *Frozen) Get(i int64) bool {
+	if i < 0 || i >= this.e.sizeInBits {
+		return false
+	}
+
+	w := i / wordInBits
+
+	// The marker covering w is the last one starting at or before it
+	k := sort.Search(len(this.starts), func(k int) bool { return this.starts[k] > w }) - 1
+	if k < 0 {
+		return false
+	}
+
+	rlw := this.e.buffer[this.markers[k]]
+	runlen := int64((rlw >> 1) & LargestRunningLengthCount)
+	literals := int64(rlw >> uint32(1+RunningLengthBits))
+
+	offset := w - this.starts[k]
+	if offset < runlen {
+		return rlw&1 != 0
+	}
+
+	if offset -= runlen; offset < literals {
+		return this.e.buffer[this.markers[k]+1+offset]&(uint64(1)<<uint64(i%wordInBits)) != 0
+	}
+
+	return false
+}
+
+// Size returns the size in bits of the *uncompressed* bitmap represented by this bitmap.
+func (this *Frozen) Size() int64 {
+	return this.e.sizeInBits
+}
+
+// Cardinality returns the number of bits set to 1. It's only counted once, since the bitmap never changes.
+// Readers racing on the first call may all count it, but they all store the same value.
+func (this *Frozen) Cardinality() int64 {
+	if n := this.cardinality.Load(); n > 0 {
+		return n - 1
+	}
+
+	n := this.e.Cardinality()
+	this.cardinality.Store(n + 1)
+
+	return n
+}
+
+// Bitmap returns the frozen bitmap as a bitmap that belongs to the caller, for use with the bitmap
+// operations. It is cheap, since it shares the buffer until it's modified.
+func (this *Frozen) Bitmap() *Ewah {
+	return this.e.Snapshot()
+}
+
+// AsBytes returns the bitmap encoded with MarshalBinary. It's encoded on the first call, and every call
+// returns the same bytes, which must never be modified, so they can be stored as they are in a cache like
+// groupcache or memcached, or sent to several clients, without a copy. It returns nil if the bitmap is too
+// large to be encoded.
+func (this *Frozen) AsBytes() []byte {
+	this.encodeOnce.Do(func() {
+		this.encoded, _ = this.e.MarshalBinary()
+	})
+
+	return this.encoded
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"io"
+)
+
+// Git stores the bitmaps of its pack bitmap indexes, the .bitmap files, with its own EWAH implementation,
+// which has the same words as this package: a running bit, 32 bits of running length and 31 bits of
+// literal count. Each bitmap is stored like JavaEWAH does, in network byte order:
+//
+//	bit size (uint32) | word count (uint32) | words (word count x uint64) | rlw position (uint32)
+//
+// A .bitmap file starts with a header, has an entry for each commit before each of its bitmaps, and ends
+// with the checksum of the whole file. Reading and checking those is left to the reader of the file.
+
+// ReadGit reads a bitmap stored by Git from r, and nothing past it. A stream that ends before the bitmap
+// does, or words that are not valid, return an error matching ErrCorruptData.
+func ReadGit(r io.Reader) (*Ewah, error) {
+	e := NewEwah()
+	if _, err := e.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// WriteGit writes the bitmap to w as Git stores it, and returns the number of bytes written. Unlike WriteTo,
+// it never writes a checksum, whatever the options of the bitmap.
+func (this *Ewah) WriteGit(w io.Writer) (int64, error) {
+	b, err := this.orEmpty().marshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
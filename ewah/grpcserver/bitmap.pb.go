@@ -0,0 +1,448 @@
+//go:build grpc
+
+// Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: bitmap.proto
+
+package grpcserver
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PutRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// bitmap is encoded by MarshalBinary
+	Bitmap        []byte `protobuf:"bytes,2,opt,name=bitmap,proto3" json:"bitmap,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutRequest) Reset() {
+	*x = PutRequest{}
+	mi := &file_bitmap_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutRequest) ProtoMessage() {}
+
+func (x *PutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bitmap_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutRequest.ProtoReflect.Descriptor instead.
+func (*PutRequest) Descriptor() ([]byte, []int) {
+	return file_bitmap_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PutRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PutRequest) GetBitmap() []byte {
+	if x != nil {
+		return x.Bitmap
+	}
+	return nil
+}
+
+type PutResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutResponse) Reset() {
+	*x = PutResponse{}
+	mi := &file_bitmap_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutResponse) ProtoMessage() {}
+
+func (x *PutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bitmap_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutResponse.ProtoReflect.Descriptor instead.
+func (*PutResponse) Descriptor() ([]byte, []int) {
+	return file_bitmap_proto_rawDescGZIP(), []int{1}
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_bitmap_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bitmap_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_bitmap_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type GetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bitmap        []byte                 `protobuf:"bytes,1,opt,name=bitmap,proto3" json:"bitmap,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_bitmap_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
+
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bitmap_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_bitmap_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetResponse) GetBitmap() []byte {
+	if x != nil {
+		return x.Bitmap
+	}
+	return nil
+}
+
+type OpRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Names []string               `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	// dest is the name the result is stored under, if it's not empty
+	Dest          string `protobuf:"bytes,2,opt,name=dest,proto3" json:"dest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpRequest) Reset() {
+	*x = OpRequest{}
+	mi := &file_bitmap_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpRequest) ProtoMessage() {}
+
+func (x *OpRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bitmap_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpRequest.ProtoReflect.Descriptor instead.
+func (*OpRequest) Descriptor() ([]byte, []int) {
+	return file_bitmap_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *OpRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+func (x *OpRequest) GetDest() string {
+	if x != nil {
+		return x.Dest
+	}
+	return ""
+}
+
+type OpResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bitmap        []byte                 `protobuf:"bytes,1,opt,name=bitmap,proto3" json:"bitmap,omitempty"`
+	Cardinality   int64                  `protobuf:"varint,2,opt,name=cardinality,proto3" json:"cardinality,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpResponse) Reset() {
+	*x = OpResponse{}
+	mi := &file_bitmap_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpResponse) ProtoMessage() {}
+
+func (x *OpResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bitmap_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpResponse.ProtoReflect.Descriptor instead.
+func (*OpResponse) Descriptor() ([]byte, []int) {
+	return file_bitmap_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *OpResponse) GetBitmap() []byte {
+	if x != nil {
+		return x.Bitmap
+	}
+	return nil
+}
+
+func (x *OpResponse) GetCardinality() int64 {
+	if x != nil {
+		return x.Cardinality
+	}
+	return 0
+}
+
+type CardinalityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cardinality   int64                  `protobuf:"varint,1,opt,name=cardinality,proto3" json:"cardinality,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CardinalityResponse) Reset() {
+	*x = CardinalityResponse{}
+	mi := &file_bitmap_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CardinalityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CardinalityResponse) ProtoMessage() {}
+
+func (x *CardinalityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bitmap_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CardinalityResponse.ProtoReflect.Descriptor instead.
+func (*CardinalityResponse) Descriptor() ([]byte, []int) {
+	return file_bitmap_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CardinalityResponse) GetCardinality() int64 {
+	if x != nil {
+		return x.Cardinality
+	}
+	return 0
+}
+
+var File_bitmap_proto protoreflect.FileDescriptor
+
+const file_bitmap_proto_rawDesc = "" +
+	"\n" +
+	"\fbitmap.proto\x12\x0fewah.grpcserver\"8\n" +
+	"\n" +
+	"PutRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06bitmap\x18\x02 \x01(\fR\x06bitmap\"\r\n" +
+	"\vPutResponse\" \n" +
+	"\n" +
+	"GetRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"%\n" +
+	"\vGetResponse\x12\x16\n" +
+	"\x06bitmap\x18\x01 \x01(\fR\x06bitmap\"5\n" +
+	"\tOpRequest\x12\x14\n" +
+	"\x05names\x18\x01 \x03(\tR\x05names\x12\x12\n" +
+	"\x04dest\x18\x02 \x01(\tR\x04dest\"F\n" +
+	"\n" +
+	"OpResponse\x12\x16\n" +
+	"\x06bitmap\x18\x01 \x01(\fR\x06bitmap\x12 \n" +
+	"\vcardinality\x18\x02 \x01(\x03R\vcardinality\"7\n" +
+	"\x13CardinalityResponse\x12 \n" +
+	"\vcardinality\x18\x01 \x01(\x03R\vcardinality2\xde\x02\n" +
+	"\aBitmaps\x12@\n" +
+	"\x03Put\x12\x1b.ewah.grpcserver.PutRequest\x1a\x1c.ewah.grpcserver.PutResponse\x12@\n" +
+	"\x03Get\x12\x1b.ewah.grpcserver.GetRequest\x1a\x1c.ewah.grpcserver.GetResponse\x12>\n" +
+	"\x03And\x12\x1a.ewah.grpcserver.OpRequest\x1a\x1b.ewah.grpcserver.OpResponse\x12=\n" +
+	"\x02Or\x12\x1a.ewah.grpcserver.OpRequest\x1a\x1b.ewah.grpcserver.OpResponse\x12P\n" +
+	"\vCardinality\x12\x1b.ewah.grpcserver.GetRequest\x1a$.ewah.grpcserver.CardinalityResponseB,Z*github.com/reducedb/bitmap/ewah/grpcserverb\x06proto3"
+
+var (
+	file_bitmap_proto_rawDescOnce sync.Once
+	file_bitmap_proto_rawDescData []byte
+)
+
+func file_bitmap_proto_rawDescGZIP() []byte {
+	file_bitmap_proto_rawDescOnce.Do(func() {
+		file_bitmap_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_bitmap_proto_rawDesc), len(file_bitmap_proto_rawDesc)))
+	})
+	return file_bitmap_proto_rawDescData
+}
+
+var file_bitmap_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_bitmap_proto_goTypes = []any{
+	(*PutRequest)(nil),          // 0: ewah.grpcserver.PutRequest
+	(*PutResponse)(nil),         // 1: ewah.grpcserver.PutResponse
+	(*GetRequest)(nil),          // 2: ewah.grpcserver.GetRequest
+	(*GetResponse)(nil),         // 3: ewah.grpcserver.GetResponse
+	(*OpRequest)(nil),           // 4: ewah.grpcserver.OpRequest
+	(*OpResponse)(nil),          // 5: ewah.grpcserver.OpResponse
+	(*CardinalityResponse)(nil), // 6: ewah.grpcserver.CardinalityResponse
+}
+var file_bitmap_proto_depIdxs = []int32{
+	0, // 0: ewah.grpcserver.Bitmaps.Put:input_type -> ewah.grpcserver.PutRequest
+	2, // 1: ewah.grpcserver.Bitmaps.Get:input_type -> ewah.grpcserver.GetRequest
+	4, // 2: ewah.grpcserver.Bitmaps.And:input_type -> ewah.grpcserver.OpRequest
+	4, // 3: ewah.grpcserver.Bitmaps.Or:input_type -> ewah.grpcserver.OpRequest
+	2, // 4: ewah.grpcserver.Bitmaps.Cardinality:input_type -> ewah.grpcserver.GetRequest
+	1, // 5: ewah.grpcserver.Bitmaps.Put:output_type -> ewah.grpcserver.PutResponse
+	3, // 6: ewah.grpcserver.Bitmaps.Get:output_type -> ewah.grpcserver.GetResponse
+	5, // 7: ewah.grpcserver.Bitmaps.And:output_type -> ewah.grpcserver.OpResponse
+	5, // 8: ewah.grpcserver.Bitmaps.Or:output_type -> ewah.grpcserver.OpResponse
+	6, // 9: ewah.grpcserver.Bitmaps.Cardinality:output_type -> ewah.grpcserver.CardinalityResponse
+	5, // [5:10] is the sub-list for method output_type
+	0, // [0:5] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_bitmap_proto_init() }
+func file_bitmap_proto_init() {
+	if File_bitmap_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_bitmap_proto_rawDesc), len(file_bitmap_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_bitmap_proto_goTypes,
+		DependencyIndexes: file_bitmap_proto_depIdxs,
+		MessageInfos:      file_bitmap_proto_msgTypes,
+	}.Build()
+	File_bitmap_proto = out.File
+	file_bitmap_proto_goTypes = nil
+	file_bitmap_proto_depIdxs = nil
+}
@@ -0,0 +1,292 @@
+//go:build grpc
+
+// Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: bitmap.proto
+
+package grpcserver
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Bitmaps_Put_FullMethodName         = "/ewah.grpcserver.Bitmaps/Put"
+	Bitmaps_Get_FullMethodName         = "/ewah.grpcserver.Bitmaps/Get"
+	Bitmaps_And_FullMethodName         = "/ewah.grpcserver.Bitmaps/And"
+	Bitmaps_Or_FullMethodName          = "/ewah.grpcserver.Bitmaps/Or"
+	Bitmaps_Cardinality_FullMethodName = "/ewah.grpcserver.Bitmaps/Cardinality"
+)
+
+// BitmapsClient is the client API for Bitmaps service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Bitmaps stores named EWAH bitmaps, and computes their intersections and unions
+type BitmapsClient interface {
+	// Put stores a bitmap under a name, replacing the bitmap already there
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	// Get returns a bitmap
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// And returns the intersection of bitmaps, and stores it if a name is given
+	And(ctx context.Context, in *OpRequest, opts ...grpc.CallOption) (*OpResponse, error)
+	// Or returns the union of bitmaps, and stores it if a name is given
+	Or(ctx context.Context, in *OpRequest, opts ...grpc.CallOption) (*OpResponse, error)
+	// Cardinality returns the number of bits set in a bitmap
+	Cardinality(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*CardinalityResponse, error)
+}
+
+type bitmapsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBitmapsClient(cc grpc.ClientConnInterface) BitmapsClient {
+	return &bitmapsClient{cc}
+}
+
+func (c *bitmapsClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, Bitmaps_Put_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bitmapsClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, Bitmaps_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bitmapsClient) And(ctx context.Context, in *OpRequest, opts ...grpc.CallOption) (*OpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OpResponse)
+	err := c.cc.Invoke(ctx, Bitmaps_And_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bitmapsClient) Or(ctx context.Context, in *OpRequest, opts ...grpc.CallOption) (*OpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OpResponse)
+	err := c.cc.Invoke(ctx, Bitmaps_Or_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bitmapsClient) Cardinality(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*CardinalityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CardinalityResponse)
+	err := c.cc.Invoke(ctx, Bitmaps_Cardinality_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BitmapsServer is the server API for Bitmaps service.
+// All implementations must embed UnimplementedBitmapsServer
+// for forward compatibility.
+//
+// Bitmaps stores named EWAH bitmaps, and computes their intersections and unions
+type BitmapsServer interface {
+	// Put stores a bitmap under a name, replacing the bitmap already there
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	// Get returns a bitmap
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// And returns the intersection of bitmaps, and stores it if a name is given
+	And(context.Context, *OpRequest) (*OpResponse, error)
+	// Or returns the union of bitmaps, and stores it if a name is given
+	Or(context.Context, *OpRequest) (*OpResponse, error)
+	// Cardinality returns the number of bits set in a bitmap
+	Cardinality(context.Context, *GetRequest) (*CardinalityResponse, error)
+	mustEmbedUnimplementedBitmapsServer()
+}
+
+// UnimplementedBitmapsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBitmapsServer struct{}
+
+func (UnimplementedBitmapsServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedBitmapsServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedBitmapsServer) And(context.Context, *OpRequest) (*OpResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method And not implemented")
+}
+func (UnimplementedBitmapsServer) Or(context.Context, *OpRequest) (*OpResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Or not implemented")
+}
+func (UnimplementedBitmapsServer) Cardinality(context.Context, *GetRequest) (*CardinalityResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Cardinality not implemented")
+}
+func (UnimplementedBitmapsServer) mustEmbedUnimplementedBitmapsServer() {}
+func (UnimplementedBitmapsServer) testEmbeddedByValue()                 {}
+
+// UnsafeBitmapsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BitmapsServer will
+// result in compilation errors.
+type UnsafeBitmapsServer interface {
+	mustEmbedUnimplementedBitmapsServer()
+}
+
+func RegisterBitmapsServer(s grpc.ServiceRegistrar, srv BitmapsServer) {
+	// If the following call panics, it indicates UnimplementedBitmapsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Bitmaps_ServiceDesc, srv)
+}
+
+func _Bitmaps_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BitmapsServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bitmaps_Put_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BitmapsServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bitmaps_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BitmapsServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bitmaps_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BitmapsServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bitmaps_And_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BitmapsServer).And(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bitmaps_And_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BitmapsServer).And(ctx, req.(*OpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bitmaps_Or_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BitmapsServer).Or(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bitmaps_Or_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BitmapsServer).Or(ctx, req.(*OpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bitmaps_Cardinality_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BitmapsServer).Cardinality(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bitmaps_Cardinality_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BitmapsServer).Cardinality(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Bitmaps_ServiceDesc is the grpc.ServiceDesc for Bitmaps service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Bitmaps_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ewah.grpcserver.Bitmaps",
+	HandlerType: (*BitmapsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Put",
+			Handler:    _Bitmaps_Put_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Bitmaps_Get_Handler,
+		},
+		{
+			MethodName: "And",
+			Handler:    _Bitmaps_And_Handler,
+		},
+		{
+			MethodName: "Or",
+			Handler:    _Bitmaps_Or_Handler,
+		},
+		{
+			MethodName: "Cardinality",
+			Handler:    _Bitmaps_Cardinality_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "bitmap.proto",
+}
@@ -0,0 +1,22 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package grpcserver implements a gRPC service storing named EWAH bitmaps, with Put, Get, And, Or and
+// Cardinality, described in bitmap.proto. Bitmaps travel in the format of MarshalBinary. It's only built
+// with the grpc build tag, so the rest of the library doesn't depend on gRPC:
+//
+//	go get google.golang.org/grpc google.golang.org/protobuf
+//	go build -tags grpc
+//
+// A bitmap service is then:
+//
+//	s := grpc.NewServer()
+//	grpcserver.RegisterBitmapsServer(s, grpcserver.NewServer())
+//	s.Serve(listener)
+package grpcserver
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative bitmap.proto
+//go:generate sed -i "1i //go:build grpc\n" bitmap.pb.go bitmap_grpc.pb.go
@@ -0,0 +1,151 @@
+//go:build grpc
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+)
+
+// Server is the Bitmaps service, keeping the bitmaps in memory. Any number of requests can be served at the
+// same time.
+type Server struct {
+	UnimplementedBitmapsServer
+
+	mu      sync.RWMutex
+	bitmaps map[string]*ewah.Ewah
+}
+
+var _ BitmapsServer = (*Server)(nil)
+
+func NewServer() *Server {
+	return &Server{
+		bitmaps: make(map[string]*ewah.Ewah),
+	}
+}
+
+func (this *Server) Put(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+	e := ewah.NewEwah()
+	if err := e.UnmarshalBinary(req.GetBitmap()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := e.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	this.store(req.GetName(), e)
+
+	return &PutResponse{}, nil
+}
+
+func (this *Server) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	e, err := this.lookup(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := e.MarshalBinary()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &GetResponse{Bitmap: b}, nil
+}
+
+func (this *Server) And(ctx context.Context, req *OpRequest) (*OpResponse, error) {
+	return this.op(req, (*ewah.Ewah).AndChecked)
+}
+
+func (this *Server) Or(ctx context.Context, req *OpRequest) (*OpResponse, error) {
+	return this.op(req, (*ewah.Ewah).OrChecked)
+}
+
+func (this *Server) Cardinality(ctx context.Context, req *GetRequest) (*CardinalityResponse, error) {
+	e, err := this.lookup(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &CardinalityResponse{Cardinality: e.Cardinality()}, nil
+}
+
+//
+// Not-exported functions
+//
+
+func (this *Server) store(name string, e *ewah.Ewah) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.bitmaps[name] = e
+}
+
+// lookup returns a snapshot of the bitmap, which can be read while the bitmap is replaced
+func (this *Server) lookup(name string) (*ewah.Ewah, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	e, ok := this.bitmaps[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no bitmap named %q", name)
+	}
+
+	return e.Snapshot(), nil
+}
+
+// op applies f to the bitmaps named in the request. A result over the budget set with ewah.SetMaxResultWords
+// fails with codes.ResourceExhausted.
+func (this *Server) op(req *OpRequest, f func(*ewah.Ewah, ...bitmap.Bitmap) (bitmap.Bitmap, error)) (*OpResponse, error) {
+	names := req.GetNames()
+	if len(names) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no bitmap named")
+	}
+
+	bms := make([]*ewah.Ewah, len(names))
+	for k, name := range names {
+		e, err := this.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		bms[k] = e
+	}
+
+	others := make([]bitmap.Bitmap, len(bms)-1)
+	for k, e := range bms[1:] {
+		others[k] = e
+	}
+
+	e := bms[0]
+	if len(others) > 0 {
+		r, err := f(bms[0], others...)
+		if errors.Is(err, ewah.ErrResultTooLarge) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		e = r.(*ewah.Ewah)
+	}
+
+	b, err := e.MarshalBinary()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if req.GetDest() != "" {
+		this.store(req.GetDest(), e)
+	}
+
+	return &OpResponse{Bitmap: b, Cardinality: e.Cardinality()}, nil
+}
@@ -0,0 +1,110 @@
+//go:build grpc
+
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package grpcserver
+
+import (
+	"context"
+	"github.com/reducedb/bitmap/ewah"
+	"github.com/reducedb/bitmap/ewah/ewahtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	RegisterBitmapsServer(s, NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := NewBitmapsClient(conn)
+	ctx := context.Background()
+
+	a, b := ewah.NewEwah(), ewah.NewEwah()
+	for i := int64(0); i < 10000; i += 3 {
+		a.Set(i)
+	}
+	for i := int64(0); i < 20000; i += 5 {
+		b.Set(i)
+	}
+
+	for name, e := range map[string]*ewah.Ewah{"a": a, "b": b} {
+		buf, _ := e.MarshalBinary()
+		if _, err := c.Put(ctx, &PutRequest{Name: name, Bitmap: buf}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decode := func(buf []byte) *ewah.Ewah {
+		e := ewah.NewEwah()
+		if err := e.UnmarshalBinary(buf); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	r, err := c.Get(ctx, &GetRequest{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ewahtest.Equal(t, decode(r.GetBitmap()), a)
+
+	and, err := c.And(ctx, &OpRequest{Names: []string{"a", "b"}, Dest: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ewahtest.Equal(t, decode(and.GetBitmap()), a.And(b).(*ewah.Ewah))
+
+	or, err := c.Or(ctx, &OpRequest{Names: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ewahtest.Equal(t, decode(or.GetBitmap()), a.Or(b).(*ewah.Ewah))
+	if or.GetCardinality() != a.Or(b).Cardinality() {
+		t.Errorf("Or: cardinality %d, should be %d", or.GetCardinality(), a.Or(b).Cardinality())
+	}
+
+	n, err := c.Cardinality(ctx, &GetRequest{Name: "c"})
+	if err != nil || n.GetCardinality() != and.GetCardinality() {
+		t.Errorf("Cardinality of the stored result: %v, %v, should be %d", n, err, and.GetCardinality())
+	}
+
+	if _, err := c.Get(ctx, &GetRequest{Name: "d"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Get of a missing bitmap: %v", err)
+	}
+	if _, err := c.Put(ctx, &PutRequest{Name: "d", Bitmap: []byte{1, 2, 3}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Put of an invalid bitmap: %v", err)
+	}
+	if _, err := c.And(ctx, &OpRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("And without names: %v", err)
+	}
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if _, err := c.Or(ctx, &OpRequest{Names: []string{"a", "b"}, Dest: "e"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Or over the budget: %v", err)
+	}
+	if _, err := c.Get(ctx, &GetRequest{Name: "e"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Or over the budget stored a result: %v", err)
+	}
+}
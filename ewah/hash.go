@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Hash64 returns a hash of the content of the bitmap, for deduplication or as a cache key. It hashes the
+// size and the uncompressed words of the bitmap, with the runs of empty or full words merged, so bitmaps
+// with the same bits up to the same size have the same hash, however they're encoded: a run split in two
+// marker words, or a literal word with all its bits set, hash like the single run they stand for.
+func (this *Ewah) Hash64() uint64 {
+	h := fnv.New64a()
+	b := make([]byte, 9)
+	write := func(tag byte, v uint64) {
+		b[0] = tag
+		binary.BigEndian.PutUint64(b[1:], v)
+		h.Write(b)
+	}
+
+	write('S', uint64(this.sizeInBits))
+
+	this.walkCanonical(func(v bool, n int64) {
+		if v {
+			write('R', ^uint64(0))
+		} else {
+			write('R', 0)
+		}
+		write('N', uint64(n))
+	}, func(w uint64) {
+		write('L', w)
+	})
+
+	return h.Sum64()
+}
@@ -0,0 +1,24 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"github.com/reducedb/bitmap/hll"
+)
+
+// ToHLL returns a HyperLogLog sketch of the positions of the bits set to 1, with 2^precision registers.
+// Merging the sketches of many bitmaps estimates the cardinality of their union, much faster than
+// computing it.
+func (this *Ewah) ToHLL(precision int) *hll.Sketch {
+	s := hll.New(precision)
+
+	for it := this.Iterator(); it.HasNext(); {
+		s.Add(it.Next())
+	}
+
+	return s
+}
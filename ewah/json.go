@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+)
+
+// JSONFormat is how MarshalJSON encodes the bitmaps
+type JSONFormat int32
+
+const (
+	// JSONPositions encodes a bitmap as the array of the positions of its bits set, like [1,5,7], which is
+	// easy to write by hand. It doesn't keep the size of the bitmap past the last bit set. It's the default.
+	JSONPositions JSONFormat = iota
+
+	// JSONBase64 encodes a bitmap as a string, the base64 encoding of MarshalBinary, which is much smaller
+	// for large bitmaps
+	JSONBase64
+)
+
+var jsonFormat int32
+
+var _ json.Marshaler = (*Ewah)(nil)
+var _ json.Unmarshaler = (*Ewah)(nil)
+
+// SetJSONFormat sets how MarshalJSON encodes the bitmaps of the whole program. UnmarshalJSON decodes both
+// formats, whatever the format set.
+func SetJSONFormat(f JSONFormat) {
+	atomic.StoreInt32(&jsonFormat, int32(f))
+}
+
+// CurrentJSONFormat returns the format set with SetJSONFormat
+func CurrentJSONFormat() JSONFormat {
+	return JSONFormat(atomic.LoadInt32(&jsonFormat))
+}
+
+// MarshalJSON encodes the bitmap in the format set with SetJSONFormat
+func (this *Ewah) MarshalJSON() ([]byte, error) {
+	if CurrentJSONFormat() == JSONBase64 {
+		b, err := this.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(b)
+	}
+
+	positions := make([]int64, 0, this.Cardinality())
+	for it := this.Iterator(); it.HasNext(); {
+		positions = append(positions, it.Next())
+	}
+
+	return json.Marshal(positions)
+}
+
+// UnmarshalJSON decodes a bitmap encoded by MarshalJSON, in either format, and replaces the content of the
+// bitmap. The positions of an array may be in any order, and repeated. null leaves the bitmap untouched.
+// Positions that can't be set return an error matching ErrOutOfRange, and strings that are not a bitmap
+// encoded by MarshalBinary an error matching ErrCorruptData.
+func (this *Ewah) UnmarshalJSON(b []byte) error {
+	if err := this.checkWritable("UnmarshalJSON"); err != nil {
+		return err
+	}
+
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+
+	if len(b) > 0 && b[0] == '"' {
+		var data string
+		if err := json.Unmarshal(b, &data); err != nil {
+			return err
+		}
+
+		words, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return newError(ErrCorruptData, "ewah/UnmarshalJSON: "+err.Error())
+		}
+
+		return this.UnmarshalBinary(words)
+	}
+
+	var positions []int64
+	if err := json.Unmarshal(b, &positions); err != nil {
+		return err
+	}
+
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	e := NewWithOptions(this.Options())
+	for k, i := range positions {
+		if k > 0 && i == positions[k-1] {
+			continue
+		}
+		if err := e.SetChecked(i); err != nil {
+			return err
+		}
+	}
+
+	this.load(e.buffer, e.actualSizeInWords, e.sizeInBits, e.setCursor.marker, false)
+
+	return nil
+}
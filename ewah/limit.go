@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// maxResultWords is the maximum number of words the result of a single Or or Not may take. 0 means
+// there is no limit.
+var maxResultWords int64
+
+// SetMaxResultWords sets the maximum number of compressed words that the result of a single Or or Not
+// is allowed to take. Operations whose estimated result is larger fail with ErrResultTooLarge (or return
+// nil for the methods that don't return an error). Use 0 to remove the limit, which is the default.
+func SetMaxResultWords(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&maxResultWords, n)
+}
+
+// MaxResultWords returns the current budget set with SetMaxResultWords.
+func MaxResultWords() int64 {
+	return atomic.LoadInt64(&maxResultWords)
+}
+
+// checkResultWords returns an error matching ErrResultTooLarge if the estimate goes over the configured
+// budget. fn is the function reported in the error.
+func checkResultWords(fn string, estimate int64) error {
+	if max := MaxResultWords(); max > 0 && estimate > max {
+		return newError(ErrResultTooLarge, fmt.Sprintf("ewah/%s: the result could take %d words, more than the budget of %d", fn, estimate, max))
+	}
+
+	return nil
+}
+
+// estimateOrWords returns an upper bound of the number of words needed to hold the union of the bitmaps.
+// Each word of the result is produced by consuming at least one word from one of the operands, so the
+// sum of the operands' sizes is never exceeded.
+func estimateOrWords(a ...*Ewah) int64 {
+	n := int64(0)
+	for _, v := range a {
+		n += v.actualSizeInWords
+	}
+
+	return n
+}
+
+// estimateNotWords returns an upper bound of the number of words needed to hold the negation of the
+// bitmap. Not works in place, but the last running length word may be split into a literal word.
+func estimateNotWords(a *Ewah) int64 {
+	return a.actualSizeInWords + 1
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LoadOptions describes the input of LoadPositions. The zero value reads one position per line, in
+// ascending order.
+type LoadOptions struct {
+	// Comma is the separator of the fields of a CSV input, like ',' or '\t'. If it's 0, the input has one
+	// position per line.
+	Comma rune
+
+	// Column is the index of the CSV field holding the positions, from 0
+	Column int
+
+	// Header skips the first line of the input
+	Header bool
+
+	// SortBuffer is the number of positions kept and sorted before they're added to the bitmap, so the
+	// input can be in any order. If it's 0, the positions must be in ascending order.
+	SortBuffer int
+}
+
+// LoadPositions returns a bitmap with the bits set at the positions read from r. Empty lines are skipped, and
+// positions may be repeated. With a sort buffer, the bitmap of each full buffer is merged into the result
+// with Or, so the memory used is bounded whatever the size of the input. A merge that could exceed the budget
+// set with SetMaxResultWords returns ErrResultTooLarge.
+func LoadPositions(r io.Reader, opts LoadOptions) (*Ewah, error) {
+	ans := NewEwah()
+	var buf []int64
+
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+
+		sort.Slice(buf, func(i, j int) bool { return buf[i] < buf[j] })
+
+		e := NewEwah()
+		for k, i := range buf {
+			if k > 0 && i == buf[k-1] {
+				continue
+			}
+			if e.Set(i) == nil {
+				return newError(ErrOutOfRange, fmt.Sprintf("ewah/LoadPositions: position %d out of range", i))
+			}
+		}
+		buf = buf[:0]
+
+		if ans.sizeInBits == 0 {
+			ans = e
+		} else {
+			res, err := ans.OrChecked(e)
+			if err != nil {
+				return err
+			}
+			ans = res.(*Ewah)
+		}
+
+		return nil
+	}
+
+	add := func(line int, s string) error {
+		if s = strings.TrimSpace(s); s == "" {
+			return nil
+		}
+
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ewah/LoadPositions: line %d: %v", line, err)
+		}
+
+		if opts.SortBuffer > 0 {
+			if buf = append(buf, i); len(buf) >= opts.SortBuffer {
+				return flush()
+			}
+			return nil
+		}
+
+		// Repeated positions are already set
+		if i == ans.sizeInBits-1 {
+			return nil
+		}
+		if i < ans.sizeInBits {
+			return newError(ErrOutOfOrder, fmt.Sprintf("ewah/LoadPositions: line %d: position %d after %d, without a sort buffer positions must be ascending", line, i, ans.sizeInBits-1))
+		}
+		if ans.Set(i) == nil {
+			return newError(ErrOutOfRange, fmt.Sprintf("ewah/LoadPositions: line %d: position %d out of range", line, i))
+		}
+
+		return nil
+	}
+
+	if opts.Comma == 0 {
+		s := bufio.NewScanner(r)
+		for line := 1; s.Scan(); line++ {
+			if line == 1 && opts.Header {
+				continue
+			}
+			if err := add(line, s.Text()); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		c := csv.NewReader(r)
+		c.Comma = opts.Comma
+		c.FieldsPerRecord = -1
+		c.ReuseRecord = true
+
+		for first := true; ; first = false {
+			record, err := c.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			line, _ := c.FieldPos(0)
+			if first && opts.Header {
+				continue
+			}
+			if opts.Column >= len(record) {
+				return nil, fmt.Errorf("ewah/LoadPositions: line %d: no column %d", line, opts.Column)
+			}
+			if err := add(line, record[opts.Column]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return ans, nil
+}
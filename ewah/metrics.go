@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"sync/atomic"
+)
+
+// Metrics receives measures of the work done by the package, for monitoring. The methods are called from
+// the goroutines doing the work, so they must be safe for concurrent use, and fast.
+type Metrics interface {
+	// Operation is called after each And, AndNot, Or, Xor or Not, with the name of the operation ("and",
+	// "andnot", "or", "xor" or "not") and the number of words of the result
+	Operation(op string, resultWords int64)
+
+	// PoolTask is called for each task given to a pool, with hit true if a goroutine of the pool was free to
+	// take it right away, and false if the task had to wait for one
+	PoolTask(hit bool)
+}
+
+// metricsHolder wraps the metrics, since an atomic.Value must always hold the same type
+type metricsHolder struct {
+	m Metrics
+}
+
+var metrics atomic.Value
+
+// SetMetrics sets where the measures of the package go. Use nil to stop sending them, which is the default.
+func SetMetrics(m Metrics) {
+	metrics.Store(metricsHolder{m})
+}
+
+//
+// Not-exported functions
+//
+
+func init() {
+	metrics.Store(metricsHolder{})
+}
+
+func currentMetrics() Metrics {
+	return metrics.Load().(metricsHolder).m
+}
+
+// recordOperation sends the size of the result of an operation to the metrics, if there are some
+func recordOperation(op string, ans *Ewah) {
+	if m := currentMetrics(); m != nil {
+		m.Operation(op, ans.actualSizeInWords)
+	}
+}
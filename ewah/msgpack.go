@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// The MessagePack type bytes of nil and of the binary values, whose length takes 1, 2 or 4 bytes
+const (
+	msgpackNil   = 0xc0
+	msgpackBin8  = 0xc4
+	msgpackBin16 = 0xc5
+	msgpackBin32 = 0xc6
+)
+
+// MarshalMsgpack encodes the bitmap as a MessagePack binary value holding its encoding by MarshalBinary.
+// It's the method the MessagePack libraries, like github.com/vmihailenco/msgpack, call to encode a value
+// that has it, so bitmaps can be embedded in MessagePack documents without this package depending on one.
+func (this *Ewah) MarshalMsgpack() ([]byte, error) {
+	b, err := this.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	var header []byte
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		header = []byte{msgpackBin8, byte(n)}
+	case n <= math.MaxUint16:
+		header = binary.BigEndian.AppendUint16([]byte{msgpackBin16}, uint16(n))
+	case n <= math.MaxUint32:
+		header = binary.BigEndian.AppendUint32([]byte{msgpackBin32}, uint32(n))
+	default:
+		return nil, newError(ErrOutOfRange, "ewah/MarshalMsgpack: bitmap is too large for MessagePack")
+	}
+
+	return append(header, b...), nil
+}
+
+// UnmarshalMsgpack decodes a bitmap encoded by MarshalMsgpack, and replaces the content of the bitmap. nil
+// leaves the bitmap untouched. Anything else than a binary value holding a bitmap returns an error matching
+// ErrCorruptData.
+func (this *Ewah) UnmarshalMsgpack(b []byte) error {
+	if err := this.checkWritable("UnmarshalMsgpack"); err != nil {
+		return err
+	}
+
+	if len(b) == 1 && b[0] == msgpackNil {
+		return nil
+	}
+
+	var n, header int
+	switch {
+	case len(b) >= 2 && b[0] == msgpackBin8:
+		n, header = int(b[1]), 2
+	case len(b) >= 3 && b[0] == msgpackBin16:
+		n, header = int(binary.BigEndian.Uint16(b[1:])), 3
+	case len(b) >= 5 && b[0] == msgpackBin32:
+		n, header = int(binary.BigEndian.Uint32(b[1:])), 5
+	default:
+		return newError(ErrCorruptData, "ewah/UnmarshalMsgpack: not a MessagePack binary value")
+	}
+
+	if len(b) != header+n {
+		return newError(ErrCorruptData, "ewah/UnmarshalMsgpack: invalid length")
+	}
+
+	return this.UnmarshalBinary(b[header:])
+}
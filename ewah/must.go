@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"github.com/reducedb/bitmap"
+)
+
+// MustSet is the same as SetChecked, but it panics with the error instead of returning it, and returns the
+// bitmap so calls can be chained:
+//
+//	a := ewah.NewEwah().MustSet(1).MustSet(5).MustAnd(b)
+func (this *Ewah) MustSet(i int64) *Ewah {
+	must(this.SetChecked(i))
+	return this
+}
+
+// MustAnd is the same as AndChecked, but it panics with the error instead of returning it
+func (this *Ewah) MustAnd(a ...bitmap.Bitmap) *Ewah {
+	return mustResult(this.AndChecked(a...))
+}
+
+// MustAndNot is the same as AndNotChecked, but it panics with the error instead of returning it
+func (this *Ewah) MustAndNot(a ...bitmap.Bitmap) *Ewah {
+	return mustResult(this.AndNotChecked(a...))
+}
+
+// MustOr is the same as OrChecked, but it panics with the error instead of returning it
+func (this *Ewah) MustOr(a ...bitmap.Bitmap) *Ewah {
+	return mustResult(this.OrChecked(a...))
+}
+
+// MustXor is the same as XorChecked, but it panics with the error instead of returning it
+func (this *Ewah) MustXor(a ...bitmap.Bitmap) *Ewah {
+	return mustResult(this.XorChecked(a...))
+}
+
+// MustNot is the same as NotChecked, but it panics with the error instead of returning it
+func (this *Ewah) MustNot() *Ewah {
+	return mustResult(this.NotChecked())
+}
+
+// MustEncodeToString is the same as EncodeToString, but it panics with the error instead of returning it
+func (this *Ewah) MustEncodeToString() string {
+	s, err := this.EncodeToString()
+	must(err)
+
+	return s
+}
+
+//
+// Not-exported functions
+//
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func mustResult(ans bitmap.Bitmap, err error) *Ewah {
+	must(err)
+	return ans.(*Ewah)
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"github.com/reducedb/bitmap"
+	"math"
+	"sort"
+)
+
+// Options changes how the operations of a bitmap build their results, and how it's encoded. The zero value
+// is the default behavior of the package, the one of JavaEWAH.
+type Options struct {
+	// NoPadding leaves the results of And, AndNot, Or and Xor at the size their words cover, a multiple of
+	// 64 bits, instead of padding them with 0's to the size of the largest operand. It changes what Size,
+	// Not and the operations on the result see: an unpadded And of two bitmaps of 100 bits is 128 bits,
+	// and Not sets the bits up to there.
+	NoPadding bool
+
+	// OutOfOrder is what Set does with a position before the last bit set
+	OutOfOrder SetMode
+
+	// Checksum appends the CRC32C of the encoding, big endian, to what MarshalBinary and the encoders built
+	// on it return, and makes UnmarshalBinary, ReadFrom and DeserializeLimitedWithOptions fail with
+	// ErrChecksumMismatch on encodings that don't end with a matching one. Without it, UnmarshalBinary still checks the encodings ending with one,
+	// but ReadFrom doesn't read it.
+	Checksum bool
+}
+
+// SetMode is what Set does with a position before the last bit set, until bitmaps support setting bits in
+// any order
+type SetMode int
+
+const (
+	// SetFail fails with ErrOutOfOrder, Set returning nil. It's the default.
+	SetFail SetMode = iota
+
+	// SetIgnoreSet does nothing if the bit is already set, and fails like SetFail otherwise
+	SetIgnoreSet
+
+	// SetBuffered keeps the positions aside, and merges them into the bitmap with a single Or when there
+	// are many of them, when Flush is called, or when the bitmap is read by Get, Cardinality, Iterator,
+	// Snapshot, Equal, the operations or the encoders. The other methods, like Stats or Validate,
+	// don't see the positions kept aside until Flush is called. As the reads merging them modify the
+	// bitmap, Flush must be called before the bitmap is read by several goroutines.
+	SetBuffered
+)
+
+// NewWithOptions returns an empty bitmap with the options. The results of the operations of the bitmap,
+// its clones and its snapshots have the same options, and Reset keeps them. The results of AndWith, OrWith
+// and the other variants taking options have the options of the call.
+func NewWithOptions(opts Options) *Ewah {
+	e := NewEwah()
+	e.SetOptions(opts)
+
+	return e
+}
+
+// Options returns the options of the bitmap
+func (this *Ewah) Options() Options {
+	if this == nil {
+		return Options{}
+	}
+
+	return Options{NoPadding: !this.adjustContainerSizeWhenAggregating, OutOfOrder: this.setMode, Checksum: this.checksum}
+}
+
+// SetOptions changes the options of the bitmap, for the next operations
+func (this *Ewah) SetOptions(opts Options) {
+	if this.IsReadOnly() {
+		return
+	}
+
+	this.Flush()
+	this.adjustContainerSizeWhenAggregating = !opts.NoPadding
+	this.setMode = opts.OutOfOrder
+	this.checksum = opts.Checksum
+}
+
+// Flush merges into the bitmap the positions kept aside by Set with the SetBuffered mode
+func (this *Ewah) Flush() {
+	if this == nil || len(this.pending) == 0 {
+		return
+	}
+
+	pending := this.pending
+	this.pending = nil
+	sort.Slice(pending, func(i, j int) bool { return pending[i] < pending[j] })
+
+	p := NewEwah()
+	for _, i := range pending {
+		if i >= p.sizeInBits {
+			p.Set(i)
+		}
+	}
+
+	ans := NewEwah()
+	ans.reserve(int32(math.Max(float64(this.actualSizeInWords), float64(p.actualSizeInWords))))
+	this.orToContainer(p, ans)
+	this.load(ans.buffer, ans.actualSizeInWords, this.sizeInBits, ans.setCursor.marker, false)
+}
+
+// AndWith is the same as AndChecked, but with the options instead of the ones of the bitmap
+func (this *Ewah) AndWith(opts Options, a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.withOptions(opts).AndChecked(a...)
+}
+
+// AndNotWith is the same as AndNotChecked, but with the options instead of the ones of the bitmap
+func (this *Ewah) AndNotWith(opts Options, a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.withOptions(opts).AndNotChecked(a...)
+}
+
+// OrWith is the same as OrChecked, but with the options instead of the ones of the bitmap
+func (this *Ewah) OrWith(opts Options, a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.withOptions(opts).OrChecked(a...)
+}
+
+// XorWith is the same as XorChecked, but with the options instead of the ones of the bitmap
+func (this *Ewah) XorWith(opts Options, a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.withOptions(opts).XorChecked(a...)
+}
+
+//
+// Not-exported functions
+//
+
+// withOptions returns the bitmap with other options, as a view sharing its buffer. Unlike a snapshot, the
+// view doesn't protect the buffer, so it's only used as the left operand of an operation.
+func (this *Ewah) withOptions(opts Options) *Ewah {
+	this = this.orEmpty()
+	if this.Options() == opts {
+		return this
+	}
+
+	buffer := this.buffer[:this.actualSizeInWords:this.actualSizeInWords]
+
+	v := &Ewah{
+		actualSizeInWords:                  this.actualSizeInWords,
+		sizeInBits:                         this.sizeInBits,
+		buffer:                             buffer,
+		adjustContainerSizeWhenAggregating: !opts.NoPadding,
+		setMode:                            opts.OutOfOrder,
+		checksum:                           opts.Checksum,
+		getCursor:                          newCursor(buffer, this.actualSizeInWords),
+		setCursor:                          newCursor(buffer, this.actualSizeInWords),
+	}
+	v.setCursor.resetMarker(buffer, this.actualSizeInWords, this.setCursor.marker)
+
+	return v
+}
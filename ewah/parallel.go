@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// parallelBatchSize is the number of bitmaps a worker takes at once, and ORs together before checking if
+// the context is done
+const parallelBatchSize = 64
+
+// ParallelOrAll returns the union of all the bitmaps, computed by up to workers goroutines of the default
+// pool (all of them if workers is not positive). Each worker ORs batches of bitmaps into a partial union,
+// and the partial unions are ORed at the end. It stops as soon as the context is done, and returns its
+// error, or ErrResultTooLarge if a union could exceed the budget set with SetMaxResultWords. The bitmaps
+// must not be modified meanwhile.
+func ParallelOrAll(ctx context.Context, bms []*Ewah, workers int) (*Ewah, error) {
+	end := startOperationAll(ctx, "parallelor", bms)
+	ans, err := parallelOrAll(ctx, bms, workers)
+	end(ans, err)
+
+	return ans, err
+}
+
+//
+// Not-exported functions
+//
+
+// parallelOrAll is ParallelOrAll, without the span
+func parallelOrAll(ctx context.Context, bms []*Ewah, workers int) (*Ewah, error) {
+	batches := (len(bms) + parallelBatchSize - 1) / parallelBatchSize
+	pool := DefaultPool()
+	workers = pool.workers(workers, batches)
+
+	var next int64 = -1
+	partials := make([]*Ewah, workers)
+	errs := make([]error, workers)
+	tasks := make([]func(), workers)
+
+	for w := range tasks {
+		w := w
+		tasks[w] = func() {
+			for k := int(atomic.AddInt64(&next, 1)); k < batches && errs[w] == nil; k = int(atomic.AddInt64(&next, 1)) {
+				if errs[w] = ctx.Err(); errs[w] != nil {
+					break
+				}
+
+				start, end := k*parallelBatchSize, (k+1)*parallelBatchSize
+				if end > len(bms) {
+					end = len(bms)
+				}
+
+				// Copy the batch, since the partial union is appended to it
+				batch := append(make([]*Ewah, 0, end-start+1), bms[start:end]...)
+				if partials[w] != nil {
+					batch = append(batch, partials[w])
+				}
+
+				partials[w], errs[w] = orAll(batch)
+			}
+		}
+	}
+
+	pool.run(tasks...)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var results []*Ewah
+	for w := range partials {
+		if errs[w] != nil {
+			return nil, errs[w]
+		}
+		if partials[w] != nil {
+			results = append(results, partials[w])
+		}
+	}
+
+	return orAll(results)
+}
+
+// orAll returns the union of the bitmaps, or an empty bitmap if there are none
+func orAll(bms []*Ewah) (*Ewah, error) {
+	switch len(bms) {
+	case 0:
+		return NewEwah(), nil
+	case 1:
+		return bms[0].Clone().(*Ewah), nil
+	}
+
+	return orOperands(bms)
+}
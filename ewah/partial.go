@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"context"
+	"errors"
+	"github.com/reducedb/bitmap"
+)
+
+// ErrDeadlineExceeded is returned with a partial result when the deadline of the context passed to
+// OrAllPartial or AndAllPartial is reached before all the bitmaps are folded.
+var ErrDeadlineExceeded = errors.New("ewah: deadline exceeded, the result is partial")
+
+// OrAllPartial returns the union of the bitmaps, and the number of bitmaps it covers. If the context is
+// done before all the bitmaps are folded, it returns the union of the first ones, with ErrDeadlineExceeded
+// if the deadline was reached or the error of the context otherwise. The context is checked between
+// batches of bitmaps.
+func OrAllPartial(ctx context.Context, bms []*Ewah) (*Ewah, int, error) {
+	return foldPartial(ctx, bms, orAll)
+}
+
+// AndAllPartial returns the intersection of the bitmaps, and the number of bitmaps it covers, like
+// OrAllPartial. A partial intersection has all the bits of the complete one, and maybe more.
+func AndAllPartial(ctx context.Context, bms []*Ewah) (*Ewah, int, error) {
+	return foldPartial(ctx, bms, andAll)
+}
+
+//
+// Not-exported functions
+//
+
+// foldPartial folds the bitmaps with f by batches, until they're all folded or the context is done
+func foldPartial(ctx context.Context, bms []*Ewah, f func([]*Ewah) (*Ewah, error)) (*Ewah, int, error) {
+	ans := NewEwah()
+
+	for n := 0; n < len(bms); {
+		if err := ctx.Err(); err != nil {
+			if err == context.DeadlineExceeded {
+				err = ErrDeadlineExceeded
+			}
+			return ans, n, err
+		}
+
+		end := n + parallelBatchSize
+		if end > len(bms) {
+			end = len(bms)
+		}
+
+		batch := append(make([]*Ewah, 0, end-n+1), bms[n:end]...)
+		if n > 0 {
+			batch = append(batch, ans)
+		}
+
+		r, err := f(batch)
+		if err != nil {
+			return ans, n, err
+		}
+
+		ans, n = r, end
+	}
+
+	return ans, len(bms), nil
+}
+
+// andAll returns the intersection of the bitmaps, or an empty bitmap if there are none
+func andAll(bms []*Ewah) (*Ewah, error) {
+	switch len(bms) {
+	case 0:
+		return NewEwah(), nil
+	case 1:
+		return bms[0].Clone().(*Ewah), nil
+	}
+
+	others := make([]bitmap.Bitmap, len(bms)-1)
+	for k, e := range bms[1:] {
+		others[k] = e
+	}
+
+	ans := bms[0].And(others...)
+	if ans == nil {
+		return nil, errors.New("ewah/andAll: intersection failed")
+	}
+
+	return ans.(*Ewah), nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool is a fixed set of goroutines that run the work of the parallel operations (ParallelOrAll,
+// Builder.Build, MarshalSegmented and UnmarshalSegmented). All the operations share the default pool, so the
+// number of goroutines working for the package is bounded however many operations run at the same time.
+type Pool struct {
+	size  int
+	tasks chan func()
+	once  sync.Once
+}
+
+var defaultPool atomic.Value
+
+// NewPool returns a pool of size goroutines, or one per CPU if size is not positive. The goroutines are
+// started the first time the pool is used.
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = runtime.GOMAXPROCS(0)
+	}
+
+	return &Pool{
+		size:  size,
+		tasks: make(chan func()),
+	}
+}
+
+// SetDefaultPool sets the pool used by the parallel operations. The previous pool is not closed, since
+// operations may still be using it.
+func SetDefaultPool(p *Pool) {
+	if p != nil {
+		defaultPool.Store(p)
+	}
+}
+
+// DefaultPool returns the pool used by the parallel operations, by default one goroutine per CPU
+func DefaultPool() *Pool {
+	return defaultPool.Load().(*Pool)
+}
+
+// Size returns the number of goroutines of the pool
+func (this *Pool) Size() int {
+	return this.size
+}
+
+// Close stops the goroutines of the pool once they're done with their current work. The pool must not be
+// used anymore.
+func (this *Pool) Close() {
+	this.once.Do(func() {})
+	close(this.tasks)
+}
+
+//
+// Not-exported functions
+//
+
+func init() {
+	defaultPool.Store(NewPool(0))
+}
+
+// run runs the tasks on the goroutines of the pool, and waits until they're all done. Tasks wait for a free
+// goroutine, so run must not be called from a task.
+func (this *Pool) run(tasks ...func()) {
+	this.once.Do(func() {
+		for k := 0; k < this.size; k++ {
+			go func() {
+				for task := range this.tasks {
+					task()
+				}
+			}()
+		}
+	})
+
+	m := currentMetrics()
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		task := task
+		f := func() {
+			defer wg.Done()
+			task()
+		}
+
+		if m == nil {
+			this.tasks <- f
+			continue
+		}
+
+		// The send only goes through right away if a goroutine is waiting for a task
+		select {
+		case this.tasks <- f:
+			m.PoolTask(true)
+		default:
+			m.PoolTask(false)
+			this.tasks <- f
+		}
+	}
+
+	wg.Wait()
+}
+
+// workers returns how many goroutines of the pool work on n tasks, when the caller asks for workers (all of
+// them if it's not positive)
+func (this *Pool) workers(workers, n int) int {
+	if workers < 1 || workers > this.size {
+		workers = this.size
+	}
+	if workers > n {
+		workers = n
+	}
+
+	return workers
+}
+
+// parallelFor calls f(0) ... f(n-1) from up to workers goroutines of the default pool (as many as the pool
+// has if workers is not positive), and returns the first error
+func parallelFor(n, workers int, f func(k int) error) error {
+	pool := DefaultPool()
+	workers = pool.workers(workers, n)
+
+	var next int64 = -1
+	errs := make([]error, workers)
+	tasks := make([]func(), workers)
+
+	for w := range tasks {
+		w := w
+		tasks[w] = func() {
+			for k := int(atomic.AddInt64(&next, 1)); k < n; k = int(atomic.AddInt64(&next, 1)) {
+				if errs[w] == nil {
+					errs[w] = f(k)
+				}
+			}
+		}
+	}
+
+	pool.run(tasks...)
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"math"
+	"sort"
+)
+
+// queueBatchSize is the number of positions the queue collects before applying them to the bitmap
+const queueBatchSize = 4096
+
+// Queue lets many goroutines set bits in a bitmap, in any order. The positions go through a channel to a
+// single goroutine that owns the bitmap, which sorts them by batches and adds them to the bitmap. Flush
+// waits until everything queued before it is applied.
+type Queue struct {
+	items chan queueItem
+}
+
+// queueItem is either a position to set, or a flush request if done is not nil
+type queueItem struct {
+	pos  int64
+	done chan queueResult
+}
+
+type queueResult struct {
+	e   *Ewah
+	err error
+}
+
+// NewQueue returns a queue that sets bits in e, or in a new bitmap if e is nil. e must not be used
+// anymore, except through Flush and Close. capacity is the number of positions that can be queued before
+// Set blocks.
+func NewQueue(e *Ewah, capacity int) *Queue {
+	if e == nil {
+		e = NewEwah()
+	}
+
+	this := &Queue{
+		items: make(chan queueItem, capacity),
+	}
+
+	go this.run(e)
+
+	return this
+}
+
+// Set queues the bit at position i to be set to true (1). It returns nil if i is out of the range EWAH
+// supports. It must not be called after Close.
+func (this *Queue) Set(i int64) *Queue {
+	if i < 0 || i > math.MaxInt32-wordInBits {
+		return nil
+	}
+
+	this.items <- queueItem{pos: i}
+
+	return this
+}
+
+// Flush waits until all the bits queued before are set, and returns a snapshot of the bitmap. It returns
+// ErrResultTooLarge if merging the queued bits could exceed the budget set with SetMaxResultWords, in which
+// case they are dropped.
+func (this *Queue) Flush() (*Ewah, error) {
+	done := make(chan queueResult)
+	this.items <- queueItem{done: done}
+
+	r := <-done
+
+	return r.e, r.err
+}
+
+// Close flushes the queue, stops its goroutine and returns the bitmap
+func (this *Queue) Close() (*Ewah, error) {
+	e, err := this.Flush()
+	close(this.items)
+
+	return e, err
+}
+
+//
+// Not-exported functions
+//
+
+func (this *Queue) run(e *Ewah) {
+	pending := make([]int64, 0, queueBatchSize)
+
+	var err error
+	for item := range this.items {
+		if item.done == nil {
+			if pending = append(pending, item.pos); len(pending) == queueBatchSize {
+				e, err = applyPending(e, pending, err)
+				pending = pending[:0]
+			}
+			continue
+		}
+
+		e, err = applyPending(e, pending, err)
+		pending = pending[:0]
+
+		item.done <- queueResult{e.Snapshot(), err}
+		err = nil
+	}
+}
+
+// applyPending adds the positions to e. Positions after the last bit of e are set directly, otherwise they're
+// ORed with e. err is the error of a previous batch, which is kept.
+func applyPending(e *Ewah, pending []int64, err error) (*Ewah, error) {
+	if len(pending) == 0 {
+		return e, err
+	}
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i] < pending[j] })
+
+	target := e
+	if pending[0] < e.Size() {
+		target = NewEwah()
+	}
+
+	for k, i := range pending {
+		if k == 0 || i != pending[k-1] {
+			target.Set(i)
+		}
+	}
+
+	if target == e {
+		return e, err
+	}
+
+	ans, orErr := e.OrChecked(target)
+	if orErr != nil {
+		return e, orErr
+	}
+
+	return ans.(*Ewah), err
+}
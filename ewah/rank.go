@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// rankBlockWords is the number of literal words between two checkpoints of a rank index. Rank and Select
+// count the bits of up to this many words after the binary search.
+const rankBlockWords = 64
+
+// RankIndex answers rank and select queries on a bitmap in O(log n). It keeps, next to the bitmap, the
+// number of bits set before each run and each block of literal words, which costs about one checkpoint
+// for every 64 literal words. The index is built for the bitmap as it is, and later changes to the bitmap
+// are not seen. Any number of goroutines can use it at the same time.
+type RankIndex struct {
+	e *Ewah
+
+	blocks      []rankBlock
+	cardinality int64
+}
+
+// rankBlock is a run of empty or full words, or a block of literal words
+type rankBlock struct {
+	// word is the index of the first uncompressed word of the block, and n the number of words
+	word int64
+	n    int64
+
+	// pos is the position in the buffer of the first literal word, or -1 for a run of value
+	pos   int64
+	value bool
+
+	// ones is the number of bits set before the block
+	ones int64
+}
+
+// BuildRankIndex returns a rank index of the bitmap as it is now. It shares the buffer with the bitmap
+// until the bitmap is modified.
+func (this *Ewah) BuildRankIndex() *RankIndex {
+	r := &RankIndex{
+		e: this.Snapshot(),
+	}
+
+	buffer := r.e.buffer
+	word, ones := int64(0), int64(0)
+	for pos := int64(0); pos < r.e.actualSizeInWords; {
+		rlw := buffer[pos]
+		runlen := int64((rlw >> 1) & LargestRunningLengthCount)
+		literals := int64(rlw >> uint32(1+RunningLengthBits))
+
+		if runlen > 0 {
+			b := rankBlock{word: word, n: runlen, pos: -1, value: rlw&1 != 0, ones: ones}
+			r.blocks = append(r.blocks, b)
+
+			if b.value {
+				ones += runlen * wordInBits
+			}
+			word += runlen
+		}
+
+		for k := int64(0); k < literals; k += rankBlockWords {
+			n := literals - k
+			if n > rankBlockWords {
+				n = rankBlockWords
+			}
+
+			r.blocks = append(r.blocks, rankBlock{word: word, n: n, pos: pos + 1 + k, ones: ones})
+
+			for _, w := range buffer[pos+1+k : pos+1+k+n] {
+				ones += int64(bits.OnesCount64(w))
+			}
+			word += n
+		}
+
+		pos += 1 + literals
+	}
+
+	r.cardinality = ones
+
+	return r
+}
+
+// Cardinality returns the number of bits set to 1
+func (this *RankIndex) Cardinality() int64 {
+	return this.cardinality
+}
+
+// Rank returns the number of bits set to 1 before position i, that is in [0, i[
+func (this *RankIndex) Rank(i int64) int64 {
+	if i <= 0 {
+		return 0
+	}
+	if i >= this.e.sizeInBits {
+		return this.cardinality
+	}
+
+	w := i / wordInBits
+
+	// The block covering w is the last one starting at or before it
+	k := sort.Search(len(this.blocks), func(k int) bool { return this.blocks[k].word > w }) - 1
+	if k < 0 {
+		return 0
+	}
+
+	b := this.blocks[k]
+	if w >= b.word+b.n {
+		return this.cardinality
+	}
+
+	if b.pos < 0 {
+		if b.value {
+			return b.ones + (w-b.word)*wordInBits + i%wordInBits
+		}
+		return b.ones
+	}
+
+	n := b.ones
+	for _, x := range this.e.buffer[b.pos : b.pos+w-b.word] {
+		n += int64(bits.OnesCount64(x))
+	}
+
+	mask := uint64(1)<<uint64(i%wordInBits) - 1
+
+	return n + int64(bits.OnesCount64(this.e.buffer[b.pos+w-b.word]&mask))
+}
+
+// Select returns the position of the bit set to 1 of rank k, that is the (k+1)-th one, or -1 if there are
+// not that many bits set. Rank(Select(k)) == k.
+func (this *RankIndex) Select(k int64) int64 {
+	if k < 0 || k >= this.cardinality {
+		return -1
+	}
+
+	// The block holding the bit is the last one with fewer bits set before it
+	j := sort.Search(len(this.blocks), func(j int) bool { return this.blocks[j].ones > k }) - 1
+	b := this.blocks[j]
+	k -= b.ones
+
+	if b.pos < 0 {
+		return b.word*wordInBits + k
+	}
+
+	for x, w := range this.e.buffer[b.pos : b.pos+b.n] {
+		n := int64(bits.OnesCount64(w))
+		if k >= n {
+			k -= n
+			continue
+		}
+
+		// Drop the k lowest bits set, the next one is the bit
+		for ; k > 0; k-- {
+			w &= w - 1
+		}
+
+		return (b.word+int64(x))*wordInBits + int64(bits.TrailingZeros64(w))
+	}
+
+	return -1
+}
+
+// PositionAtPercentile returns the smallest position with at least p percent of the bits set at or below
+// it, so PositionAtPercentile(50) is the median of the positions. It returns -1 if there's no bit set or p
+// is out of [0, 100].
+func (this *RankIndex) PositionAtPercentile(p float64) int64 {
+	if p < 0 || p > 100 || this.cardinality == 0 {
+		return -1
+	}
+
+	k := int64(math.Ceil(p/100*float64(this.cardinality))) - 1
+	if k < 0 {
+		k = 0
+	}
+
+	return this.Select(k)
+}
+
+// PositionAtPercentile is RankIndex's PositionAtPercentile, without an index. It walks the bitmap, so build
+// a rank index to query several percentiles.
+func (this *Ewah) PositionAtPercentile(p float64) int64 {
+	return this.BuildRankIndex().PositionAtPercentile(p)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"github.com/reducedb/bitmap"
+)
+
+// ReadOnlyBitmap is a bitmap that can be read, iterated, and used as the left operand of the operations,
+// but not modified. Like a bitmap, it must not be read by several goroutines at the same time.
+type ReadOnlyBitmap interface {
+	bitmap.Reader
+	Iterator() *Iterator
+	And(...bitmap.Bitmap) bitmap.Bitmap
+	Or(...bitmap.Bitmap) bitmap.Bitmap
+	AndNot(...bitmap.Bitmap) bitmap.Bitmap
+	Xor(...bitmap.Bitmap) bitmap.Bitmap
+}
+
+var _ ReadOnlyBitmap = (*Ewah)(nil)
+
+// SetReadOnly makes the bitmap read-only, for good. The methods returning an error, like SetChecked,
+// CopyFrom, NotChecked and the Unmarshal methods, then return an error matching ErrReadOnly, and the others
+// leave it untouched: Set, SetRange, Not, Copy and Swap return nil, and Reset, Clear and SetOptions do
+// nothing. The operations, Clone and Snapshot still work, and their results are not read-only.
+//
+// Unlike Freeze, it doesn't change the type of the bitmap, so a service can hand a reference to code it
+// doesn't trust and be sure it comes back unmodified. It doesn't make the bitmap safe for concurrent reads.
+func (this *Ewah) SetReadOnly() {
+	this.Flush()
+	this.readOnly.Store(true)
+}
+
+// IsReadOnly returns true if SetReadOnly was called
+func (this *Ewah) IsReadOnly() bool {
+	return this != nil && this.readOnly.Load()
+}
+
+// FromBuffer returns the bitmap encoded in b by MarshalCpp or by the C++ library, reading its words in place like
+// ViewCpp, so a large file mapped in memory is opened without a copy. b must not be modified while the bitmap
+// is in use. The bitmap is read-only: if it's converted back to an *Ewah, it can't be modified either.
+//
+// The words of MarshalBinary are big endian, so they can't be read in place on the little endian machines
+// most programs run on. Bitmaps meant to be opened with FromBuffer are written with MarshalCpp instead.
+func FromBuffer(b []byte) (ReadOnlyBitmap, error) {
+	e, err := ViewCpp(b)
+	if err != nil {
+		return nil, err
+	}
+
+	e.SetReadOnly()
+
+	return e, nil
+}
+
+//
+// Not-exported functions
+//
+
+// checkWritable returns an error matching ErrReadOnly if the bitmap is read-only
+func (this *Ewah) checkWritable(fn string) error {
+	if this.IsReadOnly() {
+		return newError(ErrReadOnly, "ewah/"+fn+": the bitmap is read-only")
+	}
+
+	return nil
+}
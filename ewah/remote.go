@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// DefaultRemoteCacheSize is the default number of segments a RemoteSegmented keeps decoded in memory
+const DefaultRemoteCacheSize = 16
+
+// RangeFetcher reads ranges of bytes of an encoded bitmap, from an object store for example, with HTTP
+// range requests. It's called from several goroutines if the RemoteSegmented is.
+type RangeFetcher interface {
+	FetchRange(ctx context.Context, offset, length int64) ([]byte, error)
+}
+
+// RangeFetcherFunc is a function used as a RangeFetcher
+type RangeFetcherFunc func(ctx context.Context, offset, length int64) ([]byte, error)
+
+func (this RangeFetcherFunc) FetchRange(ctx context.Context, offset, length int64) ([]byte, error) {
+	return this(ctx, offset, length)
+}
+
+// ReaderAtFetcher returns a RangeFetcher reading from r, like a local file
+func ReaderAtFetcher(r io.ReaderAt) RangeFetcher {
+	return RangeFetcherFunc(func(ctx context.Context, offset, length int64) ([]byte, error) {
+		b := make([]byte, length)
+		if _, err := r.ReadAt(b, offset); err != nil {
+			return nil, err
+		}
+		return b, nil
+	})
+}
+
+// RemoteSegmented answers queries on a bitmap encoded by MarshalSegmented without reading all of it: only
+// the header and the segments a query needs are fetched, the segments next to each other with a single
+// range. The most recently used segments are kept decoded, and the number of bits set in each segment once
+// it has been read, so Rank only fetches the segments it has never seen. Any number of goroutines can use
+// it at the same time.
+type RemoteSegmented struct {
+	f RangeFetcher
+
+	segmentBits int64
+	sizeInBits  int64
+	offsets     []int64
+
+	mu sync.Mutex
+
+	// cardinalities is the number of bits set in each segment, or -1 if it has never been read
+	cardinalities []int64
+
+	// cache holds the most recently used segments, most recent first
+	cache     *list.List
+	cached    map[int64]*list.Element
+	cacheSize int
+}
+
+type remoteSegment struct {
+	k int64
+	e *Ewah
+}
+
+// OpenSegmented reads the header of a segmented bitmap through f, and keeps up to cacheSize segments decoded
+// in memory, or DefaultRemoteCacheSize if cacheSize is not positive
+func OpenSegmented(ctx context.Context, f RangeFetcher, cacheSize int) (*RemoteSegmented, error) {
+	header, err := f.FetchRange(ctx, 0, segmentedHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	segmentBits, sizeInBits, count, err := readSegmentedHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := f.FetchRange(ctx, segmentedHeaderSize, 8*count)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(table)) != 8*count {
+		return nil, errors.New("ewah/OpenSegmented: short read")
+	}
+
+	offsets, err := segmentedOffsets(table, count, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheSize < 1 {
+		cacheSize = DefaultRemoteCacheSize
+	}
+
+	cardinalities := make([]int64, count)
+	for k := range cardinalities {
+		cardinalities[k] = -1
+	}
+
+	return &RemoteSegmented{
+		f:             f,
+		segmentBits:   segmentBits,
+		sizeInBits:    sizeInBits,
+		offsets:       offsets,
+		cardinalities: cardinalities,
+		cache:         list.New(),
+		cached:        make(map[int64]*list.Element),
+		cacheSize:     cacheSize,
+	}, nil
+}
+
+// Size returns the size of the bitmap in bits
+func (this *RemoteSegmented) Size() int64 {
+	return this.sizeInBits
+}
+
+// Get returns the value of the bit at position i, fetching its segment if needed
+func (this *RemoteSegmented) Get(ctx context.Context, i int64) (bool, error) {
+	if i < 0 || i >= this.sizeInBits {
+		return false, nil
+	}
+
+	segments, err := this.segments(ctx, i/this.segmentBits, i/this.segmentBits)
+	if err != nil {
+		return false, err
+	}
+
+	return segments[0].lookup(i % this.segmentBits), nil
+}
+
+// Rank returns the number of bits set before position i, that is in [0, i[, fetching the segments before
+// it that have never been read
+func (this *RemoteSegmented) Rank(ctx context.Context, i int64) (int64, error) {
+	if i <= 0 {
+		return 0, nil
+	}
+	if i > this.sizeInBits {
+		i = this.sizeInBits
+	}
+
+	last := (i - 1) / this.segmentBits
+
+	// Fetch the segments never read, then count the bits of the whole ones
+	for k := int64(0); k < last; k++ {
+		if this.cardinality(k) >= 0 {
+			continue
+		}
+
+		end := k
+		for end+1 < last && this.cardinality(end+1) < 0 {
+			end++
+		}
+
+		if _, err := this.segments(ctx, k, end); err != nil {
+			return 0, err
+		}
+		k = end
+	}
+
+	n := int64(0)
+	for k := int64(0); k < last; k++ {
+		n += this.cardinality(k)
+	}
+
+	segments, err := this.segments(ctx, last, last)
+	if err != nil {
+		return 0, err
+	}
+
+	return n + segments[0].BuildRankIndex().Rank(i-last*this.segmentBits), nil
+}
+
+// Slice returns a bitmap with the bits set in [start, end[, at the same positions, fetching the segments of
+// the range. Its size is end, or the size of the bitmap if it's smaller.
+func (this *RemoteSegmented) Slice(ctx context.Context, start, end int64) (*Ewah, error) {
+	if start < 0 {
+		start = 0
+	}
+	if end > this.sizeInBits {
+		end = this.sizeInBits
+	}
+
+	ans := NewEwah()
+	if start >= end {
+		return ans, nil
+	}
+
+	first, last := start/this.segmentBits, (end-1)/this.segmentBits
+	segments, err := this.segments(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	// Put the segments back together after the 0's before them, then keep the range
+	ans.addStreamOfEmptyWords(false, first*this.segmentBits/wordInBits)
+	for _, s := range segments {
+		s.walkWords(ans.addStreamOfEmptyWords, ans.add)
+	}
+	ans.sizeInBits = first*this.segmentBits + segments[len(segments)-1].sizeInBits + int64(len(segments)-1)*this.segmentBits
+
+	mask := NewEwah()
+	mask.SetRange(start, end)
+
+	r, err := ans.AndChecked(mask)
+	if err != nil {
+		return nil, err
+	}
+
+	ans = r.(*Ewah)
+	ans.sizeInBits = end
+
+	return ans, nil
+}
+
+//
+// Not-exported functions
+//
+
+func (this *RemoteSegmented) cardinality(k int64) int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.cardinalities[k]
+}
+
+// segments returns the segments first to last, fetching those that are not cached with a single range
+func (this *RemoteSegmented) segments(ctx context.Context, first, last int64) ([]*Ewah, error) {
+	ans := make([]*Ewah, last-first+1)
+
+	this.mu.Lock()
+	from, to := int64(-1), int64(-1)
+	for k := first; k <= last; k++ {
+		if el, ok := this.cached[k]; ok {
+			this.cache.MoveToFront(el)
+			ans[k-first] = el.Value.(*remoteSegment).e
+			continue
+		}
+
+		if from < 0 {
+			from = k
+		}
+		to = k
+	}
+	this.mu.Unlock()
+
+	if from < 0 {
+		return ans, nil
+	}
+
+	// The segments between the first and the last missing ones are fetched again if they're cached, which
+	// costs less than another request
+	b, err := this.f.FetchRange(ctx, this.offsets[from], this.offsets[to+1]-this.offsets[from])
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != this.offsets[to+1]-this.offsets[from] {
+		return nil, errors.New("ewah/RemoteSegmented: short read")
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for k := from; k <= to; k++ {
+		e, err := decodeSegment(b[this.offsets[k]-this.offsets[from]:this.offsets[k+1]-this.offsets[from]], k, this.segmentBits, this.sizeInBits)
+		if err != nil {
+			return nil, err
+		}
+
+		ans[k-first] = e
+		this.cardinalities[k] = e.Cardinality()
+
+		if el, ok := this.cached[k]; ok {
+			this.cache.Remove(el)
+		}
+		this.cached[k] = this.cache.PushFront(&remoteSegment{k, e})
+	}
+
+	for this.cache.Len() > this.cacheSize {
+		el := this.cache.Back()
+		this.cache.Remove(el)
+		delete(this.cached, el.Value.(*remoteSegment).k)
+	}
+
+	return ans, nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Result is the result of an aggregation, with what it cost, so services can log and bill queries without
+// measuring them again
+type Result struct {
+	Bitmap      *Ewah
+	Cardinality int64
+
+	// WordsScanned is the number of words read by the aggregation: the words of the operands, and the ones of
+	// the intermediate results, which are read again with each operand
+	WordsScanned int64
+
+	// Duration is the time the aggregation took, including the cardinality of the result
+	Duration time.Duration
+
+	// OperandWords is the size in words of each operand
+	OperandWords []int64
+}
+
+// AndAllResult returns the intersection of the bitmaps, with its cost. The bitmaps are folded from left to
+// right, and a nil bitmap is an empty one. It stops as soon as the context is done, and returns its error.
+// With no bitmap, the result is an empty bitmap.
+func AndAllResult(ctx context.Context, bms []*Ewah) (*Result, error) {
+	return aggregate(ctx, "AndAllResult", "and", bms, nil, func(ctx context.Context, a, b, container *Ewah) error {
+		return a.andToContainerCtx(ctx, b, container)
+	})
+}
+
+// OrAllResult returns the union of the bitmaps, with its cost, like AndAllResult. It returns
+// ErrResultTooLarge, without doing any work, if the union could exceed the budget set with
+// SetMaxResultWords.
+func OrAllResult(ctx context.Context, bms []*Ewah) (*Result, error) {
+	return aggregate(ctx, "OrAllResult", "or", bms, estimateOrWords, func(ctx context.Context, a, b, container *Ewah) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		a.orToContainer(b, container)
+		return nil
+	})
+}
+
+//
+// Not-exported functions
+//
+
+// aggregate folds the bitmaps with the toContainer function of an operation, measuring what it costs. If
+// estimate is not nil, it bounds the size of the result, which is checked against SetMaxResultWords first.
+// fn is the function reported in the errors, and op the operation of the spans and the metrics.
+func aggregate(ctx context.Context, fn, op string, bms []*Ewah, estimate func(...*Ewah) int64,
+	toContainer func(ctx context.Context, a, b, container *Ewah) error) (*Result, error) {
+
+	start := time.Now()
+
+	operands := make([]*Ewah, len(bms))
+	r := &Result{OperandWords: make([]int64, len(bms))}
+	for k, b := range bms {
+		operands[k] = b.orEmpty()
+		r.OperandWords[k] = operands[k].actualSizeInWords
+	}
+
+	if estimate != nil {
+		if err := checkResultWords(fn, estimate(operands...)); err != nil {
+			return nil, err
+		}
+	}
+
+	end := startOperationAll(ctx, op, operands)
+
+	ans := NewEwah()
+	if len(operands) > 0 {
+		ans = operands[0].Clone().(*Ewah)
+		r.WordsScanned = ans.actualSizeInWords
+	}
+
+	for k := 1; k < len(operands); k++ {
+		b := operands[k]
+
+		tmp := NewWithOptions(ans.Options())
+		tmp.reserve(int32(math.Max(float64(ans.actualSizeInWords), float64(b.actualSizeInWords))))
+
+		if err := toContainer(ctx, ans, b, tmp); err != nil {
+			end(nil, err)
+			return nil, err
+		}
+
+		r.WordsScanned += ans.actualSizeInWords + b.actualSizeInWords
+		ans = tmp
+	}
+
+	recordOperation(op, ans)
+	end(ans, nil)
+
+	r.Bitmap = ans
+	r.Cardinality = ans.Cardinality()
+	r.Duration = time.Since(start)
+
+	return r, nil
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// DefaultSegmentBits is the default number of bits in a segment of the segmented format
+	DefaultSegmentBits int64 = 1 << 24
+
+	segmentedMagic = "EWSG"
+
+	// segmentedHeaderSize is the size of the magic, the segment size, the bitmap size and the segment count
+	segmentedHeaderSize = 4 + 8 + 8 + 4
+)
+
+// MarshalSegmented encodes the bitmap cut into segments of segmentBits bits, each one encoded with
+// MarshalBinary, so the segments can be encoded and decoded in parallel by up to workers goroutines of the
+// default pool (all of them if workers is not positive). segmentBits is rounded up to a multiple of 64.
+// Everything is big endian:
+//
+//	"EWSG" | segmentBits (uint64) | sizeInBits (uint64) | count (uint32) | count x length (uint64) | segments
+func (this *Ewah) MarshalSegmented(segmentBits int64, workers int) ([]byte, error) {
+	end := startCodec("marshalsegmented", this.actualSizeInWords)
+	b, err := this.marshalSegmented(segmentBits, workers)
+	end(this, err)
+
+	return b, err
+}
+
+// marshalSegmented is MarshalSegmented, without the span
+func (this *Ewah) marshalSegmented(segmentBits int64, workers int) ([]byte, error) {
+	if segmentBits < wordInBits {
+		segmentBits = wordInBits
+	}
+	segmentBits = (segmentBits + wordInBits - 1) / wordInBits * wordInBits
+
+	segments := this.split(segmentBits)
+	encoded := make([][]byte, len(segments))
+
+	err := parallelFor(len(segments), workers, func(k int) error {
+		var err error
+		encoded[k], err = segments[k].marshalBinary()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	size := segmentedHeaderSize + 8*len(encoded)
+	for _, v := range encoded {
+		size += len(v)
+	}
+
+	b := make([]byte, segmentedHeaderSize+8*len(encoded), size)
+	copy(b, segmentedMagic)
+	binary.BigEndian.PutUint64(b[4:], uint64(segmentBits))
+	binary.BigEndian.PutUint64(b[12:], uint64(this.sizeInBits))
+	binary.BigEndian.PutUint32(b[20:], uint32(len(encoded)))
+
+	for k, v := range encoded {
+		binary.BigEndian.PutUint64(b[segmentedHeaderSize+8*k:], uint64(len(v)))
+		b = append(b, v...)
+	}
+
+	return b, nil
+}
+
+// UnmarshalSegmented decodes a bitmap encoded by MarshalSegmented, decoding the segments with up to
+// workers goroutines of the default pool (all of them if workers is not positive). It replaces the content
+// of the bitmap.
+func (this *Ewah) UnmarshalSegmented(b []byte, workers int) error {
+	if err := this.checkWritable("UnmarshalSegmented"); err != nil {
+		return err
+	}
+
+	end := startCodec("unmarshalsegmented", int64(len(b)/8))
+	err := this.unmarshalSegmented(b, workers)
+	end(this, err)
+
+	return err
+}
+
+// unmarshalSegmented is UnmarshalSegmented, without the span
+func (this *Ewah) unmarshalSegmented(b []byte, workers int) error {
+	segmentBits, sizeInBits, count, err := readSegmentedHeader(b)
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) < segmentedHeaderSize+8*count {
+		return newError(ErrCorruptData, "ewah/UnmarshalSegmented: invalid sizes")
+	}
+
+	// Find where each segment starts
+	offsets, err := segmentedOffsets(b[segmentedHeaderSize:], count, int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	segments := make([]*Ewah, count)
+	err = parallelFor(int(count), workers, func(k int) error {
+		var err error
+		segments[k], err = decodeSegment(b[offsets[k]:offsets[k+1]], int64(k), segmentBits, sizeInBits)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	ans := NewEwah()
+	for _, s := range segments {
+		s.walkWords(ans.addStreamOfEmptyWords, ans.add)
+	}
+	ans.sizeInBits = sizeInBits
+
+	this.Swap(ans)
+
+	return nil
+}
+
+// WalkWords calls run for each stream of n empty words of value v, and literal for each literal word, in
+// order, without uncompressing the bitmap. The words cover the bitmap up to its last word, which may have
+// bits past the size, always 0. It's meant for converting the bitmap to other formats.
+func (this *Ewah) WalkWords(run func(v bool, n int64), literal func(w uint64)) {
+	this.walkWords(run, literal)
+}
+
+//
+// Not-exported functions
+//
+
+// split cuts the bitmap into segments of segmentBits bits, segmentBits being a multiple of 64. Every
+// segment is full, except the last one.
+func (this *Ewah) split(segmentBits int64) []*Ewah {
+	segmentWords := segmentBits / wordInBits
+
+	var segments []*Ewah
+	current := NewEwah()
+	left := segmentWords
+	words := int64(0)
+
+	next := func() {
+		segments = append(segments, current)
+		current = NewEwah()
+		left = segmentWords
+	}
+
+	run := func(v bool, n int64) {
+		words += n
+		for n > 0 {
+			m := n
+			if m > left {
+				m = left
+			}
+
+			current.addStreamOfEmptyWords(v, m)
+			n -= m
+			if left -= m; left == 0 {
+				next()
+			}
+		}
+	}
+
+	this.walkWords(run, func(w uint64) {
+		words++
+		current.add(w)
+		if left--; left == 0 {
+			next()
+		}
+	})
+
+	// The words may not cover the whole size if the bitmap ends with 0's
+	if n := (this.sizeInBits+wordInBits-1)/wordInBits - words; n > 0 {
+		run(false, n)
+	}
+
+	if left < segmentWords {
+		segments = append(segments, current)
+	}
+
+	// The last word may only be partly used
+	if n := len(segments); n > 0 {
+		segments[n-1].sizeInBits = this.sizeInBits - int64(n-1)*segmentBits
+	}
+
+	return segments
+}
+
+// walkWords calls run for each stream of empty words of the bitmap, and literal for each literal word, in
+// order. The words cover the bitmap up to the last word, which may only be partly used.
+func (this *Ewah) walkWords(run func(v bool, n int64), literal func(w uint64)) {
+	for pos := int64(0); pos < this.actualSizeInWords; {
+		rlw := this.buffer[pos]
+		runlen := int64((rlw >> 1) & LargestRunningLengthCount)
+		literals := int64(rlw >> uint32(1+RunningLengthBits))
+
+		if runlen > 0 {
+			run(rlw&1 != 0, runlen)
+		}
+
+		for _, w := range this.buffer[pos+1 : pos+1+literals] {
+			literal(w)
+		}
+
+		pos += 1 + literals
+	}
+}
+
+// readSegmentedHeader returns the segment size, the bitmap size and the segment count of the header of a
+// segmented bitmap
+func readSegmentedHeader(b []byte) (int64, int64, int64, error) {
+	if len(b) < segmentedHeaderSize || string(b[:4]) != segmentedMagic {
+		return 0, 0, 0, newError(ErrCorruptData, "ewah/UnmarshalSegmented: not a segmented bitmap")
+	}
+
+	segmentBits := int64(binary.BigEndian.Uint64(b[4:]))
+	sizeInBits := int64(binary.BigEndian.Uint64(b[12:]))
+	count := int64(binary.BigEndian.Uint32(b[20:]))
+
+	if segmentBits < wordInBits || segmentBits%wordInBits != 0 || sizeInBits < 0 ||
+		count != (sizeInBits+segmentBits-1)/segmentBits {
+		return 0, 0, 0, newError(ErrCorruptData, "ewah/UnmarshalSegmented: invalid sizes")
+	}
+
+	return segmentBits, sizeInBits, count, nil
+}
+
+// segmentedOffsets returns where each segment starts, and where the last one ends, from the table of the
+// lengths of the count segments. total is the length of the encoded bitmap, or -1 if it's not known.
+func segmentedOffsets(table []byte, count, total int64) ([]int64, error) {
+	offsets := make([]int64, count+1)
+	offsets[0] = segmentedHeaderSize + 8*count
+	for k := int64(0); k < count; k++ {
+		length := binary.BigEndian.Uint64(table[8*k:])
+		if length > uint64(math.MaxInt64-offsets[k]) || (total >= 0 && offsets[k]+int64(length) > total) {
+			return nil, newError(ErrCorruptData, "ewah/UnmarshalSegmented: invalid segment length")
+		}
+		offsets[k+1] = offsets[k] + int64(length)
+	}
+
+	return offsets, nil
+}
+
+// decodeSegment decodes segment k of a segmented bitmap, and checks its size
+func decodeSegment(b []byte, k, segmentBits, sizeInBits int64) (*Ewah, error) {
+	e := NewEwah()
+	if err := e.unmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	// Every segment but the last one is full, so they can be put back together word by word
+	expected := segmentBits
+	if k == (sizeInBits+segmentBits-1)/segmentBits-1 {
+		expected = sizeInBits - k*segmentBits
+	}
+	if e.sizeInBits != expected {
+		return nil, newError(ErrCorruptData, "ewah/UnmarshalSegmented: invalid segment size")
+	}
+
+	return e, nil
+}
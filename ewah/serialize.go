@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// deserializeChunkWords is the number of words DeserializeLimited reads at once
+const deserializeChunkWords = 4096
+
+// castagnoli is the table of CRC32C, the checksum of Options.Checksum
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var _ io.WriterTo = (*Ewah)(nil)
+var _ io.ReaderFrom = (*Ewah)(nil)
+
+// MarshalBinary encodes the bitmap in the same format as JavaEWAH's serialize(): the size in bits, the number
+// of words and the position of the last running length word are 32-bit integers, and everything is big endian.
+//
+//	sizeInBits (int32) | sizeInWords (int32) | words (sizeInWords x uint64) | rlw position (int32)
+func (this *Ewah) MarshalBinary() ([]byte, error) {
+	this = this.orEmpty()
+
+	end := startCodec("marshal", this.actualSizeInWords)
+	b, err := this.marshalBinary()
+	end(this, err)
+
+	if err == nil && this.checksum {
+		b = appendChecksum(b)
+	}
+
+	return b, err
+}
+
+// WriteTo writes the bitmap to w, encoded like MarshalBinary, and returns the number of bytes written
+func (this *Ewah) WriteTo(w io.Writer) (int64, error) {
+	b, err := this.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadFrom replaces the content of the bitmap with a bitmap read from r, encoded like MarshalBinary, and
+// returns the number of bytes read. It reads no more than the bitmap, so several bitmaps can follow each
+// other in r. Like the decoders, it only allocates memory as the words are read, whatever the header says.
+// A stream that ends before the bitmap does returns an error matching ErrCorruptData.
+func (this *Ewah) ReadFrom(r io.Reader) (int64, error) {
+	if err := this.checkWritable("ReadFrom"); err != nil {
+		return 0, err
+	}
+
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, r, 8)
+	if err == nil {
+		sizeInWords := int64(int32(binary.BigEndian.Uint32(b.Bytes()[4:])))
+		if sizeInWords < 1 {
+			return n, newError(ErrCorruptData, "ewah/ReadFrom: invalid sizes")
+		}
+
+		trailer := int64(4)
+		if this.checksum {
+			trailer += 4
+		}
+
+		var m int64
+		m, err = io.CopyN(&b, r, 8*sizeInWords+trailer)
+		n += m
+	}
+	if errors.Is(err, io.EOF) {
+		return n, newError(ErrCorruptData, "ewah/ReadFrom: the stream ends before the bitmap")
+	}
+	if err != nil {
+		return n, err
+	}
+
+	return n, this.UnmarshalBinary(b.Bytes())
+}
+
+// marshalBinary is MarshalBinary, without the span
+func (this *Ewah) marshalBinary() ([]byte, error) {
+	if this.sizeInBits > math.MaxInt32 || this.actualSizeInWords > math.MaxInt32 {
+		return nil, newError(ErrOutOfRange, "ewah/MarshalBinary: bitmap is too large to be serialized")
+	}
+
+	b := make([]byte, 4+4+8*this.actualSizeInWords+4)
+
+	binary.BigEndian.PutUint32(b, uint32(this.sizeInBits))
+	binary.BigEndian.PutUint32(b[4:], uint32(this.actualSizeInWords))
+
+	for i, v := range this.buffer[:this.actualSizeInWords] {
+		binary.BigEndian.PutUint64(b[8+8*i:], v)
+	}
+
+	binary.BigEndian.PutUint32(b[8+8*this.actualSizeInWords:], uint32(this.setCursor.marker))
+
+	return b, nil
+}
+
+// DeserializeLimited reads a bitmap encoded like MarshalBinary from r, and nothing past it, for input that
+// can't be trusted. A bitmap of more than maxWords words returns an error matching ErrInputTooLarge before
+// any word is read. The words are read in chunks, and the marker words checked as they come, so invalid
+// input returns an error matching ErrCorruptData as soon as it's found, having allocated no more memory than
+// what it sent. It doesn't read checksums, see DeserializeLimitedWithOptions.
+func DeserializeLimited(r io.Reader, maxWords int64) (*Ewah, error) {
+	return DeserializeLimitedWithOptions(r, maxWords, Options{})
+}
+
+// DeserializeLimitedWithOptions is DeserializeLimited, returning a bitmap with the options. With
+// Options.Checksum, the bitmap must be followed by its checksum, which is read and checked like ReadFrom
+// does: a missing or different one returns an error matching ErrChecksumMismatch.
+func DeserializeLimitedWithOptions(r io.Reader, maxWords int64, opts Options) (*Ewah, error) {
+	// The checksum covers everything read before it
+	sum := crc32.New(castagnoli)
+	content := r
+	if opts.Checksum {
+		content = io.TeeReader(r, sum)
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(content, header[:]); err != nil {
+		return nil, limitedReadError(err)
+	}
+
+	sizeInBits := int64(int32(binary.BigEndian.Uint32(header[:])))
+	sizeInWords := int64(int32(binary.BigEndian.Uint32(header[4:])))
+
+	if sizeInBits < 0 || sizeInWords < 1 {
+		return nil, newError(ErrCorruptData, "ewah/DeserializeLimited: invalid sizes")
+	}
+	if sizeInWords > maxWords {
+		return nil, newError(ErrInputTooLarge, fmt.Sprintf("ewah/DeserializeLimited: the bitmap has %d words, more than the limit of %d", sizeInWords, maxWords))
+	}
+
+	chunkWords := int64(deserializeChunkWords)
+	if sizeInWords < chunkWords {
+		chunkWords = sizeInWords
+	}
+	chunk := make([]byte, 8*chunkWords)
+
+	// next is the position of the next marker word, and last the one of the last marker word found
+	var buffer []uint64
+	next, last := int64(0), int64(0)
+	for int64(len(buffer)) < sizeInWords {
+		n := sizeInWords - int64(len(buffer))
+		if n > chunkWords {
+			n = chunkWords
+		}
+
+		if _, err := io.ReadFull(content, chunk[:8*n]); err != nil {
+			return nil, limitedReadError(err)
+		}
+		for i := int64(0); i < n; i++ {
+			buffer = append(buffer, binary.BigEndian.Uint64(chunk[8*i:]))
+		}
+
+		for next < int64(len(buffer)) {
+			literals := int64(buffer[next] >> uint32(1+RunningLengthBits))
+			if next+1+literals > sizeInWords {
+				return nil, newError(ErrCorruptData, fmt.Sprintf("ewah/DeserializeLimited: marker word at %d has %d literal words, past the %d words used", next, literals, sizeInWords))
+			}
+
+			last = next
+			next += 1 + literals
+		}
+	}
+
+	var trailer [4]byte
+	if _, err := io.ReadFull(content, trailer[:]); err != nil {
+		return nil, limitedReadError(err)
+	}
+	if rlw := int64(int32(binary.BigEndian.Uint32(trailer[:]))); rlw != last {
+		return nil, newError(ErrCorruptData, fmt.Sprintf("ewah/DeserializeLimited: the last marker word is at %d, not at %d", last, rlw))
+	}
+
+	if opts.Checksum {
+		if _, err := io.ReadFull(r, trailer[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, newError(ErrChecksumMismatch, "ewah/DeserializeLimited: the bitmap has no checksum")
+			}
+			return nil, limitedReadError(err)
+		}
+		if binary.BigEndian.Uint32(trailer[:]) != sum.Sum32() {
+			return nil, newError(ErrChecksumMismatch, "ewah/DeserializeLimited: the checksum doesn't match the bitmap")
+		}
+	}
+
+	e := NewWithOptions(opts)
+	e.load(buffer, sizeInWords, sizeInBits, last, false)
+
+	return e, nil
+}
+
+// UnmarshalBinary decodes a bitmap encoded by MarshalBinary, or by JavaEWAH's serialize(). It replaces the
+// content of the bitmap. An encoding ending with a checksum, see Options.Checksum, must match it.
+func (this *Ewah) UnmarshalBinary(b []byte) error {
+	if err := this.checkWritable("UnmarshalBinary"); err != nil {
+		return err
+	}
+
+	b, err := stripChecksum(b, this.checksum)
+	if err != nil {
+		return err
+	}
+
+	end := startCodec("unmarshal", int64(len(b)/8))
+	err = this.unmarshalBinary(b)
+	end(this, err)
+
+	return err
+}
+
+// unmarshalBinary is UnmarshalBinary, without the span
+func (this *Ewah) unmarshalBinary(b []byte) error {
+	if len(b) < 8 {
+		return newError(ErrCorruptData, "ewah/UnmarshalBinary: buffer is too short")
+	}
+
+	sizeInBits := int64(int32(binary.BigEndian.Uint32(b)))
+	sizeInWords := int64(int32(binary.BigEndian.Uint32(b[4:])))
+
+	if sizeInBits < 0 || sizeInWords < 1 || int64(len(b)) != 4+4+8*sizeInWords+4 {
+		return newError(ErrCorruptData, "ewah/UnmarshalBinary: invalid sizes")
+	}
+
+	rlw := int64(int32(binary.BigEndian.Uint32(b[8+8*sizeInWords:])))
+	if rlw < 0 || rlw >= sizeInWords {
+		return newError(ErrCorruptData, "ewah/UnmarshalBinary: invalid running length word position")
+	}
+
+	buffer := make([]uint64, sizeInWords)
+	for i := range buffer {
+		buffer[i] = binary.BigEndian.Uint64(b[8+8*i:])
+	}
+
+	if err := checkMarkers(buffer, sizeInWords, rlw); err != nil {
+		return newError(ErrCorruptData, "ewah/UnmarshalBinary: "+err.Error())
+	}
+
+	this.load(buffer, sizeInWords, sizeInBits, rlw, false)
+
+	return nil
+}
+
+// appendChecksum appends the checksum of b to b
+func appendChecksum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, crc32.Checksum(b, castagnoli))
+}
+
+// stripChecksum checks the checksum ending b, an encoding of MarshalBinary, if its length says it has one,
+// and returns b without it. required fails on encodings that have the length of one without a checksum.
+// Other lengths are left to the decoder.
+func stripChecksum(b []byte, required bool) ([]byte, error) {
+	if len(b) < 8 {
+		return b, nil
+	}
+
+	n := 4 + 4 + 8*int64(int32(binary.BigEndian.Uint32(b[4:]))) + 4
+	switch {
+	case int64(len(b)) == n+4:
+		if binary.BigEndian.Uint32(b[n:]) != crc32.Checksum(b[:n], castagnoli) {
+			return nil, newError(ErrChecksumMismatch, "ewah/UnmarshalBinary: the checksum doesn't match the bitmap")
+		}
+		return b[:n], nil
+	case int64(len(b)) == n && required:
+		return nil, newError(ErrChecksumMismatch, "ewah/UnmarshalBinary: the bitmap has no checksum")
+	}
+
+	return b, nil
+}
+
+// limitedReadError returns the error of DeserializeLimited for an error of the reader
+func limitedReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return newError(ErrCorruptData, "ewah/DeserializeLimited: the stream ends before the bitmap")
+	}
+
+	return err
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"sync"
+)
+
+// Sharded is a bitmap split into shards by position range, each one with its own lock, so it can be used by
+// several goroutines at once. Writes to different shards proceed concurrently, and reads only wait for
+// writes to the same shard. Within a shard, bits must be set in ascending order.
+type Sharded struct {
+	shardBits int64
+	shards    []*shard
+}
+
+type shard struct {
+	mu sync.RWMutex
+
+	// e holds the bits of the shard, relative to the first position of the shard
+	e *Ewah
+}
+
+// NewSharded returns an empty bitmap of n shards of shardBits bits each, rounded up to a multiple of 64.
+// It covers the positions from 0 to n * shardBits - 1.
+func NewSharded(shardBits int64, n int) *Sharded {
+	if shardBits < wordInBits {
+		shardBits = wordInBits
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	this := &Sharded{
+		shardBits: (shardBits + wordInBits - 1) / wordInBits * wordInBits,
+		shards:    make([]*shard, n),
+	}
+
+	for k := range this.shards {
+		this.shards[k] = &shard{e: NewEwah()}
+	}
+
+	return this
+}
+
+// Set sets the bit at position i to true (1). It returns nil if i is out of range, or not after the last bit
+// set in its shard.
+func (this *Sharded) Set(i int64) *Sharded {
+	if i < 0 || i >= this.shardBits*int64(len(this.shards)) {
+		return nil
+	}
+
+	s := this.shards[i/this.shardBits]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.e.Set(i%this.shardBits) == nil {
+		return nil
+	}
+
+	return this
+}
+
+func (this *Sharded) Get(i int64) bool {
+	if i < 0 || i >= this.shardBits*int64(len(this.shards)) {
+		return false
+	}
+
+	s := this.shards[i/this.shardBits]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Get moves the cursor of the bitmap, which readers sharing the lock can't do
+	return s.e.lookup(i % this.shardBits)
+}
+
+// Size returns the size in bits of the *uncompressed* bitmap, up to the last bit set
+func (this *Sharded) Size() int64 {
+	for k := len(this.shards) - 1; k >= 0; k-- {
+		s := this.shards[k]
+
+		s.mu.RLock()
+		size := s.e.sizeInBits
+		s.mu.RUnlock()
+
+		if size > 0 {
+			return int64(k)*this.shardBits + size
+		}
+	}
+
+	return 0
+}
+
+func (this *Sharded) Cardinality() int64 {
+	n := int64(0)
+
+	for _, s := range this.shards {
+		s.mu.RLock()
+		n += s.e.Cardinality()
+		s.mu.RUnlock()
+	}
+
+	return n
+}
+
+// Bitmap returns all the shards put together as a single bitmap. Each shard is locked in turn, so bits set
+// meanwhile may or may not be in the result.
+func (this *Sharded) Bitmap() *Ewah {
+	ans := NewEwah()
+	shardWords := this.shardBits / wordInBits
+	size := int64(0)
+
+	for k, s := range this.shards {
+		s.mu.RLock()
+
+		if s.e.sizeInBits > 0 {
+			// Pad with 0's up to the start of the shard, then copy its words
+			ans.addStreamOfEmptyWords(false, int64(k)*shardWords-ans.sizeInBits/wordInBits)
+			s.e.walkWords(ans.addStreamOfEmptyWords, ans.add)
+			size = int64(k)*this.shardBits + s.e.sizeInBits
+		}
+
+		s.mu.RUnlock()
+	}
+
+	ans.sizeInBits = size
+
+	return ans
+}
+
+//
+// Not-exported functions
+//
+
+// lookup is Get without the cursor: it walks the marker words from the start, and doesn't modify the bitmap
+func (this *Ewah) lookup(i int64) bool {
+	if i < 0 || i >= this.sizeInBits {
+		return false
+	}
+
+	w := i / wordInBits
+	for pos, start := int64(0), int64(0); pos < this.actualSizeInWords; {
+		rlw := this.buffer[pos]
+		runlen := int64((rlw >> 1) & LargestRunningLengthCount)
+		literals := int64(rlw >> uint32(1+RunningLengthBits))
+
+		if w < start+runlen {
+			return rlw&1 != 0
+		}
+
+		if w < start+runlen+literals {
+			return this.buffer[pos+1+w-start-runlen]&(uint64(1)<<uint64(i%wordInBits)) != 0
+		}
+
+		start += runlen + literals
+		pos += 1 + literals
+	}
+
+	return false
+}
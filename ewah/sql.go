@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+var _ sql.Scanner = (*Ewah)(nil)
+var _ driver.Valuer = (*Ewah)(nil)
+
+// Scan replaces the content of the bitmap with the bitmap of a value read from a database, which must be
+// bytes or a string encoded with MarshalBinary. NULL returns an error; NullEwah scans nullable columns.
+func (this *Ewah) Scan(value interface{}) error {
+	if err := this.checkWritable("Scan"); err != nil {
+		return err
+	}
+
+	b, err := scanBytes("ewah/Scan", value)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return fmt.Errorf("ewah/Scan: cannot scan NULL, use NullEwah")
+	}
+
+	return this.UnmarshalBinary(b)
+}
+
+// Value returns the bitmap encoded with MarshalBinary, to write it to a BLOB column. A nil bitmap is NULL.
+func (this *Ewah) Value() (driver.Value, error) {
+	if this == nil {
+		return nil, nil
+	}
+
+	return this.MarshalBinary()
+}
+
+// NullEwah is a bitmap that may be NULL, like sql.NullString is a string that may be NULL. It implements
+// sql.Scanner and driver.Valuer, so a nullable BLOB column holding bitmaps encoded with MarshalBinary can
+// be read and written directly, and NULL stays distinct from an empty bitmap.
+type NullEwah struct {
+	Ewah  *Ewah
+	Valid bool
+}
+
+var _ driver.Valuer = NullEwah{}
+
+// Scan decodes the bitmap from a value read from a database, which must be NULL, or bytes or a string
+// encoded with MarshalBinary
+func (this *NullEwah) Scan(value interface{}) error {
+	b, err := scanBytes("ewah/NullEwah.Scan", value)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		this.Ewah, this.Valid = nil, false
+		return nil
+	}
+
+	// UnmarshalBinary copies the words, so the driver can reuse b
+	e := NewEwah()
+	if err := e.UnmarshalBinary(b); err != nil {
+		return err
+	}
+
+	this.Ewah, this.Valid = e, true
+
+	return nil
+}
+
+// Value returns the bitmap encoded with MarshalBinary, or nil for NULL if it's not valid. A valid NullEwah
+// without bitmap is an empty bitmap.
+func (this NullEwah) Value() (driver.Value, error) {
+	if !this.Valid {
+		return nil, nil
+	}
+
+	if this.Ewah == nil {
+		return NewEwah().MarshalBinary()
+	}
+
+	return this.Ewah.MarshalBinary()
+}
+
+//
+// Not-exported functions
+//
+
+// scanBytes returns the bytes of a value read from a database, or nil for NULL
+func scanBytes(fn string, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+
+	return nil, fmt.Errorf("%s: cannot scan a %T", fn, value)
+}
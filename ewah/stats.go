@@ -0,0 +1,355 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Stats describes how a bitmap is compressed, for monitoring
+type Stats struct {
+	// MarkerWords is the number of marker words in the buffer, and LiteralWords the number of literal words
+	MarkerWords  int64
+	LiteralWords int64
+
+	// RunWords is the number of uncompressed words covered by runs of 0's or 1's, and LongestRun the number
+	// of words of the longest one
+	RunWords   int64
+	LongestRun int64
+
+	// CompressionRatio is the size of the bitmap divided by the size of the same bitmap uncompressed, so the
+	// lower the better. It's 0 for an empty bitmap.
+	CompressionRatio float64
+
+	// BufferUtilization is the part of the allocated buffer in use
+	BufferUtilization float64
+}
+
+// RunHistogram is the distribution of the lengths of the runs of 1's and 0's of a bitmap, in bits. Ones[k]
+// is the number of runs of 1's of 2^k to 2^(k+1)-1 bits, and Zeros[k] the same for runs of 0's.
+type RunHistogram struct {
+	Ones  []int64
+	Zeros []int64
+}
+
+// GapStats describes the distances between consecutive bits set to 1. Small gaps compress into runs, while
+// gaps of a few dozen bits leave a literal word for almost every bit set.
+type GapStats struct {
+	// Count is the number of gaps, one less than the cardinality
+	Count int64
+
+	Min, Max int64
+	Mean     float64
+
+	// P50, P90 and P99 are the percentiles: half of the gaps are at most P50 bits, and so on
+	P50, P90, P99 int64
+}
+
+// Stats returns the statistics of the bitmap. It only reads the bitmap.
+func (this *Ewah) Stats() Stats {
+	var s Stats
+
+	run, value := int64(0), false
+	this.walkWords(func(v bool, n int64) {
+		// Runs of the same value can follow each other, when the marker between them has no literal word
+		if run > 0 && v == value {
+			run += n
+		} else {
+			run, value = n, v
+		}
+
+		if run > s.LongestRun {
+			s.LongestRun = run
+		}
+
+		s.RunWords += n
+	}, func(w uint64) {
+		run = 0
+		s.LiteralWords++
+	})
+
+	s.MarkerWords = this.actualSizeInWords - s.LiteralWords
+
+	if words := (this.sizeInBits + wordInBits - 1) / wordInBits; words > 0 {
+		s.CompressionRatio = float64(this.actualSizeInWords) / float64(words)
+	}
+
+	if len(this.buffer) > 0 {
+		s.BufferUtilization = float64(this.actualSizeInWords) / float64(len(this.buffer))
+	}
+
+	return s
+}
+
+// RunHistogram returns the distribution of the lengths of the runs of the bitmap, up to its size. Many long
+// runs mean EWAH compresses the bitmap well, while mostly short runs mean it's closer to a plain bitset.
+func (this *Ewah) RunHistogram() RunHistogram {
+	var h RunHistogram
+
+	pos, start, value := int64(0), int64(0), false
+	addBits := func(v bool, n int64) {
+		if n > this.sizeInBits-pos {
+			n = this.sizeInBits - pos
+		}
+		if n <= 0 {
+			return
+		}
+
+		if v != value {
+			h.add(value, pos-start)
+			start, value = pos, v
+		}
+		pos += n
+	}
+
+	this.walkWords(func(v bool, n int64) {
+		addBits(v, n*wordInBits)
+	}, func(w uint64) {
+		for k := 0; k < int(wordInBits); {
+			var n int
+			if w&1 != 0 {
+				n = bits.TrailingZeros64(^w)
+			} else {
+				n = bits.TrailingZeros64(w)
+			}
+			if n > int(wordInBits)-k {
+				n = int(wordInBits) - k
+			}
+
+			addBits(w&1 != 0, int64(n))
+			w >>= uint(n)
+			k += n
+		}
+	})
+
+	h.add(value, pos-start)
+
+	return h
+}
+
+// DensityProfile returns the fraction of bits set in each chunk of chunkBits bits, from the start of the
+// bitmap up to its size. The last chunk may be shorter. It returns nil if chunkBits is not positive.
+func (this *Ewah) DensityProfile(chunkBits int64) []float64 {
+	if chunkBits < 1 {
+		return nil
+	}
+
+	counts := this.chunkCounts(chunkBits)
+	profile := make([]float64, len(counts))
+	for k, n := range counts {
+		size := chunkBits
+		if k == len(counts)-1 {
+			size = this.sizeInBits - int64(k)*chunkBits
+		}
+
+		profile[k] = float64(n) / float64(size)
+	}
+
+	return profile
+}
+
+// Region is a window of a bitmap, and the number of bits set in it
+type Region struct {
+	Start int64
+	Count int64
+}
+
+// DenseRegions returns the k windows of windowBits bits with the most bits set, the densest first. The
+// windows are aligned on multiples of windowBits, and those without any bit set are never returned. It
+// returns nil if k or windowBits is not positive.
+func (this *Ewah) DenseRegions(k int, windowBits int64) []Region {
+	if k < 1 || windowBits < 1 {
+		return nil
+	}
+
+	var regions []Region
+	for w, n := range this.chunkCounts(windowBits) {
+		if n > 0 {
+			regions = append(regions, Region{Start: int64(w) * windowBits, Count: n})
+		}
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].Count > regions[j].Count })
+
+	if len(regions) > k {
+		regions = regions[:k]
+	}
+
+	return regions
+}
+
+// GapStats returns the statistics of the distances between consecutive bits set. They're all 0 if there's
+// less than two bits set.
+func (this *Ewah) GapStats() GapStats {
+	var g GapStats
+
+	// counts[d] is the number of gaps of d bits. Runs of 1's add all their gaps of 1 at once.
+	counts := make(map[int64]int64)
+	last := int64(-1)
+	add := func(i, n int64) {
+		if n > this.sizeInBits-i {
+			n = this.sizeInBits - i
+		}
+		if n <= 0 {
+			return
+		}
+
+		if last >= 0 {
+			counts[i-last]++
+		}
+		if n > 1 {
+			counts[1] += n - 1
+		}
+		last = i + n - 1
+	}
+
+	pos := int64(0)
+	this.walkWords(func(v bool, n int64) {
+		if v {
+			add(pos, n*wordInBits)
+		}
+		pos += n * wordInBits
+	}, func(w uint64) {
+		for ; w != 0; w &= w - 1 {
+			add(pos+int64(bits.TrailingZeros64(w)), 1)
+		}
+		pos += wordInBits
+	})
+
+	if len(counts) == 0 {
+		return g
+	}
+
+	gaps := make([]int64, 0, len(counts))
+	sum := 0.0
+	for d, n := range counts {
+		gaps = append(gaps, d)
+		g.Count += n
+		sum += float64(d) * float64(n)
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+
+	g.Min, g.Max = gaps[0], gaps[len(gaps)-1]
+	g.Mean = sum / float64(g.Count)
+
+	// Each percentile is the smallest gap with at least that part of the gaps at or below it
+	percentiles := []*int64{&g.P50, &g.P90, &g.P99}
+	ranks := []float64{0.5, 0.9, 0.99}
+	seen := int64(0)
+	for _, d := range gaps {
+		seen += counts[d]
+		for len(ranks) > 0 && seen >= int64(math.Ceil(ranks[0]*float64(g.Count))) {
+			*percentiles[0] = d
+			percentiles, ranks = percentiles[1:], ranks[1:]
+		}
+	}
+
+	return g
+}
+
+// EstimateCompressedSize returns the number of bytes MarshalBinary needs for the bitmap once it's in its
+// canonical form, with each run in a single marker word and no literal word that could be part of a run.
+// It's computed from the runs and literal words, without encoding anything.
+func (this *Ewah) EstimateCompressedSize() int64 {
+	markers, literals := int64(0), int64(0)
+
+	// open is the number of literal words the current marker can still take, or -1 if there's none
+	open := int64(-1)
+	this.walkCanonical(func(v bool, n int64) {
+		markers += (n + int64(LargestRunningLengthCount) - 1) / int64(LargestRunningLengthCount)
+		open = int64(LargestLiteralCount)
+	}, func(w uint64) {
+		if open <= 0 {
+			markers++
+			open = int64(LargestLiteralCount)
+		}
+		open--
+		literals++
+	})
+
+	// There's always at least one marker word
+	if markers == 0 {
+		markers = 1
+	}
+
+	return 4 + 4 + 8*(markers+literals) + 4
+}
+
+// Entropy returns the number of bits an encoding of the bitmap would need at least, if each bit had the
+// same probability of being set, independently of the others: size * H(cardinality / size). Bitmaps with
+// long runs compress much better than that, while EWAH does worse on bits scattered at random.
+func (this *Ewah) Entropy() float64 {
+	if this.sizeInBits == 0 {
+		return 0
+	}
+
+	p := float64(this.Cardinality()) / float64(this.sizeInBits)
+	if p == 0 || p == 1 {
+		return 0
+	}
+
+	return float64(this.sizeInBits) * -(p*math.Log2(p) + (1-p)*math.Log2(1-p))
+}
+
+//
+// Not-exported functions
+//
+
+// add counts a run of n bits of value v
+func (this *RunHistogram) add(v bool, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	counts := &this.Zeros
+	if v {
+		counts = &this.Ones
+	}
+
+	k := 63 - bits.LeadingZeros64(uint64(n))
+	for len(*counts) <= k {
+		*counts = append(*counts, 0)
+	}
+	(*counts)[k]++
+}
+
+// chunkCounts returns the number of bits set in each chunk of chunkBits bits, up to the size of the bitmap
+func (this *Ewah) chunkCounts(chunkBits int64) []int64 {
+	counts := make([]int64, (this.sizeInBits+chunkBits-1)/chunkBits)
+
+	pos := int64(0)
+	this.walkWords(func(v bool, n int64) {
+		end := pos + n*wordInBits
+		if end > this.sizeInBits {
+			end = this.sizeInBits
+		}
+
+		// Spread the run over the chunks it covers
+		for i := pos; v && i < end; {
+			next := (i/chunkBits + 1) * chunkBits
+			if next > end {
+				next = end
+			}
+			counts[i/chunkBits] += next - i
+			i = next
+		}
+
+		pos += n * wordInBits
+	}, func(w uint64) {
+		for ; w != 0; w &= w - 1 {
+			if i := pos + int64(bits.TrailingZeros64(w)); i < this.sizeInBits {
+				counts[i/chunkBits]++
+			}
+		}
+
+		pos += wordInBits
+	})
+
+	return counts
+}
@@ -0,0 +1,26 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+// SetTrace makes the bitmap report its structural changes to f: runs extended or started, literal words
+// added, and the buffer grown or copied from a snapshot. f has the signature of log.Printf and
+// testing.T.Logf, so either can be used. The trace is for debugging the encoding, and slows down building
+// the bitmap a lot. It belongs to the bitmap, and isn't passed on to clones or to the results of the
+// operations. A nil f turns it off.
+func (this *Ewah) SetTrace(f func(format string, args ...interface{})) {
+	this.trace = f
+}
+
+//
+// Not-exported functions
+//
+
+// tracef reports a change to the trace of the bitmap. Callers check there's a trace first, so the arguments
+// aren't built for nothing when adding words.
+func (this *Ewah) tracef(format string, args ...interface{}) {
+	this.trace("ewah: "+format, args...)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"context"
+	"github.com/reducedb/bitmap"
+	"sync/atomic"
+)
+
+// Tracer starts a span, in the sense of distributed tracing, around each aggregation and each encoding or
+// decoding of a bitmap, so they show up in the traces of the requests they're part of. The ewahotel
+// package implements it with OpenTelemetry. Unlike SetTrace, which logs the changes to a single bitmap,
+// the tracer is set for the whole package. Its methods must be safe for concurrent use.
+type Tracer interface {
+	// Start is called before an operation, with the context of the call, or context.Background() if the
+	// function has none, the name of the operation and the size in words of each operand. For decoding,
+	// the operand is the encoded bitmap. It returns the function called once the operation is done, with
+	// the cardinality of the result, or the error if it failed.
+	//
+	// The operations are "and", "andnot", "or", "xor", "parallelor", "marshal", "unmarshal", "marshalcpp",
+	// "unmarshalcpp", "marshalsegmented" and "unmarshalsegmented".
+	Start(ctx context.Context, op string, operandWords []int64) (end func(resultCardinality int64, err error))
+}
+
+// tracerHolder wraps the tracer, since an atomic.Value must always hold the same type
+type tracerHolder struct {
+	t Tracer
+}
+
+var tracer atomic.Value
+
+// SetTracer sets the tracer of the package. Use nil to stop tracing, which is the default. Without a
+// tracer, the operations only check there's none, and the cardinality of the results is never computed.
+func SetTracer(t Tracer) {
+	tracer.Store(tracerHolder{t})
+}
+
+//
+// Not-exported functions
+//
+
+func init() {
+	tracer.Store(tracerHolder{})
+}
+
+func currentTracer() Tracer {
+	return tracer.Load().(tracerHolder).t
+}
+
+// endSpan is returned by the start functions when there's no tracer
+func endSpan(ans *Ewah, err error) {}
+
+// startOperation starts a span for an operation of this with the operands. Operands that are not *Ewah
+// count as 0 words, since they're only converted once the span is started.
+func (this *Ewah) startOperation(ctx context.Context, op string, a []bitmap.Bitmap) func(ans *Ewah, err error) {
+	t := currentTracer()
+	if t == nil {
+		return endSpan
+	}
+
+	words := make([]int64, 1, len(a)+1)
+	words[0] = this.actualSizeInWords
+	for _, v := range a {
+		n := int64(0)
+		if b, ok := v.(*Ewah); ok {
+			n = b.actualSizeInWords
+		}
+		words = append(words, n)
+	}
+
+	return spanEnd(t.Start(ctx, op, words))
+}
+
+// startOperationAll starts a span for an operation on all the bitmaps
+func startOperationAll(ctx context.Context, op string, bms []*Ewah) func(ans *Ewah, err error) {
+	t := currentTracer()
+	if t == nil {
+		return endSpan
+	}
+
+	words := make([]int64, len(bms))
+	for k, b := range bms {
+		words[k] = b.actualSizeInWords
+	}
+
+	return spanEnd(t.Start(ctx, op, words))
+}
+
+// startCodec starts a span for the encoding or the decoding of a bitmap of the given number of words
+func startCodec(op string, words int64) func(ans *Ewah, err error) {
+	t := currentTracer()
+	if t == nil {
+		return endSpan
+	}
+
+	return spanEnd(t.Start(context.Background(), op, []int64{words}))
+}
+
+// spanEnd adapts the end function of a span to take the result of the operation
+func spanEnd(end func(int64, error)) func(ans *Ewah, err error) {
+	return func(ans *Ewah, err error) {
+		if err != nil || ans == nil {
+			end(-1, err)
+			return
+		}
+
+		end(ans.Cardinality(), nil)
+	}
+}
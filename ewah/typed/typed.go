@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package typed wraps the EWAH bitmaps with the type of their positions, like uint32 document IDs, so
+// callers don't convert them to and from int64, and unsigned positions can't be negative:
+//
+//	docs := typed.New[uint32]()
+//	docs.Set(42)
+//	docs.Range(func(id uint32) bool { ...; return true })
+package typed
+
+import (
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"math"
+)
+
+// Position is the type of the positions of a bitmap. All the positions a bitmap can hold fit in each of
+// them.
+type Position interface {
+	~int | ~int32 | ~int64 | ~uint | ~uint32 | ~uint64
+}
+
+// Bitmap is an EWAH bitmap with positions of type T
+type Bitmap[T Position] struct {
+	e *ewah.Ewah
+}
+
+// New returns an empty bitmap
+func New[T Position]() *Bitmap[T] {
+	return &Bitmap[T]{ewah.NewEwah()}
+}
+
+// Of returns e as a bitmap with positions of type T. They share the same words.
+func Of[T Position](e *ewah.Ewah) *Bitmap[T] {
+	return &Bitmap[T]{e}
+}
+
+// Ewah returns the underlying bitmap
+func (this *Bitmap[T]) Ewah() *ewah.Ewah {
+	return this.e
+}
+
+// Set sets the bit at position i, which must be after the last bit set. Positions the bitmap can't hold
+// return an error matching ewah.ErrOutOfRange.
+func (this *Bitmap[T]) Set(i T) error {
+	p, err := position(i)
+	if err != nil {
+		return err
+	}
+
+	return this.e.SetChecked(p)
+}
+
+// Get returns true if the bit at position i is set
+func (this *Bitmap[T]) Get(i T) bool {
+	p, err := position(i)
+	return err == nil && this.e.Get(p)
+}
+
+// Size returns the position of the last bit set + 1
+func (this *Bitmap[T]) Size() T {
+	return T(this.e.Size())
+}
+
+func (this *Bitmap[T]) Cardinality() int64 {
+	return this.e.Cardinality()
+}
+
+// Range calls f with the positions of the bits set, in ascending order, until f returns false
+func (this *Bitmap[T]) Range(f func(i T) bool) {
+	for it := this.e.Iterator(); it.HasNext(); {
+		if !f(T(it.Next())) {
+			return
+		}
+	}
+}
+
+// Positions returns the positions of the bits set, in ascending order
+func (this *Bitmap[T]) Positions() []T {
+	ans := make([]T, 0, this.e.Cardinality())
+	this.Range(func(i T) bool {
+		ans = append(ans, i)
+		return true
+	})
+
+	return ans
+}
+
+func (this *Bitmap[T]) And(a ...*Bitmap[T]) (*Bitmap[T], error) {
+	return this.apply(this.e.AndChecked, a)
+}
+
+func (this *Bitmap[T]) Or(a ...*Bitmap[T]) (*Bitmap[T], error) {
+	return this.apply(this.e.OrChecked, a)
+}
+
+func (this *Bitmap[T]) AndNot(a ...*Bitmap[T]) (*Bitmap[T], error) {
+	return this.apply(this.e.AndNotChecked, a)
+}
+
+func (this *Bitmap[T]) Xor(a ...*Bitmap[T]) (*Bitmap[T], error) {
+	return this.apply(this.e.XorChecked, a)
+}
+
+//
+// Not-exported functions
+//
+
+// position converts a position to the type of the positions of ewah.Ewah
+func position[T Position](i T) (int64, error) {
+	// Converted to uint64, negative positions are above math.MaxInt64
+	if i < 0 || uint64(i) > math.MaxInt64 {
+		return 0, fmt.Errorf("typed/Set: position %v: %w", i, ewah.ErrOutOfRange)
+	}
+
+	return int64(i), nil
+}
+
+// apply applies an operation of ewah.Ewah to the underlying bitmaps
+func (this *Bitmap[T]) apply(op func(...bitmap.Bitmap) (bitmap.Bitmap, error), a []*Bitmap[T]) (*Bitmap[T], error) {
+	// A nil operand is an empty bitmap, like a nil *ewah.Ewah
+	operands := make([]bitmap.Bitmap, len(a))
+	for k, b := range a {
+		if b != nil {
+			operands[k] = b.e
+		}
+	}
+
+	ans, err := op(operands...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bitmap[T]{ans.(*ewah.Ewah)}, nil
+}
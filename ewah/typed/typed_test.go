@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package typed
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"math"
+	"testing"
+)
+
+func TestBitmap(t *testing.T) {
+	a, b := New[uint32](), New[uint32]()
+	for i := uint32(0); i < 1000; i++ {
+		if i%2 == 0 {
+			if err := a.Set(i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i%3 == 0 {
+			b.Set(i)
+		}
+	}
+
+	if !a.Get(998) || a.Get(999) || a.Size() != 999 || a.Cardinality() != 500 {
+		t.Errorf("got size %d, cardinality %d", a.Size(), a.Cardinality())
+	}
+
+	and, err := a.And(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	positions := and.Positions()
+	if len(positions) != 167 || positions[0] != 0 || positions[1] != 6 || positions[166] != 996 {
+		t.Errorf("got %v", positions)
+	}
+
+	for _, c := range []struct {
+		f    func(...*Bitmap[uint32]) (*Bitmap[uint32], error)
+		want int64
+	}{{a.Or, 667}, {a.AndNot, 333}, {a.Xor, 500}} {
+		if ans, err := c.f(b); err != nil || ans.Cardinality() != c.want {
+			t.Errorf("got %v, want a cardinality of %d", err, c.want)
+		}
+	}
+
+	if ans, err := a.And(nil); err != nil || ans.Cardinality() != 0 {
+		t.Errorf("got %v for a nil operand", err)
+	}
+
+	n := 0
+	a.Range(func(i uint32) bool {
+		n++
+		return i < 10
+	})
+	if n != 6 {
+		t.Errorf("Range called f %d times, want 6", n)
+	}
+
+	if Of[uint32](a.Ewah()).Cardinality() != 500 {
+		t.Error("Of doesn't share the bitmap")
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	a := New[int]()
+	if err := a.Set(-1); !errors.Is(err, ewah.ErrOutOfRange) {
+		t.Errorf("got %v, want ewah.ErrOutOfRange", err)
+	}
+	if a.Get(-1) {
+		t.Error("Get(-1) should be false")
+	}
+
+	b := New[uint64]()
+	for _, i := range []uint64{math.MaxUint64, math.MaxInt64 + 1, math.MaxInt32} {
+		if err := b.Set(i); !errors.Is(err, ewah.ErrOutOfRange) {
+			t.Errorf("Set(%d): got %v, want ewah.ErrOutOfRange", i, err)
+		}
+	}
+
+	if err := b.Set(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set(5); !errors.Is(err, ewah.ErrOutOfOrder) {
+		t.Errorf("got %v, want ewah.ErrOutOfOrder", err)
+	}
+}
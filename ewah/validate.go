@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Validate checks the structure of the bitmap, and returns an error describing the first problem found, or
+// nil if there's none. The marker words must chain up to the last word of the buffer, the last one must be
+// where the next Set would go, and no bit may be set at or past the size. It's meant for bitmaps decoded
+// from disk or built by hand, since the operations of the package always produce valid bitmaps.
+func (this *Ewah) Validate() error {
+	if this == nil {
+		return newError(ErrCorruptData, "ewah/Validate: nil bitmap")
+	}
+
+	if this.actualSizeInWords < 1 || this.actualSizeInWords > int64(len(this.buffer)) {
+		return newError(ErrCorruptData, fmt.Sprintf("ewah/Validate: %d words used, with a buffer of %d", this.actualSizeInWords, len(this.buffer)))
+	}
+
+	if this.sizeInBits < 0 {
+		return newError(ErrCorruptData, fmt.Sprintf("ewah/Validate: negative size %d", this.sizeInBits))
+	}
+
+	last, highest, err := scanMarkers(this.buffer, this.actualSizeInWords)
+	if err != nil {
+		return newError(ErrCorruptData, "ewah/Validate: "+err.Error())
+	}
+
+	if this.setCursor != nil && this.setCursor.marker != last {
+		return newError(ErrCorruptData, fmt.Sprintf("ewah/Validate: the last marker word is at %d, not at %d", last, this.setCursor.marker))
+	}
+
+	if highest > this.sizeInBits {
+		return newError(ErrCorruptData, fmt.Sprintf("ewah/Validate: bit %d is set, past the size of %d bits", highest-1, this.sizeInBits))
+	}
+
+	return nil
+}
+
+//
+// Not-exported functions
+//
+
+// checkMarkers checks the marker words of the first sizeInWords words of buffer, which the decoders read
+// from untrusted input: the literal words of every marker word must be in the words used, and rlw must be
+// the position of the last marker word. The bitmaps are then safe to read and modify, even if their bits
+// may still not match their size, which Validate checks.
+func checkMarkers(buffer []uint64, sizeInWords, rlw int64) error {
+	last, _, err := scanMarkers(buffer, sizeInWords)
+	if err != nil {
+		return err
+	}
+
+	if last != rlw {
+		return fmt.Errorf("the last marker word is at %d, not at %d", last, rlw)
+	}
+
+	return nil
+}
+
+// scanMarkers walks the marker words of the first sizeInWords words of buffer, and returns the position of
+// the last one, and the position of the last bit set + 1. It fails if the literal words of a marker word
+// are not all in the words used.
+func scanMarkers(buffer []uint64, sizeInWords int64) (last, highest int64, err error) {
+	word := int64(0)
+	for pos := int64(0); pos < sizeInWords; {
+		rlw := buffer[pos]
+		runlen := int64((rlw >> 1) & LargestRunningLengthCount)
+		literals := int64(rlw >> uint32(1+RunningLengthBits))
+
+		if pos+1+literals > sizeInWords {
+			return 0, 0, fmt.Errorf("marker word at %d has %d literal words, past the %d words used", pos, literals, sizeInWords)
+		}
+
+		if runlen > 0 && rlw&1 != 0 {
+			highest = (word + runlen) * wordInBits
+		}
+		word += runlen
+
+		for _, w := range buffer[pos+1 : pos+1+literals] {
+			if w != 0 {
+				highest = word*wordInBits + wordInBits - int64(bits.LeadingZeros64(w))
+			}
+			word++
+		}
+
+		last = pos
+		pos += 1 + literals
+	}
+
+	return last, highest, nil
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah32
+
+import (
+	"math/bits"
+)
+
+type bitCounter struct {
+	oneBits uint64
+}
+
+func newBitCounter() BitmapStorage {
+	return &bitCounter{}
+}
+
+var _ BitmapStorage = (*bitCounter)(nil)
+
+func (this *bitCounter) add(newdata uint32) {
+	this.oneBits += uint64(bits.OnesCount32(newdata))
+}
+
+func (this *bitCounter) addStreamOfLiteralWords(data []uint32, start, number int32) {
+	for _, v := range data[start : start+number] {
+		this.add(v)
+	}
+}
+
+func (this *bitCounter) addStreamOfEmptyWords(v bool, number int64) {
+	if v {
+		this.oneBits += uint64(number * wordInBits)
+	}
+}
+
+func (this *bitCounter) addStreamOfNegatedLiteralWords(data []uint32, start, number int32) {
+	for _, v := range data[start : start+number] {
+		this.add(^v)
+	}
+}
+
+func (this *bitCounter) getCount() uint64 {
+	return this.oneBits
+}
+
+func (this *bitCounter) setSizeInBits(bits int64) error {
+	return nil
+}
@@ -0,0 +1,667 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package ewah32 is the 32-bit version of the EWAH bitmap compression. The words are 32 bits, and the
+// running length word has 16 bits for the running length and 15 bits for the number of literal words,
+// like the 32-bit versions of JavaEWAH and of the C++ EWAHBoolArray. It uses less memory than the 64-bit
+// version for small or very sparse bitmaps.
+package ewah32
+
+import (
+	"errors"
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"math"
+	"math/bits"
+)
+
+const (
+	// wordInBits is the constant representing the number of bits in a uint32
+	wordInBits int64 = 32
+
+	// defaultBufferSize is a constant default memory allocation when the object is constructed
+	defaultBufferSize uint32 = 4
+
+	RunningLengthBits                   int32  = 16
+	LiteralBits                         int32  = 32 - 1 - RunningLengthBits
+	LargestLiteralCount                 uint32 = (uint32(1) << uint32(LiteralBits)) - 1
+	LargestRunningLengthCount           uint32 = (uint32(1) << uint32(RunningLengthBits)) - 1
+	RunningLengthPlusRunningBit         uint32 = (uint32(1) << uint32(RunningLengthBits+1)) - 1
+	ShiftedLargestRunningLengthCount    uint32 = LargestRunningLengthCount << 1
+	NotRunningLengthPlusRunningBit      uint32 = ^RunningLengthPlusRunningBit
+	NotShiftedLargestRunningLengthCount uint32 = ^ShiftedLargestRunningLengthCount
+)
+
+type Ewah struct {
+	// actualSizeInWords is the number of words actually used in the buffer to represent the bitmap
+	actualSizeInWords int64
+
+	// sizeInBits is the number of total bits in the bitmap
+	sizeInBits int64
+
+	// buffer representing the bitmap
+	buffer []uint32
+
+	// whether we adjust after some aggregation by adding in zeroes
+	adjustContainerSizeWhenAggregating bool
+
+	// getCursor remembers the last search position and try to search from there for the next one
+	// It's an optimization for sequential Gets
+	getCursor *cursor
+
+	// setCursor remembers the last set position and move forward from there
+	setCursor *cursor
+
+	// trace receives the structural changes of the bitmap when it's set, see SetTrace
+	trace func(format string, args ...interface{})
+}
+
+var _ bitmap.Bitmap = (*Ewah)(nil)
+var _ BitmapStorage = (*Ewah)(nil)
+
+func init() {
+	bitmap.Register("ewah32", New)
+}
+
+func New() bitmap.Bitmap {
+	ewah := new(Ewah)
+
+	ewah.Reset()
+
+	return ewah
+}
+
+// Set sets the bit at position i to true (1). The bits must be set in ascending order. For example, set(15)
+// then set(7) will fail.
+func (this *Ewah) Set(i int64) bitmap.Bitmap {
+	// According to @lemire: https://github.com/lemire/javaewah/issues/23#issuecomment-23998948
+	// For the 32-bit EWAH, the range of allowable values for the set method is [0,Integer.MAX_VALUE - 32].
+	// One concern about supporting very wide ranges is that bitmaps are not appropriate if the data is too sparse.
+	// If you want to use a bitmap having few values over a wide range, it is wasted effort.
+	// You are better off using a different data structure.
+	if i > math.MaxInt32-wordInBits || i < 0 {
+		return nil
+	}
+
+	// If i is less than sizeInBits, then we are trying to set a previous bit, which is not allowed
+	if i < this.sizeInBits {
+		return nil
+	}
+
+	// Distance of the bit from the active word in the buffer
+	// We want to know this so we can decide whether we need to add some empty words to pad the bitmap,
+	// or update the bit in the current word
+	dist := (i+wordInBits)/wordInBits - (this.sizeInBits+wordInBits-1)/wordInBits
+
+	// Set the new size of the bitmap to the latest bit that's set (index is 0-based, thus +1)
+	this.sizeInBits = i + 1
+
+	// If the distance is greater than 0, that means we are not acting on the current active word
+	if dist > 0 {
+		// So we need to add some empty words if the distance is greater than 1
+		// Basically adding dist-1 zero words to the bitmap
+		if dist > 1 {
+			this.fastAddStreamOfEmptyWords(false, dist-1)
+		}
+
+		// Once we padded the bitmap with empty words, then we can add a new literal word at the end
+		this.addLiteralWord(uint32(1) << uint32((i % wordInBits)))
+
+		return this
+	}
+
+	// Now we know dist == 0 since it can't be < 0 (can't set a bit past the current active bit)
+	if this.setCursor.literalCount() == 0 {
+		this.setCursor.setEmptyCount(this.setCursor.emptyCount() - 1)
+		this.addLiteralWord(1 << uint32(i%wordInBits))
+		return this
+	}
+
+	this.buffer[this.actualSizeInWords-1] |= 1 << uint32(i%wordInBits)
+	if this.buffer[this.actualSizeInWords-1] == ^uint32(0) {
+		this.buffer[this.actualSizeInWords-1] = 0
+		this.actualSizeInWords -= 1
+		this.setCursor.setLiteralCount(this.setCursor.literalCount() - 1)
+		this.addEmptyWord(true)
+
+		// Be a good citizen and update the cursors
+		this.getCursor.quickUpdate(this.buffer, this.actualSizeInWords)
+		this.setCursor.quickUpdate(this.buffer, this.actualSizeInWords)
+	}
+
+	return this
+}
+
+// SetRange sets all the bits from start (inclusive) to end (exclusive) to true (1). Like Set, the range must
+// start after the last bit set. Whole words are added as a run of 1's instead of one bit at a time.
+func (this *Ewah) SetRange(start, end int64) bitmap.Bitmap {
+	if end <= start || start < this.sizeInBits || end-1 > math.MaxInt32-wordInBits {
+		return nil
+	}
+
+	i := start
+	for ; i < end && (i == start || i%wordInBits != 0); i++ {
+		this.Set(i)
+	}
+
+	if n := (end - i) / wordInBits; n > 0 {
+		this.addStreamOfEmptyWords(true, n)
+		i += n * wordInBits
+	}
+
+	for ; i < end; i++ {
+		this.Set(i)
+	}
+
+	return this
+}
+
+func (this *Ewah) Get(i int64) bool {
+	if i < 0 || i > this.sizeInBits {
+		return false
+	}
+
+	wordToCheck := i / wordInBits
+	bitInWord := uint32(i % wordInBits)
+
+	// The marker word under the cursor may have been extended by the set cursor since the last Get, so
+	// make sure we are not looking at stale counts
+	this.getCursor.updateMarkerCounts()
+
+	// If the word to check is before the the words already checked then let's update the buffer
+	if wordToCheck < this.getCursor.totalChecked {
+		this.getCursor.reset(this.buffer, this.actualSizeInWords)
+	}
+
+	//this.printDetails()
+
+	for this.getCursor.totalChecked <= wordToCheck && !this.getCursor.end() {
+
+		if emptyRemaining := this.getCursor.emptyRemaining(); emptyRemaining > 0 {
+			if wordToCheck < this.getCursor.totalChecked+emptyRemaining {
+				return this.getCursor.emptyBit()
+			}
+
+			// If the marker has no literal words, this takes us to the next marker, which may start with
+			// some empty words of its own, so we start over
+			this.getCursor.moveForward(emptyRemaining)
+			continue
+		}
+
+		if literalRemaining := this.getCursor.literalRemaining(); literalRemaining > 0 {
+			if wordToCheck < this.getCursor.totalChecked+literalRemaining {
+				n := this.getCursor.marker + this.getCursor.literalChecked + (wordToCheck - this.getCursor.totalChecked) + 1
+				return this.buffer[n]&(uint32(1)<<bitInWord) != 0
+			}
+
+			this.getCursor.moveForward(literalRemaining)
+			continue
+		}
+
+		// Nothing left in this marker, so let's go to the next one
+		if this.getCursor.nextMarker() != nil {
+			break
+		}
+	}
+
+	return false
+}
+
+// Returns the size in bits of the *uncompressed* bitmap represented by this compressed bitmap.
+// Initially, the sizeInBits is zero. It is extended automatically when you set bits to true.
+func (this *Ewah) Size() int64 {
+	return this.sizeInBits
+}
+
+// Report the *compressed* size of the bitmap (equivalent to memory usage, after accounting for some overhead).
+func (this *Ewah) SizeInBytes() int64 {
+	return this.actualSizeInWords * (wordInBits / 8)
+}
+
+func (this *Ewah) SizeInWords() int64 {
+	return this.actualSizeInWords
+}
+
+func (this *Ewah) Clear() {
+	this.Reset()
+}
+
+func (this *Ewah) Reset() {
+	this.actualSizeInWords = 1
+	this.sizeInBits = 0
+	this.adjustContainerSizeWhenAggregating = true
+
+	if this.buffer == nil {
+		this.buffer = make([]uint32, defaultBufferSize)
+	} else {
+		this.buffer[0] = 0
+	}
+
+	if this.setCursor == nil {
+		this.setCursor = newCursor(this.buffer, this.actualSizeInWords)
+	} else {
+		this.setCursor.reset(this.buffer, this.actualSizeInWords)
+	}
+
+	if this.getCursor == nil {
+		this.getCursor = newCursor(this.buffer, this.actualSizeInWords)
+	} else {
+		this.getCursor.reset(this.buffer, this.actualSizeInWords)
+	}
+
+}
+
+func (this *Ewah) Swap(other *Ewah) bitmap.Bitmap {
+	this.buffer, other.buffer = other.buffer, this.buffer
+	this.actualSizeInWords, other.actualSizeInWords = other.actualSizeInWords, this.actualSizeInWords
+	this.sizeInBits, other.sizeInBits = other.sizeInBits, this.sizeInBits
+
+	s1, s2 := this.setCursor.marker, other.setCursor.marker
+
+	// The get cursors can't be carried over since resetting the marker loses the number of words
+	// checked before it, so they just start over from the beginning.
+	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, s2)
+	this.getCursor.reset(this.buffer, this.actualSizeInWords)
+	other.setCursor.resetMarker(other.buffer, other.actualSizeInWords, s1)
+	other.getCursor.reset(other.buffer, other.actualSizeInWords)
+
+	return this
+}
+
+func (this *Ewah) Clone() bitmap.Bitmap {
+	c := New().(*Ewah)
+	c.reserve(int32(this.actualSizeInWords))
+	copy(c.buffer, this.buffer)
+	c.actualSizeInWords = this.actualSizeInWords
+	c.sizeInBits = this.sizeInBits
+
+	c.setCursor.resetMarker(c.buffer, c.actualSizeInWords, this.setCursor.marker)
+	c.getCursor.reset(c.buffer, c.actualSizeInWords)
+
+	return c
+}
+
+func (this *Ewah) Copy(other bitmap.Bitmap) bitmap.Bitmap {
+	o := other.(*Ewah)
+	this.buffer = make([]uint32, o.SizeInWords())
+	copy(this.buffer, o.buffer)
+	this.actualSizeInWords = o.SizeInWords()
+	this.sizeInBits = o.Size()
+
+	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, o.setCursor.marker)
+	this.getCursor.reset(this.buffer, this.actualSizeInWords)
+
+	return this
+}
+
+func (this *Ewah) Equal(other bitmap.Bitmap) bool {
+	if other == nil {
+		return false
+	}
+
+	o := other.(*Ewah)
+	if this.Size() != o.Size() {
+		return false
+	}
+
+	for i, v := range this.buffer[:this.actualSizeInWords] {
+		if o.buffer[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *Ewah) Cardinality() int64 {
+	n := int64(0)
+	c := newCursor(this.buffer, this.actualSizeInWords)
+
+	for !c.end() {
+		if c.emptyBit() {
+			n += wordInBits * c.emptyCount()
+		}
+
+		for j := int64(0); j < c.literalCount(); j++ {
+			n += int64(bits.OnesCount32(c.getLiteralWordAt(j)))
+		}
+
+		if c.nextMarker() != nil {
+			break
+		}
+	}
+
+	return n
+}
+
+func (this *Ewah) PrintStats(details bool) {
+	fmt.Printf("actualSizeInWords = %d, actualSizeInBits = %d, cardinality = %d\n", this.SizeInWords(), this.Size(), this.Cardinality())
+
+	if details {
+		this.printDetails()
+	}
+}
+
+func (this *Ewah) printDetails() {
+	fmt.Println("                           10987654321098765432109876543210")
+	for i, v := range this.buffer[:this.actualSizeInWords] {
+		fmt.Printf("%4d: %20d %032b\n", i, uint32(v), uint32(v))
+	}
+}
+
+//
+// Not-exported functions
+//
+
+// add is used to add words directly to the bitmap.
+func (this *Ewah) add(newdata uint32) {
+	this.addSignificantBits(newdata, wordInBits)
+}
+
+// addWithSize adds words directly to the bitmap, but with the number of significant bits specified.
+func (this *Ewah) addSignificantBits(newdata uint32, bitsthatmatter int64) {
+	this.sizeInBits += bitsthatmatter
+	if newdata == 0 {
+		this.addEmptyWord(false)
+	} else if newdata == ^uint32(0) {
+		this.addEmptyWord(true)
+	} else {
+		this.addLiteralWord(newdata)
+	}
+}
+
+// addEmptyWord adds an empty word of 1's or 0's to the bitmap. true: newdata==0; false: newdata== ~0
+func (this *Ewah) addEmptyWord(v bool) {
+	noLiteralWord := this.setCursor.literalCount() == 0
+	runlen := this.setCursor.emptyCount()
+
+	if noLiteralWord && runlen == 0 {
+		this.setCursor.setEmptyBit(v)
+	}
+
+	if noLiteralWord && this.setCursor.emptyBit() == v && uint32(runlen) < LargestRunningLengthCount {
+		this.setCursor.setEmptyCount(runlen + 1)
+		if this.trace != nil {
+			this.tracef("run of %v extended to %d words", v, runlen+1)
+		}
+		return
+	}
+
+	this.pushback(0)
+	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+	this.setCursor.setEmptyBit(v)
+	this.setCursor.setEmptyCount(1)
+	if this.trace != nil {
+		this.tracef("run of %v started with a new marker word at %d", v, this.actualSizeInWords-1)
+	}
+}
+
+// addLiteralWord adds a literal word to the bitmap.
+func (this *Ewah) addLiteralWord(newdata uint32) {
+	numberSoFar := this.setCursor.literalCount()
+	if uint32(numberSoFar) >= LargestLiteralCount {
+		this.pushback(0)
+		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		this.setCursor.setLiteralCount(1)
+		this.pushback(newdata)
+	}
+	this.setCursor.setLiteralCount(numberSoFar + 1)
+	this.pushback(newdata)
+	if this.trace != nil {
+		this.tracef("literal word %#08x added at %d", newdata, this.actualSizeInWords-1)
+	}
+}
+
+// addStreamOfLiteralWords adds several literal words at a time, might be faster
+func (this *Ewah) addStreamOfLiteralWords(data []uint32, start, number int32) {
+	leftOverNumber := int64(number)
+
+	for leftOverNumber > 0 {
+		numberOfLiteralWords := this.setCursor.literalCount()
+		whatWeCanAdd := int64(math.Min(float64(leftOverNumber), float64(LargestLiteralCount-uint32(numberOfLiteralWords))))
+
+		this.setCursor.setLiteralCount(numberOfLiteralWords + whatWeCanAdd)
+		leftOverNumber -= whatWeCanAdd
+
+		this.pushbackMultiple(data, start, int32(whatWeCanAdd))
+		this.sizeInBits += whatWeCanAdd * wordInBits
+
+		if leftOverNumber > 0 {
+			this.pushback(0)
+			this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		}
+	}
+
+	if this.trace != nil {
+		this.tracef("%d literal words added, %d words used", number, this.actualSizeInWords)
+	}
+}
+
+// addStreamOfEmptyWords adds several empty words at a time, might be faster
+func (this *Ewah) addStreamOfEmptyWords(v bool, number int64) {
+	if number == 0 {
+		return
+	}
+
+	this.sizeInBits += number * wordInBits
+	n := number
+
+	if this.setCursor.emptyBit() != v && this.setCursor.size() == 0 {
+		this.setCursor.setEmptyBit(v)
+	} else if this.setCursor.literalCount() != 0 || this.setCursor.emptyBit() != v {
+		this.pushback(0)
+		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		if v {
+			this.setCursor.setEmptyBit(v)
+		}
+	}
+
+	runlen := this.setCursor.emptyCount()
+	whatWeCanAdd := int64(math.Min(float64(number), float64(LargestRunningLengthCount-uint32(runlen))))
+
+	this.setCursor.setEmptyCount(runlen + whatWeCanAdd)
+	number -= whatWeCanAdd
+
+	for uint32(number) >= LargestRunningLengthCount {
+		this.pushback(0)
+		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		if v {
+			this.setCursor.setEmptyBit(v)
+		}
+
+		this.setCursor.setEmptyCount(int64(LargestRunningLengthCount))
+		number -= int64(LargestRunningLengthCount)
+	}
+
+	if number > 0 {
+		this.pushback(0)
+		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		if v {
+			this.setCursor.setEmptyBit(v)
+		}
+		this.setCursor.setEmptyCount(number)
+	}
+
+	if this.trace != nil {
+		this.tracef("run of %d words of %v added, %d words used", n, v, this.actualSizeInWords)
+	}
+}
+
+// fastAddStreamOfEmptyWords adds many zeroes and ones faster. This does not update sizeInBits
+func (this *Ewah) fastAddStreamOfEmptyWords(v bool, number int64) {
+	n := number
+
+	if this.setCursor.emptyBit() != v && this.setCursor.size() == 0 {
+		this.setCursor.setEmptyBit(v)
+	} else if this.setCursor.literalCount() != 0 || this.setCursor.emptyBit() != v {
+		this.pushback(0)
+		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		if v {
+			this.setCursor.setEmptyBit(v)
+		}
+	}
+
+	runlen := this.setCursor.emptyCount()
+	whatWeCanAdd := int64(math.Min(float64(number), float64(LargestRunningLengthCount-uint32(runlen))))
+
+	this.setCursor.setEmptyCount(runlen + whatWeCanAdd)
+	number -= whatWeCanAdd
+
+	for uint32(number) >= LargestRunningLengthCount {
+		this.pushback(0)
+		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		if v {
+			this.setCursor.setEmptyBit(v)
+		}
+
+		this.setCursor.setEmptyCount(int64(LargestRunningLengthCount))
+		number -= int64(LargestRunningLengthCount)
+	}
+
+	if number > 0 {
+		this.pushback(0)
+		this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		if v {
+			this.setCursor.setEmptyBit(v)
+		}
+
+		this.setCursor.setEmptyCount(number)
+	}
+
+	if this.trace != nil {
+		this.tracef("run of %d words of %v added, %d words used", n, v, this.actualSizeInWords)
+	}
+}
+
+// addStreamOfNegatedLiteralWords is similar to addStreamOfLiteralWords except the words are negated
+func (this *Ewah) addStreamOfNegatedLiteralWords(data []uint32, start, number int32) {
+	leftOverNumber := int64(number)
+
+	for leftOverNumber > 0 {
+		numberOfLiteralWords := this.setCursor.literalCount()
+		whatWeCanAdd := int64(math.Min(float64(leftOverNumber), float64(LargestLiteralCount-uint32(numberOfLiteralWords))))
+
+		this.setCursor.setLiteralCount(numberOfLiteralWords + whatWeCanAdd)
+		leftOverNumber -= whatWeCanAdd
+		this.negativePushBack(data, start, int32(whatWeCanAdd))
+		this.sizeInBits += whatWeCanAdd * wordInBits
+
+		if leftOverNumber > 0 {
+			this.pushback(0)
+			this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, this.actualSizeInWords-1)
+		}
+	}
+}
+
+func (this *Ewah) negativePushBack(data []uint32, start, number int32) {
+	negativeData := make([]uint32, number)
+
+	for i, v := range data[start : start+number] {
+		negativeData[i] = ^v
+	}
+
+	this.pushbackMultiple(negativeData, 0, number)
+}
+
+// pushback adds an element at the end
+//
+// This is a convenience method that calls push_back_multiple
+func (this *Ewah) pushback(data uint32) {
+	this.pushbackMultiple([]uint32{data}, 0, 1)
+}
+
+// pushback adds multiple element at the end
+//
+// This is the C++ vector pushback description. Adds a new element at the end of the vector, after its
+// current last element. The content of val is copied (or moved) to the new element.
+//
+// This effectively increases the container size by one, which causes an automatic reallocation of the
+// allocated storage space if -and only if- the new vector size surpasses the current vector capacity.
+func (this *Ewah) pushbackMultiple(data []uint32, start, number int32) {
+	// If the size of the bitmap is the same as the buffer length, that means the buffer is full, so we need
+	// to allocate
+	nextSize := this.actualSizeInWords + int64(number)
+	bufferCap := int64(cap(this.buffer))
+	if nextSize >= bufferCap {
+		var newSize int64
+		if nextSize < 32768 {
+			newSize = nextSize * 2
+		} else if nextSize*3/2 < nextSize {
+			// overflow
+			newSize = math.MaxInt32
+		} else {
+			newSize = nextSize * 3 / 2
+		}
+		oldBuffer := this.buffer
+		this.buffer = make([]uint32, newSize)
+		copy(this.buffer, oldBuffer)
+		if this.trace != nil {
+			this.tracef("buffer grown from %d to %d words", len(oldBuffer), newSize)
+		}
+	}
+	copy(this.buffer[this.actualSizeInWords:], data[start:start+number])
+	this.actualSizeInWords += int64(number)
+
+	// Let's do the right thing and update the set and get cursors
+	this.setCursor.quickUpdate(this.buffer, this.actualSizeInWords)
+	this.getCursor.quickUpdate(this.buffer, this.actualSizeInWords)
+}
+
+func (this *Ewah) setSizeInBits(size int64) error {
+	if (size+wordInBits-1)/wordInBits != (this.sizeInBits+wordInBits-1)/wordInBits {
+		return errors.New("ewah/setSizeInBits: You can only reduce the size of teh bitmap within the scope of the last word. To extend the bitmap, please call setSizeInBitsWithDefault(int32)")
+	}
+
+	this.sizeInBits = size
+	return nil
+}
+
+// setSizeInBitsWithDefault changes the reported size in bits of the *uncompressed* bitmap represented
+// by this compressed bitmap. It may change the underlying compressedb bitmap. It is not possible to reduce
+// the sizeInBits, but it can be extended. The new bits are set to false or true depending on the
+// value of the defaultValue
+func (this *Ewah) setSizeInBitsWithDefault(size int64, defaultValue bool) bool {
+	if size < this.sizeInBits {
+		return false
+	}
+
+	if !defaultValue {
+		this.extendEmptyBits(this, this.sizeInBits, size)
+	} else {
+		for this.sizeInBits%wordInBits != 0 && this.sizeInBits < size {
+			this.Set(this.sizeInBits)
+		}
+
+		this.addStreamOfEmptyWords(defaultValue, (size/wordInBits)-this.sizeInBits/wordInBits)
+
+		for this.sizeInBits < size {
+			this.Set(this.sizeInBits)
+		}
+	}
+
+	this.sizeInBits = size
+	return true
+
+}
+
+func (this *Ewah) toArray() []int {
+	return nil
+}
+
+func (this *Ewah) extendEmptyBits(storage *Ewah, currentSize, newSize int64) {
+
+}
+
+func (this *Ewah) reserve(size int32) bitmap.Bitmap {
+	if size > int32(len(this.buffer)) {
+		oldBuffer := this.buffer
+		this.buffer = make([]uint32, size)
+		copy(this.buffer, oldBuffer)
+		this.setCursor.reset(this.buffer, this.actualSizeInWords)
+		this.getCursor.reset(this.buffer, this.actualSizeInWords)
+	}
+
+	return this
+}
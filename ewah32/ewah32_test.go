@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah32
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitmaptest"
+	"github.com/reducedb/bitmap/bitset"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+	c2 uint32 = 0x1b873593
+)
+
+func TestSet(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	bm := New().(*Ewah)
+	nums := make([]int64, 10000)
+
+	bit := int64(0)
+	for i := range nums {
+		bit += int64(rand.Intn(10000) + 1)
+		nums[i] = bit
+
+		if !bm.Set(bit).Get(bit) {
+			t.Fatalf("Problem setting bm[%d] with number %d\n", i, bit)
+		}
+	}
+
+	if bm.Set(nums[0]) != nil {
+		t.Fatalf("Setting bit %d out of order should fail", nums[0])
+	}
+
+	if bm.Cardinality() != int64(len(nums)) {
+		t.Fatalf("Cardinality %d != %d", bm.Cardinality(), len(nums))
+	}
+
+	for i, v := range nums {
+		if !bm.Get(v) {
+			t.Fatalf("Problem getting bm[%d] with number %d\n", i, v)
+		}
+	}
+}
+
+func TestLongRuns(t *testing.T) {
+	// More empty words than a single running length word can hold
+	bit := int64(LargestRunningLengthCount) * 3 * wordInBits
+
+	bm := New().(*Ewah)
+	if bm.Set(1).Set(bit) == nil || bm.Cardinality() != 2 || !bm.Get(bit) || bm.Get(bit-1) {
+		t.Fatalf("Problem setting bit %d", bit)
+	}
+
+	n := bm.Clone().Not()
+	if n.Cardinality() != bit-1 || n.Get(1) || !n.Get(bit-1) {
+		t.Fatalf("Problem with Not on long runs, cardinality = %d", n.Cardinality())
+	}
+
+	r := New().(*Ewah)
+	if r.SetRange(0, bit) == nil || r.Cardinality() != bit || !r.Or(bm).Equal(r.Set(bit)) {
+		t.Fatalf("Problem with SetRange on long runs, cardinality = %d", r.Cardinality())
+	}
+}
+
+func TestIterator(t *testing.T) {
+	rand.Seed(int64(c2))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	for n := 0; n < 100; n++ {
+		e, b := crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+
+		if n%2 == 1 {
+			e.Not()
+			b.Not()
+		}
+
+		it := e.Iterator()
+		for i := int64(0); i < b.Size(); i++ {
+			if b.Get(i) {
+				if next := it.Next(); next != i {
+					t.Fatalf("Iterator returned %d, should be %d", next, i)
+				}
+			}
+		}
+
+		if it.HasNext() {
+			t.Fatal("Iterator should be done")
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	bm := New().(*Ewah)
+	bm.Set(0).Set(100)
+
+	// The bytes of JavaEWAH's EWAHCompressedBitmap32 with bits 0 and 100 set
+	want := []byte{
+		0, 0, 0, 101, 0, 0, 0, 4,
+		0, 2, 0, 0, 0, 0, 0, 1, 0, 2, 0, 4, 0, 0, 0, 0x10,
+		0, 0, 0, 2,
+	}
+	if b, _ := bm.MarshalBinary(); !bytes.Equal(b, want) {
+		t.Fatalf("MarshalBinary = %v, should be %v", b, want)
+	}
+
+	// The same bitmap laid out as EWAHBoolArray<uint32_t>::write() writes it on a little endian machine: the
+	// sizes as uint64, the same words little endian, and nothing after them
+	want = []byte{
+		101, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 2, 0, 1, 0, 0, 0, 4, 0, 2, 0, 0x10, 0, 0, 0,
+	}
+	if b, _ := bm.MarshalCpp(); !bytes.Equal(b, want) {
+		t.Fatalf("MarshalCpp = %v, should be %v", b, want)
+	}
+
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	for n := 0; n < 20; n++ {
+		e, _ := crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+
+		for _, codec := range []struct {
+			marshal   func() ([]byte, error)
+			unmarshal func(*Ewah, []byte) error
+		}{
+			{e.MarshalBinary, (*Ewah).UnmarshalBinary},
+			{e.MarshalCpp, (*Ewah).UnmarshalCpp},
+		} {
+			b, err := codec.marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := New().(*Ewah)
+			if err := codec.unmarshal(d, b); err != nil {
+				t.Fatal(err)
+			}
+			if !d.Equal(e) || d.Size() != e.Size() || d.Cardinality() != e.Cardinality() {
+				t.Fatalf("the decoded bitmap doesn't match")
+			}
+
+			// The decoded bitmap can still be appended to
+			if d.Set(e.Size()+100) == nil || !d.Get(e.Size()+100) {
+				t.Fatalf("Problem setting a bit after decoding")
+			}
+
+			for _, invalid := range [][]byte{nil, b[:len(b)-1], append(b[:len(b):len(b)], 0, 0, 0, 0)} {
+				if codec.unmarshal(New().(*Ewah), invalid) == nil {
+					t.Fatalf("decoding %d bytes should fail", len(invalid))
+				}
+			}
+		}
+	}
+
+	// A marker word with more literal words than there are words
+	b, _ := New().(*Ewah).Set(1).(*Ewah).MarshalBinary()
+	b[8] = 0xff
+	if err := New().(*Ewah).UnmarshalBinary(b); err == nil {
+		t.Fatal("decoding a marker word past the end should fail")
+	}
+}
+
+func TestNoOperands(t *testing.T) {
+	bm := New().(*Ewah)
+	bm.Set(3).Set(1000)
+
+	for op, f := range map[string]func(...bitmap.Bitmap) bitmap.Bitmap{"And": bm.And, "AndNot": bm.AndNot, "Or": bm.Or, "Xor": bm.Xor} {
+		c := f()
+		if c == nil || c == bitmap.Bitmap(bm) || !c.Equal(bm) {
+			t.Fatalf("%s with no operand should return a copy", op)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var events []string
+	e := New().(*Ewah)
+	e.SetTrace(func(format string, args ...interface{}) {
+		events = append(events, fmt.Sprintf(format, args...))
+	})
+
+	for i := int64(0); i < 200; i += 3 {
+		e.Set(i)
+	}
+	e.Set(10000)
+
+	for _, s := range []string{"literal word", "words of false", "buffer grown"} {
+		found := false
+		for _, ev := range events {
+			found = found || strings.Contains(ev, s)
+		}
+		if !found {
+			t.Errorf("no %q in the trace: %v", s, events)
+		}
+	}
+
+	n := len(events)
+	e.SetTrace(nil)
+	e.Set(20000)
+	if len(events) != n || e.Clone().(*Ewah).trace != nil {
+		t.Errorf("trace not turned off")
+	}
+}
+
+func TestCrossCheckBitset(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	bitmaptest.CrossCheck(t, 100, func() (bitmap.Bitmap, *bitset.Bitset) {
+		return crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+	})
+}
+
+// crossCheckBitmaps returns the same random bitmap as an Ewah and as a Bitset, see bitmaptest.Bits
+func crossCheckBitmaps(gap int) (*Ewah, *bitset.Bitset) {
+	e, b := bitmaptest.Bits(New, 500, gap, gap*100)
+	return e.(*Ewah), b
+}
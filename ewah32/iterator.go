@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah32
+
+import (
+	"math/bits"
+)
+
+// Iterator walks the positions of the bits set to 1, in ascending order. It reads the buffer directly
+// and doesn't touch the cursors of the bitmap, so several iterators can walk the same bitmap. The bitmap
+// must not be modified while iterating.
+type Iterator struct {
+	buffer     []uint32
+	bsize      int64
+	sizeInBits int64
+
+	// next is the position of the next word to read in the buffer, either a literal or a marker word
+	next int64
+
+	// emptyRemaining and literalRemaining are the number of words left to read for the current marker
+	emptyRemaining   int64
+	literalRemaining int64
+	emptyBit         bool
+
+	// word is what's left of the current uncompressed word, and base the position of its first bit
+	word uint32
+	base int64
+
+	// wordIndex is the index of the next uncompressed word
+	wordIndex int64
+}
+
+// Iterator returns an iterator over the bits set to 1 in the bitmap
+func (this *Ewah) Iterator() *Iterator {
+	return &Iterator{
+		buffer:     this.buffer,
+		bsize:      this.actualSizeInWords,
+		sizeInBits: this.sizeInBits,
+	}
+}
+
+// HasNext returns true if there are more bits set to 1
+func (this *Iterator) HasNext() bool {
+	for this.word == 0 {
+		if this.emptyRemaining > 0 {
+			if this.emptyBit {
+				this.word = ^uint32(0)
+				this.base = this.wordIndex * wordInBits
+				this.wordIndex++
+				this.emptyRemaining--
+			} else {
+				this.wordIndex += this.emptyRemaining
+				this.emptyRemaining = 0
+			}
+			continue
+		}
+
+		if this.literalRemaining > 0 {
+			this.word = this.buffer[this.next]
+			this.base = this.wordIndex * wordInBits
+			this.next++
+			this.wordIndex++
+			this.literalRemaining--
+			continue
+		}
+
+		if this.next >= this.bsize {
+			return false
+		}
+
+		rlw := this.buffer[this.next]
+		this.emptyBit = rlw&1 != 0
+		this.emptyRemaining = int64((rlw >> 1) & LargestRunningLengthCount)
+		this.literalRemaining = int64(rlw >> uint32(1+RunningLengthBits))
+		this.next++
+	}
+
+	return this.base+int64(bits.TrailingZeros32(this.word)) < this.sizeInBits
+}
+
+// Next returns the position of the next bit set to 1, or -1 if there are none left
+func (this *Iterator) Next() int64 {
+	if !this.HasNext() {
+		return -1
+	}
+
+	i := this.base + int64(bits.TrailingZeros32(this.word))
+	this.word &= this.word - 1
+
+	return i
+}
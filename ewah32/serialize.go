@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package ewah32
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"math"
+)
+
+var _ bitmap.Serializable = (*Ewah)(nil)
+
+// MarshalBinary encodes the bitmap in the same format as serialize() of JavaEWAH's EWAHCompressedBitmap32:
+// the size in bits, the number of words, the words and the position of the last running length word are
+// 32-bit integers, and everything is big endian.
+//
+//	sizeInBits (int32) | sizeInWords (int32) | words (sizeInWords x uint32) | rlw position (int32)
+func (this *Ewah) MarshalBinary() ([]byte, error) {
+	return this.marshal(binary.BigEndian), nil
+}
+
+// UnmarshalBinary decodes a bitmap encoded by MarshalBinary, or by serialize() of JavaEWAH's
+// EWAHCompressedBitmap32. It replaces the content of the bitmap.
+func (this *Ewah) UnmarshalBinary(b []byte) error {
+	return this.unmarshal("UnmarshalBinary", b, binary.BigEndian)
+}
+
+// MarshalCpp encodes the bitmap in the format of EWAHBoolArray<uint32_t>::write() of the C++ library, with
+// the size in bits saved. The integers are little endian, as the C++ library writes its memory as it is on
+// the little endian machines it runs on. The sizes are 64 bits, and the position of the last marker word is
+// not written.
+//
+//	sizeInBits (uint64) | sizeInWords (uint64) | words (sizeInWords x uint32)
+func (this *Ewah) MarshalCpp() ([]byte, error) {
+	b := make([]byte, 8+8+4*this.actualSizeInWords)
+
+	binary.LittleEndian.PutUint64(b, uint64(this.sizeInBits))
+	binary.LittleEndian.PutUint64(b[8:], uint64(this.actualSizeInWords))
+
+	for i, v := range this.buffer[:this.actualSizeInWords] {
+		binary.LittleEndian.PutUint32(b[16+4*i:], v)
+	}
+
+	return b, nil
+}
+
+// UnmarshalCpp decodes a bitmap encoded by MarshalCpp, or by EWAHBoolArray<uint32_t>::write() of the C++
+// library with the size in bits saved. It replaces the content of the bitmap.
+func (this *Ewah) UnmarshalCpp(b []byte) error {
+	if len(b) < 16 {
+		return errors.New("ewah32/UnmarshalCpp: buffer is too short")
+	}
+
+	sizeInBits := binary.LittleEndian.Uint64(b)
+	sizeInWords := binary.LittleEndian.Uint64(b[8:])
+
+	if sizeInBits > math.MaxInt32 || sizeInWords < 1 || sizeInWords != uint64(len(b)-16)/4 || len(b)%4 != 0 {
+		return errors.New("ewah32/UnmarshalCpp: invalid sizes")
+	}
+
+	return this.load("UnmarshalCpp", b[16:], int64(sizeInWords), int64(sizeInBits), -1, binary.LittleEndian)
+}
+
+//
+// Not-exported functions
+//
+
+// marshal encodes the bitmap in the format of MarshalBinary, with the byte order given. Set never goes past
+// math.MaxInt32 bits, so the sizes always fit.
+func (this *Ewah) marshal(order binary.ByteOrder) []byte {
+	b := make([]byte, 4+4+4*this.actualSizeInWords+4)
+
+	order.PutUint32(b, uint32(this.sizeInBits))
+	order.PutUint32(b[4:], uint32(this.actualSizeInWords))
+
+	for i, v := range this.buffer[:this.actualSizeInWords] {
+		order.PutUint32(b[8+4*i:], v)
+	}
+
+	order.PutUint32(b[8+4*this.actualSizeInWords:], uint32(this.setCursor.marker))
+
+	return b
+}
+
+// unmarshal decodes a bitmap encoded by marshal with the byte order given, and replaces the content of the
+// bitmap. name is the function reported in the errors.
+func (this *Ewah) unmarshal(name string, b []byte, order binary.ByteOrder) error {
+	if len(b) < 8 {
+		return errors.New("ewah32/" + name + ": buffer is too short")
+	}
+
+	sizeInBits := int64(int32(order.Uint32(b)))
+	sizeInWords := int64(int32(order.Uint32(b[4:])))
+
+	if sizeInBits < 0 || sizeInWords < 1 || int64(len(b)) != 4+4+4*sizeInWords+4 {
+		return errors.New("ewah32/" + name + ": invalid sizes")
+	}
+
+	rlw := int64(int32(order.Uint32(b[8+4*sizeInWords:])))
+
+	return this.load(name, b[8:8+4*sizeInWords], sizeInWords, sizeInBits, rlw, order)
+}
+
+// load replaces the content of the bitmap with the words encoded in b with the byte order given. rlw is
+// the position of the last marker word, or -1 if it wasn't encoded and is found by walking the marker words.
+func (this *Ewah) load(name string, b []byte, sizeInWords, sizeInBits, rlw int64, order binary.ByteOrder) error {
+	buffer := make([]uint32, sizeInWords)
+	for i := range buffer {
+		buffer[i] = order.Uint32(b[4*i:])
+	}
+
+	// The literal words of every marker word must be in the buffer, and the last one must be at rlw
+	last := int64(0)
+	for pos := int64(0); pos < sizeInWords; {
+		literals := int64(buffer[pos] >> uint32(1+RunningLengthBits))
+		if pos+1+literals > sizeInWords {
+			return fmt.Errorf("ewah32/%s: marker word at %d has %d literal words, past the %d words used", name, pos, literals, sizeInWords)
+		}
+
+		last = pos
+		pos += 1 + literals
+	}
+
+	if rlw >= 0 && last != rlw {
+		return fmt.Errorf("ewah32/%s: the last marker word is at %d, not at %d", name, last, rlw)
+	}
+
+	this.buffer = buffer
+	this.actualSizeInWords = sizeInWords
+	this.sizeInBits = sizeInBits
+
+	this.setCursor.resetMarker(this.buffer, this.actualSizeInWords, last)
+	this.getCursor.reset(this.buffer, this.actualSizeInWords)
+
+	return nil
+}
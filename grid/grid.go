@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package grid implements a 2D bitmap addressed by (row, column), such as an occupancy grid or a
+// feature x entity matrix. Each row is stored as an EWAH bitmap, so a row is as cheap to extract as it is
+// to store, while a column is built by looking up every row.
+package grid
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+)
+
+type Grid struct {
+	// rows[r] holds the columns set in row r, or nil if the row is empty
+	rows []*ewah.Ewah
+
+	cols int64
+}
+
+// New returns an empty grid with cols columns. Rows are added as bits are set.
+func New(cols int64) *Grid {
+	if cols < 0 {
+		cols = 0
+	}
+
+	return &Grid{
+		cols: cols,
+	}
+}
+
+// Set sets the bit at (row, col). Within a row, the columns must be set in ascending order, but rows can be
+// set in any order. It returns nil if the position is out of range, or the column out of order.
+func (this *Grid) Set(row, col int64) *Grid {
+	if row < 0 || col < 0 || col >= this.cols {
+		return nil
+	}
+
+	for int64(len(this.rows)) <= row {
+		this.rows = append(this.rows, nil)
+	}
+
+	if this.rows[row] == nil {
+		this.rows[row] = ewah.NewEwah()
+	}
+
+	if this.rows[row].Set(col) == nil {
+		return nil
+	}
+
+	return this
+}
+
+func (this *Grid) Get(row, col int64) bool {
+	if row < 0 || row >= int64(len(this.rows)) || this.rows[row] == nil {
+		return false
+	}
+
+	return this.rows[row].Get(col)
+}
+
+// Rows returns the number of rows. Setting a bit past the last row adds rows.
+func (this *Grid) Rows() int64 {
+	return int64(len(this.rows))
+}
+
+func (this *Grid) Cols() int64 {
+	return this.cols
+}
+
+// Cardinality returns the number of bits set in the grid
+func (this *Grid) Cardinality() int64 {
+	n := int64(0)
+	for _, r := range this.rows {
+		if r != nil {
+			n += r.Cardinality()
+		}
+	}
+
+	return n
+}
+
+// Row returns the columns set in the row
+func (this *Grid) Row(row int64) *ewah.Ewah {
+	if row < 0 || row >= int64(len(this.rows)) || this.rows[row] == nil {
+		return ewah.NewEwah()
+	}
+
+	return this.rows[row].Clone().(*ewah.Ewah)
+}
+
+// Column returns the rows that have the column set
+func (this *Grid) Column(col int64) *ewah.Ewah {
+	c := ewah.NewEwah()
+
+	for r, row := range this.rows {
+		if row != nil && row.Get(col) {
+			c.Set(int64(r))
+		}
+	}
+
+	return c
+}
+
+// SliceRows returns a new grid with the rows from, from+1, ... to-1 of this one
+func (this *Grid) SliceRows(from, to int64) *Grid {
+	if from < 0 {
+		from = 0
+	}
+	if to > int64(len(this.rows)) {
+		to = int64(len(this.rows))
+	}
+
+	g := New(this.cols)
+
+	for r := from; r < to; r++ {
+		if this.rows[r] == nil {
+			g.rows = append(g.rows, nil)
+		} else {
+			g.rows = append(g.rows, this.rows[r].Clone().(*ewah.Ewah))
+		}
+	}
+
+	return g
+}
+
+// SliceColumns returns a new grid with the columns from, from+1, ... to-1 of this one, and all its rows
+func (this *Grid) SliceColumns(from, to int64) *Grid {
+	if from < 0 {
+		from = 0
+	}
+	if to > this.cols {
+		to = this.cols
+	}
+	if to < from {
+		to = from
+	}
+
+	g := New(to - from)
+	g.rows = make([]*ewah.Ewah, len(this.rows))
+
+	for r, row := range this.rows {
+		if row == nil {
+			continue
+		}
+
+		for it := row.Iterator(); it.HasNext(); {
+			c := it.Next()
+			if c >= to {
+				break
+			}
+			if c >= from {
+				g.Set(int64(r), c-from)
+			}
+		}
+	}
+
+	return g
+}
+
+// Transpose returns a new grid where the rows are the columns of this one
+func (this *Grid) Transpose() *Grid {
+	g := New(int64(len(this.rows)))
+	g.rows = make([]*ewah.Ewah, this.cols)
+
+	// Walking the rows in order sets the columns of the new grid in ascending order
+	for r, row := range this.rows {
+		if row == nil {
+			continue
+		}
+
+		for it := row.Iterator(); it.HasNext(); {
+			g.Set(it.Next(), int64(r))
+		}
+	}
+
+	return g
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package grid
+
+import (
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestGrid(t *testing.T) {
+	g, m := randomGrid(50, 300)
+
+	checkGrid(t, g, m, 0, 0)
+
+	if g.Set(0, 300) != nil || g.Set(-1, 0) != nil {
+		t.Fatal("Set should return nil out of range")
+	}
+
+	for r := int64(0); r < 50; r++ {
+		row := g.Row(r)
+		for c := int64(0); c < 300; c++ {
+			if row.Get(c) != m[r][c] {
+				t.Fatalf("Row(%d).Get(%d) = %v", r, c, row.Get(c))
+			}
+		}
+	}
+
+	for c := int64(0); c < 300; c++ {
+		col := g.Column(c)
+		for r := int64(0); r < 50; r++ {
+			if col.Get(r) != m[r][c] {
+				t.Fatalf("Column(%d).Get(%d) = %v", c, r, col.Get(r))
+			}
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	g, m := randomGrid(50, 300)
+
+	s := g.SliceRows(10, 30)
+	if s.Rows() != 20 || s.Cols() != 300 {
+		t.Fatalf("SliceRows is %dx%d", s.Rows(), s.Cols())
+	}
+	checkGrid(t, s, m[10:30], 0, 0)
+
+	s = g.SliceColumns(100, 250)
+	if s.Rows() != 50 || s.Cols() != 150 {
+		t.Fatalf("SliceColumns is %dx%d", s.Rows(), s.Cols())
+	}
+	checkGrid(t, s, m, 0, 100)
+}
+
+func TestTranspose(t *testing.T) {
+	g, m := randomGrid(50, 300)
+
+	tr := g.Transpose()
+	if tr.Rows() != 300 || tr.Cols() != 50 {
+		t.Fatalf("Transpose is %dx%d", tr.Rows(), tr.Cols())
+	}
+
+	for r := int64(0); r < 50; r++ {
+		for c := int64(0); c < 300; c++ {
+			if tr.Get(c, r) != m[r][c] {
+				t.Fatalf("Transpose().Get(%d, %d) = %v", c, r, tr.Get(c, r))
+			}
+		}
+	}
+
+	if tr.Cardinality() != g.Cardinality() {
+		t.Fatalf("Cardinality %d != %d", tr.Cardinality(), g.Cardinality())
+	}
+}
+
+// randomGrid returns a grid and the same bits as a matrix. Rows are filled in a random order.
+func randomGrid(rows, cols int64) (*Grid, [][]bool) {
+	rand.Seed(int64(c1))
+
+	g := New(cols)
+	m := make([][]bool, rows)
+
+	for _, r := range rand.Perm(int(rows)) {
+		m[r] = make([]bool, cols)
+		for c := int64(rand.Intn(20)); c < cols; c += int64(rand.Intn(20) + 1) {
+			g.Set(int64(r), c)
+			m[r][c] = true
+		}
+	}
+
+	return g, m
+}
+
+// checkGrid checks that g has the bits of m, starting at row r0 and column c0 of m
+func checkGrid(t *testing.T, g *Grid, m [][]bool, r0, c0 int64) {
+	n := int64(0)
+
+	for r := int64(0); r < g.Rows(); r++ {
+		for c := int64(0); c < g.Cols(); c++ {
+			if g.Get(r, c) != m[r0+r][c0+c] {
+				t.Fatalf("Get(%d, %d) = %v", r, c, g.Get(r, c))
+			}
+			if m[r0+r][c0+c] {
+				n++
+			}
+		}
+	}
+
+	if g.Cardinality() != n {
+		t.Fatalf("Cardinality %d != %d", g.Cardinality(), n)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package hll implements a HyperLogLog sketch over bit positions. It estimates how many distinct positions
+// were added, within a few percent, in a fixed and small size. Sketches merge without losing precision, so
+// the cardinality of the union of thousands of bitmaps can be estimated from their sketches, without ever
+// computing the union.
+package hll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// MinPrecision and MaxPrecision bound the precision of a sketch, which has 2^precision registers
+	MinPrecision = 4
+	MaxPrecision = 18
+
+	// DefaultPrecision gives a standard error of about 0.8%, for 16 KB
+	DefaultPrecision = 14
+)
+
+type Sketch struct {
+	p         uint8
+	registers []uint8
+}
+
+// New returns an empty sketch with 2^precision registers. The standard error of the estimate is about
+// 1.04 / sqrt(2^precision). Precisions out of [MinPrecision, MaxPrecision] are replaced by
+// DefaultPrecision.
+func New(precision int) *Sketch {
+	if precision < MinPrecision || precision > MaxPrecision {
+		precision = DefaultPrecision
+	}
+
+	return &Sketch{
+		p:         uint8(precision),
+		registers: make([]uint8, 1<<uint(precision)),
+	}
+}
+
+// Add adds the position to the sketch
+func (this *Sketch) Add(i int64) *Sketch {
+	h := mix(uint64(i))
+
+	// The first p bits pick the register, the others are where the leading zeros are counted
+	k := h >> (64 - this.p)
+	rank := uint8(bits.LeadingZeros64(h<<this.p|1<<(this.p-1))) + 1
+
+	if rank > this.registers[k] {
+		this.registers[k] = rank
+	}
+
+	return this
+}
+
+// Merge adds the positions of other to the sketch. Both must have the same precision.
+func (this *Sketch) Merge(other *Sketch) error {
+	if other.p != this.p {
+		return errors.New("hll/Merge: precisions are different")
+	}
+
+	for k, r := range other.registers {
+		if r > this.registers[k] {
+			this.registers[k] = r
+		}
+	}
+
+	return nil
+}
+
+// Count returns the estimated number of distinct positions added to the sketch
+func (this *Sketch) Count() int64 {
+	m := float64(len(this.registers))
+
+	sum, zeros := 0.0, 0
+	for _, r := range this.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(this.registers)) * m * m / sum
+
+	// Small cardinalities are better estimated by counting the empty registers (linear counting)
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return int64(estimate + 0.5)
+}
+
+// Precision returns the precision of the sketch
+func (this *Sketch) Precision() int {
+	return int(this.p)
+}
+
+// MarshalBinary encodes the sketch: the precision, then one byte per register
+func (this *Sketch) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 1+len(this.registers))
+
+	b[0] = this.p
+	copy(b[1:], this.registers)
+
+	return b, nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary. It replaces the content of the sketch.
+func (this *Sketch) UnmarshalBinary(b []byte) error {
+	if len(b) < 1 {
+		return errors.New("hll/UnmarshalBinary: buffer is too short")
+	}
+
+	p := b[0]
+	if p < MinPrecision || p > MaxPrecision || len(b)-1 != 1<<p {
+		return errors.New("hll/UnmarshalBinary: invalid precision")
+	}
+
+	for _, r := range b[1:] {
+		if r > 64-p+1 {
+			return errors.New("hll/UnmarshalBinary: invalid register")
+		}
+	}
+
+	this.p = p
+	this.registers = append([]uint8(nil), b[1:]...)
+
+	return nil
+}
+
+//
+// Not-exported functions
+//
+
+// alpha corrects the bias of the estimate for m registers
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// mix is the finalizer of splitmix64
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package hll
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestCount(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	for _, precision := range []int{10, 14} {
+		for _, n := range []int{0, 100, 10000, 1000000} {
+			s := New(precision)
+			first := rand.Int63()
+			for k := 0; k < n; k++ {
+				if k == 0 {
+					s.Add(first)
+				} else {
+					s.Add(rand.Int63())
+				}
+			}
+
+			count := s.Count()
+			if e := relativeError(count, int64(n)); e > 5*1.04/math.Sqrt(float64(int(1)<<uint(precision))) {
+				t.Fatalf("Precision %d: estimate %d for %d positions", precision, count, n)
+			}
+
+			// Adding the same position again changes nothing
+			if n > 0 && s.Add(first).Count() != count {
+				t.Fatalf("Precision %d: adding a position twice changed the estimate", precision)
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	// 100 sketches of 10000 positions each, half of them shared
+	all := New(DefaultPrecision)
+	for k := 0; k < 100; k++ {
+		s := New(DefaultPrecision)
+		for n := 0; n < 10000; n++ {
+			i := int64(k*5000 + n)
+			s.Add(i)
+		}
+
+		if err := all.Merge(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if e := relativeError(all.Count(), 99*5000+10000); e > 0.05 {
+		t.Fatalf("Estimate %d for %d positions", all.Count(), 99*5000+10000)
+	}
+
+	if err := all.Merge(New(10)); err == nil {
+		t.Fatal("Merge should fail with different precisions")
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	s := New(12)
+	for n := 0; n < 10000; n++ {
+		s.Add(rand.Int63())
+	}
+
+	b, _ := s.MarshalBinary()
+
+	r := New(4)
+	if err := r.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Precision() != 12 || r.Count() != s.Count() {
+		t.Fatal("UnmarshalBinary: the sketch is different")
+	}
+
+	if err := r.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Fatal("UnmarshalBinary should fail on a truncated buffer")
+	}
+}
+
+func relativeError(estimate, n int64) float64 {
+	if n == 0 {
+		return float64(estimate)
+	}
+
+	return math.Abs(float64(estimate-n)) / float64(n)
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package hybrid
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+)
+
+// Advice is the representation that would hold a bitmap in the least memory, with the estimated size in
+// bytes of each representation
+type Advice struct {
+	Kind Kind
+
+	SparseBytes     int64
+	CompressedBytes int64
+	DenseBytes      int64
+}
+
+// Advise compares the size of the bitmap as an array of positions, as EWAH and as a plain bitset, and
+// returns the smallest. When the sizes are the same, EWAH is preferred, then the array. The smallest is
+// usually the fastest too, since the operations are linear in the size of their operands.
+func Advise(e *ewah.Ewah) Advice {
+	a := Advice{
+		Kind:            Compressed,
+		SparseBytes:     8 * e.Cardinality(),
+		CompressedBytes: e.SizeInBytes(),
+		DenseBytes:      8 * ((e.Size() + 63) / 64),
+	}
+
+	if a.SparseBytes < a.CompressedBytes {
+		a.Kind = Sparse
+	}
+
+	if a.DenseBytes < a.CompressedBytes && a.DenseBytes < a.SparseBytes {
+		a.Kind = Dense
+	}
+
+	return a
+}
+
+// Convert returns the bitmap as a Hybrid bitmap using the advised representation. e is not modified.
+func (this Advice) Convert(e *ewah.Ewah) *Hybrid {
+	h := &Hybrid{
+		kind:       Compressed,
+		e:          e.Snapshot(),
+		maxSparse:  DefaultMaxSparse,
+		sizeInBits: e.Size(),
+	}
+
+	switch this.Kind {
+	case Sparse:
+		if n := e.Cardinality(); n > h.maxSparse {
+			h.maxSparse = n
+		}
+		h.toSparse()
+	case Dense:
+		h.toDense()
+	}
+
+	return h
+}
@@ -0,0 +1,488 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package hybrid implements a bitmap that picks its own representation depending on the data. It starts
+// as a sorted array of positions, which is the smallest for a handful of bits, switches to EWAH once it
+// holds more than a few bits, and switches again to a plain bitset when the data is so dense that EWAH
+// doesn't save any memory anymore.
+package hybrid
+
+import (
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitset"
+	"github.com/reducedb/bitmap/ewah"
+	"math"
+	"sort"
+)
+
+// Kind is the representation currently used by a Hybrid bitmap
+type Kind int
+
+const (
+	Sparse Kind = iota
+	Compressed
+	Dense
+)
+
+func (this Kind) String() string {
+	switch this {
+	case Sparse:
+		return "sparse"
+	case Compressed:
+		return "compressed"
+	case Dense:
+		return "dense"
+	}
+
+	return "unknown"
+}
+
+const (
+	// DefaultMaxSparse is the default number of bits a bitmap holds as an array of positions before
+	// switching to EWAH
+	DefaultMaxSparse int64 = 1024
+
+	// maxPosition is the largest position EWAH supports
+	maxPosition int64 = math.MaxInt32 - 64
+)
+
+type Hybrid struct {
+	kind Kind
+
+	// Only one of these is used at a time, depending on kind
+	sparse []int64
+	e      *ewah.Ewah
+	b      *bitset.Bitset
+
+	// maxSparse is the number of bits above which the sparse array is converted to EWAH
+	maxSparse int64
+
+	// sizeInBits is the number of total bits in the bitmap. The underlying representation may be
+	// smaller, if the bitmap ends with 0's.
+	sizeInBits int64
+}
+
+var _ bitmap.Bitmap = (*Hybrid)(nil)
+
+func init() {
+	bitmap.Register("hybrid", New)
+}
+
+func New() bitmap.Bitmap {
+	return NewWithMaxSparse(DefaultMaxSparse)
+}
+
+// NewWithMaxSparse returns a bitmap that switches from an array of positions to EWAH once it holds more
+// than maxSparse bits.
+func NewWithMaxSparse(maxSparse int64) bitmap.Bitmap {
+	return &Hybrid{
+		kind:      Sparse,
+		maxSparse: maxSparse,
+	}
+}
+
+// Kind returns the representation currently used by the bitmap
+func (this *Hybrid) Kind() Kind {
+	return this.kind
+}
+
+// Set sets the bit at position i to true (1). The bits must be set in ascending order. For example, set(15)
+// then set(7) will fail. Like EWAH, positions go up to math.MaxInt32 - 64.
+func (this *Hybrid) Set(i int64) bitmap.Bitmap {
+	if i < this.sizeInBits || i < 0 || i > maxPosition {
+		return nil
+	}
+
+	switch this.kind {
+	case Sparse:
+		this.sparse = append(this.sparse, i)
+		if int64(len(this.sparse)) > this.maxSparse {
+			this.toCompressed()
+		}
+	case Compressed:
+		this.e.Set(i)
+		if this.e.SizeInWords() >= this.denseWords(i+1) {
+			this.toDense()
+		}
+	case Dense:
+		this.b.Set(i)
+	}
+
+	this.sizeInBits = i + 1
+
+	return this
+}
+
+func (this *Hybrid) Get(i int64) bool {
+	if i < 0 || i >= this.sizeInBits {
+		return false
+	}
+
+	switch this.kind {
+	case Sparse:
+		k := sort.Search(len(this.sparse), func(k int) bool { return this.sparse[k] >= i })
+		return k < len(this.sparse) && this.sparse[k] == i
+	case Compressed:
+		return this.e.Get(i)
+	}
+
+	return this.b.Get(i)
+}
+
+// Size returns the size in bits of the *uncompressed* bitmap represented by this bitmap.
+func (this *Hybrid) Size() int64 {
+	return this.sizeInBits
+}
+
+func (this *Hybrid) Reset() {
+	this.kind = Sparse
+	this.sparse = this.sparse[:0]
+	this.e = nil
+	this.b = nil
+	this.sizeInBits = 0
+}
+
+func (this *Hybrid) Swap(other *Hybrid) bitmap.Bitmap {
+	*this, *other = *other, *this
+
+	return this
+}
+
+func (this *Hybrid) Clone() bitmap.Bitmap {
+	c := *this
+
+	switch this.kind {
+	case Sparse:
+		c.sparse = make([]int64, len(this.sparse))
+		copy(c.sparse, this.sparse)
+	case Compressed:
+		c.e = this.e.Clone().(*ewah.Ewah)
+	case Dense:
+		c.b = this.b.Clone().(*bitset.Bitset)
+	}
+
+	return &c
+}
+
+func (this *Hybrid) Copy(other bitmap.Bitmap) bitmap.Bitmap {
+	o, ok := other.(*Hybrid)
+	if !ok {
+		return nil
+	}
+
+	*this = *o.Clone().(*Hybrid)
+
+	return this
+}
+
+// Equal returns true if both bitmaps have the same size and the same bits set, whatever their
+// representation.
+func (this *Hybrid) Equal(other bitmap.Bitmap) bool {
+	o, ok := other.(*Hybrid)
+	if !ok || o == nil {
+		return false
+	}
+
+	if this.sizeInBits != o.sizeInBits || this.Cardinality() != o.Cardinality() {
+		return false
+	}
+
+	n1, n2 := this.iterator(), o.iterator()
+	for i := n1(); i >= 0; i = n1() {
+		if n2() != i {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (this *Hybrid) Cardinality() int64 {
+	switch this.kind {
+	case Sparse:
+		return int64(len(this.sparse))
+	case Compressed:
+		return this.e.Cardinality()
+	}
+
+	return this.b.Cardinality()
+}
+
+func (this *Hybrid) And(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return orNil(this.AndChecked(a...))
+}
+
+func (this *Hybrid) Or(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return orNil(this.OrChecked(a...))
+}
+
+func (this *Hybrid) AndNot(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return orNil(this.AndNotChecked(a...))
+}
+
+func (this *Hybrid) Xor(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return orNil(this.XorChecked(a...))
+}
+
+// AndChecked is the same as And, but it reports why the operation failed: an operand that's not a Hybrid,
+// or an EWAH result over the budget set with ewah.SetMaxResultWords, which matches ewah.ErrResultTooLarge.
+func (this *Hybrid) AndChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.fold("AndChecked", a, func(x, y bool) bool { return x && y }, (*ewah.Ewah).AndChecked, (*bitset.Bitset).And)
+}
+
+// OrChecked is the same as Or, but it reports why the operation failed, like AndChecked
+func (this *Hybrid) OrChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.fold("OrChecked", a, func(x, y bool) bool { return x || y }, (*ewah.Ewah).OrChecked, (*bitset.Bitset).Or)
+}
+
+// AndNotChecked is the same as AndNot, but it reports why the operation failed, like AndChecked
+func (this *Hybrid) AndNotChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.fold("AndNotChecked", a, func(x, y bool) bool { return x && !y }, (*ewah.Ewah).AndNotChecked, (*bitset.Bitset).AndNot)
+}
+
+// XorChecked is the same as Xor, but it reports why the operation failed, like AndChecked
+func (this *Hybrid) XorChecked(a ...bitmap.Bitmap) (bitmap.Bitmap, error) {
+	return this.fold("XorChecked", a, func(x, y bool) bool { return x != y }, (*ewah.Ewah).XorChecked, (*bitset.Bitset).Xor)
+}
+
+// Not negates all the bits of the bitmap, up to Size(), in place. The result is usually dense, so it is
+// computed with EWAH, then stored with whatever representation suits it. It returns nil, leaving the bitmap
+// untouched, if the operation fails.
+func (this *Hybrid) Not() bitmap.Bitmap {
+	return orNil(this.NotChecked())
+}
+
+// NotChecked is the same as Not, but it returns an error matching ewah.ErrResultTooLarge, leaving the
+// bitmap untouched, if the EWAH result is over the budget set with ewah.SetMaxResultWords.
+func (this *Hybrid) NotChecked() (bitmap.Bitmap, error) {
+	if this.sizeInBits == 0 {
+		return this, nil
+	}
+
+	// The EWAH bitmap may be shorter than the hybrid one, so we can't just negate it
+	ones := ewah.NewEwah()
+	ones.SetRange(0, this.sizeInBits)
+
+	bm, err := ones.AndNotChecked(this.toEwah())
+	if err != nil {
+		return nil, err
+	}
+
+	*this = *this.result(Compressed, bm, this.sizeInBits)
+
+	return this, nil
+}
+
+//
+// Not-exported functions
+//
+
+// denseWords returns the number of words a bitset of size bits would use
+func (this *Hybrid) denseWords(size int64) int64 {
+	return (size + 63) / 64
+}
+
+func (this *Hybrid) toCompressed() {
+	this.e = this.toEwah()
+	this.sparse = nil
+	this.kind = Compressed
+}
+
+func (this *Hybrid) toDense() {
+	this.b = this.toBitset()
+	this.e = nil
+	this.sparse = nil
+	this.kind = Dense
+}
+
+func (this *Hybrid) toSparse() {
+	sparse := make([]int64, 0, this.Cardinality())
+
+	next := this.iterator()
+	for i := next(); i >= 0; i = next() {
+		sparse = append(sparse, i)
+	}
+
+	this.sparse = sparse
+	this.e = nil
+	this.b = nil
+	this.kind = Sparse
+}
+
+// toEwah returns the bitmap as EWAH. It is not a copy if it is already compressed.
+func (this *Hybrid) toEwah() *ewah.Ewah {
+	if this.kind == Compressed {
+		return this.e
+	}
+
+	e := ewah.NewEwah()
+
+	next := this.iterator()
+	for i := next(); i >= 0; i = next() {
+		e.Set(i)
+	}
+
+	return e
+}
+
+// toBitset returns the bitmap as a bitset. It is not a copy if it is already dense.
+func (this *Hybrid) toBitset() *bitset.Bitset {
+	if this.kind == Dense {
+		return this.b
+	}
+
+	b := bitset.New().(*bitset.Bitset)
+
+	next := this.iterator()
+	for i := next(); i >= 0; i = next() {
+		b.Set(i)
+	}
+
+	return b
+}
+
+// iterator returns a function that returns the positions of the bits set to 1 one after the other, then -1
+func (this *Hybrid) iterator() func() int64 {
+	switch this.kind {
+	case Sparse:
+		k := 0
+		return func() int64 {
+			if k >= len(this.sparse) {
+				return -1
+			}
+			k++
+			return this.sparse[k-1]
+		}
+	case Compressed:
+		return this.e.Iterator().Next
+	}
+
+	i := int64(0)
+	return func() int64 {
+		for ; i < this.b.Size(); i++ {
+			if this.b.Get(i) {
+				i++
+				return i - 1
+			}
+		}
+		return -1
+	}
+}
+
+// result wraps the result of an operation done with the given representation, then switches to the
+// representation that best suits it
+func (this *Hybrid) result(kind Kind, bm bitmap.Bitmap, size int64) *Hybrid {
+	ans := &Hybrid{
+		kind:       kind,
+		maxSparse:  this.maxSparse,
+		sizeInBits: size,
+	}
+
+	switch kind {
+	case Compressed:
+		ans.e = bm.(*ewah.Ewah)
+	case Dense:
+		ans.b = bm.(*bitset.Bitset)
+	}
+
+	if ans.Cardinality() <= ans.maxSparse {
+		ans.toSparse()
+	} else if kind == Compressed && ans.e.SizeInWords() >= ans.denseWords(ans.sizeInBits) {
+		ans.toDense()
+	}
+
+	return ans
+}
+
+// fold applies the operation to this bitmap and each of the bitmaps in a, from left to right. Two sparse
+// bitmaps are merged directly with f. Otherwise both are converted to the densest of their representations
+// and combined with the matching EWAH or bitset operation. fn is the name of the function for the errors.
+func (this *Hybrid) fold(fn string, a []bitmap.Bitmap, f func(x, y bool) bool,
+	fe func(*ewah.Ewah, ...bitmap.Bitmap) (bitmap.Bitmap, error),
+	fb func(*bitset.Bitset, ...bitmap.Bitmap) bitmap.Bitmap) (bitmap.Bitmap, error) {
+
+	ans := this
+
+	for _, v := range a {
+		b, ok := v.(*Hybrid)
+		if !ok {
+			return nil, fmt.Errorf("hybrid/%s: operand of type %T is not a Hybrid", fn, v)
+		}
+
+		size := ans.sizeInBits
+		if b.sizeInBits > size {
+			size = b.sizeInBits
+		}
+
+		switch {
+		case ans.kind == Sparse && b.kind == Sparse:
+			ans = &Hybrid{
+				kind:       Sparse,
+				sparse:     combine(ans.sparse, b.sparse, f),
+				maxSparse:  this.maxSparse,
+				sizeInBits: size,
+			}
+			if int64(len(ans.sparse)) > ans.maxSparse {
+				ans.toCompressed()
+			}
+		case ans.kind == Dense || b.kind == Dense:
+			ans = this.result(Dense, fb(ans.toBitset(), b.toBitset()), size)
+		default:
+			e, err := fe(ans.toEwah(), b.toEwah())
+			if err != nil {
+				return nil, fmt.Errorf("hybrid/%s: %w", fn, err)
+			}
+			ans = this.result(Compressed, e, size)
+		}
+	}
+
+	if ans == this {
+		return this.Clone(), nil
+	}
+
+	return ans, nil
+}
+
+// orNil returns the result of a checked operation, or nil if it failed
+func orNil(bm bitmap.Bitmap, err error) bitmap.Bitmap {
+	if err != nil {
+		return nil
+	}
+
+	return bm
+}
+
+// combine merges two sorted arrays of positions, keeping the positions for which f is true. f(false, false)
+// must be false.
+func combine(a, b []int64, f func(x, y bool) bool) []int64 {
+	ans := make([]int64, 0, len(a)+len(b))
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var pos int64
+		var x, y bool
+
+		switch {
+		case j >= len(b) || (i < len(a) && a[i] < b[j]):
+			pos, x = a[i], true
+			i++
+		case i >= len(a) || b[j] < a[i]:
+			pos, y = b[j], true
+			j++
+		default:
+			pos, x, y = a[i], true, true
+			i++
+			j++
+		}
+
+		if f(x, y) {
+			ans = append(ans, pos)
+		}
+	}
+
+	return ans
+}
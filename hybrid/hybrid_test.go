@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package hybrid
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitmaptest"
+	"github.com/reducedb/bitmap/bitset"
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestKind(t *testing.T) {
+	bm := New().(*Hybrid)
+
+	// One bit out of two, EWAH can't compress that
+	bit := int64(0)
+	for i := int64(0); i < DefaultMaxSparse; i++ {
+		bit += 2
+		bm.Set(bit)
+	}
+
+	if bm.Kind() != Sparse {
+		t.Fatalf("Kind is %s, should be sparse", bm.Kind())
+	}
+
+	bit += 2
+	if bm.Set(bit); bm.Kind() != Compressed {
+		t.Fatalf("Kind is %s, should be compressed", bm.Kind())
+	}
+
+	for i := 0; i < 1000 && bm.Kind() == Compressed; i++ {
+		bit += 2
+		bm.Set(bit)
+	}
+
+	if bm.Kind() != Dense {
+		t.Fatalf("Kind is %s, should be dense", bm.Kind())
+	}
+
+	if bm.Set(bit) != nil {
+		t.Fatal("Setting bits out of order should fail")
+	}
+
+	if bm.And(New()).(*Hybrid).Kind() != Sparse {
+		t.Fatal("An empty result should be sparse")
+	}
+}
+
+func TestAdvise(t *testing.T) {
+	sparse, compressed, dense := ewah.NewEwah(), ewah.NewEwah(), ewah.NewEwah()
+	for i := int64(0); i < 100000; i++ {
+		if i%10000 == 0 {
+			sparse.Set(i)
+		}
+		if i < 50000 {
+			compressed.Set(i)
+		}
+		if i%2 == 0 {
+			dense.Set(i)
+		}
+	}
+
+	for _, c := range []struct {
+		e    *ewah.Ewah
+		kind Kind
+	}{{sparse, Sparse}, {compressed, Compressed}, {dense, Dense}} {
+		a := Advise(c.e)
+		if a.Kind != c.kind {
+			t.Fatalf("Advised %s, should be %s: %+v", a.Kind, c.kind, a)
+		}
+
+		h := a.Convert(c.e)
+		if h.Kind() != c.kind || h.Size() != c.e.Size() || h.Cardinality() != c.e.Cardinality() {
+			t.Fatalf("Convert to %s: kind %s, size %d, cardinality %d", c.kind, h.Kind(), h.Size(), h.Cardinality())
+		}
+
+		for it := c.e.Iterator(); it.HasNext(); {
+			if i := it.Next(); !h.Get(i) {
+				t.Fatalf("Convert to %s: Get(%d) failed, should be set", c.kind, i)
+			}
+		}
+	}
+}
+
+func TestMaxResultWords(t *testing.T) {
+	// Compressed bitmaps, so the operations are done with EWAH
+	h1, h2 := NewWithMaxSparse(10).(*Hybrid), NewWithMaxSparse(10).(*Hybrid)
+	for i := int64(0); i < 1000000; i += 1000 {
+		h1.Set(i)
+		h2.Set(i + 500)
+	}
+	if h1.Kind() != Compressed || h2.Kind() != Compressed {
+		t.Fatalf("Kinds are %s and %s, should be compressed", h1.Kind(), h2.Kind())
+	}
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if _, err := h1.OrChecked(h2); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Fatalf("OrChecked over the budget: %v", err)
+	}
+	if h1.Or(h2) != nil {
+		t.Fatal("Or over the budget should return nil")
+	}
+	if _, err := h1.AndChecked(ewah.NewEwah()); err == nil {
+		t.Fatal("AndChecked of an Ewah should fail")
+	}
+}
+
+func TestCrossCheckBitset(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 3, 10, 100, 1000}
+	bitmaptest.CrossCheck(t, 100, func() (bitmap.Bitmap, *bitset.Bitset) {
+		return crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+	})
+}
+
+// crossCheckBitmaps returns the same random bitmap as a Hybrid and as a Bitset, with a number of bits
+// ranging from a few to a few thousands so we get all the representations.
+func crossCheckBitmaps(gap int) (bitmap.Bitmap, *bitset.Bitset) {
+	return bitmaptest.Bits(func() bitmap.Bitmap { return NewWithMaxSparse(100) }, 3000, gap, 0)
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Column returns the values of a column of a table, one row at a time, like the column readers of Parquet
+// or ORC files. Next returns a nil value for a row without value, and io.EOF after the last row.
+type Column interface {
+	Next() (interface{}, error)
+}
+
+// ColumnFunc is a function used as a Column
+type ColumnFunc func() (interface{}, error)
+
+var _ Column = ColumnFunc(nil)
+
+func (this ColumnFunc) Next() (interface{}, error) {
+	return this()
+}
+
+// FromColumn returns the bitmap index of a column: the rows are the documents, numbered from 0, and the term
+// of each row is the key bucket returns for its value. With a nil bucket, each distinct value is a term,
+// formatted with fmt.Sprint. Rows without value, or for which bucket returns "", are documents without any
+// term, so they're in Docs, and match Not queries. It returns the first error of the column, other than
+// io.EOF.
+func FromColumn(c Column, bucket func(v interface{}) string) (*Index, error) {
+	idx := New()
+
+	for row := int64(0); ; row++ {
+		v, err := c.Next()
+		if err == io.EOF {
+			return idx, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var terms []string
+		if v != nil {
+			t := fmt.Sprint(v)
+			if bucket != nil {
+				t = bucket(v)
+			}
+			if t != "" {
+				terms = append(terms, t)
+			}
+		}
+
+		if idx.Add(row, terms...) == nil {
+			return nil, errors.New("index/FromColumn: too many rows")
+		}
+	}
+}
+
+// Buckets returns a bucket function for FromColumn that puts numbers in ranges between the bounds, which
+// must be sorted in ascending order. The keys are "<b0" for numbers below the first bound, "[b0,b1)" for
+// numbers from b0 to b1, and so on, and ">=bn" for numbers at or above the last bound. Values that are not
+// numbers have no bucket.
+func Buckets(bounds ...float64) func(v interface{}) string {
+	keys := make([]string, len(bounds)+1)
+	for k := range keys {
+		switch {
+		case len(bounds) == 0:
+			keys[k] = "all"
+		case k == 0:
+			keys[k] = "<" + formatBound(bounds[0])
+		case k == len(bounds):
+			keys[k] = ">=" + formatBound(bounds[k-1])
+		default:
+			keys[k] = "[" + formatBound(bounds[k-1]) + "," + formatBound(bounds[k]) + ")"
+		}
+	}
+
+	return func(v interface{}) string {
+		x, ok := toFloat(v)
+		if !ok || x != x {
+			return ""
+		}
+
+		// The bucket is the number of bounds at or below x
+		return keys[sort.Search(len(bounds), func(k int) bool { return bounds[k] > x })]
+	}
+}
+
+//
+// Not-exported functions
+//
+
+func formatBound(b float64) string {
+	return strconv.FormatFloat(b, 'g', -1, 64)
+}
+
+// toFloat converts a number of any of the builtin types to a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+
+	return 0, false
+}
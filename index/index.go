@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package index implements a small inverted index: each term maps to the EWAH bitmap of the documents that
+// contain it, and queries combine these posting bitmaps with AND, OR and NOT. With the rows of a table as
+// documents, and the values of a column as terms, it's the bitmap index of the column, which FromColumn
+// builds.
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"sort"
+)
+
+type Index struct {
+	// postings maps each term to the documents that contain it
+	postings map[string]*ewah.Ewah
+
+	// docs has a bit set for every document added, it's what NOT queries are relative to
+	docs *ewah.Ewah
+}
+
+func New() *Index {
+	return &Index{
+		postings: make(map[string]*ewah.Ewah),
+		docs:     ewah.NewEwah(),
+	}
+}
+
+// Add adds a document and the terms it contains. Like the bits of a bitmap, the documents must be added in
+// ascending order of their IDs. It returns nil if the document is out of order or out of range.
+func (this *Index) Add(doc int64, terms ...string) *Index {
+	if this.docs.Set(doc) == nil {
+		return nil
+	}
+
+	for _, t := range terms {
+		p, ok := this.postings[t]
+		if !ok {
+			p = ewah.NewEwah()
+			this.postings[t] = p
+		}
+
+		// The same term may appear twice for a document, which Set rejects, but that's fine
+		p.Set(doc)
+	}
+
+	return this
+}
+
+// Get returns the documents that contain the term. The bitmap belongs to the index and must not be modified.
+func (this *Index) Get(term string) *ewah.Ewah {
+	if p, ok := this.postings[term]; ok {
+		return p
+	}
+
+	return ewah.NewEwah()
+}
+
+// Docs returns all the documents added. The bitmap belongs to the index and must not be modified.
+func (this *Index) Docs() *ewah.Ewah {
+	return this.docs
+}
+
+// Terms returns all the terms of the index, sorted
+func (this *Index) Terms() []string {
+	terms := make([]string, 0, len(this.postings))
+	for t := range this.postings {
+		terms = append(terms, t)
+	}
+
+	sort.Strings(terms)
+
+	return terms
+}
+
+// Query returns the documents that match the query. An operation whose result would exceed the budget set
+// with ewah.SetMaxResultWords returns an error matching ewah.ErrResultTooLarge.
+func (this *Index) Query(q Query) (*ewah.Ewah, error) {
+	return q.eval(this)
+}
+
+// Query is a boolean combination of terms, built with Term, And, Or and Not
+type Query interface {
+	eval(*Index) (*ewah.Ewah, error)
+}
+
+type termQuery string
+
+type andQuery []Query
+
+type orQuery []Query
+
+type notQuery struct {
+	q Query
+}
+
+// Term matches the documents that contain the term
+func Term(t string) Query {
+	return termQuery(t)
+}
+
+// And matches the documents that match all the queries
+func And(q ...Query) Query {
+	return andQuery(q)
+}
+
+// Or matches the documents that match any of the queries
+func Or(q ...Query) Query {
+	return orQuery(q)
+}
+
+// Not matches the documents that don't match the query
+func Not(q Query) Query {
+	return notQuery{q}
+}
+
+func (this termQuery) eval(idx *Index) (*ewah.Ewah, error) {
+	return idx.Get(string(this)), nil
+}
+
+func (this andQuery) eval(idx *Index) (*ewah.Ewah, error) {
+	if len(this) == 0 {
+		return idx.docs, nil
+	}
+
+	return combine(idx, this, (*ewah.Ewah).AndChecked)
+}
+
+func (this orQuery) eval(idx *Index) (*ewah.Ewah, error) {
+	if len(this) == 0 {
+		return ewah.NewEwah(), nil
+	}
+
+	return combine(idx, this, (*ewah.Ewah).OrChecked)
+}
+
+func (this notQuery) eval(idx *Index) (*ewah.Ewah, error) {
+	e, err := this.q.eval(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	return result(idx.docs.AndNotChecked(e))
+}
+
+// combine evaluates the queries and folds the results with op
+func combine(idx *Index, q []Query, op func(*ewah.Ewah, ...bitmap.Bitmap) (bitmap.Bitmap, error)) (*ewah.Ewah, error) {
+	first, err := q[0].eval(idx)
+	if err != nil || len(q) == 1 {
+		return first, err
+	}
+
+	operands := make([]bitmap.Bitmap, len(q)-1)
+	for i, v := range q[1:] {
+		e, err := v.eval(idx)
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = e
+	}
+
+	return result(op(first, operands...))
+}
+
+// result returns the result of a checked operation as an Ewah
+func result(b bitmap.Bitmap, err error) (*ewah.Ewah, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return b.(*ewah.Ewah), nil
+}
+
+// MarshalBinary encodes the whole index. The bitmaps are encoded with ewah's MarshalBinary, and the terms
+// are sorted so the same index always gives the same bytes.
+//
+//	docs bitmap | number of terms | for each term: term, bitmap
+//
+// where the number of terms is a uvarint, and terms and bitmaps are prefixed with their length as a uvarint.
+func (this *Index) MarshalBinary() ([]byte, error) {
+	var b []byte
+
+	put := func(v []byte) {
+		b = binary.AppendUvarint(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+
+	docs, err := this.docs.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	put(docs)
+
+	terms := this.Terms()
+	b = binary.AppendUvarint(b, uint64(len(terms)))
+
+	for _, t := range terms {
+		p, err := this.postings[t].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+
+		put([]byte(t))
+		put(p)
+	}
+
+	return b, nil
+}
+
+// UnmarshalBinary decodes an index encoded by MarshalBinary. It replaces the content of the index.
+func (this *Index) UnmarshalBinary(b []byte) error {
+	errCorrupt := errors.New("index/UnmarshalBinary: invalid or truncated data")
+
+	get := func() []byte {
+		n, k := binary.Uvarint(b)
+		if k <= 0 || n > uint64(len(b)-k) {
+			return nil
+		}
+
+		v := b[k : k+int(n)]
+		b = b[k+int(n):]
+		return v
+	}
+
+	docs := ewah.NewEwah()
+	if err := docs.UnmarshalBinary(get()); err != nil {
+		return err
+	}
+
+	count, k := binary.Uvarint(b)
+	if k <= 0 {
+		return errCorrupt
+	}
+	b = b[k:]
+
+	postings := make(map[string]*ewah.Ewah)
+	for i := uint64(0); i < count; i++ {
+		t := get()
+		if t == nil {
+			return errCorrupt
+		}
+
+		p := ewah.NewEwah()
+		if err := p.UnmarshalBinary(get()); err != nil {
+			return err
+		}
+
+		postings[string(t)] = p
+	}
+
+	if len(b) != 0 {
+		return errCorrupt
+	}
+
+	this.docs = docs
+	this.postings = postings
+
+	return nil
+}
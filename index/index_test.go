@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/reducedb/bitmap/ewah"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+var terms = []string{"red", "green", "blue", "cyan", "magenta", "yellow", "black"}
+
+func TestQuery(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	idx, docs := randomIndex(2000)
+
+	has := func(doc int64, term string) bool {
+		for _, v := range docs[doc] {
+			if v == term {
+				return true
+			}
+		}
+		return false
+	}
+
+	queries := []struct {
+		q     Query
+		match func(doc int64) bool
+	}{
+		{Term("red"), func(d int64) bool { return has(d, "red") }},
+		{Term("white"), func(d int64) bool { return false }},
+		{And(Term("red"), Term("blue")), func(d int64) bool { return has(d, "red") && has(d, "blue") }},
+		{Or(Term("red"), Term("blue"), Term("cyan")), func(d int64) bool { return has(d, "red") || has(d, "blue") || has(d, "cyan") }},
+		{Not(Term("black")), func(d int64) bool { return !has(d, "black") }},
+		{And(Or(Term("red"), Term("green")), Not(Term("yellow"))), func(d int64) bool {
+			return (has(d, "red") || has(d, "green")) && !has(d, "yellow")
+		}},
+		{And(), func(d int64) bool { return true }},
+		{Or(), func(d int64) bool { return false }},
+	}
+
+	for i, q := range queries {
+		r, err := idx.Query(q.q)
+		if err != nil {
+			t.Fatalf("Query %d: %v", i, err)
+		}
+
+		n := int64(0)
+		for doc := range docs {
+			if r.Get(doc) != q.match(doc) {
+				t.Fatalf("Query %d: document %d should match = %t", i, doc, q.match(doc))
+			}
+			if q.match(doc) {
+				n++
+			}
+		}
+
+		if r.Cardinality() != n {
+			t.Fatalf("Query %d: %d documents match, should be %d", i, r.Cardinality(), n)
+		}
+	}
+
+	if idx.Add(0, "red") != nil {
+		t.Fatal("Adding documents out of order should fail")
+	}
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if _, err := idx.Query(And(Term("red"), Or(Term("green"), Term("blue")))); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Fatalf("Query over the budget: %v", err)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	idx, _ := randomIndex(1000)
+
+	b, err := idx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := New()
+	if err := d.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !d.Docs().Equal(idx.Docs()) || len(d.Terms()) != len(idx.Terms()) {
+		t.Fatal("UnmarshalBinary should give back the same documents and terms")
+	}
+
+	for _, term := range idx.Terms() {
+		if !d.Get(term).Equal(idx.Get(term)) {
+			t.Fatalf("Postings of %q are different", term)
+		}
+	}
+
+	if d.UnmarshalBinary(b[:len(b)-1]) == nil || d.UnmarshalBinary(append(b, 0)) == nil {
+		t.Fatal("UnmarshalBinary should fail on corrupted data")
+	}
+}
+
+func TestFromColumn(t *testing.T) {
+	values := []interface{}{"red", nil, "blue", "red", 7, "blue", nil, "red"}
+	k := 0
+	column := ColumnFunc(func() (interface{}, error) {
+		if k == len(values) {
+			return nil, io.EOF
+		}
+		k++
+		return values[k-1], nil
+	})
+
+	idx, err := FromColumn(column, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if idx.Docs().Cardinality() != int64(len(values)) || strings.Join(idx.Terms(), ",") != "7,blue,red" {
+		t.Fatalf("unexpected index: %d rows, terms %v", idx.Docs().Cardinality(), idx.Terms())
+	}
+
+	for term, rows := range map[string][]int64{"red": {0, 3, 7}, "blue": {2, 5}, "7": {4}} {
+		var got []int64
+		for it := idx.Get(term).Iterator(); it.HasNext(); {
+			got = append(got, it.Next())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(rows) {
+			t.Errorf("%s: rows %v, should be %v", term, got, rows)
+		}
+	}
+
+	// The rows without value match the NOT queries
+	if r, err := idx.Query(Not(Or(Term("red"), Term("blue"), Term("7")))); err != nil || r.Cardinality() != 2 || !r.Get(1) || !r.Get(6) {
+		t.Fatal("rows without value should only match NOT queries")
+	}
+
+	fail := errors.New("read failed")
+	if _, err := FromColumn(ColumnFunc(func() (interface{}, error) { return nil, fail }), nil); err != fail {
+		t.Fatalf("expected the error of the column, got %v", err)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	bucket := Buckets(0, 10, 100)
+	for _, c := range []struct {
+		v    interface{}
+		want string
+	}{
+		{-1, "<0"},
+		{int8(0), "[0,10)"},
+		{9.5, "[0,10)"},
+		{uint64(10), "[10,100)"},
+		{float32(100), ">=100"},
+		{1e9, ">=100"},
+		{"10", ""},
+		{math.NaN(), ""},
+	} {
+		if got := bucket(c.v); got != c.want {
+			t.Errorf("bucket(%v) = %q, should be %q", c.v, got, c.want)
+		}
+	}
+
+	rand.Seed(int64(c1))
+
+	ages := make([]int, 1000)
+	for k := range ages {
+		ages[k] = rand.Intn(90)
+	}
+
+	k := 0
+	idx, err := FromColumn(ColumnFunc(func() (interface{}, error) {
+		if k == len(ages) {
+			return nil, io.EOF
+		}
+		k++
+		return ages[k-1], nil
+	}), Buckets(18, 65))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for row, age := range ages {
+		key := "[18,65)"
+		if age < 18 {
+			key = "<18"
+		} else if age >= 65 {
+			key = ">=65"
+		}
+		if !idx.Get(key).Get(int64(row)) {
+			t.Fatalf("row %d, of age %d, should be in %s", row, age, key)
+		}
+	}
+}
+
+// randomIndex returns an index of n documents with random terms, and the terms of each document
+func randomIndex(n int) (*Index, map[int64][]string) {
+	idx := New()
+	docs := make(map[int64][]string)
+
+	doc := int64(0)
+	for i := 0; i < n; i++ {
+		doc += int64(rand.Intn(3) + 1)
+
+		var dt []string
+		for _, term := range terms {
+			if rand.Intn(3) == 0 {
+				dt = append(dt, term)
+			}
+		}
+
+		idx.Add(doc, dt...)
+		docs[doc] = dt
+	}
+
+	return idx, docs
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package intervals implements the bitmap interface as a sorted list of [start, end) ranges of bits set
+// to 1. It is ideal for data that is naturally made of ranges, such as blocks of IDs or time windows,
+// where a single interval stands for any number of consecutive bits.
+package intervals
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"math"
+	"sort"
+)
+
+// Interval is a range of bits set to 1, from Start (inclusive) to End (exclusive)
+type Interval struct {
+	Start, End int64
+}
+
+type Intervals struct {
+	// runs are sorted, and never overlap nor touch each other
+	runs []Interval
+
+	// sizeInBits is the number of total bits in the bitmap
+	sizeInBits int64
+}
+
+var _ bitmap.Bitmap = (*Intervals)(nil)
+
+func init() {
+	bitmap.Register("intervals", New)
+}
+
+func New() bitmap.Bitmap {
+	return new(Intervals)
+}
+
+// Set sets the bit at position i to true (1). The bits must be set in ascending order. For example, set(15)
+// then set(7) will fail.
+func (this *Intervals) Set(i int64) bitmap.Bitmap {
+	return this.SetRange(i, i+1)
+}
+
+// SetRange sets all the bits from start (inclusive) to end (exclusive) to true (1). Like Set, the range must
+// start after the last bit set.
+func (this *Intervals) SetRange(start, end int64) bitmap.Bitmap {
+	if start < 0 || end <= start || start < this.sizeInBits {
+		return nil
+	}
+
+	if l := len(this.runs) - 1; l >= 0 && this.runs[l].End == start {
+		this.runs[l].End = end
+	} else {
+		this.runs = append(this.runs, Interval{start, end})
+	}
+
+	this.sizeInBits = end
+
+	return this
+}
+
+func (this *Intervals) Get(i int64) bool {
+	if i < 0 || i >= this.sizeInBits {
+		return false
+	}
+
+	// Find the first interval ending after i, i is set if that interval starts at or before i
+	k := sort.Search(len(this.runs), func(k int) bool { return this.runs[k].End > i })
+
+	return k < len(this.runs) && this.runs[k].Start <= i
+}
+
+// Size returns the size in bits of the *uncompressed* bitmap represented by this bitmap.
+func (this *Intervals) Size() int64 {
+	return this.sizeInBits
+}
+
+// Intervals returns a copy of the ranges of bits set to 1, in ascending order.
+func (this *Intervals) Intervals() []Interval {
+	runs := make([]Interval, len(this.runs))
+	copy(runs, this.runs)
+
+	return runs
+}
+
+func (this *Intervals) Reset() {
+	this.runs = this.runs[:0]
+	this.sizeInBits = 0
+}
+
+func (this *Intervals) Swap(other *Intervals) bitmap.Bitmap {
+	this.runs, other.runs = other.runs, this.runs
+	this.sizeInBits, other.sizeInBits = other.sizeInBits, this.sizeInBits
+
+	return this
+}
+
+func (this *Intervals) Clone() bitmap.Bitmap {
+	return &Intervals{
+		runs:       this.Intervals(),
+		sizeInBits: this.sizeInBits,
+	}
+}
+
+func (this *Intervals) Copy(other bitmap.Bitmap) bitmap.Bitmap {
+	o, ok := other.(*Intervals)
+	if !ok {
+		return nil
+	}
+
+	this.runs = o.Intervals()
+	this.sizeInBits = o.sizeInBits
+
+	return this
+}
+
+func (this *Intervals) Equal(other bitmap.Bitmap) bool {
+	o, ok := other.(*Intervals)
+	if !ok || o == nil {
+		return false
+	}
+
+	if this.sizeInBits != o.sizeInBits || len(this.runs) != len(o.runs) {
+		return false
+	}
+
+	for i, v := range this.runs {
+		if o.runs[i] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (this *Intervals) Cardinality() int64 {
+	n := int64(0)
+	for _, v := range this.runs {
+		n += v.End - v.Start
+	}
+
+	return n
+}
+
+func (this *Intervals) And(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y bool) bool { return x && y })
+}
+
+func (this *Intervals) Or(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y bool) bool { return x || y })
+}
+
+func (this *Intervals) AndNot(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y bool) bool { return x && !y })
+}
+
+func (this *Intervals) Xor(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y bool) bool { return x != y })
+}
+
+// Not negates all the bits of the bitmap, up to Size(), in place.
+func (this *Intervals) Not() bitmap.Bitmap {
+	runs := make([]Interval, 0, len(this.runs)+1)
+
+	start := int64(0)
+	for _, v := range this.runs {
+		if v.Start > start {
+			runs = append(runs, Interval{start, v.Start})
+		}
+		start = v.End
+	}
+
+	if start < this.sizeInBits {
+		runs = append(runs, Interval{start, this.sizeInBits})
+	}
+
+	this.runs = runs
+
+	return this
+}
+
+// ToEwah converts the bitmap to an EWAH compressed bitmap, or returns nil if some of the bits are out of
+// the range EWAH supports. The size of the result is the position of the last bit set + 1, which is
+// smaller than Size() if the bitmap ends with 0's (after a Not for example).
+func (this *Intervals) ToEwah() *ewah.Ewah {
+	e := ewah.NewEwah()
+
+	for _, v := range this.runs {
+		if e.SetRange(v.Start, v.End) == nil {
+			return nil
+		}
+	}
+
+	return e
+}
+
+// FromEwah converts an EWAH compressed bitmap to intervals.
+func FromEwah(e *ewah.Ewah) *Intervals {
+	ans := new(Intervals)
+
+	for it := e.Iterator(); it.HasNext(); {
+		ans.Set(it.Next())
+	}
+
+	ans.sizeInBits = e.Size()
+
+	return ans
+}
+
+//
+// Not-exported functions
+//
+
+// fold applies the operation f to this bitmap and each of the bitmaps in a, from left to right. The result
+// is as large as the largest of the operands.
+func (this *Intervals) fold(a []bitmap.Bitmap, f func(x, y bool) bool) bitmap.Bitmap {
+	ans := this.Clone().(*Intervals)
+
+	for _, v := range a {
+		b, ok := v.(*Intervals)
+		if !ok {
+			return nil
+		}
+
+		ans.runs = combine(ans.runs, b.runs, f)
+		if b.sizeInBits > ans.sizeInBits {
+			ans.sizeInBits = b.sizeInBits
+		}
+	}
+
+	return ans
+}
+
+// combine sweeps the boundaries of both lists of intervals in ascending order. The k-th boundary of a list
+// is the start of an interval when k is even and its end when k is odd, so once we moved past k boundaries
+// we are inside an interval of that list if k is odd. f(false, false) must be false.
+func combine(a, b []Interval, f func(x, y bool) bool) []Interval {
+	ans := make([]Interval, 0, len(a)+len(b))
+
+	i, j := 0, 0
+	in, start := false, int64(0)
+	for i < 2*len(a) || j < 2*len(b) {
+		pos := boundary(a, i)
+		if p := boundary(b, j); p < pos {
+			pos = p
+		}
+
+		if boundary(a, i) == pos {
+			i++
+		}
+		if boundary(b, j) == pos {
+			j++
+		}
+
+		if now := f(i%2 == 1, j%2 == 1); now != in {
+			if now {
+				start = pos
+			} else {
+				ans = append(ans, Interval{start, pos})
+			}
+			in = now
+		}
+	}
+
+	return ans
+}
+
+// boundary returns the k-th boundary of the list of intervals, or the largest position if there are none
+// left
+func boundary(a []Interval, k int) int64 {
+	if k >= 2*len(a) {
+		return math.MaxInt64
+	}
+
+	if k%2 == 0 {
+		return a[k/2].Start
+	}
+
+	return a[k/2].End
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package intervals
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitmaptest"
+	"github.com/reducedb/bitmap/bitset"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestSetRange(t *testing.T) {
+	bm := New().(*Intervals)
+
+	if bm.SetRange(10, 20) == nil || bm.SetRange(20, 30).Set(30) == nil || bm.SetRange(40, 50) == nil {
+		t.Fatal("Problem setting ranges")
+	}
+
+	if bm.SetRange(45, 60) != nil || bm.Set(49) != nil {
+		t.Fatal("Setting bits out of order should fail")
+	}
+
+	if r := bm.Intervals(); len(r) != 2 || r[0] != (Interval{10, 31}) || r[1] != (Interval{40, 50}) {
+		t.Fatalf("Adjacent ranges should be merged, got %v", r)
+	}
+
+	if bm.Cardinality() != 31 || bm.Size() != 50 || !bm.Get(30) || bm.Get(31) || bm.Get(9) {
+		t.Fatalf("Problem with ranges %v", bm.Intervals())
+	}
+}
+
+func TestCrossCheckBitset(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	bitmaptest.CrossCheck(t, 200, func() (bitmap.Bitmap, *bitset.Bitset) {
+		return bitmaptest.Ranges(New, 50, 300, 300)
+	})
+}
+
+func TestEwah(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	for n := 0; n < 200; n++ {
+		i, b := crossCheckBitmaps()
+
+		e := i.ToEwah()
+		bitmaptest.Check(t, "ToEwah", e, b)
+
+		if j := FromEwah(e); !j.Equal(i) {
+			t.Fatalf("FromEwah: %v != %v", j.Intervals(), i.Intervals())
+		}
+	}
+}
+
+// crossCheckBitmaps returns the same random bitmap as Intervals and as a Bitset, made of ranges of all
+// lengths, some of them spanning several words.
+func crossCheckBitmaps() (*Intervals, *bitset.Bitset) {
+	i, b := bitmaptest.Ranges(New, 50, 300, 300)
+	return i.(*Intervals), b
+}
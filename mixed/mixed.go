@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package mixed implements the bitmap interface for data that has both long runs of 1's and scattered bits.
+// Runs of at least MinRun bits are kept in a list of intervals, where each one costs the same whatever its
+// length, and the other bits in an EWAH bitmap, which compresses the gaps between them.
+package mixed
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"github.com/reducedb/bitmap/intervals"
+	"math"
+)
+
+const (
+	// DefaultMinRun is the default length from which a run of 1's is stored as an interval. Shorter runs
+	// cost less as literal words in EWAH.
+	DefaultMinRun int64 = 128
+
+	// maxPosition is the largest position EWAH supports
+	maxPosition int64 = math.MaxInt32 - 64
+)
+
+type Mixed struct {
+	// runs are the runs of at least minRun bits, and bits the other bits set to 1. They never overlap.
+	runs *intervals.Intervals
+	bits *ewah.Ewah
+
+	// start and end are the bounds of the last run, which may still grow, so it isn't stored yet
+	start, end int64
+
+	minRun int64
+
+	// sizeInBits is the number of total bits in the bitmap
+	sizeInBits int64
+}
+
+var _ bitmap.Bitmap = (*Mixed)(nil)
+
+func init() {
+	bitmap.Register("mixed", New)
+}
+
+func New() bitmap.Bitmap {
+	return NewWithMinRun(DefaultMinRun)
+}
+
+// NewWithMinRun returns an empty bitmap that stores runs of at least minRun bits as intervals
+func NewWithMinRun(minRun int64) bitmap.Bitmap {
+	if minRun < 1 {
+		minRun = 1
+	}
+
+	return &Mixed{
+		runs:   intervals.New().(*intervals.Intervals),
+		bits:   ewah.NewEwah(),
+		minRun: minRun,
+	}
+}
+
+// Set sets the bit at position i to true (1). The bits must be set in ascending order. For example, set(15)
+// then set(7) will fail. Like EWAH, positions go up to math.MaxInt32 - 64.
+func (this *Mixed) Set(i int64) bitmap.Bitmap {
+	return this.SetRange(i, i+1)
+}
+
+// SetRange sets all the bits from start (inclusive) to end (exclusive) to true (1). Like Set, the range must
+// start after the last bit set.
+func (this *Mixed) SetRange(start, end int64) bitmap.Bitmap {
+	if start < this.sizeInBits || start < 0 || end <= start || end > maxPosition+1 {
+		return nil
+	}
+
+	if start != this.end || this.start == this.end {
+		this.flush()
+		this.start = start
+	}
+
+	this.end = end
+	this.sizeInBits = end
+
+	return this
+}
+
+func (this *Mixed) Get(i int64) bool {
+	if i < 0 || i >= this.sizeInBits {
+		return false
+	}
+
+	if i >= this.start && i < this.end {
+		return true
+	}
+
+	return this.runs.Get(i) || this.bits.Get(i)
+}
+
+// Size returns the size in bits of the *uncompressed* bitmap represented by this bitmap.
+func (this *Mixed) Size() int64 {
+	return this.sizeInBits
+}
+
+// SizeInBytes returns the approximate memory used by the runs and the EWAH bitmap
+func (this *Mixed) SizeInBytes() int64 {
+	return 16*int64(len(this.runs.Intervals())+1) + this.bits.SizeInBytes()
+}
+
+// Runs returns the number of runs stored as intervals, including the last run if it's long enough
+func (this *Mixed) Runs() int {
+	n := len(this.runs.Intervals())
+	if this.end-this.start >= this.minRun {
+		n++
+	}
+
+	return n
+}
+
+func (this *Mixed) Reset() {
+	this.runs.Reset()
+	this.bits.Reset()
+	this.start = 0
+	this.end = 0
+	this.sizeInBits = 0
+}
+
+func (this *Mixed) Swap(other *Mixed) bitmap.Bitmap {
+	*this, *other = *other, *this
+
+	return this
+}
+
+func (this *Mixed) Clone() bitmap.Bitmap {
+	c := *this
+	c.runs = this.runs.Clone().(*intervals.Intervals)
+	c.bits = this.bits.Clone().(*ewah.Ewah)
+
+	return &c
+}
+
+func (this *Mixed) Copy(other bitmap.Bitmap) bitmap.Bitmap {
+	o, ok := other.(*Mixed)
+	if !ok {
+		return nil
+	}
+
+	*this = *o.Clone().(*Mixed)
+
+	return this
+}
+
+// Equal returns true if both bitmaps have the same size and the same bits set, whatever the split between
+// runs and scattered bits.
+func (this *Mixed) Equal(other bitmap.Bitmap) bool {
+	o, ok := other.(*Mixed)
+	if !ok || o == nil {
+		return false
+	}
+
+	return this.sizeInBits == o.sizeInBits && this.toIntervals().Equal(o.toIntervals())
+}
+
+func (this *Mixed) Cardinality() int64 {
+	return this.runs.Cardinality() + this.bits.Cardinality() + this.end - this.start
+}
+
+func (this *Mixed) And(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, (*intervals.Intervals).And)
+}
+
+func (this *Mixed) Or(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, (*intervals.Intervals).Or)
+}
+
+func (this *Mixed) AndNot(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, (*intervals.Intervals).AndNot)
+}
+
+func (this *Mixed) Xor(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, (*intervals.Intervals).Xor)
+}
+
+// Not negates all the bits of the bitmap, up to Size(), in place.
+func (this *Mixed) Not() bitmap.Bitmap {
+	if this.sizeInBits == 0 {
+		return this
+	}
+
+	// The intervals may be shorter than the bitmap, so we can't just negate them
+	ones := intervals.New().(*intervals.Intervals)
+	ones.SetRange(0, this.sizeInBits)
+
+	this.fromIntervals(ones.AndNot(this.toIntervals()).(*intervals.Intervals), this.sizeInBits)
+
+	return this
+}
+
+//
+// Not-exported functions
+//
+
+// flush stores the last run, as an interval if it's long enough, or in the EWAH bitmap otherwise
+func (this *Mixed) flush() {
+	switch {
+	case this.start == this.end:
+		return
+	case this.end-this.start >= this.minRun:
+		this.runs.SetRange(this.start, this.end)
+	default:
+		this.bits.SetRange(this.start, this.end)
+	}
+
+	this.start = this.end
+}
+
+// toIntervals returns all the bits set to 1 as intervals. Its size is the position of the last bit set + 1.
+func (this *Mixed) toIntervals() *intervals.Intervals {
+	ans := intervals.FromEwah(this.bits).Or(this.runs).(*intervals.Intervals)
+
+	if this.start < this.end {
+		last := intervals.New().(*intervals.Intervals)
+		last.SetRange(this.start, this.end)
+		ans = ans.Or(last).(*intervals.Intervals)
+	}
+
+	return ans
+}
+
+// fromIntervals replaces the content of the bitmap with the intervals, splitting them between runs and
+// scattered bits
+func (this *Mixed) fromIntervals(iv *intervals.Intervals, size int64) {
+	this.Reset()
+
+	for _, v := range iv.Intervals() {
+		this.SetRange(v.Start, v.End)
+	}
+
+	if size > this.sizeInBits {
+		this.sizeInBits = size
+	}
+}
+
+// fold applies the operation to this bitmap and each of the bitmaps in a, from left to right, on their
+// intervals. The result is as large as the largest of the operands.
+func (this *Mixed) fold(a []bitmap.Bitmap, f func(*intervals.Intervals, ...bitmap.Bitmap) bitmap.Bitmap) bitmap.Bitmap {
+	iv := this.toIntervals()
+	size := this.sizeInBits
+
+	for _, v := range a {
+		b, ok := v.(*Mixed)
+		if !ok {
+			return nil
+		}
+
+		iv = f(iv, b.toIntervals()).(*intervals.Intervals)
+		if b.sizeInBits > size {
+			size = b.sizeInBits
+		}
+	}
+
+	ans := NewWithMinRun(this.minRun).(*Mixed)
+	ans.fromIntervals(iv, size)
+
+	return ans
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package mixed
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitmaptest"
+	"github.com/reducedb/bitmap/bitset"
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestRuns(t *testing.T) {
+	m := New().(*Mixed)
+	e := ewah.NewEwah()
+
+	// Long runs separated by scattered bits
+	bit := int64(0)
+	for i := 0; i < 100; i++ {
+		m.SetRange(bit, bit+10000)
+		e.SetRange(bit, bit+10000)
+		bit += 10000
+
+		for j := 0; j < 20; j++ {
+			bit += 37
+			m.Set(bit)
+			e.Set(bit)
+		}
+		bit += 37
+	}
+
+	if m.Runs() != 100 {
+		t.Fatalf("Runs() = %d, should be 100", m.Runs())
+	}
+
+	if m.Cardinality() != e.Cardinality() {
+		t.Fatalf("Cardinality %d != %d", m.Cardinality(), e.Cardinality())
+	}
+
+	// The last bit is still the pending run
+	if c := m.bits.Cardinality(); c != 1999 {
+		t.Fatalf("Only the scattered bits should be in EWAH, found %d", c)
+	}
+
+	if m.Set(bit-37) != nil {
+		t.Fatal("Setting bits out of order should fail")
+	}
+}
+
+func TestCrossCheckBitset(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	bitmaptest.CrossCheck(t, 100, crossCheckBitmaps)
+}
+
+// crossCheckBitmaps returns the same random bitmap as a Mixed and as a Bitset, made of runs of random
+// lengths, some shorter and some longer than the minimum run
+func crossCheckBitmaps() (bitmap.Bitmap, *bitset.Bitset) {
+	return bitmaptest.Ranges(func() bitmap.Bitmap { return NewWithMinRun(50) }, 200, 100, 200)
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package pipeline processes streams of EWAH bitmaps with stages that run concurrently, connected by
+// channels. A stream is a sequence of bitmaps encoded with ewah's MarshalBinary, one after the other, so a
+// job can read bitmaps from a file, combine each one with another bitmap, and write the results, with only
+// a few bitmaps in memory at any time:
+//
+//	err := pipeline.Run(ctx, pipeline.Source(r), pipeline.And(mask), pipeline.Sink(w))
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"io"
+	"sync"
+)
+
+// Stage reads bitmaps from in and sends bitmaps to out, until in is closed or the context is done. The
+// first stage of a pipeline has no input, and the last one no output.
+type Stage func(ctx context.Context, in <-chan *ewah.Ewah, out chan<- *ewah.Ewah) error
+
+// Run runs the stages concurrently, each one sending its bitmaps to the next. It returns when all the
+// stages are done, with the first error, which stops all the stages.
+func Run(ctx context.Context, stages ...Stage) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	var in chan *ewah.Ewah
+	for k, stage := range stages {
+		var out chan *ewah.Ewah
+		if k < len(stages)-1 {
+			out = make(chan *ewah.Ewah)
+		}
+
+		wg.Add(1)
+		go func(stage Stage, in <-chan *ewah.Ewah, out chan<- *ewah.Ewah) {
+			defer wg.Done()
+			if out != nil {
+				defer close(out)
+			}
+
+			if err := stage(ctx, in, out); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+
+			// Drain the input so the previous stage isn't stuck sending
+			if in != nil {
+				for range in {
+				}
+			}
+		}(stage, in, out)
+
+		in = out
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// Source reads the bitmaps of a stream from r
+func Source(r io.Reader) Stage {
+	return func(ctx context.Context, in <-chan *ewah.Ewah, out chan<- *ewah.Ewah) error {
+		br := bufio.NewReader(r)
+
+		for {
+			e, err := read(br)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := send(ctx, out, e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Sink writes the bitmaps it receives to w, as a stream
+func Sink(w io.Writer) Stage {
+	return func(ctx context.Context, in <-chan *ewah.Ewah, out chan<- *ewah.Ewah) error {
+		bw := bufio.NewWriter(w)
+
+		for e := range in {
+			b, err := e.MarshalBinary()
+			if err != nil {
+				return err
+			}
+
+			if _, err := bw.Write(b); err != nil {
+				return err
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		return bw.Flush()
+	}
+}
+
+// Op applies f to each bitmap it receives, and sends the result
+func Op(f func(e *ewah.Ewah) (*ewah.Ewah, error)) Stage {
+	return func(ctx context.Context, in <-chan *ewah.Ewah, out chan<- *ewah.Ewah) error {
+		for e := range in {
+			r, err := f(e)
+			if err != nil {
+				return err
+			}
+
+			if err := send(ctx, out, r); err != nil {
+				return err
+			}
+		}
+
+		return ctx.Err()
+	}
+}
+
+// And intersects each bitmap with x
+func And(x *ewah.Ewah) Stage {
+	return Op(func(e *ewah.Ewah) (*ewah.Ewah, error) {
+		r, err := e.AndChecked(x)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.(*ewah.Ewah), nil
+	})
+}
+
+// Or unites each bitmap with x
+func Or(x *ewah.Ewah) Stage {
+	return Op(func(e *ewah.Ewah) (*ewah.Ewah, error) {
+		r, err := e.OrChecked(x)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.(*ewah.Ewah), nil
+	})
+}
+
+// AndNot removes the bits of x from each bitmap
+func AndNot(x *ewah.Ewah) Stage {
+	return Op(func(e *ewah.Ewah) (*ewah.Ewah, error) {
+		r, err := e.AndNotChecked(x)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.(*ewah.Ewah), nil
+	})
+}
+
+//
+// Not-exported functions
+//
+
+// send sends e to out, unless the context is done first. Stages without output drop the bitmaps.
+func send(ctx context.Context, out chan<- *ewah.Ewah, e *ewah.Ewah) error {
+	if out == nil {
+		return nil
+	}
+
+	select {
+	case out <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// read reads the next bitmap of the stream. The MarshalBinary format starts with the size in bits and the
+// number of words, which tells how long the rest is.
+func read(r io.Reader) (*ewah.Ewah, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("pipeline/read: truncated bitmap")
+		}
+		return nil, err
+	}
+
+	words := int64(int32(binary.BigEndian.Uint32(header[4:])))
+	if words < 1 {
+		return nil, errors.New("pipeline/read: invalid number of words")
+	}
+
+	b := make([]byte, 8+8*words+4)
+	copy(b, header)
+	if _, err := io.ReadFull(r, b[8:]); err != nil {
+		return nil, errors.New("pipeline/read: truncated bitmap")
+	}
+
+	e := ewah.NewEwah()
+	if err := e.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+)
+
+func TestPipeline(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	input := make([]*ewah.Ewah, 100)
+	var buf bytes.Buffer
+	for k := range input {
+		input[k] = randomBitmap()
+		b, _ := input[k].MarshalBinary()
+		buf.Write(b)
+	}
+
+	mask, extra := randomBitmap(), randomBitmap()
+
+	var out bytes.Buffer
+	if err := Run(context.Background(), Source(&buf), And(mask), Or(extra), Sink(&out)); err != nil {
+		t.Fatal(err)
+	}
+
+	var results []*ewah.Ewah
+	err := Run(context.Background(), Source(&out), Op(func(e *ewah.Ewah) (*ewah.Ewah, error) {
+		results = append(results, e)
+		return e, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(input) {
+		t.Fatalf("%d bitmaps out of %d", len(results), len(input))
+	}
+
+	for k, e := range input {
+		expected := e.And(mask).Or(extra)
+		if !results[k].Equal(expected) {
+			t.Fatalf("Bitmap %d is different from what was expected", k)
+		}
+	}
+}
+
+func TestPipelineError(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	var buf bytes.Buffer
+	for k := 0; k < 100; k++ {
+		b, _ := randomBitmap().MarshalBinary()
+		buf.Write(b)
+	}
+
+	// An error in the middle stops the whole pipeline
+	fail := errors.New("fail")
+	n := 0
+	err := Run(context.Background(), Source(&buf), Op(func(e *ewah.Ewah) (*ewah.Ewah, error) {
+		if n++; n == 10 {
+			return nil, fail
+		}
+		return e, nil
+	}), Sink(&bytes.Buffer{}))
+
+	if err != fail {
+		t.Fatalf("Run should return the error of the stage, got %v", err)
+	}
+
+	// A truncated stream is an error
+	b, _ := randomBitmap().MarshalBinary()
+	if err := Run(context.Background(), Source(bytes.NewReader(b[:len(b)-1])), Sink(&bytes.Buffer{})); err == nil {
+		t.Fatal("Run should fail on a truncated stream")
+	}
+}
+
+func randomBitmap() *ewah.Ewah {
+	e := ewah.NewEwah()
+	for i := int64(rand.Intn(100)); i < 100000; i += int64(rand.Intn(1000) + 1) {
+		e.Set(i)
+	}
+
+	return e
+}
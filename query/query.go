@@ -0,0 +1,350 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package query parses and evaluates boolean expressions over named EWAH bitmaps, such as
+//
+//	(segA AND segB) ANDNOT segC
+//
+// The operators are AND, ANDNOT, OR and XOR, in any case. AND and ANDNOT bind tighter than OR and XOR, and
+// operators of the same precedence are evaluated from left to right. Parentheses group expressions. A name
+// is any run of characters other than spaces, parentheses and double quotes, and a name that is also an
+// operator, or has any of these characters, can be written between double quotes.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/ewah"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var ErrNotFound = errors.New("query: no bitmap with that name")
+
+// Collection gives the bitmaps names refer to. store.Store is a Collection.
+type Collection interface {
+	Get(name string) (*ewah.Ewah, error)
+}
+
+// Map is a Collection held in memory
+type Map map[string]*ewah.Ewah
+
+var _ Collection = Map(nil)
+
+// Get returns the bitmap named name, or ErrNotFound
+func (this Map) Get(name string) (*ewah.Ewah, error) {
+	if e, ok := this[name]; ok {
+		return e, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// Expr is a parsed expression. It can be evaluated any number of times, against any collection.
+type Expr struct {
+	root node
+}
+
+// Parse parses the expression, and returns an error telling where the first problem is, if any
+func Parse(s string) (*Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, fmt.Errorf("query/Parse: unexpected %s at %d", t, t.pos)
+	}
+
+	return &Expr{root: root}, nil
+}
+
+// Eval parses the expression and evaluates it against c
+func Eval(s string, c Collection) (*ewah.Ewah, error) {
+	x, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return x.Eval(c)
+}
+
+// Eval returns the bitmap the expression stands for. The bitmaps of the collection are only read, and each
+// name is looked up once, however many times it appears. If a name can't be found, the error of the
+// collection is returned, wrapped with the name. An operation whose result would exceed the budget set with
+// ewah.SetMaxResultWords returns an error matching ewah.ErrResultTooLarge.
+func (this *Expr) Eval(c Collection) (*ewah.Ewah, error) {
+	bitmaps := make(map[string]*ewah.Ewah)
+	for _, name := range this.Names() {
+		e, err := c.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("query/Eval: %s: %w", name, err)
+		}
+		bitmaps[name] = e
+	}
+
+	return this.root.eval(bitmaps)
+}
+
+// Names returns the names the expression refers to, sorted and without duplicates
+func (this *Expr) Names() []string {
+	seen := make(map[string]bool)
+	this.root.names(seen)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// String returns the expression fully parenthesized, which parses back to the same expression
+func (this *Expr) String() string {
+	return this.root.String()
+}
+
+//
+// Not-exported functions
+//
+
+type node interface {
+	eval(bitmaps map[string]*ewah.Ewah) (*ewah.Ewah, error)
+	names(seen map[string]bool)
+	String() string
+}
+
+type nameNode string
+
+type opNode struct {
+	op          string
+	left, right node
+}
+
+func (this nameNode) eval(bitmaps map[string]*ewah.Ewah) (*ewah.Ewah, error) {
+	return bitmaps[string(this)], nil
+}
+
+func (this nameNode) names(seen map[string]bool) {
+	seen[string(this)] = true
+}
+
+func (this nameNode) String() string {
+	s := string(this)
+	if _, ok := operators[strings.ToUpper(s)]; ok || strings.IndexFunc(s, isSeparator) >= 0 {
+		return `"` + s + `"`
+	}
+
+	return s
+}
+
+func (this *opNode) eval(bitmaps map[string]*ewah.Ewah) (*ewah.Ewah, error) {
+	left, err := this.left.eval(bitmaps)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := this.right.eval(bitmaps)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bitmap.Bitmap
+	switch this.op {
+	case "AND":
+		result, err = left.AndChecked(right)
+	case "ANDNOT":
+		result, err = left.AndNotChecked(right)
+	case "OR":
+		result, err = left.OrChecked(right)
+	case "XOR":
+		result, err = left.XorChecked(right)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query/Eval: %s: %w", this.op, err)
+	}
+
+	return result.(*ewah.Ewah), nil
+}
+
+func (this *opNode) names(seen map[string]bool) {
+	this.left.names(seen)
+	this.right.names(seen)
+}
+
+func (this *opNode) String() string {
+	return "(" + this.left.String() + " " + this.op + " " + this.right.String() + ")"
+}
+
+// operators gives the precedence of each operator, the higher the tighter it binds
+var operators = map[string]int{
+	"OR":     1,
+	"XOR":    1,
+	"AND":    2,
+	"ANDNOT": 2,
+}
+
+const (
+	tokenEnd = iota
+	tokenName
+	tokenOp
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+func (this token) String() string {
+	switch this.kind {
+	case tokenEnd:
+		return "end of expression"
+	case tokenOpen:
+		return `"("`
+	case tokenClose:
+		return `")"`
+	}
+
+	return fmt.Sprintf("%q", this.text)
+}
+
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+// tokenize splits the expression into names, operators and parentheses, followed by an end token
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i})
+			i++
+
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("query/Parse: unterminated name at %d", i)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("query/Parse: empty name at %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenName, text: s[i+1 : i+1+end], pos: i})
+			i += end + 2
+
+		default:
+			end := strings.IndexFunc(s[i:], isSeparator)
+			if end < 0 {
+				end = len(s) - i
+			}
+
+			text := s[i : i+end]
+			if _, ok := operators[strings.ToUpper(text)]; ok {
+				tokens = append(tokens, token{kind: tokenOp, text: strings.ToUpper(text), pos: i})
+			} else {
+				tokens = append(tokens, token{kind: tokenName, text: text, pos: i})
+			}
+			i += end
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, pos: len(s)}), nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (this *parser) peek() token {
+	return this.tokens[this.next]
+}
+
+func (this *parser) take() token {
+	t := this.tokens[this.next]
+	if t.kind != tokenEnd {
+		this.next++
+	}
+
+	return t
+}
+
+func (this *parser) parseOr() (node, error) {
+	return this.parseBinary(1)
+}
+
+// parseBinary parses a chain of operands joined by operators of the given precedence, where the operands
+// are expressions of higher precedence
+func (this *parser) parseBinary(precedence int) (node, error) {
+	operand := this.parseOperand
+	if precedence < 2 {
+		operand = func() (node, error) { return this.parseBinary(precedence + 1) }
+	}
+
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := this.peek()
+		if t.kind != tokenOp || operators[t.text] != precedence {
+			return left, nil
+		}
+		this.take()
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &opNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (this *parser) parseOperand() (node, error) {
+	t := this.take()
+	switch t.kind {
+	case tokenName:
+		return nameNode(t.text), nil
+
+	case tokenOpen:
+		n, err := this.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if c := this.take(); c.kind != tokenClose {
+			return nil, fmt.Errorf("query/Parse: expected \")\" at %d, found %s", c.pos, c)
+		}
+
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("query/Parse: expected a name or \"(\" at %d, found %s", t.pos, t)
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package query
+
+import (
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"github.com/reducedb/bitmap/store"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+var _ Collection = (*store.Store)(nil)
+
+func TestEval(t *testing.T) {
+	const n = 3000
+
+	sets := make(map[string][]bool)
+	c := make(Map)
+	for _, name := range []string{"segA", "segB", "segC", "or", "x-1/y"} {
+		bits := make([]bool, n)
+		e := ewah.NewEwah()
+		for i := int64(0); i < n; i++ {
+			if rand.Intn(3) == 0 {
+				bits[i] = true
+				e.Set(i)
+			}
+		}
+		sets[name], c[name] = bits, e
+	}
+
+	tests := []struct {
+		expr  string
+		match func(i int) bool
+	}{
+		{"segA", func(i int) bool { return sets["segA"][i] }},
+		{"(segA AND segB) ANDNOT segC", func(i int) bool { return sets["segA"][i] && sets["segB"][i] && !sets["segC"][i] }},
+		{"segA or segB and segC", func(i int) bool { return sets["segA"][i] || sets["segB"][i] && sets["segC"][i] }},
+		{"(segA OR segB) AND segC", func(i int) bool { return (sets["segA"][i] || sets["segB"][i]) && sets["segC"][i] }},
+		{"segA XOR segB XOR segC", func(i int) bool { return sets["segA"][i] != sets["segB"][i] != sets["segC"][i] }},
+		{"segA ANDNOT segB ANDNOT segC", func(i int) bool { return sets["segA"][i] && !sets["segB"][i] && !sets["segC"][i] }},
+		{`"or" AND x-1/y`, func(i int) bool { return sets["or"][i] && sets["x-1/y"][i] }},
+		{"((segA))", func(i int) bool { return sets["segA"][i] }},
+	}
+
+	for _, test := range tests {
+		x, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", test.expr, err)
+		}
+
+		// The string form must parse back to the same expression
+		if y, err := Parse(x.String()); err != nil || y.String() != x.String() {
+			t.Fatalf("%q: %q doesn't parse back: %v", test.expr, x.String(), err)
+		}
+
+		e, err := x.Eval(c)
+		if err != nil {
+			t.Fatalf("Eval(%q): %v", test.expr, err)
+		}
+
+		for i := 0; i < n; i++ {
+			if e.Get(int64(i)) != test.match(i) {
+				t.Fatalf("%q: expected bit %d to be %v", test.expr, i, test.match(i))
+			}
+		}
+	}
+
+	// The collection is only read
+	for name, e := range c {
+		for i := int64(0); i < n; i++ {
+			if e.Get(i) != sets[name][i] {
+				t.Fatalf("%s was modified at %d", name, i)
+			}
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	x, err := Parse("b AND (a OR b) ANDNOT c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := strings.Join(x.Names(), ","); names != "a,b,c" {
+		t.Fatalf("expected names a,b,c, got %s", names)
+	}
+
+	if x.String() != "((b AND (a OR b)) ANDNOT c)" {
+		t.Fatalf("unexpected string %s", x.String())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, expr := range []string{"", "a AND", "AND a", "(a OR b", "a OR b)", "a b", `"a`, `""`, "()"} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("expected an error for %q", expr)
+		} else if !strings.HasPrefix(err.Error(), "query/Parse: ") {
+			t.Fatalf("unexpected error for %q: %v", expr, err)
+		}
+	}
+
+	c := Map{"a": ewah.NewEwah()}
+	if _, err := Eval("a AND missing", c); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMaxResultWords(t *testing.T) {
+	c := Map{"a": ewah.NewEwah(), "b": ewah.NewEwah()}
+	for i := int64(0); i < 10000; i += 100 {
+		c["a"].Set(i)
+		c["b"].Set(i + 50)
+	}
+
+	ewah.SetMaxResultWords(2)
+	defer ewah.SetMaxResultWords(0)
+
+	if _, err := Eval("a AND (a OR b)", c); !errors.Is(err, ewah.ErrResultTooLarge) {
+		t.Fatalf("expected ErrResultTooLarge, got %v", err)
+	}
+}
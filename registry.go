@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package bitmap
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]func() Bitmap)
+)
+
+// Register makes a bitmap implementation available by name, so data can record which implementation it
+// was encoded with and be decoded into the same one. Implementations usually register themselves when
+// their package is imported. Register panics if the name is already registered or factory is nil.
+func Register(name string, factory func() Bitmap) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("bitmap: Register factory is nil")
+	}
+
+	if _, dup := registry[name]; dup {
+		panic("bitmap: Register called twice for " + name)
+	}
+
+	registry[name] = factory
+}
+
+// New returns an empty bitmap of the implementation registered under name, or nil if there's none
+func New(name string) Bitmap {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	return factory()
+}
+
+// Registered returns the names of the registered implementations, sorted
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
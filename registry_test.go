@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package bitmap_test
+
+import (
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitset"
+	"github.com/reducedb/bitmap/ewah"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	if _, ok := bitmap.New("ewah").(*ewah.Ewah); !ok {
+		t.Fatal("New(\"ewah\") should return an *ewah.Ewah")
+	}
+
+	if _, ok := bitmap.New("bitset").(*bitset.Bitset); !ok {
+		t.Fatal("New(\"bitset\") should return a *bitset.Bitset")
+	}
+
+	if bitmap.New("unknown") != nil {
+		t.Fatal("New should return nil for an unknown implementation")
+	}
+
+	if names := bitmap.Registered(); len(names) != 2 || names[0] != "bitset" || names[1] != "ewah" {
+		t.Fatalf("Registered() = %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Registering a name twice should panic")
+		}
+	}()
+
+	bitmap.Register("ewah", ewah.New)
+}
+
+func TestVariadic(t *testing.T) {
+	for _, name := range bitmap.Registered() {
+		a, b, c := bitmap.New(name), bitmap.New(name), bitmap.New(name)
+		for i := int64(0); i < 3000; i++ {
+			if i%3 == 0 {
+				a.Set(i)
+			}
+			if i%5 == 0 && i < 2000 {
+				b.Set(i)
+			}
+			if i%7 == 0 && i >= 500 {
+				c.Set(i + 1000)
+			}
+		}
+
+		for _, op := range []struct {
+			name string
+			f    func(bitmap.Bitmap, ...bitmap.Bitmap) bitmap.Bitmap
+		}{
+			{"And", bitmap.Bitmap.And},
+			{"Or", bitmap.Bitmap.Or},
+			{"AndNot", bitmap.Bitmap.AndNot},
+			{"Xor", bitmap.Bitmap.Xor},
+		} {
+			// The variadic call is the same as a left fold
+			got, want := op.f(a, b, c), op.f(op.f(a, b), c)
+			if !sameBits(got, want) {
+				t.Errorf("%s %s: the variadic call differs from the left fold", name, op.name)
+			}
+
+			if got := op.f(a); !sameBits(got, a) || got == a {
+				t.Errorf("%s %s: without operands, got %v, want a copy", name, op.name, got)
+			}
+		}
+	}
+}
+
+// sameBits returns true if a and b have the same size and the same bits set
+func sameBits(a, b bitmap.Bitmap) bool {
+	if a == nil || b == nil || a.Size() != b.Size() || a.Cardinality() != b.Cardinality() {
+		return false
+	}
+
+	for i := int64(0); i < a.Size(); i++ {
+		if a.Get(i) != b.Get(i) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,424 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package store persists named EWAH bitmaps in a single file. The file is an append-only log of records,
+// each one checked with a CRC, so an update is either fully written or ignored when the file is opened
+// again. Bitmaps are only read from the file when they're needed, and the most recently used ones are kept
+// decoded in memory. Compact rewrites the file with only the live bitmaps.
+//
+// The file starts with an 8-byte magic string, followed by the records:
+//
+//	length (uint32) | CRC-32 of the payload (uint32) | payload (length bytes)
+//
+// where the payload is an operation byte (put or delete), the name prefixed with its length as a uvarint,
+// and for a put, the bitmap encoded with ewah's MarshalBinary. Integers are big endian.
+package store
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"github.com/reducedb/bitmap/ewah"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	magic = "EWAHSTR1"
+
+	opPut    byte = 1
+	opDelete byte = 2
+
+	// recordHeaderSize is the size of the length and the CRC of a record
+	recordHeaderSize = 8
+
+	// DefaultCacheSize is the default number of bitmaps kept decoded in memory
+	DefaultCacheSize = 64
+)
+
+var (
+	ErrClosed   = errors.New("store: the store is closed")
+	ErrNotFound = errors.New("store: no bitmap with that name")
+)
+
+type Store struct {
+	mu sync.Mutex
+
+	path string
+	f    *os.File
+
+	// size is the size of the valid part of the file, where the next record is written
+	size int64
+
+	// index gives the position and the size of the encoded bitmap for each name
+	index map[string]location
+
+	// cache holds the most recently used bitmaps, most recent first
+	cache     *list.List
+	cached    map[string]*list.Element
+	cacheSize int
+}
+
+type location struct {
+	offset, length int64
+}
+
+type cacheEntry struct {
+	name string
+	e    *ewah.Ewah
+}
+
+// Open opens the store at path, creating the file if needed, and keeps up to cacheSize bitmaps decoded in
+// memory, or DefaultCacheSize if cacheSize is not positive. A record that was only partially written,
+// because of a crash for example, is discarded.
+func Open(path string, cacheSize int) (*Store, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheSize < 1 {
+		cacheSize = DefaultCacheSize
+	}
+
+	s := &Store{
+		path:      path,
+		f:         f,
+		index:     make(map[string]location),
+		cache:     list.New(),
+		cached:    make(map[string]*list.Element),
+		cacheSize: cacheSize,
+	}
+
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the bitmap stored under name. The bitmap belongs to the caller, who may modify it.
+func (this *Store) Get(name string) (*ewah.Ewah, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f == nil {
+		return nil, ErrClosed
+	}
+
+	if el, ok := this.cached[name]; ok {
+		this.cache.MoveToFront(el)
+		return el.Value.(*cacheEntry).e.Snapshot(), nil
+	}
+
+	loc, ok := this.index[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	b := make([]byte, loc.length)
+	if _, err := this.f.ReadAt(b, loc.offset); err != nil {
+		return nil, err
+	}
+
+	e := ewah.NewEwah()
+	if err := e.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	this.addToCache(name, e)
+
+	return e.Snapshot(), nil
+}
+
+// Put stores the bitmap under name, replacing the previous one if any. The update is written and synced to
+// disk before Put returns.
+func (this *Store) Put(name string, e *ewah.Ewah) error {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f == nil {
+		return ErrClosed
+	}
+
+	offset, err := this.append(opPut, name, data)
+	if err != nil {
+		return err
+	}
+
+	this.index[name] = location{offset, int64(len(data))}
+	this.removeFromCache(name)
+	this.addToCache(name, e.Snapshot())
+
+	return nil
+}
+
+// Delete removes the bitmap stored under name, if any
+func (this *Store) Delete(name string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f == nil {
+		return ErrClosed
+	}
+
+	if _, ok := this.index[name]; !ok {
+		return nil
+	}
+
+	if _, err := this.append(opDelete, name, nil); err != nil {
+		return err
+	}
+
+	delete(this.index, name)
+	this.removeFromCache(name)
+
+	return nil
+}
+
+// Names returns the names of all the bitmaps, sorted
+func (this *Store) Names() []string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	names := make([]string, 0, len(this.index))
+	for name := range this.index {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Size returns the size of the file, which Compact brings down to the size of the live bitmaps
+func (this *Store) Size() int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.size
+}
+
+// Compact rewrites the file with only the latest version of each bitmap. The new file is written next to
+// the current one, then renamed over it, so the store is never left half compacted.
+func (this *Store) Compact() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f == nil {
+		return ErrClosed
+	}
+
+	tmp := this.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	index, size, err := this.copyLive(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, this.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	this.f.Close()
+	this.f = f
+	this.index = index
+	this.size = size
+
+	return nil
+}
+
+// Close closes the file. The store can't be used anymore.
+func (this *Store) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f == nil {
+		return ErrClosed
+	}
+
+	err := this.f.Close()
+	this.f = nil
+
+	return err
+}
+
+//
+// Not-exported functions
+//
+
+// load reads all the records to build the index. It stops at the first invalid record, and truncates the
+// file there so the next records are written after the valid ones.
+func (this *Store) load() error {
+	fi, err := this.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() == 0 {
+		if _, err := this.f.WriteAt([]byte(magic), 0); err != nil {
+			return err
+		}
+		this.size = int64(len(magic))
+		return this.f.Sync()
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(this.f, 0, fi.Size()))
+
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, m); err != nil || string(m) != magic {
+		return errors.New("store: not a bitmap store file")
+	}
+
+	offset := int64(len(magic))
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+
+		length := int64(binary.BigEndian.Uint32(header))
+		if offset+recordHeaderSize+length > fi.Size() {
+			break
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil || crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+
+		op, name, data, ok := decodePayload(payload)
+		if !ok {
+			break
+		}
+
+		switch op {
+		case opPut:
+			this.index[name] = location{offset + recordHeaderSize + length - int64(len(data)), int64(len(data))}
+		case opDelete:
+			delete(this.index, name)
+		}
+
+		offset += recordHeaderSize + length
+	}
+
+	this.size = offset
+	if offset < fi.Size() {
+		return this.f.Truncate(offset)
+	}
+
+	return nil
+}
+
+// append writes a record at the end of the file, and returns the offset of data in the file
+func (this *Store) append(op byte, name string, data []byte) (int64, error) {
+	b := encodeRecord(op, name, data)
+
+	if _, err := this.f.WriteAt(b, this.size); err != nil {
+		return 0, err
+	}
+
+	if err := this.f.Sync(); err != nil {
+		return 0, err
+	}
+
+	offset := this.size + int64(len(b)-len(data))
+	this.size += int64(len(b))
+
+	return offset, nil
+}
+
+// copyLive writes the magic string and one put record for each bitmap of the index into f
+func (this *Store) copyLive(f *os.File) (map[string]location, int64, error) {
+	if _, err := f.WriteAt([]byte(magic), 0); err != nil {
+		return nil, 0, err
+	}
+
+	index := make(map[string]location, len(this.index))
+	size := int64(len(magic))
+
+	for name, loc := range this.index {
+		data := make([]byte, loc.length)
+		if _, err := this.f.ReadAt(data, loc.offset); err != nil {
+			return nil, 0, err
+		}
+
+		b := encodeRecord(opPut, name, data)
+		if _, err := f.WriteAt(b, size); err != nil {
+			return nil, 0, err
+		}
+
+		index[name] = location{size + int64(len(b)-len(data)), loc.length}
+		size += int64(len(b))
+	}
+
+	return index, size, nil
+}
+
+func (this *Store) addToCache(name string, e *ewah.Ewah) {
+	this.cached[name] = this.cache.PushFront(&cacheEntry{name, e})
+
+	for this.cache.Len() > this.cacheSize {
+		el := this.cache.Back()
+		this.cache.Remove(el)
+		delete(this.cached, el.Value.(*cacheEntry).name)
+	}
+}
+
+func (this *Store) removeFromCache(name string) {
+	if el, ok := this.cached[name]; ok {
+		this.cache.Remove(el)
+		delete(this.cached, name)
+	}
+}
+
+// encodeRecord returns the record for op, with its header. data is at the end of the record.
+func encodeRecord(op byte, name string, data []byte) []byte {
+	b := make([]byte, recordHeaderSize, recordHeaderSize+1+binary.MaxVarintLen64+len(name)+len(data))
+	b = append(b, op)
+	b = binary.AppendUvarint(b, uint64(len(name)))
+	b = append(b, name...)
+	b = append(b, data...)
+
+	binary.BigEndian.PutUint32(b, uint32(len(b)-recordHeaderSize))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[recordHeaderSize:]))
+
+	return b
+}
+
+func decodePayload(b []byte) (byte, string, []byte, bool) {
+	if len(b) < 1 {
+		return 0, "", nil, false
+	}
+
+	n, k := binary.Uvarint(b[1:])
+	if k <= 0 || n > uint64(len(b)-1-k) {
+		return 0, "", nil, false
+	}
+
+	name := string(b[1+k : 1+k+int(n)])
+	data := b[1+k+int(n):]
+
+	return b[0], name, data, b[0] == opPut || (b[0] == opDelete && len(data) == 0)
+}
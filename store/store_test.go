@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package store
+
+import (
+	"fmt"
+	"github.com/reducedb/bitmap/ewah"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPutGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitmaps")
+
+	s, err := Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int64(0); i < 10; i++ {
+		if err := s.Put(fmt.Sprintf("bm%d", i), makeBitmap(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replace bm3 and delete bm5
+	if err := s.Put("bm3", makeBitmap(30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("bm5"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkStore(t, s)
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = Open(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	checkStore(t, s)
+}
+
+func TestGetOwned(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "bitmaps"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Put("bm", makeBitmap(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := s.Get("bm")
+	e.Set(1 << 20)
+
+	if e, _ = s.Get("bm"); e.Get(1 << 20) {
+		t.Fatal("Modifying a bitmap returned by Get shouldn't modify the store")
+	}
+}
+
+func TestTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitmaps")
+
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Put("bm1", makeBitmap(1))
+	size := s.Size()
+	s.Put("bm2", makeBitmap(2))
+	s.Close()
+
+	// Cut the last record in the middle
+	if err := os.Truncate(path, size+10); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = Open(path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get("bm2"); err != ErrNotFound {
+		t.Fatal("A partially written record should be discarded")
+	}
+	if e, err := s.Get("bm1"); err != nil || !e.Equal(makeBitmap(1)) {
+		t.Fatal("Records before a partially written one should be kept")
+	}
+	if s.Size() != size {
+		t.Fatalf("Size %d != %d", s.Size(), size)
+	}
+
+	// New records are written after the valid ones
+	s.Put("bm3", makeBitmap(3))
+	s.Close()
+
+	if s, err = Open(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if e, err := s.Get("bm3"); err != nil || !e.Equal(makeBitmap(3)) {
+		t.Fatal("Records after a partially written one should be readable")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitmaps")
+
+	s, err := Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < 5; n++ {
+		for i := int64(0); i < 10; i++ {
+			s.Put(fmt.Sprintf("bm%d", i), makeBitmap(i))
+		}
+	}
+	s.Put("bm3", makeBitmap(30))
+	s.Delete("bm5")
+
+	size := s.Size()
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() >= size/4 {
+		t.Fatalf("Size after Compact %d, before %d", s.Size(), size)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Fatal("Compact should leave no temporary file")
+	}
+
+	checkStore(t, s)
+
+	// The store can still be updated after Compact, and the compacted file reopened
+	s.Put("bm10", makeBitmap(10))
+	s.Close()
+
+	if s, err = Open(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if e, err := s.Get("bm10"); err != nil || !e.Equal(makeBitmap(10)) {
+		t.Fatal("bm10 should be stored")
+	}
+
+	s.Delete("bm10")
+	checkStore(t, s)
+}
+
+func TestInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitmaps")
+	os.WriteFile(path, []byte("not a store"), 0644)
+
+	if _, err := Open(path, 0); err == nil {
+		t.Fatal("Open should fail on a file that's not a store")
+	}
+}
+
+// makeBitmap returns a bitmap that's different for each n
+func makeBitmap(n int64) *ewah.Ewah {
+	e := ewah.NewEwah()
+	for i := n; i < 10000; i += n + 1 {
+		e.Set(i)
+	}
+	e.Set(100000 + n)
+
+	return e
+}
+
+// checkStore checks the content of a store after bm0..bm9 were stored, bm3 replaced and bm5 deleted
+func checkStore(t *testing.T, s *Store) {
+	if names := s.Names(); len(names) != 9 || names[0] != "bm0" || names[8] != "bm9" {
+		t.Fatalf("Names = %v", names)
+	}
+
+	// Twice, to read from the file then from the cache
+	for n := 0; n < 2; n++ {
+		for i := int64(0); i < 10; i++ {
+			e, err := s.Get(fmt.Sprintf("bm%d", i))
+
+			switch i {
+			case 3:
+				if err != nil || !e.Equal(makeBitmap(30)) {
+					t.Fatalf("bm3 should have been replaced: %v", err)
+				}
+			case 5:
+				if err != ErrNotFound {
+					t.Fatal("bm5 should have been deleted")
+				}
+			default:
+				if err != nil || !e.Equal(makeBitmap(i)) {
+					t.Fatalf("bm%d is different from what was stored: %v", i, err)
+				}
+			}
+		}
+	}
+}
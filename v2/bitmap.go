@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package bitmap is the version 2 of the interfaces of the bitmaps. Unlike version 1, where a failed Set or
+// And returns nil and the failure shows up as a panic further down a chain of calls, the methods that
+// modify or combine bitmaps return an error, and the operations take a context, so a long aggregation can
+// be canceled. Chains of operations are written with a Builder, which keeps the first error.
+//
+// The implementations of version 1 are used through Wrap:
+//
+//	a, b := bitmap.Wrap(ewah.NewEwah()), bitmap.Wrap(ewah.NewEwah())
+//	...
+//	ans, err := bitmap.NewBuilder(ctx, a).And(b).AndNot(c).Build()
+//
+// Both versions can be imported by the same program, the import path of this one being
+// github.com/reducedb/bitmap/v2.
+package bitmap
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrFailed is returned when a bitmap of version 1 fails without saying why
+	ErrFailed = errors.New("bitmap: operation failed")
+
+	// ErrIncompatible is returned when the operands of an operation can't be combined
+	ErrIncompatible = errors.New("bitmap: incompatible operands")
+)
+
+// Reader is the read-only part of a bitmap
+type Reader interface {
+	Get(i int64) bool
+	Size() int64
+	Cardinality() int64
+}
+
+type Bitmap interface {
+	Reader
+
+	// Set sets the bit at position i. The bits must be set in ascending order.
+	Set(i int64) error
+	Reset()
+
+	Clone() Bitmap
+	Equal(Bitmap) bool
+
+	// The operations return a new bitmap, and leave the bitmap and the operands untouched
+	And(ctx context.Context, a ...Bitmap) (Bitmap, error)
+	Or(ctx context.Context, a ...Bitmap) (Bitmap, error)
+	AndNot(ctx context.Context, a ...Bitmap) (Bitmap, error)
+	Xor(ctx context.Context, a ...Bitmap) (Bitmap, error)
+	Not(ctx context.Context) (Bitmap, error)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package bitmap
+
+import (
+	"context"
+	"errors"
+	"github.com/reducedb/bitmap/bitset"
+	"github.com/reducedb/bitmap/ewah"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	ctx := context.Background()
+
+	for _, name := range []string{"ewah", "bitset"} {
+		a, b := wrapNew(name), wrapNew(name)
+		for i := int64(0); i < 1000; i++ {
+			if i%2 == 0 {
+				if err := a.Set(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if i%3 == 0 {
+				if err := b.Set(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		for _, c := range []struct {
+			op   string
+			f    func(context.Context, ...Bitmap) (Bitmap, error)
+			want int64
+		}{
+			{"and", a.And, 167},
+			{"or", a.Or, 667},
+			{"andnot", a.AndNot, 333},
+			{"xor", a.Xor, 500},
+		} {
+			ans, err := c.f(ctx, b)
+			if err != nil || ans.Cardinality() != c.want {
+				t.Errorf("%s %s: got %v, %v, want a cardinality of %d", name, c.op, ans, err, c.want)
+			}
+		}
+
+		not, err := a.Not(ctx)
+		if err != nil || not.Cardinality() != a.Size()-a.Cardinality() || a.Cardinality() != 500 {
+			t.Errorf("%s not: got %v, %v", name, not, err)
+		}
+
+		if !a.Equal(a.Clone()) || a.Equal(b) || a.Equal(nil) {
+			t.Errorf("%s: Equal failed", name)
+		}
+	}
+}
+
+func TestWrapErrors(t *testing.T) {
+	a := Wrap(ewah.NewEwah())
+	a.Set(10)
+
+	if err := a.Set(5); !errors.Is(err, ewah.ErrOutOfOrder) {
+		t.Errorf("got %v, want ewah.ErrOutOfOrder", err)
+	}
+
+	if _, err := a.And(context.Background(), Wrap(bitset.New()), nil); err != ErrIncompatible {
+		t.Errorf("got %v, want ErrIncompatible", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, f := range []func(context.Context, ...Bitmap) (Bitmap, error){a.And, a.Or, a.AndNot, a.Xor} {
+		if _, err := f(ctx, a); err != context.Canceled {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	}
+
+	if Wrap(nil) != nil || Unwrap(nil) != nil || Unwrap(a) == nil {
+		t.Error("Wrap and Unwrap failed")
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := Wrap(ewah.NewEwah()), Wrap(ewah.NewEwah()), Wrap(ewah.NewEwah())
+
+	ans, err := NewBuilder(ctx, a).Set(1, 2, 3, 4).Or(b).AndNot(c).Build()
+	if err != nil || ans.Cardinality() != 4 {
+		t.Fatalf("got %v, %v", ans, err)
+	}
+
+	NewBuilder(ctx, b).Set(2, 4)
+	NewBuilder(ctx, c).Set(4)
+
+	ans, err = NewBuilder(ctx, a).And(b).AndNot(c).Xor(c).Build()
+	if err != nil || ans.Cardinality() != 2 || !ans.Get(2) || !ans.Get(4) {
+		t.Fatalf("got %v, %v", ans, err)
+	}
+
+	// The first error is kept, and the next operations are skipped
+	_, err = NewBuilder(ctx, a).Set(3).And(b).Or(nil).Not().Build()
+	if !errors.Is(err, ewah.ErrOutOfOrder) {
+		t.Errorf("got %v, want ewah.ErrOutOfOrder", err)
+	}
+
+	_, err = NewBuilder(ctx, a).Or(nil).Not().Build()
+	if err != ErrIncompatible {
+		t.Errorf("got %v, want ErrIncompatible", err)
+	}
+
+	if _, err := NewBuilder(ctx, nil).And(a).Build(); err != ErrIncompatible {
+		t.Errorf("got %v, want ErrIncompatible", err)
+	}
+}
+
+func wrapNew(name string) Bitmap {
+	if name == "ewah" {
+		return Wrap(ewah.NewEwah())
+	}
+
+	return Wrap(bitset.New())
+}
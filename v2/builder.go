@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package bitmap
+
+import (
+	"context"
+)
+
+// Builder chains operations on a bitmap, like the methods of version 1 could be chained, but it keeps the
+// first error instead of returning nil. Once an operation has failed, the next ones do nothing, and Build
+// returns the error.
+type Builder struct {
+	ctx context.Context
+	b   Bitmap
+	err error
+}
+
+// NewBuilder returns a builder starting from b, running the operations with the context. The operations
+// don't change b, but Set does until the first operation.
+func NewBuilder(ctx context.Context, b Bitmap) *Builder {
+	this := &Builder{ctx: ctx, b: b}
+	if b == nil {
+		this.err = ErrIncompatible
+	}
+
+	return this
+}
+
+// Set sets the bits at the positions, in ascending order, in the current bitmap
+func (this *Builder) Set(positions ...int64) *Builder {
+	for _, i := range positions {
+		if this.err != nil {
+			break
+		}
+		this.err = this.b.Set(i)
+	}
+
+	return this
+}
+
+func (this *Builder) And(a ...Bitmap) *Builder {
+	if this.err == nil {
+		this.b, this.err = this.b.And(this.ctx, a...)
+	}
+
+	return this
+}
+
+func (this *Builder) Or(a ...Bitmap) *Builder {
+	if this.err == nil {
+		this.b, this.err = this.b.Or(this.ctx, a...)
+	}
+
+	return this
+}
+
+func (this *Builder) AndNot(a ...Bitmap) *Builder {
+	if this.err == nil {
+		this.b, this.err = this.b.AndNot(this.ctx, a...)
+	}
+
+	return this
+}
+
+func (this *Builder) Xor(a ...Bitmap) *Builder {
+	if this.err == nil {
+		this.b, this.err = this.b.Xor(this.ctx, a...)
+	}
+
+	return this
+}
+
+func (this *Builder) Not() *Builder {
+	if this.err == nil {
+		this.b, this.err = this.b.Not(this.ctx)
+	}
+
+	return this
+}
+
+// Build returns the result of the operations, or the first error
+func (this *Builder) Build() (Bitmap, error) {
+	if this.err != nil {
+		return nil, this.err
+	}
+
+	return this.b, nil
+}
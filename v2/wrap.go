@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package bitmap
+
+import (
+	"context"
+	v1 "github.com/reducedb/bitmap"
+)
+
+// wrapped is a bitmap of version 1, with the methods of version 2
+type wrapped struct {
+	b v1.Bitmap
+}
+
+var _ Bitmap = (*wrapped)(nil)
+
+// Wrap returns the bitmap of version 1 as a bitmap of version 2, or nil if b is nil. The bitmap is used in
+// place, not copied. The methods use the variants of the bitmap returning errors when it has them, like
+// the SetChecked, AndChecked and AndCtx methods of ewah.Ewah, and return ErrFailed when a method of
+// version 1 returns nil. Only the operations of the bitmap itself check the context as they go, the others
+// check it before they start.
+func Wrap(b v1.Bitmap) Bitmap {
+	if b == nil {
+		return nil
+	}
+
+	return &wrapped{b}
+}
+
+// Unwrap returns the bitmap of version 1 of a bitmap returned by Wrap, or nil if it's not one
+func Unwrap(b Bitmap) v1.Bitmap {
+	w, ok := b.(*wrapped)
+	if !ok || w == nil {
+		return nil
+	}
+
+	return w.b
+}
+
+func (this *wrapped) Get(i int64) bool {
+	return this.b.Get(i)
+}
+
+func (this *wrapped) Size() int64 {
+	return this.b.Size()
+}
+
+func (this *wrapped) Cardinality() int64 {
+	return this.b.Cardinality()
+}
+
+func (this *wrapped) Set(i int64) error {
+	if c, ok := this.b.(interface{ SetChecked(int64) error }); ok {
+		return c.SetChecked(i)
+	}
+
+	if this.b.Set(i) == nil {
+		return ErrFailed
+	}
+
+	return nil
+}
+
+func (this *wrapped) Reset() {
+	this.b.Reset()
+}
+
+func (this *wrapped) Clone() Bitmap {
+	return Wrap(this.b.Clone())
+}
+
+func (this *wrapped) Equal(other Bitmap) bool {
+	o := Unwrap(other)
+	return o != nil && this.b.Equal(o)
+}
+
+func (this *wrapped) And(ctx context.Context, a ...Bitmap) (Bitmap, error) {
+	if c, ok := this.b.(interface {
+		AndCtx(context.Context, ...v1.Bitmap) (v1.Bitmap, error)
+	}); ok {
+		return this.apply(ctx, a, func(o ...v1.Bitmap) (v1.Bitmap, error) { return c.AndCtx(ctx, o...) })
+	}
+
+	if c, ok := this.b.(checkedOperations); ok {
+		return this.apply(ctx, a, c.AndChecked)
+	}
+
+	return this.apply(ctx, a, noError(this.b.And))
+}
+
+func (this *wrapped) Or(ctx context.Context, a ...Bitmap) (Bitmap, error) {
+	if c, ok := this.b.(checkedOperations); ok {
+		return this.apply(ctx, a, c.OrChecked)
+	}
+
+	return this.apply(ctx, a, noError(this.b.Or))
+}
+
+func (this *wrapped) AndNot(ctx context.Context, a ...Bitmap) (Bitmap, error) {
+	if c, ok := this.b.(checkedOperations); ok {
+		return this.apply(ctx, a, c.AndNotChecked)
+	}
+
+	return this.apply(ctx, a, noError(this.b.AndNot))
+}
+
+func (this *wrapped) Xor(ctx context.Context, a ...Bitmap) (Bitmap, error) {
+	if c, ok := this.b.(checkedOperations); ok {
+		return this.apply(ctx, a, c.XorChecked)
+	}
+
+	return this.apply(ctx, a, noError(this.b.Xor))
+}
+
+// Not returns the complement of the bitmap, computed on a clone since Not of version 1 may change the bitmap
+func (this *wrapped) Not(ctx context.Context) (Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c := this.b.Clone()
+	if n, ok := c.(interface{ NotChecked() (v1.Bitmap, error) }); ok {
+		ans, err := n.NotChecked()
+		if err != nil {
+			return nil, err
+		}
+		return Wrap(ans), nil
+	}
+
+	ans := c.Not()
+	if ans == nil {
+		return nil, ErrFailed
+	}
+
+	return Wrap(ans), nil
+}
+
+//
+// Not-exported functions
+//
+
+// checkedOperations are the variants returning errors of the operations, that a bitmap of version 1 may have
+type checkedOperations interface {
+	AndChecked(...v1.Bitmap) (v1.Bitmap, error)
+	OrChecked(...v1.Bitmap) (v1.Bitmap, error)
+	AndNotChecked(...v1.Bitmap) (v1.Bitmap, error)
+	XorChecked(...v1.Bitmap) (v1.Bitmap, error)
+}
+
+// noError adapts an operation of version 1 to apply, which turns its nil results into ErrFailed
+func noError(op func(...v1.Bitmap) v1.Bitmap) func(...v1.Bitmap) (v1.Bitmap, error) {
+	return func(a ...v1.Bitmap) (v1.Bitmap, error) {
+		return op(a...), nil
+	}
+}
+
+// apply unwraps the operands, and applies the operation to them, once it has checked the context
+func (this *wrapped) apply(ctx context.Context, a []Bitmap, op func(...v1.Bitmap) (v1.Bitmap, error)) (Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	operands := make([]v1.Bitmap, len(a))
+	for k, v := range a {
+		if operands[k] = Unwrap(v); operands[k] == nil {
+			return nil, ErrIncompatible
+		}
+	}
+
+	ans, err := op(operands...)
+	if err != nil {
+		return nil, err
+	}
+	if ans == nil {
+		return nil, ErrFailed
+	}
+
+	return Wrap(ans), nil
+}
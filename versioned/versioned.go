@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package versioned implements an EWAH bitmap with snapshots taken at commit points. A writer keeps setting
+// bits while readers query a stable, committed version. Taking a snapshot is cheap: it shares the compressed
+// buffer with the bitmap, which only copies it the next time it's modified.
+package versioned
+
+import (
+	"github.com/reducedb/bitmap/ewah"
+	"sync"
+)
+
+type Bitmap struct {
+	mu sync.RWMutex
+
+	// head is the bitmap the writer sets bits in
+	head *ewah.Ewah
+
+	// snapshots are the committed versions still retained, oldest first
+	snapshots []*Snapshot
+
+	// version is the version of the last commit
+	version uint64
+}
+
+// Snapshot is a committed version of the bitmap. It is safe for concurrent use.
+type Snapshot struct {
+	mu sync.Mutex
+
+	version uint64
+	e       *ewah.Ewah
+}
+
+// New returns an empty bitmap, with an empty version 0 committed
+func New() *Bitmap {
+	head := ewah.NewEwah()
+
+	return &Bitmap{
+		head:      head,
+		snapshots: []*Snapshot{{e: head.Snapshot()}},
+	}
+}
+
+// Set sets the bit at position i to true (1) in the working version. The bits must be set in ascending
+// order. It returns nil if the bit is out of order or out of range.
+func (this *Bitmap) Set(i int64) *Bitmap {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.head.Set(i) == nil {
+		return nil
+	}
+
+	return this
+}
+
+// Commit makes the bits set so far visible to readers as a new version, and returns it
+func (this *Bitmap) Commit() *Snapshot {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.version++
+	s := &Snapshot{
+		version: this.version,
+		e:       this.head.Snapshot(),
+	}
+	this.snapshots = append(this.snapshots, s)
+
+	return s
+}
+
+// Latest returns the last committed version
+func (this *Bitmap) Latest() *Snapshot {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return this.snapshots[len(this.snapshots)-1]
+}
+
+// At returns the committed version v, or nil if it doesn't exist or is not retained anymore
+func (this *Bitmap) At(v uint64) *Snapshot {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	for _, s := range this.snapshots {
+		if s.version == v {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// Versions returns the committed versions still retained, oldest first
+func (this *Bitmap) Versions() []uint64 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	versions := make([]uint64, len(this.snapshots))
+	for i, s := range this.snapshots {
+		versions[i] = s.version
+	}
+
+	return versions
+}
+
+// Prune stops retaining all but the last keep versions. The latest version is always retained. Readers
+// holding a pruned snapshot can keep using it.
+func (this *Bitmap) Prune(keep int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if keep < 1 {
+		keep = 1
+	}
+
+	if n := len(this.snapshots) - keep; n > 0 {
+		this.snapshots = append([]*Snapshot(nil), this.snapshots[n:]...)
+	}
+}
+
+// Version returns the version of the snapshot
+func (this *Snapshot) Version() uint64 {
+	return this.version
+}
+
+func (this *Snapshot) Get(i int64) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.e.Get(i)
+}
+
+func (this *Snapshot) Size() int64 {
+	return this.e.Size()
+}
+
+func (this *Snapshot) Cardinality() int64 {
+	return this.e.Cardinality()
+}
+
+// Bitmap returns the snapshot as an EWAH bitmap that belongs to the caller, for use with the bitmap
+// operations or for many Gets without locking. It is cheap, since it shares the buffer of the snapshot.
+func (this *Snapshot) Bitmap() *ewah.Ewah {
+	return this.e.Snapshot()
+}
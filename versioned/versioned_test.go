@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package versioned
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	bm := New()
+
+	if s := bm.Latest(); s.Version() != 0 || s.Cardinality() != 0 {
+		t.Fatal("Version 0 should be empty")
+	}
+
+	// Version v has bits v*1000, v*1000+3, ... v*1000+99 set, and bit v*1000+500 is set after the commit
+	for v := int64(1); v <= 10; v++ {
+		for i := v * 1000; i < v*1000+100; i += 3 {
+			bm.Set(i)
+		}
+
+		s := bm.Commit()
+		bm.Set(v*1000 + 500)
+
+		if s.Version() != uint64(v) || s.Get(v*1000+500) || s.Size() != v*1000+100 {
+			t.Fatalf("Snapshot %d sees bits set after the commit", v)
+		}
+	}
+
+	for v := int64(0); v <= 10; v++ {
+		s := bm.At(uint64(v))
+		if s == nil {
+			t.Fatalf("Version %d should be retained", v)
+		}
+
+		n := int64(0)
+		for u := int64(1); u <= v; u++ {
+			for i := u * 1000; i < u*1000+100; i += 3 {
+				n++
+				if !s.Get(i) {
+					t.Fatalf("Version %d should have bit %d set", v, i)
+				}
+			}
+
+			if u < v {
+				n++
+			}
+		}
+
+		if s.Cardinality() != n {
+			t.Fatalf("Version %d: cardinality %d != %d", v, s.Cardinality(), n)
+		}
+	}
+
+	bm.Prune(3)
+	if v := bm.Versions(); len(v) != 3 || v[0] != 8 || bm.At(7) != nil {
+		t.Fatalf("Versions after Prune(3) = %v", v)
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	bm := New()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// Every commit has all the even bits up to its size
+				s := bm.Latest()
+				e := s.Bitmap()
+				for i := int64(0); i < s.Size(); i += 2 {
+					if !e.Get(i) || !s.Get(i) {
+						t.Errorf("Version %d should have bit %d set", s.Version(), i)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for i := int64(0); i < 20000; i += 2 {
+		bm.Set(i)
+		if i%1000 == 0 {
+			bm.Commit()
+		}
+	}
+
+	close(done)
+	wg.Wait()
+}
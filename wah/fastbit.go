@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package wah
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"io"
+	"math/bits"
+)
+
+// FastBit writes its bitmaps, ibis::bitvector, as the stream of their 32-bit words, followed by the bits of
+// the last group that's not complete yet, if there are any, and their number, in the byte order of the
+// machine, little endian for all the ones it runs on:
+//
+//	words | active word (unless nbits is 0) | nbits
+//
+// The fill words are the ones of this package, but the literal words hold the first bit of their group in
+// their most significant bit, bit 30, where this package holds it in bit 0. The active word holds its nbits
+// bits the same way, the first one in bit nbits-1.
+
+var _ bitmap.Serializable = (*Wah)(nil)
+var _ io.WriterTo = (*Wah)(nil)
+var _ io.ReaderFrom = (*Wah)(nil)
+
+// Words returns the words of the bitmap as FastBit writes them, ending with the active word and nbits
+func (this *Wah) Words() []uint32 {
+	c := this
+
+	// FastBit encodes the last group as soon as it's complete
+	nbits := this.sizeInBits - this.groups*groupInBits
+	if nbits == groupInBits {
+		c = this.Clone().(*Wah)
+		c.addGroup(c.active)
+		nbits = 0
+	}
+
+	ans := make([]uint32, 0, len(c.words)+2)
+	for _, w := range c.words {
+		if w&fillFlag == 0 {
+			w = reverseGroup(w)
+		}
+		ans = append(ans, w)
+	}
+
+	if nbits > 0 {
+		ans = append(ans, reverseGroup(c.active)>>uint32(groupInBits-nbits))
+	}
+
+	return append(ans, uint32(nbits))
+}
+
+// FromWords returns the bitmap of words written by FastBit, or by Words. The literal words that could be
+// fills, and the adjacent fills of the same value, which FastBit may write, are merged.
+func FromWords(words []uint32) (*Wah, error) {
+	if len(words) == 0 {
+		return nil, errors.New("wah/FromWords: no words")
+	}
+
+	nbits, words := words[len(words)-1], words[:len(words)-1]
+	if nbits >= uint32(groupInBits) {
+		return nil, fmt.Errorf("wah/FromWords: invalid number of bits %d in the active word", nbits)
+	}
+
+	active := uint32(0)
+	if nbits > 0 {
+		if len(words) == 0 {
+			return nil, errors.New("wah/FromWords: no active word")
+		}
+
+		active, words = words[len(words)-1], words[:len(words)-1]
+		if active>>nbits != 0 {
+			return nil, fmt.Errorf("wah/FromWords: active word %#x has more than %d bits", active, nbits)
+		}
+	}
+
+	ans := New().(*Wah)
+	for _, w := range words {
+		if w&fillFlag == 0 {
+			ans.addGroup(reverseGroup(w))
+		} else {
+			ans.addFill(w&fillBit != 0, int64(w&(fillBit-1)))
+		}
+	}
+
+	switch {
+	case nbits > 0:
+		ans.active = reverseGroup(active << (uint32(groupInBits) - nbits))
+		ans.sizeInBits = ans.groups*groupInBits + int64(nbits)
+	case ans.groups > 0:
+		// This package keeps the last group in the active word, even when it's complete
+		ans.active = ans.popGroup()
+		ans.sizeInBits = (ans.groups + 1) * groupInBits
+	}
+
+	return ans, nil
+}
+
+// MarshalBinary encodes the bitmap as FastBit writes it, little endian
+func (this *Wah) MarshalBinary() ([]byte, error) {
+	words := this.Words()
+
+	b := make([]byte, 4*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+
+	return b, nil
+}
+
+// UnmarshalBinary decodes a bitmap written by FastBit, or by MarshalBinary, and replaces the content of the
+// bitmap
+func (this *Wah) UnmarshalBinary(b []byte) error {
+	if len(b)%4 != 0 {
+		return fmt.Errorf("wah/UnmarshalBinary: %d bytes is not a number of words", len(b))
+	}
+
+	words := make([]uint32, len(b)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+
+	w, err := FromWords(words)
+	if err != nil {
+		return err
+	}
+
+	this.Swap(w)
+
+	return nil
+}
+
+// WriteTo writes the bitmap to w, encoded like MarshalBinary, and returns the number of bytes written
+func (this *Wah) WriteTo(w io.Writer) (int64, error) {
+	b, _ := this.MarshalBinary()
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadFrom replaces the content of the bitmap with a bitmap read from r, encoded like MarshalBinary, and
+// returns the number of bytes read. Since the number of words only comes at the end, it reads r until EOF,
+// like FastBit reads the file of a bitmap.
+func (this *Wah) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(b)), err
+	}
+
+	return int64(len(b)), this.UnmarshalBinary(b)
+}
+
+//
+// Not-exported functions
+//
+
+// reverseGroup reverses the order of the 31 bits of a literal word, between the order of FastBit and the
+// one of this package
+func reverseGroup(w uint32) uint32 {
+	return bits.Reverse32(w) >> 1
+}
+
+// popGroup removes the last group encoded in the words, and returns it
+func (this *Wah) popGroup() uint32 {
+	l := len(this.words) - 1
+	w := this.words[l]
+	this.groups--
+
+	if w&fillFlag == 0 {
+		this.words = this.words[:l]
+		return w
+	}
+
+	if w&(fillBit-1) == 1 {
+		this.words = this.words[:l]
+	} else {
+		this.words[l]--
+	}
+
+	if w&fillBit != 0 {
+		return literalMask
+	}
+
+	return 0
+}
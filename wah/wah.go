@@ -0,0 +1,453 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+// Package wah implements the Word-Aligned Hybrid (WAH) bitmap compression, as used by FastBit.
+//
+// The bitmap is cut in groups of 31 bits, and each group is encoded in a 32-bit word. A literal word
+// has its most significant bit set to 0 and holds the 31 bits of the group as is. A fill word has its
+// most significant bit set to 1, the next bit is the value of the fill, and the remaining 30 bits are
+// the number of consecutive groups that are all 0's or all 1's.
+//
+// Words, FromWords, MarshalBinary and UnmarshalBinary convert the bitmaps to and from the words of FastBit,
+// which hold the bits of their literal words in the reverse order.
+//
+// Reference: K. Wu, E. Otoo, A. Shoshani. Optimizing bitmap indices with efficient compression.
+// ACM Transactions on Database Systems, 31(1):1-38, 2006.
+package wah
+
+import (
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"math/bits"
+)
+
+const (
+	// groupInBits is the number of bits of the bitmap encoded in each word
+	groupInBits int64 = 31
+
+	// defaultBufferSize is a constant default memory allocation when the object is constructed
+	defaultBufferSize int = 4
+
+	fillFlag      uint32 = 1 << 31
+	fillBit       uint32 = 1 << 30
+	literalMask   uint32 = fillFlag - 1
+	MaxFillLength int64  = int64(fillBit - 1)
+)
+
+type Wah struct {
+	// words holds the encoded groups, except for the active one
+	words []uint32
+
+	// groups is the number of groups encoded in words
+	groups int64
+
+	// active is the last group of the bitmap, the one bits are being set in. It's only encoded when we
+	// move past it.
+	active uint32
+
+	// sizeInBits is the number of total bits in the bitmap
+	sizeInBits int64
+
+	// getWord and getGroup are the index of the last word checked by Get, and the first group it encodes.
+	// For sequential checks, we can start from there instead of from the beginning.
+	getWord  int
+	getGroup int64
+}
+
+var _ bitmap.Bitmap = (*Wah)(nil)
+
+func init() {
+	bitmap.Register("wah", New)
+}
+
+func New() bitmap.Bitmap {
+	wah := new(Wah)
+
+	wah.Reset()
+
+	return wah
+}
+
+// Set sets the bit at position i to true (1). The bits must be set in ascending order. For example, set(15)
+// then set(7) will fail.
+func (this *Wah) Set(i int64) bitmap.Bitmap {
+	if i < 0 || i < this.sizeInBits {
+		return nil
+	}
+
+	// If the bit is past the active group, then encode the active group, and pad with a fill of 0's
+	// until we reach the group of the bit.
+	if g := i / groupInBits; g > this.groups && this.sizeInBits > 0 {
+		this.addGroup(this.active)
+		this.addFill(false, g-this.groups)
+		this.active = 0
+	} else if this.sizeInBits == 0 {
+		this.addFill(false, g)
+	}
+
+	this.active |= 1 << uint32(i%groupInBits)
+	this.sizeInBits = i + 1
+
+	return this
+}
+
+func (this *Wah) Get(i int64) bool {
+	if i < 0 || i >= this.sizeInBits {
+		return false
+	}
+
+	g := i / groupInBits
+	if g >= this.groups {
+		return this.active&(1<<uint32(i%groupInBits)) != 0
+	}
+
+	if g < this.getGroup {
+		this.getWord, this.getGroup = 0, 0
+	}
+
+	for ; this.getWord < len(this.words); this.getWord++ {
+		w := this.words[this.getWord]
+		if w&fillFlag == 0 {
+			if this.getGroup == g {
+				return w&(1<<uint32(i%groupInBits)) != 0
+			}
+			this.getGroup++
+			continue
+		}
+
+		n := int64(w & (fillBit - 1))
+		if g < this.getGroup+n {
+			return w&fillBit != 0
+		}
+		this.getGroup += n
+	}
+
+	return false
+}
+
+// Size returns the size in bits of the *uncompressed* bitmap represented by this compressed bitmap.
+func (this *Wah) Size() int64 {
+	return this.sizeInBits
+}
+
+// SizeInWords returns the number of 32-bit words used to represent the bitmap, including the active one.
+func (this *Wah) SizeInWords() int64 {
+	return int64(len(this.words)) + 1
+}
+
+func (this *Wah) Reset() {
+	if this.words == nil {
+		this.words = make([]uint32, 0, defaultBufferSize)
+	} else {
+		this.words = this.words[:0]
+	}
+
+	this.groups = 0
+	this.active = 0
+	this.sizeInBits = 0
+	this.getWord, this.getGroup = 0, 0
+}
+
+func (this *Wah) Swap(other *Wah) bitmap.Bitmap {
+	this.words, other.words = other.words, this.words
+	this.groups, other.groups = other.groups, this.groups
+	this.active, other.active = other.active, this.active
+	this.sizeInBits, other.sizeInBits = other.sizeInBits, this.sizeInBits
+	this.getWord, this.getGroup = 0, 0
+	other.getWord, other.getGroup = 0, 0
+
+	return this
+}
+
+func (this *Wah) Clone() bitmap.Bitmap {
+	c := &Wah{
+		words:      make([]uint32, len(this.words)),
+		groups:     this.groups,
+		active:     this.active,
+		sizeInBits: this.sizeInBits,
+	}
+	copy(c.words, this.words)
+
+	return c
+}
+
+func (this *Wah) Copy(other bitmap.Bitmap) bitmap.Bitmap {
+	o, ok := other.(*Wah)
+	if !ok {
+		return nil
+	}
+
+	this.words = make([]uint32, len(o.words))
+	copy(this.words, o.words)
+	this.groups = o.groups
+	this.active = o.active
+	this.sizeInBits = o.sizeInBits
+	this.getWord, this.getGroup = 0, 0
+
+	return this
+}
+
+// Equal returns true if both bitmaps have the same size and the same bits set. Since the encoding
+// never produces literal words that could be fills, nor adjacent fills that could be merged, equal
+// bitmaps have the same words.
+func (this *Wah) Equal(other bitmap.Bitmap) bool {
+	o, ok := other.(*Wah)
+	if !ok || o == nil {
+		return false
+	}
+
+	if this.sizeInBits != o.sizeInBits || this.active != o.active || len(this.words) != len(o.words) {
+		return false
+	}
+
+	for i, v := range this.words {
+		if o.words[i] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (this *Wah) Cardinality() int64 {
+	n := int64(bits.OnesCount32(this.active))
+
+	for _, w := range this.words {
+		if w&fillFlag == 0 {
+			n += int64(bits.OnesCount32(w))
+		} else if w&fillBit != 0 {
+			n += int64(w&(fillBit-1)) * groupInBits
+		}
+	}
+
+	return n
+}
+
+func (this *Wah) And(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y uint32) uint32 { return x & y })
+}
+
+func (this *Wah) Or(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y uint32) uint32 { return x | y })
+}
+
+func (this *Wah) AndNot(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y uint32) uint32 { return x &^ y })
+}
+
+func (this *Wah) Xor(a ...bitmap.Bitmap) bitmap.Bitmap {
+	return this.fold(a, func(x, y uint32) uint32 { return x ^ y })
+}
+
+// Not negates all the bits of the bitmap, up to Size(), in place.
+func (this *Wah) Not() bitmap.Bitmap {
+	for i, w := range this.words {
+		if w&fillFlag == 0 {
+			this.words[i] = ^w & literalMask
+		} else {
+			this.words[i] = w ^ fillBit
+		}
+	}
+
+	if this.sizeInBits > 0 {
+		lastBits := this.sizeInBits - this.groups*groupInBits
+		this.active = ^this.active & (literalMask >> uint32(groupInBits-lastBits))
+	}
+
+	return this
+}
+
+func (this *Wah) PrintStats(details bool) {
+	fmt.Printf("sizeInWords = %d, sizeInBits = %d, cardinality = %d\n", this.SizeInWords(), this.Size(), this.Cardinality())
+
+	if details {
+		for i, w := range this.words {
+			fmt.Printf("%4d: %032b\n", i, w)
+		}
+		fmt.Printf("   *: %032b\n", this.active)
+	}
+}
+
+//
+// Not-exported functions
+//
+
+// addGroup encodes a group of 31 bits at the end of the bitmap
+func (this *Wah) addGroup(v uint32) {
+	switch v {
+	case 0:
+		this.addFill(false, 1)
+	case literalMask:
+		this.addFill(true, 1)
+	default:
+		this.words = append(this.words, v)
+		this.groups++
+	}
+}
+
+// addFill encodes n groups of all 0's or all 1's at the end of the bitmap, extending the last fill word
+// if it has the same value.
+func (this *Wah) addFill(v bool, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	this.groups += n
+
+	f := fillFlag
+	if v {
+		f |= fillBit
+	}
+
+	if l := len(this.words) - 1; l >= 0 && this.words[l]&(fillFlag|fillBit) == f {
+		count := int64(this.words[l] & (fillBit - 1))
+		add := n
+		if count+add > MaxFillLength {
+			add = MaxFillLength - count
+		}
+
+		this.words[l] += uint32(add)
+		n -= add
+	}
+
+	for n > 0 {
+		add := n
+		if add > MaxFillLength {
+			add = MaxFillLength
+		}
+
+		this.words = append(this.words, f|uint32(add))
+		n -= add
+	}
+}
+
+// fold applies the group operation f to this bitmap and each of the bitmaps in a, from left to right.
+// The result is as large as the largest of the operands, and the missing groups of the smaller operands
+// are treated as 0's.
+func (this *Wah) fold(a []bitmap.Bitmap, f func(x, y uint32) uint32) bitmap.Bitmap {
+	ans := this.Clone().(*Wah)
+
+	for _, v := range a {
+		b, ok := v.(*Wah)
+		if !ok {
+			return nil
+		}
+
+		ans = ans.combine(b, f)
+	}
+
+	return ans
+}
+
+// combine walks both bitmaps group by group, a whole fill at a time when possible, and encodes the result
+// of f into a new bitmap.
+func (this *Wah) combine(other *Wah, f func(x, y uint32) uint32) *Wah {
+	ans := New().(*Wah)
+
+	ans.sizeInBits = this.sizeInBits
+	if other.sizeInBits > ans.sizeInBits {
+		ans.sizeInBits = other.sizeInBits
+	}
+
+	if ans.sizeInBits == 0 {
+		return ans
+	}
+
+	// The last group goes into the active word and isn't encoded
+	total := (ans.sizeInBits+groupInBits-1)/groupInBits - 1
+
+	r1, r2 := newReader(this), newReader(other)
+	for ans.groups < total {
+		max := total - ans.groups
+		v1, n1 := r1.peek(max)
+		v2, n2 := r2.peek(max)
+
+		n := n1
+		if n2 < n {
+			n = n2
+		}
+
+		v := f(v1, v2) & literalMask
+		if n > 1 {
+			// Both are fills, so the result is a fill too
+			ans.addFill(v != 0, n)
+		} else {
+			ans.addGroup(v)
+		}
+
+		r1.skip(n)
+		r2.skip(n)
+	}
+
+	v1, _ := r1.peek(1)
+	v2, _ := r2.peek(1)
+	ans.active = f(v1, v2) & literalMask
+
+	return ans
+}
+
+// reader walks the groups of a bitmap, one word at a time. Once all the groups have been read, it keeps
+// returning groups of 0's.
+type reader struct {
+	w *Wah
+
+	// i is the index of the current word
+	i int
+
+	// used is the number of groups already read from the current fill word
+	used int64
+}
+
+func newReader(w *Wah) *reader {
+	return &reader{w: w}
+}
+
+// peek returns the value of the current group, and the number of consecutive groups with that value,
+// which is only greater than 1 for fills, and never greater than max.
+func (this *reader) peek(max int64) (uint32, int64) {
+	if this.i > len(this.w.words) {
+		return 0, max
+	}
+
+	if this.i == len(this.w.words) {
+		return this.w.active, 1
+	}
+
+	w := this.w.words[this.i]
+	if w&fillFlag == 0 {
+		return w, 1
+	}
+
+	n := int64(w&(fillBit-1)) - this.used
+	if n > max {
+		n = max
+	}
+
+	if w&fillBit != 0 {
+		return literalMask, n
+	}
+
+	return 0, n
+}
+
+// skip moves forward by n groups. n must not be greater than the count returned by peek.
+func (this *reader) skip(n int64) {
+	if this.i >= len(this.w.words) {
+		this.i++
+		return
+	}
+
+	w := this.w.words[this.i]
+	if w&fillFlag != 0 {
+		this.used += n
+		if this.used < int64(w&(fillBit-1)) {
+			return
+		}
+	}
+
+	this.i++
+	this.used = 0
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2013 Zhen, LLC. http://zhen.io. All rights reserved.
+ * Use of this source code is governed by the Apache 2.0 license.
+ *
+ */
+
+package wah
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/reducedb/bitmap"
+	"github.com/reducedb/bitmap/bitmaptest"
+	"github.com/reducedb/bitmap/bitset"
+	"math/rand"
+	"testing"
+)
+
+const (
+	c1 uint32 = 0xcc9e2d51
+
+	count int = 10000
+)
+
+func TestSet(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	bm := New().(*Wah)
+	nums := make([]int64, count)
+
+	bit := int64(0)
+	for i := 0; i < count; i++ {
+		bit += int64(rand.Intn(10000) + 1)
+		nums[i] = bit
+
+		if !bm.Set(bit).Get(bit) {
+			t.Fatalf("Problem setting bm[%d] with number %d\n", i, bit)
+		}
+	}
+
+	if bm.Set(nums[0]) != nil {
+		t.Fatalf("Setting bit %d out of order should fail", nums[0])
+	}
+
+	if bm.Cardinality() != int64(count) {
+		t.Fatalf("Cardinality %d != %d", bm.Cardinality(), count)
+	}
+
+	for i := 1; i < count; i++ {
+		if !bm.Get(nums[i]) || bm.Get(nums[i]-1) != (nums[i]-1 == nums[i-1]) {
+			t.Fatalf("Problem getting bm[%d] with number %d\n", i, nums[i])
+		}
+	}
+}
+
+func TestLongFills(t *testing.T) {
+	bm := New().(*Wah)
+
+	// Long enough to need more than one fill word
+	bit := 3 * MaxFillLength * groupInBits
+	if !bm.Set(1).Set(bit).Get(bit) {
+		t.Fatalf("Problem setting bit %d", bit)
+	}
+
+	if bm.Cardinality() != 2 || bm.Get(bit-1) || !bm.Get(1) {
+		t.Fatalf("Problem with long fills, cardinality = %d", bm.Cardinality())
+	}
+
+	n := bm.Clone().Not()
+	if n.Cardinality() != bit-1 || n.Get(1) || !n.Get(bit-1) {
+		t.Fatalf("Problem with Not on long fills, cardinality = %d", n.Cardinality())
+	}
+
+	if c := n.Or(bm).Cardinality(); c != bit+1 {
+		t.Fatalf("Problem with Or on long fills, cardinality = %d", c)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	bm, _ := crossCheckBitmaps(10)
+
+	c := New().(*Wah)
+	if c.Copy(bm) == nil || !c.Equal(bm) || !bm.Clone().Equal(bm) {
+		t.Fatal("Copy and Clone should be equal to the original")
+	}
+
+	if c.Set(c.Size() + 1); c.Equal(bm) {
+		t.Fatal("Changing a copy should not change the original")
+	}
+}
+
+func TestFastBit(t *testing.T) {
+	// Bits 0 and 30 in a literal, 2 groups of 0's, 1 group of 1's, then bits 124 and 126 in the active word
+	words := []uint32{0x40000001, 0x80000002, 0xc0000001, 0x5, 0x3}
+	want := []int64{0, 30}
+	for i := int64(93); i < 124; i++ {
+		want = append(want, i)
+	}
+	want = append(want, 124, 126)
+
+	w, err := FromWords(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Size() != 127 || w.Cardinality() != int64(len(want)) {
+		t.Fatalf("FromWords: size %d, cardinality %d", w.Size(), w.Cardinality())
+	}
+	for _, i := range want {
+		if !w.Get(i) {
+			t.Fatalf("FromWords: bit %d is not set", i)
+		}
+	}
+	if got := w.Words(); fmt.Sprint(got) != fmt.Sprint(words) {
+		t.Fatalf("Words: %x, should be %x", got, words)
+	}
+
+	// FastBit may write literal words that are fills, and fills that could be merged
+	if d, err := FromWords([]uint32{0x40000001, 0x80000001, 0, 0x7fffffff, 0x5, 0x3}); err != nil || !d.Equal(w) {
+		t.Fatalf("FromWords of uncompressed words: %v", err)
+	}
+
+	// Sizes that are a multiple of 31 have no active word
+	full := New().(*Wah)
+	full.Set(61)
+	if got := full.Words(); fmt.Sprint(got) != "[2147483649 1 0]" {
+		t.Fatalf("Words of 62 bits: %v", got)
+	}
+
+	for _, gap := range []int{1, 10, 31, 1000} {
+		w, _ := crossCheckBitmaps(gap)
+
+		b, err := w.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := New().(*Wah)
+		if err := d.UnmarshalBinary(b); err != nil || !d.Equal(w) {
+			t.Fatalf("UnmarshalBinary: %v", err)
+		}
+
+		var buf bytes.Buffer
+		w.WriteTo(&buf)
+		if _, err := d.ReadFrom(&buf); err != nil || !d.Equal(w) {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+	}
+
+	for _, words := range [][]uint32{nil, {31}, {3}, {0x8, 0x3}} {
+		if _, err := FromWords(words); err == nil {
+			t.Errorf("FromWords(%x) should fail", words)
+		}
+	}
+	if err := New().(*Wah).UnmarshalBinary([]byte{1, 2}); err == nil {
+		t.Errorf("UnmarshalBinary of a partial word should fail")
+	}
+}
+
+func TestCrossCheckBitset(t *testing.T) {
+	rand.Seed(int64(c1))
+
+	gaps := []int{1, 2, 10, 100, 1000}
+	bitmaptest.CrossCheck(t, 100, func() (bitmap.Bitmap, *bitset.Bitset) {
+		return crossCheckBitmaps(gaps[rand.Intn(len(gaps))])
+	})
+}
+
+// crossCheckBitmaps returns the same random bitmap as a Wah and as a Bitset, see bitmaptest.Bits
+func crossCheckBitmaps(gap int) (*Wah, *bitset.Bitset) {
+	w, b := bitmaptest.Bits(New, 500, gap, gap*100)
+	return w.(*Wah), b
+}
+
+func BenchmarkOr(b *testing.B) {
+	rand.Seed(int64(c1))
+	w1, _ := crossCheckBitmaps(100)
+	w2, _ := crossCheckBitmaps(100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w1.Or(w2)
+	}
+}